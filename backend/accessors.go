@@ -0,0 +1,213 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The keyAccessor type maps the opaque accessor returned alongside an issued key to the identifier of the key.
+	keyAccessor struct {
+		KeyID string `json:"key_id"`
+	}
+)
+
+const (
+	keyAccessorPrefix = "key-accessors/"
+
+	revokedReasonAccessor = "accessor-revoked"
+
+	keyAccessorDescription    = "The accessor returned alongside the issued key"
+	lookupAccessorDescription = "Read the record of an issued key using its accessor"
+	revokeAccessorDescription = "Delete an issued key from the tailnet using its accessor"
+
+	lookupAccessorHelpSynopsis    = "Read the record of an issued key using its accessor."
+	lookupAccessorHelpDescription = `
+Returns the record of an issued key, such as its role, tags, requester and status, using
+the accessor returned alongside the key. The key itself is never returned.
+`
+	revokeAccessorHelpSynopsis    = "Delete an issued key from the tailnet using its accessor."
+	revokeAccessorHelpDescription = `
+Deletes an issued key from the tailnet using the accessor returned alongside it, so that
+keys can be revoked without knowing their identifier. If the deletion fails, it is
+queued and retried.
+`
+)
+
+func (b *Backend) accessorPaths() []*framework.Path {
+	fields := map[string]*framework.FieldSchema{
+		"accessor": {
+			Type:        framework.TypeString,
+			Description: keyAccessorDescription,
+			Required:    true,
+		},
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: "keys/lookup-accessor$",
+			Fields:  fields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.LookupKeyAccessor,
+					Responses: okResponse(lookupAccessorDescription, accessorResponseFields()),
+					Summary:   lookupAccessorDescription,
+				},
+			},
+			HelpSynopsis:    lookupAccessorHelpSynopsis,
+			HelpDescription: lookupAccessorHelpDescription,
+		},
+		{
+			Pattern: "keys/revoke-accessor$",
+			Fields:  fields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.RevokeKeyAccessor,
+					Responses: noContentResponse(),
+					Summary:   revokeAccessorDescription,
+				},
+			},
+			HelpSynopsis:    revokeAccessorHelpSynopsis,
+			HelpDescription: revokeAccessorHelpDescription,
+		},
+	}
+}
+
+// LookupKeyAccessor returns the record of the issued key with the given accessor. Returns an error if no key has the
+// accessor.
+func (b *Backend) LookupKeyAccessor(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issued, err := b.accessorKey(ctx, request.Storage, data.Get("accessor").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":             issued.ID,
+			"key_accessor":   issued.KeyAccessor,
+			"role":           issued.Role,
+			"tags":           issued.Tags,
+			"entity_id":      issued.EntityID,
+			"entity_name":    issued.EntityName,
+			"display_name":   issued.DisplayName,
+			"created":        issued.Created,
+			"expires":        issued.Expires,
+			"used":           issued.Used,
+			"revoked":        issued.Revoked,
+			"revoked_reason": issued.RevokedReason,
+		},
+	}, nil
+}
+
+// RevokeKeyAccessor deletes the issued key with the given accessor from the tailnet it was generated in. If the
+// deletion fails, it is retried by the periodic function. Returns an error if no key has the accessor.
+func (b *Backend) RevokeKeyAccessor(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issued, err := b.accessorKey(ctx, request.Storage, data.Get("accessor").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.revokeKey(ctx, request.Storage, issued.ID); err != nil {
+		return nil, err
+	}
+
+	b.markRevoked(ctx, request.Storage, issued.ID, revokedReasonAccessor)
+	return nil, nil
+}
+
+// accessorKey returns the record of the issued key with the given accessor. Returns an error if no key has the
+// accessor.
+func (b *Backend) accessorKey(ctx context.Context, storage logical.Storage, accessor string) (*IssuedKey, error) {
+	if accessor == "" {
+		return nil, errors.New("provided accessor cannot be empty")
+	}
+
+	entry, err := storage.Get(ctx, keyAccessorPrefix+accessor)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, errors.New("no key exists with the provided accessor")
+	}
+
+	var index keyAccessor
+	if err = entry.DecodeJSON(&index); err != nil {
+		return nil, err
+	}
+
+	issued, err := b.issuedKey(ctx, storage, index.KeyID)
+	switch {
+	case err != nil:
+		return nil, err
+	case issued == nil:
+		return nil, fmt.Errorf("no record of key %q exists", index.KeyID)
+	}
+
+	return issued, nil
+}
+
+func (b *Backend) saveKeyAccessor(ctx context.Context, storage logical.Storage, accessor, id string) error {
+	entry, err := logical.StorageEntryJSON(keyAccessorPrefix+accessor, keyAccessor{KeyID: id})
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func accessorResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: keyIDDescription,
+		},
+		"key_accessor": {
+			Type:        framework.TypeString,
+			Description: keyAccessorDescription,
+		},
+		"role": {
+			Type:        framework.TypeString,
+			Description: "The role the key was generated using",
+		},
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: "The tags of the key",
+		},
+		"entity_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the entity the key was issued to",
+		},
+		"entity_name": {
+			Type:        framework.TypeString,
+			Description: "The name of the entity the key was issued to",
+		},
+		"display_name": {
+			Type:        framework.TypeString,
+			Description: "The display name of the token the key was issued to",
+		},
+		"created": {
+			Type:        framework.TypeTime,
+			Description: "When the key was created",
+		},
+		"expires": {
+			Type:        framework.TypeTime,
+			Description: "When the key expires",
+		},
+		"used": {
+			Type:        framework.TypeBool,
+			Description: "Whether the key is known to have been used to add a device to the tailnet",
+		},
+		"revoked": {
+			Type:        framework.TypeTime,
+			Description: "When the key was revoked, if it has been",
+		},
+		"revoked_reason": {
+			Type:        framework.TypeString,
+			Description: "Why the key was revoked, if it has been",
+		},
+	}
+}
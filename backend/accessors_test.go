@@ -0,0 +1,52 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_KeyAccessors(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "roles/ci", map[string]interface{}{"tags": "tag:ci"})
+	require.NoError(t, err)
+
+	key, err := request(logical.ReadOperation, "creds/ci", nil)
+	require.NoError(t, err)
+
+	accessor, ok := key.Data["key_accessor"].(string)
+	require.True(t, ok)
+	require.NotEmpty(t, accessor)
+
+	t.Run("It should look up a key using its accessor", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "keys/lookup-accessor", map[string]interface{}{"accessor": accessor})
+		require.NoError(t, err)
+		assert.EqualValues(t, key.Data["id"], response.Data["id"])
+		assert.EqualValues(t, "ci", response.Data["role"])
+		assert.NotContains(t, response.Data, "key")
+	})
+
+	t.Run("It should revoke a key using its accessor", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "keys/revoke-accessor", map[string]interface{}{"accessor": accessor})
+		require.NoError(t, err)
+		assert.Contains(t, api.Deleted(), key.Data["id"])
+
+		response, err := request(logical.UpdateOperation, "keys/lookup-accessor", map[string]interface{}{"accessor": accessor})
+		require.NoError(t, err)
+		assert.EqualValues(t, "accessor-revoked", response.Data["revoked_reason"])
+	})
+
+	t.Run("It should return an error for an unknown accessor", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "keys/revoke-accessor", map[string]interface{}{"accessor": "unknown"})
+		assert.Error(t, err)
+	})
+}
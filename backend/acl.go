@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The aclCache type holds the tag owners of the tailnet policy, used to validate requested tags without fetching
+	// the policy for every key.
+	aclCache struct {
+		credentials clientCredentials
+		tagOwners   map[string][]string
+		fetched     time.Time
+	}
+)
+
+const (
+	aclCacheTTL = time.Minute
+
+	flushACLDescription = "Discard the cached tailnet policy used to validate requested tags"
+
+	flushACLHelpSynopsis    = "Discard the cached tailnet policy."
+	flushACLHelpDescription = `
+The tailnet policy used to validate requested tags against its tagOwners is cached.
+Writing to this path discards the cached policy so that the next request fetches it
+again, for example after the policy has been changed.
+`
+)
+
+func (b *Backend) aclPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "acl/flush$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.FlushACL,
+					Responses: noContentResponse(),
+					Summary:   flushACLDescription,
+				},
+			},
+			HelpSynopsis:    flushACLHelpSynopsis,
+			HelpDescription: flushACLHelpDescription,
+		},
+	}
+}
+
+// FlushACL discards the cached tailnet policy, so that the next validation of requested tags reflects any recent
+// changes to the tagOwners of the tailnet.
+func (b *Backend) FlushACL(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.flushACL()
+	return &logical.Response{}, nil
+}
+
+// validateTags returns an error if tag validation is enabled and any of the tags are not defined in the tagOwners of
+// the tailnet policy. The policy is cached for a minute.
+func (b *Backend) validateTags(ctx context.Context, config Config, tags []string) error {
+	if !config.ValidateTags || len(tags) == 0 {
+		return nil
+	}
+
+	owners, err := b.tagOwners(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, ok := owners[tag]; !ok {
+			return fmt.Errorf("tag %q is not defined in the tagOwners of the tailnet policy", tag)
+		}
+	}
+
+	return nil
+}
+
+// tagOwners returns the tagOwners of the tailnet policy, fetching the policy if it is not cached, the cached copy is
+// older than a minute or was fetched using different credentials.
+func (b *Backend) tagOwners(ctx context.Context, config Config) (map[string][]string, error) {
+	b.aclMu.Lock()
+	defer b.aclMu.Unlock()
+
+	if b.acl != nil && b.acl.credentials == config.credentials() && time.Since(b.acl.fetched) < aclCacheTTL {
+		return b.acl.tagOwners, nil
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := client.ACL(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tailnet policy: %w", err)
+	}
+
+	b.acl = &aclCache{
+		credentials: config.credentials(),
+		tagOwners:   acl.TagOwners,
+		fetched:     time.Now(),
+	}
+
+	return b.acl.tagOwners, nil
+}
+
+func (b *Backend) flushACL() {
+	b.aclMu.Lock()
+	defer b.aclMu.Unlock()
+
+	b.acl = nil
+}
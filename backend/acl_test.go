@@ -0,0 +1,58 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_ValidateTags(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"tailnet":       "example",
+		"api_key":       "example",
+		"api_url":       "http://localhost:1337",
+		"validate_tags": true,
+	})
+	require.NoError(t, err)
+
+	api.SetTagOwners(map[string][]string{
+		"tag:vault": {"autogroup:admin"},
+		"tag:web":   {"autogroup:admin"},
+	})
+
+	t.Run("It should generate keys with tags defined in the policy", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{"tags": "tag:web"})
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, api.ACLFetches())
+	})
+
+	t.Run("It should return an error for tags not defined in the policy", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{"tags": "tag:db"})
+		assert.Error(t, err)
+		assert.EqualValues(t, 1, api.ACLFetches())
+		assert.Len(t, api.Requests(), 1)
+	})
+
+	t.Run("It should fetch the policy again once flushed", func(t *testing.T) {
+		api.SetTagOwners(map[string][]string{
+			"tag:vault": {"autogroup:admin"},
+			"tag:db":    {"autogroup:admin"},
+		})
+
+		_, err := request(logical.UpdateOperation, "acl/flush", nil)
+		require.NoError(t, err)
+
+		_, err = request(logical.ReadOperation, "key", map[string]interface{}{"tags": "tag:db"})
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, api.ACLFetches())
+	})
+}
@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The Activity type describes a single key issuance or revocation attempt and its outcome.
+	Activity struct {
+		Type        string    `json:"type"`
+		Timestamp   time.Time `json:"timestamp"`
+		EntityID    string    `json:"entity_id"`
+		DisplayName string    `json:"display_name"`
+		Role        string    `json:"role"`
+		Tags        []string  `json:"tags"`
+		KeyID       string    `json:"key_id"`
+		Outcome     string    `json:"outcome"`
+		Error       string    `json:"error"`
+	}
+)
+
+const (
+	activityPath         = "activity"
+	maxActivity          = 100
+	defaultActivityLimit = 20
+
+	activityIssuance   = "issuance"
+	activityRevocation = "revocation"
+
+	activityOutcomeSuccess = "success"
+	activityOutcomeFailure = "failure"
+
+	readActivityDescription  = "Read the most recent key issuance and revocation attempts"
+	activityLimitDescription = "The maximum number of attempts to return, up to 100"
+
+	activityHelpSynopsis    = "Read the most recent key issuance and revocation attempts."
+	activityHelpDescription = `
+Returns the most recent attempts to issue or revoke keys, newest first, including who
+made each attempt, the role and tags involved and whether it succeeded.
+`
+)
+
+func (b *Backend) activityPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "activity",
+			Fields: map[string]*framework.FieldSchema{
+				"limit": {
+					Type:        framework.TypeInt,
+					Description: activityLimitDescription,
+					Default:     defaultActivityLimit,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadActivity,
+					Responses: okResponse(readActivityDescription, activityResponseFields()),
+					Summary:   readActivityDescription,
+				},
+			},
+			HelpSynopsis:    activityHelpSynopsis,
+			HelpDescription: activityHelpDescription,
+		},
+	}
+}
+
+// ReadActivity returns the most recent key issuance and revocation attempts, newest first, including who made them
+// and whether they succeeded.
+func (b *Backend) ReadActivity(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	limit := data.Get("limit").(int)
+	if limit <= 0 || limit > maxActivity {
+		return nil, errors.New("provided limit must be between 1 and 100")
+	}
+
+	activities, err := b.loadActivity(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]map[string]interface{}, 0, limit)
+	for i := len(activities) - 1; i >= 0 && len(events) < limit; i-- {
+		activity := activities[i]
+		events = append(events, map[string]interface{}{
+			"type":         activity.Type,
+			"timestamp":    activity.Timestamp,
+			"entity_id":    activity.EntityID,
+			"display_name": activity.DisplayName,
+			"role":         activity.Role,
+			"tags":         activity.Tags,
+			"key_id":       activity.KeyID,
+			"outcome":      activity.Outcome,
+			"error":        activity.Error,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"events": events,
+		},
+	}, nil
+}
+
+// recordActivity appends an attempt to the recent activity, discarding the oldest attempts once more than 100 are
+// stored, and exports it to the sink if one is configured. Failures are logged rather than returned so that the
+// bookkeeping never causes an operation to fail.
+func (b *Backend) recordActivity(ctx context.Context, storage logical.Storage, activity Activity) {
+	activity.Timestamp = time.Now().UTC()
+
+	b.saveActivity(ctx, storage, activity)
+	b.exportActivity(ctx, storage, activity)
+}
+
+func (b *Backend) saveActivity(ctx context.Context, storage logical.Storage, activity Activity) {
+	b.activityMu.Lock()
+	defer b.activityMu.Unlock()
+
+	activities, err := b.loadActivity(ctx, storage)
+	if err != nil {
+		b.Logger().Warn("failed to load recent activity", "error", err)
+		return
+	}
+
+	activities = append(activities, activity)
+	if len(activities) > maxActivity {
+		activities = activities[len(activities)-maxActivity:]
+	}
+
+	entry, err := logical.StorageEntryJSON(activityPath, activities)
+	if err != nil {
+		b.Logger().Warn("failed to save recent activity", "error", err)
+		return
+	}
+
+	if err = storage.Put(ctx, entry); err != nil {
+		b.Logger().Warn("failed to save recent activity", "error", err)
+	}
+}
+
+func (b *Backend) loadActivity(ctx context.Context, storage logical.Storage) ([]Activity, error) {
+	entry, err := storage.Get(ctx, activityPath)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	var activities []Activity
+	if err = entry.DecodeJSON(&activities); err != nil {
+		return nil, err
+	}
+
+	return activities, nil
+}
+
+func activityResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"events": {
+			Type:        framework.TypeSlice,
+			Description: "The attempts, each with its type, timestamp, entity_id, display_name, role, tags, key_id, outcome and error",
+		},
+	}
+}
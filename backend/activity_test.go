@@ -0,0 +1,71 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_Activity(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation:   operation,
+			Path:        path,
+			Storage:     storage,
+			Data:        data,
+			EntityID:    "entity-1",
+			DisplayName: "token-alice",
+		})
+	}
+
+	_, err := request(logical.ReadOperation, "key", map[string]interface{}{
+		"tags": "tag:test",
+	})
+	require.NoError(t, err)
+
+	api.SetFailing(true)
+	_, err = request(logical.ReadOperation, "key", nil)
+	require.Error(t, err)
+
+	t.Run("It should return the most recent activity first", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "activity", nil)
+		require.NoError(t, err)
+
+		events := response.Data["events"].([]map[string]interface{})
+		require.Len(t, events, 2)
+
+		assert.EqualValues(t, "issuance", events[0]["type"])
+		assert.EqualValues(t, "failure", events[0]["outcome"])
+		assert.NotEmpty(t, events[0]["error"])
+
+		assert.EqualValues(t, "issuance", events[1]["type"])
+		assert.EqualValues(t, "success", events[1]["outcome"])
+		assert.EqualValues(t, "key-1", events[1]["key_id"])
+		assert.EqualValues(t, "entity-1", events[1]["entity_id"])
+		assert.EqualValues(t, "token-alice", events[1]["display_name"])
+		assert.EqualValues(t, []string{"tag:test"}, events[1]["tags"])
+	})
+
+	t.Run("It should limit the number of events returned", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "activity", map[string]interface{}{
+			"limit": 1,
+		})
+		require.NoError(t, err)
+		assert.Len(t, response.Data["events"], 1)
+	})
+
+	t.Run("It should return an error if the limit is too large", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "activity", map[string]interface{}{
+			"limit": 1000,
+		})
+		assert.Error(t, err)
+	})
+}
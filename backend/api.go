@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+type (
+	// The APIError type describes an error response from an endpoint of the Tailscale API called directly by the
+	// Backend.
+	APIError struct {
+		Status  int    `json:"-"`
+		Message string `json:"message"`
+	}
+)
+
+const apiTimeout = time.Minute
+
+// Error implements the error interface.
+func (err APIError) Error() string {
+	return fmt.Sprintf("%s (%d)", err.Message, err.Status)
+}
+
+// apiRequest calls an endpoint of the Tailscale API that is not supported by the client library. The uri is relative
+// to "/api/v2/", see Config.tailnetURI for endpoints scoped to the tailnet. The body, if any, is encoded as JSON and
+// the response is decoded into out, if provided. Requests are authenticated using the configured API key or OAuth
+// client.
+func (b *Backend) apiRequest(ctx context.Context, config Config, method, uri string, query url.Values, body, out interface{}) error {
+	base, err := url.Parse(config.APIUrl)
+	if err != nil {
+		return fmt.Errorf("configured api_url is invalid: %w", err)
+	}
+
+	u := base.JoinPath("api", "v2", uri)
+	u.RawQuery = query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(encoded)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if config.OAuthClientID == "" {
+		req.SetBasicAuth(config.APIKey, "")
+	}
+
+	client, err := b.httpClient(config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// Content that is not JSON, such as an error page from a proxy, is never included in the error.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := APIError{Status: resp.StatusCode}
+		if checkContentType(resp.Header) != nil || json.Unmarshal(content, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+
+		apiErr.Message = sanitize(apiErr.Message, maxAPIErrorLength)
+		return apiErr
+	}
+
+	if out == nil || len(content) == 0 {
+		return nil
+	}
+
+	if err = checkContentType(resp.Header); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, out)
+}
+
+// tailnetURI returns the uri of an endpoint scoped to the configured tailnet, for use with apiRequest.
+func (c Config) tailnetURI(elem ...string) string {
+	return path.Join(append([]string{"tailnet", url.PathEscape(c.Tailnet)}, elem...)...)
+}
+
+// isAPINotFound returns true if the error is an APIError describing a resource that does not exist.
+func isAPINotFound(err error) bool {
+	var apiErr APIError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
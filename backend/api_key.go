@@ -0,0 +1,221 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The APIKeyStatus type describes what is known about the expiry of the configured API key.
+	APIKeyStatus struct {
+		KeyID   string    `json:"key_id"`
+		Expires time.Time `json:"expires"`
+		Checked time.Time `json:"checked"`
+	}
+)
+
+const (
+	apiKeyStatusPath      = "api-key-status"
+	apiKeyCheckInterval   = 24 * time.Hour
+	apiKeyExpiryWarning   = 14 * 24 * time.Hour
+	readStatusDescription = "Read the status of the configured Tailscale API credentials"
+
+	statusHelpSynopsis    = "Read the status of the configured Tailscale API credentials."
+	statusHelpDescription = `
+Returns the tailnet and API URL in use along with the identifier of the configured API
+key. When the expiry of the API key is known, it is returned along with the number of
+days remaining until the key expires.
+`
+)
+
+func (b *Backend) statusPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "config/status",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadStatus,
+					Responses: okResponse(readStatusDescription, statusResponseFields()),
+					Summary:   readStatusDescription,
+				},
+			},
+			HelpSynopsis:    statusHelpSynopsis,
+			HelpDescription: statusHelpDescription,
+		},
+	}
+}
+
+// ReadStatus returns the status of the configured API key, including when it expires and how many days remain until
+// it does. The expiry is fetched from the Tailscale API if it is not yet known.
+func (b *Backend) ReadStatus(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := b.refreshAPIKeyStatus(ctx, request.Storage, config)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"tailnet":    config.Tailnet,
+			"api_url":    config.APIUrl,
+			"api_key_id": status.KeyID,
+		},
+	}
+
+	if !status.Expires.IsZero() {
+		response.Data["api_key_expires"] = status.Expires
+		response.Data["api_key_days_remaining"] = status.daysRemaining(time.Now())
+	}
+
+	return response, nil
+}
+
+// checkAPIKeyStatus fetches the expiry of the configured API key if it has not been checked recently and records how
+// many days remain until it expires as a metric. Failures to fetch the expiry are logged rather than returned.
+func (b *Backend) checkAPIKeyStatus(ctx context.Context, storage logical.Storage) error {
+	config, err := b.config(ctx, storage)
+	if err != nil {
+		// The mount has not been configured yet, so there is no API key to check.
+		return nil
+	}
+
+	status, err := b.refreshAPIKeyStatus(ctx, storage, config)
+	switch {
+	case err != nil:
+		b.Logger().Warn("failed to check api key expiry", "error", err)
+		return nil
+	case status.Expires.IsZero():
+		return nil
+	}
+
+	b.setGauge(ctx, storage, []string{"api_key", "days_remaining"}, float32(status.daysRemaining(time.Now())))
+	return nil
+}
+
+// warnAPIKeyExpiry adds a warning to the response if the configured API key expires soon.
+func (b *Backend) warnAPIKeyExpiry(ctx context.Context, storage logical.Storage, response *logical.Response) {
+	status, err := b.apiKeyStatus(ctx, storage)
+	if err != nil || status == nil || status.Expires.IsZero() {
+		return
+	}
+
+	now := time.Now()
+	if status.Expires.Sub(now) < apiKeyExpiryWarning {
+		response.AddWarning(fmt.Sprintf("the configured api_key expires in %d days, at %s", status.daysRemaining(now),
+			status.Expires.Format(time.RFC3339)))
+	}
+}
+
+// refreshAPIKeyStatus returns the stored status of the configured API key, fetching its expiry from the Tailscale API
+// if the key has changed or has not been checked within the last day.
+func (b *Backend) refreshAPIKeyStatus(ctx context.Context, storage logical.Storage, config Config) (*APIKeyStatus, error) {
+	id := apiKeyID(config.APIKey)
+
+	status, err := b.apiKeyStatus(ctx, storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case status != nil && status.KeyID == id && time.Since(status.Checked) < apiKeyCheckInterval:
+		return status, nil
+	case id == "":
+		return &APIKeyStatus{}, nil
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := client.GetKey(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api key: %w", err)
+	}
+
+	status = &APIKeyStatus{
+		KeyID:   id,
+		Expires: key.Expires.UTC(),
+		Checked: time.Now().UTC(),
+	}
+
+	entry, err := logical.StorageEntryJSON(apiKeyStatusPath, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+func (b *Backend) apiKeyStatus(ctx context.Context, storage logical.Storage) (*APIKeyStatus, error) {
+	entry, err := storage.Get(ctx, apiKeyStatusPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var status APIKeyStatus
+	if err = entry.DecodeJSON(&status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// daysRemaining returns the number of whole days until the API key expires.
+func (s *APIKeyStatus) daysRemaining(now time.Time) int {
+	return int(s.Expires.Sub(now).Hours() / 24)
+}
+
+// apiKeyID returns the identifier of an API key, which is the segment following its "tskey-" or "tskey-api-" prefix.
+// Returns an empty string if the key is not in a recognised format.
+func apiKeyID(apiKey string) string {
+	if !strings.HasPrefix(apiKey, "tskey-") {
+		return ""
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(apiKey, "tskey-"), "api-")
+	if i := strings.Index(id, "-"); i > 0 {
+		return id[:i]
+	}
+
+	return ""
+}
+
+func statusResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"tailnet": {
+			Type:        framework.TypeString,
+			Description: tailnetDescription,
+		},
+		"api_url": {
+			Type:        framework.TypeString,
+			Description: apiUrlDescription,
+		},
+		"api_key_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the configured API key",
+		},
+		"api_key_expires": {
+			Type:        framework.TypeTime,
+			Description: "When the configured API key expires",
+		},
+		"api_key_days_remaining": {
+			Type:        framework.TypeInt,
+			Description: "The number of days until the configured API key expires",
+		},
+	}
+}
@@ -0,0 +1,274 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The AppConnectorConfig type describes which devices are treated as app connectors and which of their
+	// advertised routes may be approved.
+	AppConnectorConfig struct {
+		Tags          []string `json:"tags"`
+		AllowedRoutes []string `json:"allowed_routes"`
+	}
+)
+
+const (
+	appConnectorConfigPath = "config/app-connectors"
+	defaultConnectorTag    = "tag:connector"
+
+	readAppConnectorConfigDescription   = "Read the app connector route approval configuration"
+	updateAppConnectorConfigDescription = "Update the app connector route approval configuration"
+	deleteAppConnectorConfigDescription = "Delete the app connector route approval configuration"
+	appConnectorTagsDescription         = "Devices with any of these tags are treated as app connectors"
+	appConnectorRoutesDescription       = "Routes in CIDR notation. Advertised routes that fall entirely inside any of them may be approved"
+	approveConnectorRoutesDescription   = "Enable the advertised routes of an app connector that are allowed by the configuration"
+	deviceIDDescription                 = "The identifier of the device"
+
+	appConnectorConfigHelpSynopsis    = "Configure which routes of app connectors may be approved."
+	appConnectorConfigHelpDescription = `
+Devices with any of the configured tags are treated as app connectors. Routes they
+advertise that fall entirely inside the allowed routes may be approved using the
+approve-routes path of the device.
+`
+	approveConnectorRoutesHelpSynopsis    = "Approve the advertised routes of an app connector."
+	approveConnectorRoutesHelpDescription = `
+Enables the routes advertised by the device that are allowed by the app connector
+configuration, returning the routes that are enabled along with those that were approved
+and rejected by this request. Returns an error if the device is not an app connector.
+`
+)
+
+func (b *Backend) appConnectorPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: appConnectorConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"tags": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: appConnectorTagsDescription,
+					Default:     []string{defaultConnectorTag},
+				},
+				"allowed_routes": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: appConnectorRoutesDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadAppConnectorConfiguration,
+					Responses: okResponse(readAppConnectorConfigDescription, appConnectorConfigResponseFields()),
+					Summary:   readAppConnectorConfigDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateAppConnectorConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateAppConnectorConfigDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteAppConnectorConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteAppConnectorConfigDescription,
+				},
+			},
+			HelpSynopsis:    appConnectorConfigHelpSynopsis,
+			HelpDescription: appConnectorConfigHelpDescription,
+		},
+		{
+			Pattern: "app-connectors/" + framework.GenericNameRegex("device_id") + "/approve-routes$",
+			Fields: map[string]*framework.FieldSchema{
+				"device_id": {
+					Type:        framework.TypeString,
+					Description: deviceIDDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.ApproveConnectorRoutes,
+					Responses: okResponse(approveConnectorRoutesDescription, routeApprovalResponseFields()),
+					Summary:   approveConnectorRoutesDescription,
+				},
+			},
+			HelpSynopsis:    approveConnectorRoutesHelpSynopsis,
+			HelpDescription: approveConnectorRoutesHelpDescription,
+		},
+	}
+}
+
+// ReadAppConnectorConfiguration returns the app connector route approval configuration.
+func (b *Backend) ReadAppConnectorConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.appConnectorConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"tags":           config.Tags,
+			"allowed_routes": config.AllowedRoutes,
+		},
+	}, nil
+}
+
+// UpdateAppConnectorConfiguration modifies the app connector route approval configuration. Returns an error if no
+// tags or routes are provided, or if any of the routes are invalid.
+func (b *Backend) UpdateAppConnectorConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := AppConnectorConfig{
+		Tags:          data.Get("tags").([]string),
+		AllowedRoutes: data.Get("allowed_routes").([]string),
+	}
+
+	switch {
+	case len(config.Tags) == 0:
+		return nil, errors.New("provided tags cannot be empty")
+	case len(config.AllowedRoutes) == 0:
+		return nil, errors.New("provided allowed_routes cannot be empty")
+	}
+
+	if _, err := parseRoutes(config.AllowedRoutes); err != nil {
+		return nil, fmt.Errorf("provided allowed_routes are invalid: %w", err)
+	}
+
+	entry, err := logical.StorageEntryJSON(appConnectorConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteAppConnectorConfiguration removes the app connector route approval configuration.
+func (b *Backend) DeleteAppConnectorConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, appConnectorConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// ApproveConnectorRoutes enables the routes advertised by an app connector that fall entirely inside the configured
+// allowed routes, returning the routes that were approved and rejected. Returns an error if the device is not tagged
+// as an app connector, the backend is in read-only mode or during a maintenance window.
+func (b *Backend) ApproveConnectorRoutes(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	connectors, err := b.appConnectorConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case connectors == nil:
+		return nil, errors.New("app connector route approval has not been configured")
+	}
+
+	allowed, err := parseRoutes(connectors.AllowedRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	id := data.Get("device_id").(string)
+	device, ok := findDevice(devices, id)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("device %q does not exist", id)
+	case !hasAnyTag(device.Tags, connectors.Tags):
+		return nil, fmt.Errorf("device %q is not tagged as an app connector", id)
+	}
+
+	enabled, approved, rejected, err := approveRoutes(ctx, client, id, allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"device_id": id,
+			"enabled":   enabled,
+			"approved":  approved,
+			"rejected":  rejected,
+		},
+	}, nil
+}
+
+func (b *Backend) appConnectorConfig(ctx context.Context, storage logical.Storage) (*AppConnectorConfig, error) {
+	entry, err := storage.Get(ctx, appConnectorConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config AppConnectorConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func appConnectorConfigResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: appConnectorTagsDescription,
+		},
+		"allowed_routes": {
+			Type:        framework.TypeStringSlice,
+			Description: appConnectorRoutesDescription,
+		},
+	}
+}
+
+func routeApprovalResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"device_id": {
+			Type:        framework.TypeString,
+			Description: deviceIDDescription,
+		},
+		"enabled": {
+			Type:        framework.TypeStringSlice,
+			Description: "The routes of the device that are enabled",
+		},
+		"approved": {
+			Type:        framework.TypeStringSlice,
+			Description: "The advertised routes that were approved",
+		},
+		"rejected": {
+			Type:        framework.TypeStringSlice,
+			Description: "The advertised routes that are not allowed by the configuration",
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestBackend_ApproveConnectorRoutes(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	api.SetDevices(
+		tailscale.Device{ID: "connector", Tags: []string{"tag:connector"}},
+		tailscale.Device{ID: "server", Tags: []string{"tag:server"}},
+	)
+	api.SetRoutes("connector", []string{"10.0.1.0/24", "10.1.0.0/16", "192.168.0.0/24"}, []string{"192.168.0.0/24"})
+
+	t.Run("It should return an error if route approval is not configured", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "app-connectors/connector/approve-routes", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should return an error if the allowed routes are invalid", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/app-connectors", map[string]interface{}{
+			"allowed_routes": "not-a-route",
+		})
+		assert.Error(t, err)
+	})
+
+	_, err := request(logical.UpdateOperation, "config/app-connectors", map[string]interface{}{
+		"allowed_routes": "10.0.0.0/16",
+	})
+	require.NoError(t, err)
+
+	t.Run("It should return an error if the device is not an app connector", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "app-connectors/server/approve-routes", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should enable the allowed routes of an app connector", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "app-connectors/connector/approve-routes", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"10.0.1.0/24"}, response.Data["approved"])
+		assert.EqualValues(t, []string{"10.1.0.0/16"}, response.Data["rejected"])
+		assert.EqualValues(t, []string{"192.168.0.0/24", "10.0.1.0/24"}, api.Routes("connector").Enabled)
+	})
+}
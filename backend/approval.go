@@ -0,0 +1,314 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// The ApprovalConfig type describes the webhook that is called to approve the generation of keys for roles that
+	// require approval.
+	ApprovalConfig struct {
+		URL     string        `json:"url"`
+		Secret  string        `json:"secret"`
+		CACert  string        `json:"ca_cert"`
+		Timeout time.Duration `json:"timeout"`
+	}
+
+	// The ApprovalRequest type is the payload sent to the approval webhook.
+	ApprovalRequest struct {
+		RequestID     string    `json:"request_id"`
+		Role          string    `json:"role"`
+		Tags          []string  `json:"tags"`
+		Ephemeral     bool      `json:"ephemeral"`
+		Preauthorized bool      `json:"preauthorized"`
+		EntityID      string    `json:"entity_id"`
+		DisplayName   string    `json:"display_name"`
+		Timestamp     time.Time `json:"timestamp"`
+	}
+
+	// The ApprovalResponse type is the payload expected from the approval webhook.
+	ApprovalResponse struct {
+		Approved bool   `json:"approved"`
+		Reason   string `json:"reason"`
+	}
+)
+
+const (
+	approvalConfigPath      = "config/approval"
+	approvalSignatureHeader = "X-Vault-Tailscale-Signature"
+	defaultApprovalTimeout  = 30 * time.Second
+	maxApprovalResponseSize = 1 << 20
+
+	readApprovalDescription    = "Read the approval webhook configuration"
+	updateApprovalDescription  = "Update the approval webhook configuration"
+	deleteApprovalDescription  = "Delete the approval webhook configuration"
+	approvalURLDescription     = "The HTTPS URL of the webhook that approves or denies key generation"
+	approvalSecretDescription  = "The secret used to sign webhook payloads using HMAC-SHA256"
+	approvalCACertDescription  = "A PEM encoded CA certificate used to verify the webhook's TLS certificate"
+	approvalTimeoutDescription = "How long to wait for the webhook to respond"
+
+	approvalHelpSynopsis    = "Configure the webhook that approves keys for roles requiring approval."
+	approvalHelpDescription = `
+Configures the HTTPS webhook called before a key is generated using a role with
+require_approval set. Each payload is signed using HMAC-SHA256 with the configured
+secret, and the signature is sent in the X-Vault-Tailscale-Signature header. The key is
+only generated if the webhook approves it. The secret is not returned when the
+configuration is read.
+`
+)
+
+func (b *Backend) approvalPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: approvalConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"url": {
+					Type:        framework.TypeString,
+					Description: approvalURLDescription,
+				},
+				"secret": {
+					Type:        framework.TypeString,
+					Description: approvalSecretDescription,
+				},
+				"ca_cert": {
+					Type:        framework.TypeString,
+					Description: approvalCACertDescription,
+				},
+				"timeout": {
+					Type:        framework.TypeDurationSecond,
+					Description: approvalTimeoutDescription,
+					Default:     int(defaultApprovalTimeout.Seconds()),
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadApprovalConfiguration,
+					Responses: okResponse(readApprovalDescription, approvalResponseFields()),
+					Summary:   readApprovalDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateApprovalConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateApprovalDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteApprovalConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteApprovalDescription,
+				},
+			},
+			HelpSynopsis:    approvalHelpSynopsis,
+			HelpDescription: approvalHelpDescription,
+		},
+	}
+}
+
+// ReadApprovalConfiguration returns the approval webhook configuration. The signing secret is not included in the
+// response.
+func (b *Backend) ReadApprovalConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.approvalConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url":     config.URL,
+			"ca_cert": config.CACert,
+			"timeout": int64(config.Timeout.Seconds()),
+		},
+	}, nil
+}
+
+// UpdateApprovalConfiguration modifies the approval webhook configuration. Returns an error if the URL does not use
+// HTTPS or the secret is missing.
+func (b *Backend) UpdateApprovalConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := ApprovalConfig{
+		URL:     data.Get("url").(string),
+		Secret:  data.Get("secret").(string),
+		CACert:  data.Get("ca_cert").(string),
+		Timeout: time.Duration(data.Get("timeout").(int)) * time.Second,
+	}
+
+	u, err := url.Parse(config.URL)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("provided url is invalid: %w", err)
+	case u.Scheme != "https":
+		return nil, errors.New("provided url must use https")
+	case config.Secret == "":
+		return nil, errors.New("provided secret cannot be empty")
+	case config.Timeout <= 0:
+		return nil, errors.New("provided timeout must be greater than zero")
+	}
+
+	if config.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(config.CACert)) {
+		return nil, errors.New("provided ca_cert does not contain a valid PEM encoded certificate")
+	}
+
+	entry, err := logical.StorageEntryJSON(approvalConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteApprovalConfiguration removes the approval webhook configuration.
+func (b *Backend) DeleteApprovalConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, approvalConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// requestApproval calls the approval webhook with the details of the key being requested, returning an error unless
+// the webhook approves it. The payload is signed using HMAC-SHA256 with the configured secret, the hex encoded
+// signature is sent in the X-Vault-Tailscale-Signature header.
+func (b *Backend) requestApproval(ctx context.Context, request *logical.Request, role *Role, capabilities tailscale.KeyCapabilities) error {
+	config, err := b.approvalConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return err
+	case config == nil:
+		return fmt.Errorf("role %q requires approval but no approval webhook is configured", role.Name)
+	}
+
+	body, err := json.Marshal(ApprovalRequest{
+		RequestID:     request.ID,
+		Role:          role.Name,
+		Tags:          capabilities.Devices.Create.Tags,
+		Ephemeral:     capabilities.Devices.Create.Ephemeral,
+		Preauthorized: capabilities.Devices.Create.Preauthorized,
+		EntityID:      request.EntityID,
+		DisplayName:   request.DisplayName,
+		Timestamp:     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	client, err := config.client()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.Secret))
+	mac.Write(body)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(approvalSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call approval webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("approval webhook returned status %d", resp.StatusCode)
+	}
+
+	var approval ApprovalResponse
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxApprovalResponseSize)).Decode(&approval); err != nil {
+		return fmt.Errorf("failed to decode approval webhook response: %w", err)
+	}
+
+	if !approval.Approved {
+		return fmt.Errorf("request denied by approval webhook: %s", approval.Reason)
+	}
+
+	return nil
+}
+
+// client returns the HTTP client used to call the webhook. Redirects are refused so that signed payloads are only ever
+// sent to the configured URL.
+func (c *ApprovalConfig) client() (*http.Client, error) {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("approval webhook ca_cert does not contain a valid PEM encoded certificate")
+		}
+
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   apiTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errors.New("approval webhook redirects are not followed")
+		},
+	}, nil
+}
+
+func (b *Backend) approvalConfig(ctx context.Context, storage logical.Storage) (*ApprovalConfig, error) {
+	entry, err := storage.Get(ctx, approvalConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config ApprovalConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func approvalResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"url": {
+			Type:        framework.TypeString,
+			Description: approvalURLDescription,
+		},
+		"ca_cert": {
+			Type:        framework.TypeString,
+			Description: approvalCACertDescription,
+		},
+		"timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: approvalTimeoutDescription,
+		},
+	}
+}
@@ -0,0 +1,217 @@
+package backend_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_Approval(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		Response     backend.ApprovalResponse
+		StatusCode   int
+		Secret       string
+		ExpectsError bool
+	}{
+		{
+			Name:       "It should generate a key if the webhook approves it",
+			Response:   backend.ApprovalResponse{Approved: true},
+			StatusCode: http.StatusOK,
+			Secret:     "secret",
+		},
+		{
+			Name:         "It should return an error if the webhook denies the request",
+			Response:     backend.ApprovalResponse{Approved: false, Reason: "no ticket"},
+			StatusCode:   http.StatusOK,
+			Secret:       "secret",
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if the webhook fails",
+			StatusCode:   http.StatusInternalServerError,
+			Secret:       "secret",
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if the webhook is not configured",
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			putConfig(t, ctx, storage)
+			api := mockKeysAPI(t)
+
+			webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				mac := hmac.New(sha256.New, []byte(tc.Secret))
+				mac.Write(body)
+				assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Vault-Tailscale-Signature"))
+
+				var request backend.ApprovalRequest
+				require.NoError(t, json.Unmarshal(body, &request))
+				assert.Equal(t, "sensitive", request.Role)
+				assert.Equal(t, []string{"tag:prod"}, request.Tags)
+
+				w.WriteHeader(tc.StatusCode)
+				_ = json.NewEncoder(w).Encode(tc.Response)
+			}))
+			t.Cleanup(webhook.Close)
+
+			request := requester(ctx, b, storage)
+
+			if tc.Secret != "" {
+				_, err := request(logical.UpdateOperation, "config/approval", map[string]interface{}{
+					"url":     webhook.URL,
+					"secret":  tc.Secret,
+					"ca_cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: webhook.Certificate().Raw})),
+				})
+				require.NoError(t, err)
+			}
+
+			_, err := request(logical.UpdateOperation, "roles/sensitive", map[string]interface{}{
+				"tags":             "tag:prod",
+				"require_approval": true,
+			})
+			require.NoError(t, err)
+
+			_, err = request(logical.ReadOperation, "creds/sensitive", nil)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, api.Requests(), 1)
+		})
+	}
+}
+
+func TestBackend_ApprovalRedirect(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/approve" {
+			_ = json.NewEncoder(w).Encode(backend.ApprovalResponse{Approved: true})
+			return
+		}
+
+		http.Redirect(w, r, "/approve", http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(webhook.Close)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "config/approval", map[string]interface{}{
+		"url":     webhook.URL,
+		"secret":  "secret",
+		"ca_cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: webhook.Certificate().Raw})),
+	})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "roles/sensitive", map[string]interface{}{
+		"tags":             "tag:prod",
+		"require_approval": true,
+	})
+	require.NoError(t, err)
+
+	t.Run("It should not follow redirects from the webhook", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "creds/sensitive", nil)
+		assert.Error(t, err)
+		assert.Empty(t, api.Requests())
+	})
+}
+
+func TestBackend_UpdateApprovalConfiguration(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		Data         map[string]interface{}
+		ExpectsError bool
+	}{
+		{
+			Name: "It should store the approval configuration",
+			Data: map[string]interface{}{
+				"url":    "https://approvals.example.com",
+				"secret": "secret",
+			},
+		},
+		{
+			Name: "It should return an error if the url does not use https",
+			Data: map[string]interface{}{
+				"url":    "http://approvals.example.com",
+				"secret": "secret",
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error if the secret is missing",
+			Data: map[string]interface{}{
+				"url": "https://approvals.example.com",
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error if the ca certificate is invalid",
+			Data: map[string]interface{}{
+				"url":     "https://approvals.example.com",
+				"secret":  "secret",
+				"ca_cert": "nope",
+			},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config/approval",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "config/approval",
+				Storage:   storage,
+			})
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.Data["url"], response.Data["url"])
+			assert.NotContains(t, response.Data, "secret")
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	auditFormatJSONL = "jsonl"
+	auditFormatCSV   = "csv"
+
+	exportAuditDescription = "Export the history of issued keys as JSON Lines or CSV"
+	auditFormatDescription = "The format of the export, either jsonl or csv"
+	auditFromDescription   = "Only export keys issued at or after this RFC3339 time"
+	auditToDescription     = "Only export keys issued before this RFC3339 time"
+
+	defaultConfigurationLogWindow = 24 * time.Hour
+
+	readConfigurationLogDescription  = "Read the configuration audit log of the tailnet"
+	configurationLogStartDescription = "Only return changes made at or after this RFC3339 time. Defaults to 24 hours before end"
+	configurationLogEndDescription   = "Only return changes made before this RFC3339 time. Defaults to the current time"
+
+	exportAuditHelpSynopsis    = "Export the history of issued keys."
+	exportAuditHelpDescription = `
+Returns the records of keys issued within the requested time range as a raw JSON Lines
+or CSV body, rather than as a Vault response, so that it can be loaded directly into
+other tools.
+`
+	configurationLogHelpSynopsis    = "Read the configuration audit log of the tailnet."
+	configurationLogHelpDescription = `
+Returns the changes made to the configuration of the tailnet, such as to its policy,
+keys and settings, within the requested time range. The entries are returned as provided
+by the Tailscale API.
+`
+)
+
+// auditCSVHeader contains the column names of CSV exports, in the order written by IssuedKey.csvRecord.
+var auditCSVHeader = []string{
+	"id", "role", "tags", "reusable", "ephemeral", "preauthorized", "entity_id", "entity_name", "display_name",
+	"accessor", "created", "expires", "used", "used_at", "device_id", "revoked", "revoked_reason",
+}
+
+func (b *Backend) auditPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "audit/export$",
+			Fields: map[string]*framework.FieldSchema{
+				"format": {
+					Type:          framework.TypeString,
+					Description:   auditFormatDescription,
+					Default:       auditFormatJSONL,
+					AllowedValues: []interface{}{auditFormatJSONL, auditFormatCSV},
+				},
+				"from": {
+					Type:        framework.TypeTime,
+					Description: auditFromDescription,
+				},
+				"to": {
+					Type:        framework.TypeTime,
+					Description: auditToDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ExportAudit,
+					Responses: okResponse(exportAuditDescription, nil),
+					Summary:   exportAuditDescription,
+				},
+			},
+			HelpSynopsis:    exportAuditHelpSynopsis,
+			HelpDescription: exportAuditHelpDescription,
+		},
+		{
+			Pattern: "audit/configuration$",
+			Fields: map[string]*framework.FieldSchema{
+				"start": {
+					Type:        framework.TypeTime,
+					Description: configurationLogStartDescription,
+				},
+				"end": {
+					Type:        framework.TypeTime,
+					Description: configurationLogEndDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadConfigurationLog,
+					Responses: okResponse(readConfigurationLogDescription, configurationLogResponseFields()),
+					Summary:   readConfigurationLogDescription,
+				},
+			},
+			HelpSynopsis:    configurationLogHelpSynopsis,
+			HelpDescription: configurationLogHelpDescription,
+		},
+	}
+}
+
+// ReadConfigurationLog returns the changes made to the configuration of the tailnet, such as to its ACL, keys and
+// settings, within the requested time range. The entries are returned as provided by the Tailscale API.
+func (b *Backend) ReadConfigurationLog(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	end := data.Get("end").(time.Time)
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	start := data.Get("start").(time.Time)
+	if start.IsZero() {
+		start = end.Add(-defaultConfigurationLogWindow)
+	}
+
+	if !end.After(start) {
+		return nil, errors.New("provided end must be after start")
+	}
+
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("start", start.UTC().Format(time.RFC3339))
+	query.Set("end", end.UTC().Format(time.RFC3339))
+
+	var result struct {
+		Logs []map[string]interface{} `json:"logs"`
+	}
+
+	if err = b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("logging", "configuration"), query, nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to read configuration audit log: %w", err)
+	}
+
+	if result.Logs == nil {
+		result.Logs = []map[string]interface{}{}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"start": start.UTC(),
+			"end":   end.UTC(),
+			"logs":  result.Logs,
+		},
+	}, nil
+}
+
+// ExportAudit returns the records of keys issued within the requested time range, oldest first, as a raw JSON Lines or
+// CSV body so that it can be ingested by other systems without parsing Vault's audit devices.
+func (b *Backend) ExportAudit(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	format := data.Get("format").(string)
+	from := data.Get("from").(time.Time)
+	to := data.Get("to").(time.Time)
+
+	switch {
+	case format != auditFormatJSONL && format != auditFormatCSV:
+		return nil, errors.New("provided format must be \"jsonl\" or \"csv\"")
+	case !from.IsZero() && !to.IsZero() && !to.After(from):
+		return nil, errors.New("provided to must be after from")
+	}
+
+	ids, err := request.Storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*IssuedKey, 0, len(ids))
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, request.Storage, id)
+		switch {
+		case err != nil:
+			return nil, err
+		case issued == nil:
+			continue
+		case !from.IsZero() && issued.Created.Before(from):
+			continue
+		case !to.IsZero() && !issued.Created.Before(to):
+			continue
+		}
+
+		records = append(records, issued)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Created.Before(records[j].Created)
+	})
+
+	var (
+		body        bytes.Buffer
+		contentType string
+	)
+
+	switch format {
+	case auditFormatCSV:
+		contentType = "text/csv"
+
+		writer := csv.NewWriter(&body)
+		if err = writer.Write(auditCSVHeader); err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			if err = writer.Write(record.csvRecord()); err != nil {
+				return nil, err
+			}
+		}
+
+		writer.Flush()
+		if err = writer.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		contentType = "application/x-ndjson"
+
+		encoder := json.NewEncoder(&body)
+		for _, record := range records {
+			if err = encoder.Encode(record); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body.Bytes(),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+// csvRecord returns the fields of the record in the order of auditCSVHeader.
+func (k *IssuedKey) csvRecord() []string {
+	return []string{
+		k.ID,
+		k.Role,
+		strings.Join(k.Tags, " "),
+		strconv.FormatBool(k.Reusable),
+		strconv.FormatBool(k.Ephemeral),
+		strconv.FormatBool(k.Preauthorized),
+		k.EntityID,
+		k.EntityName,
+		k.DisplayName,
+		k.Accessor,
+		formatAuditTime(k.Created),
+		formatAuditTime(k.Expires),
+		strconv.FormatBool(k.Used),
+		formatAuditTime(k.UsedAt),
+		k.DeviceID,
+		formatAuditTime(k.Revoked),
+		k.RevokedReason,
+	}
+}
+
+func formatAuditTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func configurationLogResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"start": {
+			Type:        framework.TypeTime,
+			Description: "The start of the returned time range",
+		},
+		"end": {
+			Type:        framework.TypeTime,
+			Description: "The end of the returned time range",
+		},
+		"logs": {
+			Type:        framework.TypeSlice,
+			Description: "The entries of the configuration audit log",
+		},
+	}
+}
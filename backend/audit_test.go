@@ -0,0 +1,163 @@
+package backend_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_ExportAudit(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	records := []backend.IssuedKey{
+		{ID: "key-2", Role: "ci", Tags: []string{"tag:ci"}, Created: time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC)},
+		{ID: "key-1", Role: "web", Tags: []string{"tag:web"}, Created: time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "key-3", Role: "ci", Created: time.Date(2022, 4, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, record := range records {
+		entry, err := logical.StorageEntryJSON("issued-keys/"+record.ID, record)
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+	}
+
+	tt := []struct {
+		Name         string
+		Data         map[string]interface{}
+		ContentType  string
+		Expected     []string
+		ExpectsError bool
+	}{
+		{
+			Name:        "It should export all records as JSON Lines",
+			ContentType: "application/x-ndjson",
+			Expected:    []string{"key-1", "key-2", "key-3"},
+		},
+		{
+			Name: "It should export records within a time range as JSON Lines",
+			Data: map[string]interface{}{
+				"from": "2022-04-02T00:00:00Z",
+				"to":   "2022-04-03T00:00:00Z",
+			},
+			ContentType: "application/x-ndjson",
+			Expected:    []string{"key-2"},
+		},
+		{
+			Name: "It should export records as CSV",
+			Data: map[string]interface{}{
+				"format": "csv",
+				"from":   "2022-04-02T00:00:00Z",
+			},
+			ContentType: "text/csv",
+			Expected:    []string{"key-2", "key-3"},
+		},
+		{
+			Name: "It should return an error if the time range is invalid",
+			Data: map[string]interface{}{
+				"from": "2022-04-03T00:00:00Z",
+				"to":   "2022-04-02T00:00:00Z",
+			},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "audit/export",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.ContentType, response.Data[logical.HTTPContentType])
+
+			body := response.Data[logical.HTTPRawBody].([]byte)
+
+			var ids []string
+			if tc.ContentType == "text/csv" {
+				rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+				require.NoError(t, err)
+				assert.EqualValues(t, "id", rows[0][0])
+
+				for _, row := range rows[1:] {
+					ids = append(ids, row[0])
+				}
+			} else {
+				decoder := json.NewDecoder(bytes.NewReader(body))
+				for decoder.More() {
+					var record backend.IssuedKey
+					require.NoError(t, decoder.Decode(&record))
+					ids = append(ids, record.ID)
+				}
+			}
+
+			assert.EqualValues(t, tc.Expected, ids)
+		})
+	}
+}
+
+func TestBackend_ReadConfigurationLog(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.EqualValues(t, "/api/v2/tailnet/example/logging/configuration", r.URL.Path)
+		assert.EqualValues(t, "2022-04-01T00:00:00Z", r.URL.Query().Get("start"))
+		assert.EqualValues(t, "2022-04-02T00:00:00Z", r.URL.Query().Get("end"))
+
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"logs": []map[string]interface{}{
+				{"action": "UPDATE", "origin": "ADMIN_CONSOLE"},
+			},
+		}))
+	})
+
+	t.Run("It should return the configuration audit log", func(t *testing.T) {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "audit/configuration",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"start": "2022-04-01T00:00:00Z",
+				"end":   "2022-04-02T00:00:00Z",
+			},
+		})
+		require.NoError(t, err)
+
+		logs := response.Data["logs"].([]map[string]interface{})
+		require.Len(t, logs, 1)
+		assert.EqualValues(t, "UPDATE", logs[0]["action"])
+	})
+
+	t.Run("It should return an error if the time range is invalid", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "audit/configuration",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"start": "2022-04-02T00:00:00Z",
+				"end":   "2022-04-01T00:00:00Z",
+			},
+		})
+		assert.Error(t, err)
+	})
+}
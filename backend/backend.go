@@ -5,7 +5,15 @@ package backend
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/tailscale/tailscale-client-go/tailscale"
@@ -16,125 +24,660 @@ type (
 	// keys.
 	Backend struct {
 		*framework.Backend
+
+		usageMu     sync.Mutex
+		apiErrors   atomic.Uint64
+		staticMu    sync.Mutex
+		retrievalMu sync.Mutex
+		activityMu  sync.Mutex
+
+		aclMu sync.Mutex
+		acl   *aclCache
+
+		clientMu    sync.Mutex
+		clientCache *clientCache
+
+		deviceCountMu sync.Mutex
+		devices       *deviceCountCache
+
+		notificationClient *http.Client
+		notifications      chan struct{}
+
+		sinkMu      sync.Mutex
+		sink        *sinkClient
+		sinkRecords chan struct{}
 	}
 
 	// The Config type describes the configuration fields used by the Backend
 	Config struct {
-		Tailnet string `json:"tailnet"`
-		APIKey  string `json:"api_key"`
-		APIUrl  string `json:"api_url"`
+		Tailnet               string            `json:"tailnet"`
+		APIKey                string            `json:"api_key"`
+		APIUrl                string            `json:"api_url"`
+		DefaultRole           string            `json:"default_role"`
+		RequireRole           bool              `json:"require_role"`
+		IssuerTag             string            `json:"issuer_tag"`
+		IdentityTags          bool              `json:"identity_tags"`
+		ReadOnly              bool              `json:"read_only"`
+		RevokeUnusedAfter     time.Duration     `json:"revoke_unused_after"`
+		IssuedKeyRetention    time.Duration     `json:"issued_key_retention"`
+		DescriptionPrefix     string            `json:"description_prefix"`
+		ValidateTags          bool              `json:"validate_tags"`
+		OAuthClientID         string            `json:"oauth_client_id"`
+		OAuthClientSecret     string            `json:"oauth_client_secret"`
+		OAuthTags             []string          `json:"oauth_tags,omitempty"`
+		OAuthRefreshMargin    time.Duration     `json:"oauth_refresh_margin,omitempty"`
+		MetricLabels          map[string]string `json:"metric_labels,omitempty"`
+		APIAddresses          []string          `json:"api_addresses,omitempty"`
+		APIResolver           string            `json:"api_resolver,omitempty"`
+		MaxTailnetDevices     int               `json:"max_tailnet_devices,omitempty"`
+		CorrelationEntityHash bool              `json:"correlation_entity_hash,omitempty"`
+		StrictTags            bool              `json:"strict_tags,omitempty"`
+		StrictRevocation      bool              `json:"strict_revocation,omitempty"`
 	}
 )
 
 const (
-	backendHelp              = "The Tailscale backend is used to generate Tailscale authentication keys for a configured Tailnet"
-	readKeyDescription       = "Generate a single-use authentication key for a device"
-	readConfigDescription    = "Read the current Tailscale backend configuration"
-	updateConfigDescription  = "Update the Tailscale backend configuration"
-	apiKeyDescription        = "The API key to use for authenticating with the Tailscale API"
-	tailnetDescription       = "The name of the Tailscale Tailnet"
-	tagsDescription          = "Tags to apply to the device that uses the authentication key"
-	preauthorizedDescription = "If true, machines added to the tailnet with this key will not required authorization"
-	apiUrlDescription        = "The URL of the Tailscale API"
-	ephemeralDescription     = "If true, nodes created with this key will be removed after a period of inactivity or when they disconnect from the Tailnet"
+	backendHelp                      = "The Tailscale backend is used to generate Tailscale authentication keys for a configured Tailnet"
+	readKeyDescription               = "Generate a single-use authentication key for a device"
+	readConfigDescription            = "Read the current Tailscale backend configuration"
+	updateConfigDescription          = "Update the Tailscale backend configuration"
+	apiKeyDescription                = "The API key to use for authenticating with the Tailscale API"
+	tailnetDescription               = "The name of the Tailscale Tailnet"
+	tagsDescription                  = "Tags to apply to the device that uses the authentication key"
+	preauthorizedDescription         = "If true, machines added to the tailnet with this key will not required authorization"
+	apiUrlDescription                = "The URL of the Tailscale API"
+	ephemeralDescription             = "If true, nodes created with this key will be removed after a period of inactivity or when they disconnect from the Tailnet"
+	defaultRoleDescription           = "The name of a role whose settings are applied to keys generated using the key path"
+	issuerTagDescription             = "A tag added to every key generated by the backend so that devices can be identified in the tailnet ACL. Set to an empty string to disable"
+	identityTagsDescription          = "If true, tags derived from the identity group memberships of the requester are added to generated keys"
+	readOnlyDescription              = "If true, the backend serves reads but refuses any operation that modifies the tailnet, such as generating or deleting keys"
+	revokeUnusedDescription          = "If set, keys that have not been used to add a device to the tailnet within this duration are deleted"
+	issuedKeyRetentionDescription    = "If set, records of issued keys that expired or were revoked longer ago than this duration are deleted"
+	descriptionPrefixDescription     = "A prefix added to the description of every key generated by the backend, identifying the Vault cluster that generated it"
+	validateTagsDescription          = "If true, the tags of each key are checked against the tagOwners of the tailnet policy before it is generated"
+	oauthClientIDDescription         = "The identifier of an OAuth client to use for authenticating with the Tailscale API instead of an API key"
+	oauthClientSecretDescription     = "The secret of the OAuth client"
+	oauthTagsDescription             = "The tags assigned to the OAuth client, used to check that requested tags can be granted by it"
+	oauthRefreshMarginDescription    = "How long before it expires the OAuth access token is refreshed. Defaults to one minute"
+	metricLabelsDescription          = "Static labels, such as team or environment, attached to all metrics and events emitted by the mount"
+	apiAddressesDescription          = "IP addresses to connect to instead of resolving the host of the api_url, for environments where its DNS is blocked"
+	apiResolverDescription           = "The host and port of a DNS server used to resolve the host of the api_url instead of the system resolver"
+	maxTailnetDevicesDescription     = "If set, keys are not generated once the tailnet has this many devices"
+	correlationEntityHashDescription = "If true, a SHA-256 hash of the requester's entity identifier is sent to the Tailscale API along with the identifier of each Vault request"
+	expiryDescription                = "How long the key is valid for. Defaults to the default_expiry of the role, or the expiry given by the Tailscale API"
+	requestConfigDescription         = "The name of a configuration in the allowed_configs of the role to generate the key with. Defaults to the config of the role"
+	strictTagsDescription            = "If true, requested and role tags that are missing the tag: prefix or contain upper case letters are refused instead of being corrected"
+	strictRevocationDescription      = "If true, revoking the lease of a key fails if the key cannot be deleted from the tailnet, instead of queueing the deletion for retry"
+	requireRoleDescription           = "If true, the key path is disabled once any roles exist and keys must be generated using the creds path of a role"
+
+	keyHelpSynopsis    = "Generate a single-use authentication key for a device."
+	keyHelpDescription = `
+Generates a single-use authentication key via the Tailscale API. The settings of the
+configured default role, if any, are applied to the key, and values provided in the
+request take precedence over them. Requested tags are checked against the group tag
+mappings and, if enabled, the tailnet policy. If a PGP key is provided the returned key
+is encrypted to it, and if a retrieval token is requested only the token is returned.
+This path is disabled once any roles exist if the configuration requires a role.
+`
+	configHelpSynopsis    = "Configure how the backend connects to the Tailscale API."
+	configHelpDescription = `
+Configures the tailnet keys are generated for and the credentials used to call the
+Tailscale API, either an API key or an OAuth client. The configuration also controls the
+settings applied to every key, such as the issuer tag and description prefix, along with
+mount-wide behaviour such as read-only mode, tag validation and the device limit. The
+OAuth client secret is not returned when the configuration is read.
+`
 )
 
 // Create a new logical.Backend implementation that can generate authentication keys for Tailscale devices.
 func Create(ctx context.Context, config *logical.BackendConfig) (logical.Backend, error) {
-	backend := &Backend{}
+	backend := &Backend{
+		notificationClient: newNotificationClient(),
+		notifications:      make(chan struct{}, maxPendingNotifications),
+		sinkRecords:        make(chan struct{}, maxPendingSinkRecords),
+	}
 	backend.Backend = &framework.Backend{
 		BackendType: logical.TypeLogical,
 		Help:        backendHelp,
-		Paths: []*framework.Path{
-			{
-				Pattern: "key",
-				Fields: map[string]*framework.FieldSchema{
-					"tags": {
-						Type:        framework.TypeStringSlice,
-						Description: tagsDescription,
-					},
-					"preauthorized": {
-						Type:        framework.TypeBool,
-						Description: preauthorizedDescription,
-					},
-					"ephemeral": {
-						Type:        framework.TypeBool,
-						Description: ephemeralDescription,
+		Paths: framework.PathAppend(
+			[]*framework.Path{
+				{
+					Pattern: "key",
+					Fields: map[string]*framework.FieldSchema{
+						"tags": {
+							Type:        framework.TypeStringSlice,
+							Description: tagsDescription,
+						},
+						"preauthorized": {
+							Type:        framework.TypeBool,
+							Description: preauthorizedDescription,
+						},
+						"ephemeral": {
+							Type:        framework.TypeBool,
+							Description: ephemeralDescription,
+						},
+						"pgp_key": {
+							Type:        framework.TypeString,
+							Description: pgpKeyDescription,
+						},
+						"retrieval_token": {
+							Type:        framework.TypeBool,
+							Description: retrievalDescription,
+						},
+						"metadata": {
+							Type:        framework.TypeKVPairs,
+							Description: metadataDescription,
+						},
+						"labels": {
+							Type:        framework.TypeKVPairs,
+							Description: labelsDescription,
+						},
+						"expiry": {
+							Type:        framework.TypeDurationSecond,
+							Description: expiryDescription,
+						},
+						"config": {
+							Type:        framework.TypeString,
+							Description: requestConfigDescription,
+						},
 					},
-				},
-				Operations: map[logical.Operation]framework.OperationHandler{
-					logical.ReadOperation: &framework.PathOperation{
-						Summary:  readKeyDescription,
-						Callback: backend.GenerateKey,
-					},
-				},
-			},
-			{
-				Pattern: "config",
-				Fields: map[string]*framework.FieldSchema{
-					"api_key": {
-						Type:        framework.TypeString,
-						Description: apiKeyDescription,
-					},
-					"tailnet": {
-						Type:        framework.TypeString,
-						Description: tailnetDescription,
-					},
-					"api_url": {
-						Type:        framework.TypeString,
-						Description: apiUrlDescription,
-						Default:     "https://api.tailscale.com",
+					Operations: map[logical.Operation]framework.OperationHandler{
+						logical.ReadOperation: &framework.PathOperation{
+							Summary:   readKeyDescription,
+							Callback:  backend.GenerateKey,
+							Responses: okResponse(readKeyDescription, keyResponseFields()),
+						},
 					},
+					HelpSynopsis:    keyHelpSynopsis,
+					HelpDescription: keyHelpDescription,
 				},
-				Operations: map[logical.Operation]framework.OperationHandler{
-					logical.ReadOperation: &framework.PathOperation{
-						Callback: backend.ReadConfiguration,
-						Summary:  readConfigDescription,
-					},
-					logical.UpdateOperation: &framework.PathOperation{
-						Callback: backend.UpdateConfiguration,
-						Summary:  updateConfigDescription,
+				{
+					Pattern: "config",
+					Fields:  configFields(),
+					Operations: map[logical.Operation]framework.OperationHandler{
+						logical.ReadOperation: &framework.PathOperation{
+							Callback:  backend.ReadConfiguration,
+							Summary:   readConfigDescription,
+							Responses: okResponse(readConfigDescription, configResponseFields()),
+						},
+						logical.CreateOperation: &framework.PathOperation{
+							Callback:  backend.UpdateConfiguration,
+							Summary:   updateConfigDescription,
+							Responses: noContentResponse(),
+						},
+						logical.UpdateOperation: &framework.PathOperation{
+							Callback:  backend.UpdateConfiguration,
+							Summary:   updateConfigDescription,
+							Responses: noContentResponse(),
+						},
 					},
+					ExistenceCheck:  backend.configExists,
+					HelpSynopsis:    configHelpSynopsis,
+					HelpDescription: configHelpDescription,
 				},
 			},
+			backend.usagePaths(),
+			backend.approvalPaths(),
+			backend.disablePaths(),
+			backend.notificationPaths(),
+			backend.groupTagsPaths(),
+			backend.issuedKeyPaths(),
+			backend.accessorPaths(),
+			backend.tidyPaths(),
+			backend.roleExportPaths(),
+			backend.rolePaths(),
+			backend.namedConfigPaths(),
+			backend.batchPaths(),
+			backend.staticRolePaths(),
+			backend.libraryPaths(),
+			backend.retrievalPaths(),
+			backend.snapshotPaths(),
+			backend.reconcilePaths(),
+			backend.auditPaths(),
+			backend.activityPaths(),
+			backend.statusPaths(),
+			backend.tailnetPaths(),
+			backend.invitePaths(),
+			backend.vipServicePaths(),
+			backend.appConnectorPaths(),
+			backend.aclPaths(),
+			backend.capabilitiesPaths(),
+			backend.setupPaths(),
+			backend.subnetRouterPaths(),
+			backend.deviceAuthorizationPaths(),
+			backend.maintenancePaths(),
+			backend.devicePaths(),
+			backend.sinkPaths(),
+			backend.checkPaths(),
+			backend.deviceInvitePaths(),
+		),
+		Secrets: []*framework.Secret{
+			backend.deviceInviteSecret(),
+			backend.keySecret(),
 		},
+		PeriodicFunc:   backend.periodic,
+		InitializeFunc: backend.initialize,
+		Invalidate:     backend.invalidate,
+		WALRollback:    backend.walRollback,
 	}
 
 	return backend, backend.Setup(ctx, config)
 }
 
 const (
-	configPath = "config"
+	configPath              = "config"
+	initializeTimeout       = 30 * time.Second
+	maxKeyDescriptionLength = 50
 )
 
+// initialize is invoked by Vault once the Backend has been mounted or Vault has been unsealed. It completes any key
+// deletions that were left outstanding, so that a restart during an outage of the Tailscale API does not leave keys
+// in the tailnet. Failures are logged rather than returned so that they do not prevent the mount from being used.
+func (b *Backend) initialize(ctx context.Context, request *logical.InitializationRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, initializeTimeout)
+	defer cancel()
+
+	if err := b.retryRevocations(ctx, request.Storage, true); err != nil {
+		b.Logger().Warn("failed to complete outstanding key deletions", "error", err)
+	}
+
+	return nil
+}
+
+// periodic is invoked by Vault on a regular interval and performs any background work required by the Backend.
+func (b *Backend) periodic(ctx context.Context, request *logical.Request) error {
+	var errs *multierror.Error
+	errs = multierror.Append(errs, b.rotateStaticRoles(ctx, request))
+	errs = multierror.Append(errs, b.tidyRetrievals(ctx, request.Storage))
+	errs = multierror.Append(errs, b.revokeUnusedKeys(ctx, request.Storage))
+	errs = multierror.Append(errs, b.purgeIssuedKeys(ctx, request.Storage))
+	errs = multierror.Append(errs, b.tidyScrubbedKeys(ctx, request.Storage))
+	errs = multierror.Append(errs, b.retryRevocations(ctx, request.Storage, false))
+	errs = multierror.Append(errs, b.snapshotDevices(ctx, request.Storage))
+	errs = multierror.Append(errs, b.reconcileKeys(ctx, request.Storage))
+	errs = multierror.Append(errs, b.checkAPIKeyStatus(ctx, request.Storage))
+	errs = multierror.Append(errs, b.completeOnboardings(ctx, request.Storage))
+	errs = multierror.Append(errs, b.autoApproveRoutes(ctx, request.Storage))
+	errs = multierror.Append(errs, b.authorizeDevices(ctx, request.Storage))
+
+	return errs.ErrorOrNil()
+}
+
 // GenerateKey generates a new authentication key via the Tailscale API. This method checks the existing Backend configuration
-// for the Tailnet and API key. It will return an error if the configuration does not exist.
+// for the Tailnet and API key. It will return an error if the configuration does not exist. If the configuration
+// names a default role, its settings are applied to the key. If the configuration requires a role, this method returns
+// an error once any roles exist.
 func (b *Backend) GenerateKey(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	entry, err := request.Storage.Get(ctx, configPath)
+	config, err := b.config(ctx, request.Storage)
 	if err != nil {
 		return nil, err
 	}
 
-	var config Config
-	if err = entry.DecodeJSON(&config); err != nil {
+	role, err := b.defaultRole(ctx, request.Storage, config)
+	if err != nil {
 		return nil, err
 	}
 
-	client, err := tailscale.NewClient(config.APIKey, config.Tailnet, tailscale.WithBaseURL(config.APIUrl))
-	if err != nil {
+	return b.issueKey(ctx, request, data, config, role, "")
+}
+
+// defaultRole returns the role applied to keys requested without naming one. This is the configured default role if
+// there is one, or an empty role otherwise. Returns an error if the configuration requires a role and any roles exist.
+func (b *Backend) defaultRole(ctx context.Context, storage logical.Storage, config Config) (*Role, error) {
+	if config.RequireRole {
+		roles, err := storage.List(ctx, rolePrefix)
+		switch {
+		case err != nil:
+			return nil, err
+		case len(roles) > 0:
+			return nil, errors.New("the key path is disabled, keys must be generated using creds/<role>")
+		}
+	}
+
+	if config.DefaultRole == "" {
+		return &Role{}, nil
+	}
+
+	role, err := b.role(ctx, storage, config.DefaultRole)
+	switch {
+	case err != nil:
 		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("default role %q does not exist", config.DefaultRole)
 	}
 
+	return role, nil
+}
+
+// issueKey generates a new authentication key on behalf of the requester using the given role, applying every check of
+// the role and configuration before the key is generated and returning it with a lease.
+func (b *Backend) issueKey(ctx context.Context, request *logical.Request, data *framework.FieldData, config Config, role *Role, description string) (response *logical.Response, err error) {
+	var key tailscale.Key
 	var capabilities tailscale.KeyCapabilities
-	capabilities.Devices.Create.Tags = data.Get("tags").([]string)
-	capabilities.Devices.Create.Preauthorized = data.Get("preauthorized").(bool)
-	capabilities.Devices.Create.Ephemeral = data.Get("ephemeral").(bool)
+	defer func() {
+		activity := Activity{
+			Type:        activityIssuance,
+			EntityID:    request.EntityID,
+			DisplayName: request.DisplayName,
+			Role:        role.Name,
+			Tags:        capabilities.Devices.Create.Tags,
+			KeyID:       key.ID,
+			Outcome:     activityOutcomeSuccess,
+		}
+
+		if key.ID != "" {
+			activity.Tags = key.Capabilities.Devices.Create.Tags
+		}
+
+		if err != nil {
+			activity.Outcome = activityOutcomeFailure
+			activity.Error = err.Error()
+		}
+
+		b.recordActivity(ctx, request.Storage, activity)
+	}()
+
+	templated, err := b.templateRole(request, role)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := templated.withRequestedConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	role = selected
+	if config, err = b.roleConfig(ctx, request.Storage, config, role); err != nil {
+		return nil, err
+	}
+
+	if err = role.checkWrapping(request); err != nil {
+		return nil, err
+	}
+
+	if capabilities, err = role.capabilities(data); err != nil {
+		return nil, err
+	}
+
+	expiry, err := role.expiry(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Key generation is checked up front so that approval is not requested for a key that cannot be generated.
+	if err = b.checkDisabled(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkDeviceLimit(ctx, config); err != nil {
+		return nil, err
+	}
+
+	metadata, err := parseMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := parseLabels(data)
+	if err != nil {
+		return nil, err
+	}
 
-	key, err := client.CreateKey(ctx, capabilities)
+	if err = role.checkReissueRequest(data); err != nil {
+		return nil, err
+	}
+
+	// The PGP key is parsed up front so that a key is never generated that cannot be returned.
+	var pgpKey *openpgp.Entity
+	if value, ok := data.GetOk("pgp_key"); ok && value.(string) != "" {
+		entity, err := parsePGPKey(value.(string))
+		if err != nil {
+			return nil, fmt.Errorf("provided pgp_key is invalid: %w", err)
+		}
+
+		pgpKey = entity
+	}
+
+	resolved, err := b.resolveCapabilities(ctx, request, config, role, capabilities, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities = resolved
+	if role.RequireApproval {
+		if err = b.requestApproval(ctx, request, role, capabilities); err != nil {
+			return nil, err
+		}
+	}
+
+	if description == "" {
+		if description, err = b.description(request, role); err != nil {
+			return nil, err
+		}
+	}
+
+	// The write-ahead log entry is stored before the key is generated and only deleted once the response is ready to
+	// be returned, so that the key is deleted from the tailnet if it cannot be returned.
+	walID, nonce, err := b.putKeyWAL(ctx, request.Storage, role.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err = b.createKey(ctx, request.Storage, config, capabilities, expiry, description, nonce)
 	if err != nil {
+		b.deleteKeyWAL(ctx, request.Storage, walID)
 		return nil, err
 	}
 
+	if walID, err = b.updateKeyWAL(ctx, request.Storage, walID, role.Config, nonce, key); err != nil {
+		return nil, err
+	}
+
+	accessor := b.recordIssuedKey(ctx, request, role, key, metadata, labels)
+	b.notify(ctx, request.Storage, eventKeyIssued, map[string]string{
+		"key_id":       key.ID,
+		"role":         role.Name,
+		"tags":         strings.Join(key.Capabilities.Devices.Create.Tags, ","),
+		"entity_id":    request.EntityID,
+		"display_name": request.DisplayName,
+	})
+
+	response = keyResponse(key)
+	if accessor != "" {
+		response.Data["key_accessor"] = accessor
+	}
+	if len(metadata) > 0 {
+		response.Data["metadata"] = metadata
+	}
+	if len(labels) > 0 {
+		response.Data["labels"] = labels
+	}
+
+	if pgpKey != nil {
+		encrypted, err := encryptPGP(pgpKey, key.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		response.Data["key"] = encrypted
+		response.Data["pgp_fingerprint"] = pgpFingerprint(pgpKey)
+	}
+
+	response.Data = role.filterResponse(response.Data)
+
+	retrieval := role.RetrievalToken
+	if value, ok := data.GetOk("retrieval_token"); ok {
+		retrieval = retrieval || value.(bool)
+	}
+
+	if retrieval {
+		if response, err = b.storeForRetrieval(ctx, request.Storage, response); err != nil {
+			return nil, err
+		}
+	}
+
+	response = b.leaseKey(response, role, key)
+	b.warnAPIKeyExpiry(ctx, request.Storage, response)
+
+	if err = framework.DeleteWAL(ctx, request.Storage, walID); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// resolveCapabilities returns the capabilities of a key requested using the given role, once the requested tags have
+// been normalized and checked against the role's allowed tags and the group tag mappings, and any tags derived from the
+// requester's identity have been added. Returns an error if the key is requested outside the role's issuance windows,
+// the requester is not bound to the role, any of its tags is denied by the role or the role's policy does not allow it
+// with the given expiry.
+func (b *Backend) resolveCapabilities(ctx context.Context, request *logical.Request, config Config, role *Role, capabilities tailscale.KeyCapabilities, expiry time.Duration) (tailscale.KeyCapabilities, error) {
+	if err := role.checkIssuanceWindows(time.Now().UTC()); err != nil {
+		return tailscale.KeyCapabilities{}, err
+	}
+
+	if err := b.checkBoundIdentity(request, role); err != nil {
+		return tailscale.KeyCapabilities{}, err
+	}
+
+	tags, err := normalizeTags(capabilities.Devices.Create.Tags, config.StrictTags)
+	if err != nil {
+		return tailscale.KeyCapabilities{}, err
+	}
+
+	if err = role.checkAllowedTags(tags); err != nil {
+		return tailscale.KeyCapabilities{}, err
+	}
+
+	tags, err = b.applyGroupTags(ctx, request, tags)
+	if err != nil {
+		return tailscale.KeyCapabilities{}, err
+	}
+
+	capabilities.Devices.Create.Tags = tags
+	if config.IdentityTags {
+		identity, err := b.identityTags(request)
+		if err != nil {
+			return tailscale.KeyCapabilities{}, err
+		}
+
+		capabilities.Devices.Create.Tags = mergeTags(capabilities.Devices.Create.Tags, identity...)
+	}
+
+	if err = role.checkDeniedTags(capabilities.Devices.Create.Tags); err != nil {
+		return tailscale.KeyCapabilities{}, err
+	}
+
+	if err = b.checkPolicy(request, role, capabilities, expiry); err != nil {
+		return tailscale.KeyCapabilities{}, err
+	}
+
+	return capabilities, nil
+}
+
+// createKey generates a new authentication key with the given capabilities, recording the outcome in the usage
+// counters. The configured issuer tag is added to the key's tags and the configured description prefix to its
+// description. If tag validation is enabled, the tags are checked against the tailnet policy. When using OAuth client
+// credentials, the tags are checked against those the client can grant. A zero expiry leaves the expiry of the key to
+// the Tailscale API. The nonce, if any, is added to the end of the description. Returns an error if key generation is
+// disabled, the backend is in read-only mode or any tag is not defined in the policy or cannot be granted.
+func (b *Backend) createKey(ctx context.Context, storage logical.Storage, config Config, capabilities tailscale.KeyCapabilities, expiry time.Duration, description, nonce string) (tailscale.Key, error) {
+	if err := b.checkDisabled(ctx, storage); err != nil {
+		return tailscale.Key{}, err
+	}
+
+	if err := config.checkWritable(); err != nil {
+		return tailscale.Key{}, err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return tailscale.Key{}, err
+	}
+
+	tags, err := b.keyTags(ctx, config, capabilities.Devices.Create.Tags)
+	if err != nil {
+		return tailscale.Key{}, err
+	}
+
+	capabilities.Devices.Create.Tags = tags
+
+	if config.DescriptionPrefix != "" {
+		description = strings.TrimSpace(config.DescriptionPrefix + " " + description)
+	}
+
+	var opts []tailscale.CreateKeyOption
+	if expiry > 0 {
+		opts = append(opts, tailscale.WithKeyExpiry(expiry))
+	}
+	if description != "" || nonce != "" {
+		opts = append(opts, tailscale.WithKeyDescription(keyDescription(description, nonce)))
+	}
+
+	key, err := client.CreateKey(ctx, capabilities, opts...)
+	if err != nil {
+		b.recordUsage(ctx, storage, func(usage *Usage) {
+			usage.KeysFailed++
+		})
+
+		return tailscale.Key{}, err
+	}
+
+	b.recordUsage(ctx, storage, func(usage *Usage) {
+		usage.KeysIssued++
+	})
+
+	return key, nil
+}
+
+// keyTags returns the tags of a generated key, adding the configured issuer tag to those given. If tag validation is
+// enabled, the tags are checked against the tailnet policy. When using OAuth client credentials, the tags are checked
+// against those the client can grant.
+func (b *Backend) keyTags(ctx context.Context, config Config, tags []string) ([]string, error) {
+	if config.IssuerTag != "" {
+		tags = mergeTags(tags, config.IssuerTag)
+	}
+
+	if err := b.validateTags(ctx, config, tags); err != nil {
+		return nil, err
+	}
+
+	if err := b.checkGrantableTags(ctx, config, tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// keyDescription returns the description in a form accepted by the Tailscale API, which allows at most 50 letters,
+// digits, hyphens and spaces. Any other characters are replaced with hyphens. The nonce, if any, is kept in full at the
+// end of the description, which is truncated to make room for it.
+func keyDescription(description, nonce string) string {
+	limit := maxKeyDescriptionLength
+	if nonce != "" {
+		limit -= len(nonce) + 1
+	}
+
+	runes := []rune(description)
+	if len(runes) > limit {
+		runes = runes[:limit]
+	}
+
+	for i, r := range runes {
+		if !(r == ' ' || r == '-' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')) {
+			runes[i] = '-'
+		}
+	}
+
+	if nonce == "" {
+		return string(runes)
+	}
+
+	return strings.TrimSpace(string(runes) + " " + nonce)
+}
+
+func keyResponse(key tailscale.Key) *logical.Response {
 	return &logical.Response{
 		Data: map[string]interface{}{
 			"id":            key.ID,
@@ -145,58 +688,385 @@ func (b *Backend) GenerateKey(ctx context.Context, request *logical.Request, dat
 			"ephemeral":     key.Capabilities.Devices.Create.Ephemeral,
 			"preauthorized": key.Capabilities.Devices.Create.Preauthorized,
 		},
-	}, nil
+	}
+}
+
+// configResponseFields returns the schema of the fields returned when the Backend configuration is read.
+func configResponseFields() map[string]*framework.FieldSchema {
+	fields := configFields()
+	delete(fields, "oauth_client_secret")
+
+	return fields
+}
+
+// configFields returns the schema of the fields describing the Backend configuration.
+func configFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"api_key": {
+			Type:        framework.TypeString,
+			Description: apiKeyDescription,
+		},
+		"tailnet": {
+			Type:        framework.TypeString,
+			Description: tailnetDescription,
+		},
+		"api_url": {
+			Type:        framework.TypeString,
+			Description: apiUrlDescription,
+			Default:     "https://api.tailscale.com",
+		},
+		"default_role": {
+			Type:        framework.TypeString,
+			Description: defaultRoleDescription,
+		},
+		"require_role": {
+			Type:        framework.TypeBool,
+			Description: requireRoleDescription,
+		},
+		"issuer_tag": {
+			Type:        framework.TypeString,
+			Description: issuerTagDescription,
+			Default:     "tag:vault",
+		},
+		"identity_tags": {
+			Type:        framework.TypeBool,
+			Description: identityTagsDescription,
+		},
+		"read_only": {
+			Type:        framework.TypeBool,
+			Description: readOnlyDescription,
+		},
+		"revoke_unused_after": {
+			Type:        framework.TypeDurationSecond,
+			Description: revokeUnusedDescription,
+		},
+		"issued_key_retention": {
+			Type:        framework.TypeDurationSecond,
+			Description: issuedKeyRetentionDescription,
+		},
+		"description_prefix": {
+			Type:        framework.TypeString,
+			Description: descriptionPrefixDescription,
+		},
+		"validate_tags": {
+			Type:        framework.TypeBool,
+			Description: validateTagsDescription,
+		},
+		"oauth_client_id": {
+			Type:        framework.TypeString,
+			Description: oauthClientIDDescription,
+		},
+		"oauth_client_secret": {
+			Type:        framework.TypeString,
+			Description: oauthClientSecretDescription,
+		},
+		"oauth_tags": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: oauthTagsDescription,
+		},
+		"oauth_refresh_margin": {
+			Type:        framework.TypeDurationSecond,
+			Description: oauthRefreshMarginDescription,
+		},
+		"metric_labels": {
+			Type:        framework.TypeKVPairs,
+			Description: metricLabelsDescription,
+		},
+		"api_addresses": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: apiAddressesDescription,
+		},
+		"api_resolver": {
+			Type:        framework.TypeString,
+			Description: apiResolverDescription,
+		},
+		"max_tailnet_devices": {
+			Type:        framework.TypeInt,
+			Description: maxTailnetDevicesDescription,
+		},
+		"correlation_entity_hash": {
+			Type:        framework.TypeBool,
+			Description: correlationEntityHashDescription,
+		},
+		"strict_tags": {
+			Type:        framework.TypeBool,
+			Description: strictTagsDescription,
+		},
+		"strict_revocation": {
+			Type:        framework.TypeBool,
+			Description: strictRevocationDescription,
+		},
+	}
 }
 
 // ReadConfiguration reads the Backend configuration and returns its values.
 func (b *Backend) ReadConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
-	entry, err := request.Storage.Get(ctx, configPath)
-	switch {
-	case err != nil:
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
 		return nil, err
-	case entry == nil:
-		return nil, errors.New("configuration has not been set")
 	}
 
-	var config Config
-	if err = entry.DecodeJSON(&config); err != nil {
-		return nil, err
-	}
+	return configResponse(config), nil
+}
 
+// configResponse returns the values of a configuration, without the OAuth client secret.
+func configResponse(config Config) *logical.Response {
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"tailnet": config.Tailnet,
-			"api_key": config.APIKey,
-			"api_url": config.APIUrl,
+			"tailnet":                 config.Tailnet,
+			"api_key":                 config.APIKey,
+			"api_url":                 config.APIUrl,
+			"default_role":            config.DefaultRole,
+			"require_role":            config.RequireRole,
+			"issuer_tag":              config.IssuerTag,
+			"identity_tags":           config.IdentityTags,
+			"read_only":               config.ReadOnly,
+			"revoke_unused_after":     int64(config.RevokeUnusedAfter.Seconds()),
+			"issued_key_retention":    int64(config.IssuedKeyRetention.Seconds()),
+			"description_prefix":      config.DescriptionPrefix,
+			"validate_tags":           config.ValidateTags,
+			"oauth_client_id":         config.OAuthClientID,
+			"oauth_tags":              config.OAuthTags,
+			"oauth_refresh_margin":    int64(config.oauthRefreshMargin().Seconds()),
+			"metric_labels":           config.MetricLabels,
+			"api_addresses":           config.APIAddresses,
+			"api_resolver":            config.APIResolver,
+			"max_tailnet_devices":     config.MaxTailnetDevices,
+			"correlation_entity_hash": config.CorrelationEntityHash,
+			"strict_tags":             config.StrictTags,
+			"strict_revocation":       config.StrictRevocation,
 		},
-	}, nil
+	}
 }
 
-// UpdateConfiguration modifies the Backend configuration. Returns an error if any required fields are missing.
+// UpdateConfiguration creates or modifies the Backend configuration. When modifying an existing configuration, any
+// fields not provided retain their values. Returns an error if any required fields are missing.
 func (b *Backend) UpdateConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config := Config{
-		Tailnet: data.Get("tailnet").(string),
-		APIKey:  data.Get("api_key").(string),
-		APIUrl:  data.Get("api_url").(string),
+	existing, err := b.storedConfig(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := parseConfig(data, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.saveConfig(ctx, request.Storage, config); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// parseConfig returns the Backend configuration described by the request, applied to the existing configuration if
+// there is one. Fields not provided retain their existing values, or take their defaults if there is no existing
+// configuration. Returns an error if any required fields are missing or any fields are invalid.
+func parseConfig(data *framework.FieldData, existing *Config) (Config, error) {
+	var config Config
+	if existing != nil {
+		config = *existing
+	}
+
+	field := func(name string) (interface{}, bool) {
+		if value, ok := data.GetOk(name); ok {
+			return value, true
+		}
+
+		return data.Get(name), existing == nil
+	}
+
+	if value, ok := field("tailnet"); ok {
+		config.Tailnet = value.(string)
+	}
+	if value, ok := field("api_key"); ok {
+		config.APIKey = value.(string)
+	}
+	if value, ok := field("api_url"); ok {
+		config.APIUrl = value.(string)
+	}
+	if value, ok := field("default_role"); ok {
+		config.DefaultRole = value.(string)
+	}
+	if value, ok := field("require_role"); ok {
+		config.RequireRole = value.(bool)
+	}
+	if value, ok := field("issuer_tag"); ok {
+		config.IssuerTag = value.(string)
+	}
+	if value, ok := field("identity_tags"); ok {
+		config.IdentityTags = value.(bool)
+	}
+	if value, ok := field("read_only"); ok {
+		config.ReadOnly = value.(bool)
+	}
+	if value, ok := field("revoke_unused_after"); ok {
+		config.RevokeUnusedAfter = time.Duration(value.(int)) * time.Second
+	}
+	if value, ok := field("issued_key_retention"); ok {
+		config.IssuedKeyRetention = time.Duration(value.(int)) * time.Second
+	}
+	if value, ok := field("description_prefix"); ok {
+		config.DescriptionPrefix = value.(string)
+	}
+	if value, ok := field("validate_tags"); ok {
+		config.ValidateTags = value.(bool)
+	}
+	if value, ok := field("oauth_client_id"); ok {
+		config.OAuthClientID = value.(string)
+	}
+	if value, ok := field("oauth_client_secret"); ok {
+		config.OAuthClientSecret = value.(string)
+	}
+	if value, ok := field("oauth_tags"); ok {
+		config.OAuthTags = value.([]string)
+	}
+	if value, ok := field("oauth_refresh_margin"); ok {
+		config.OAuthRefreshMargin = time.Duration(value.(int)) * time.Second
+	}
+	if value, ok := field("metric_labels"); ok {
+		config.MetricLabels = value.(map[string]string)
+	}
+	if value, ok := field("api_addresses"); ok {
+		config.APIAddresses = value.([]string)
+	}
+	if value, ok := field("api_resolver"); ok {
+		config.APIResolver = value.(string)
+	}
+	if value, ok := field("max_tailnet_devices"); ok {
+		config.MaxTailnetDevices = value.(int)
+	}
+	if value, ok := field("correlation_entity_hash"); ok {
+		config.CorrelationEntityHash = value.(bool)
+	}
+	if value, ok := field("strict_tags"); ok {
+		config.StrictTags = value.(bool)
+	}
+	if value, ok := field("strict_revocation"); ok {
+		config.StrictRevocation = value.(bool)
+	}
+
+	// Switching between an API key and an OAuth client only requires the new credentials to be provided.
+	_, apiKey := data.GetOk("api_key")
+	_, oauthClient := data.GetOk("oauth_client_id")
+	switch {
+	case existing == nil:
+	case apiKey && !oauthClient:
+		config.OAuthClientID, config.OAuthClientSecret, config.OAuthTags = "", "", nil
+	case oauthClient && !apiKey:
+		config.APIKey = ""
+	}
+
+	if len(config.MetricLabels) == 0 {
+		config.MetricLabels = nil
 	}
 
 	switch {
 	case config.Tailnet == "":
-		return nil, errors.New("provided tailnet cannot be empty")
-	case config.APIKey == "":
-		return nil, errors.New("provided api_key cannot be empty")
+		return Config{}, errors.New("provided tailnet cannot be empty")
+	case config.APIKey == "" && config.OAuthClientID == "":
+		return Config{}, errors.New("provided api_key cannot be empty unless oauth_client_id is set")
+	case config.APIKey != "" && config.OAuthClientID != "":
+		return Config{}, errors.New("provided api_key and oauth_client_id cannot both be set")
+	case config.OAuthClientID != "" && config.OAuthClientSecret == "":
+		return Config{}, errors.New("provided oauth_client_secret cannot be empty")
 	case config.APIUrl == "":
-		return nil, errors.New("provided api_url cannot be empty")
+		return Config{}, errors.New("provided api_url cannot be empty")
+	case config.OAuthRefreshMargin < 0 || config.OAuthRefreshMargin > maxOAuthRefreshMargin:
+		return Config{}, fmt.Errorf("provided oauth_refresh_margin cannot be negative or greater than %s", maxOAuthRefreshMargin)
+	case len(config.DescriptionPrefix) >= maxKeyDescriptionLength:
+		return Config{}, fmt.Errorf("provided description_prefix must be shorter than %d characters", maxKeyDescriptionLength)
+	case config.MaxTailnetDevices < 0:
+		return Config{}, errors.New("provided max_tailnet_devices cannot be negative")
+	case keyDescription(config.DescriptionPrefix, "") != config.DescriptionPrefix:
+		return Config{}, errors.New("provided description_prefix may only contain letters, digits, hyphens and spaces")
+	}
+
+	if err := validateMetricLabels(config.MetricLabels); err != nil {
+		return Config{}, err
 	}
 
+	if err := validateAPIHostOverride(config.APIAddresses, config.APIResolver); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// saveConfig stores the Backend configuration. Any cached clients, tailnet policy and device count are discarded, as
+// the configuration may now refer to a different tailnet.
+func (b *Backend) saveConfig(ctx context.Context, storage logical.Storage, config Config) error {
 	entry, err := logical.StorageEntryJSON(configPath, config)
 	if err != nil {
+		return err
+	}
+
+	if err = storage.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	b.invalidate(ctx, configPath)
+	return nil
+}
+
+// storedConfig returns the Backend configuration, or nil if it has not been set.
+func (b *Backend) storedConfig(ctx context.Context, storage logical.Storage) (*Config, error) {
+	entry, err := storage.Get(ctx, configPath)
+	switch {
+	case err != nil:
 		return nil, err
+	case entry == nil:
+		return nil, nil
 	}
 
-	if err = request.Storage.Put(ctx, entry); err != nil {
+	var config Config
+	if err = entry.DecodeJSON(&config); err != nil {
 		return nil, err
 	}
 
-	return &logical.Response{}, nil
+	return &config, nil
+}
+
+// configExists returns true if the configuration has been set, so that the first write to it is a create operation and
+// later writes are update operations.
+func (b *Backend) configExists(ctx context.Context, request *logical.Request, _ *framework.FieldData) (bool, error) {
+	entry, err := request.Storage.Get(ctx, configPath)
+	if err != nil {
+		return false, err
+	}
+
+	return entry != nil, nil
+}
+
+func (b *Backend) config(ctx context.Context, storage logical.Storage) (Config, error) {
+	config, err := b.storedConfig(ctx, storage)
+	switch {
+	case err != nil:
+		return Config{}, err
+	case config == nil:
+		return Config{}, errors.New("configuration has not been set")
+	}
+
+	return *config, nil
+}
+
+// ErrReadOnly is the error returned when attempting to modify the tailnet while the backend is in read-only mode.
+var ErrReadOnly = errors.New("the backend is in read-only mode and cannot modify the tailnet")
+
+// checkWritable returns ErrReadOnly if the configuration does not allow the tailnet to be modified.
+func (c Config) checkWritable() error {
+	if c.ReadOnly {
+		return ErrReadOnly
+	}
+
+	return nil
+}
+
+func (b *Backend) client(ctx context.Context, storage logical.Storage) (*tailscale.Client, error) {
+	config, err := b.config(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newClient(config)
 }
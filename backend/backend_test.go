@@ -3,7 +3,12 @@ package backend_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -83,7 +88,11 @@ func TestBackend_GenerateKey(t *testing.T) {
 				return
 			}
 
-			assert.NoError(t, err)
+			require.NoError(t, err)
+
+			// The accessor is random, so it is only checked for presence.
+			assert.NotEmpty(t, response.Data["key_accessor"])
+			delete(response.Data, "key_accessor")
 			assert.EqualValues(t, tc.Expected, response.Data)
 		})
 	}
@@ -109,9 +118,28 @@ func TestBackend_ReadConfiguration(t *testing.T) {
 				APIUrl:  "example.com",
 			},
 			Expected: map[string]interface{}{
-				"tailnet": "example.com",
-				"api_key": "1234",
-				"api_url": "example.com",
+				"tailnet":                 "example.com",
+				"api_key":                 "1234",
+				"api_url":                 "example.com",
+				"default_role":            "",
+				"require_role":            false,
+				"issuer_tag":              "",
+				"identity_tags":           false,
+				"read_only":               false,
+				"revoke_unused_after":     int64(0),
+				"issued_key_retention":    int64(0),
+				"description_prefix":      "",
+				"validate_tags":           false,
+				"oauth_client_id":         "",
+				"oauth_tags":              []string(nil),
+				"oauth_refresh_margin":    int64(60),
+				"metric_labels":           map[string]string(nil),
+				"api_addresses":           []string(nil),
+				"api_resolver":            "",
+				"max_tailnet_devices":     0,
+				"correlation_entity_hash": false,
+				"strict_tags":             false,
+				"strict_revocation":       false,
 			},
 		},
 		{
@@ -156,6 +184,67 @@ func TestBackend_UpdateConfiguration(t *testing.T) {
 			Type:    framework.TypeString,
 			Default: "https://api.tailscale.com",
 		},
+		"default_role": {
+			Type: framework.TypeString,
+		},
+		"require_role": {
+			Type: framework.TypeBool,
+		},
+		"issuer_tag": {
+			Type:    framework.TypeString,
+			Default: "tag:vault",
+		},
+		"identity_tags": {
+			Type: framework.TypeBool,
+		},
+		"read_only": {
+			Type: framework.TypeBool,
+		},
+		"revoke_unused_after": {
+			Type: framework.TypeDurationSecond,
+		},
+		"issued_key_retention": {
+			Type: framework.TypeDurationSecond,
+		},
+		"description_prefix": {
+			Type: framework.TypeString,
+		},
+		"validate_tags": {
+			Type: framework.TypeBool,
+		},
+		"oauth_client_id": {
+			Type: framework.TypeString,
+		},
+		"oauth_client_secret": {
+			Type: framework.TypeString,
+		},
+		"oauth_tags": {
+			Type: framework.TypeCommaStringSlice,
+		},
+		"oauth_refresh_margin": {
+			Type: framework.TypeDurationSecond,
+		},
+		"metric_labels": {
+			Type: framework.TypeKVPairs,
+		},
+		"api_addresses": {
+			Type: framework.TypeCommaStringSlice,
+		},
+		"api_resolver": {
+			Type: framework.TypeString,
+		},
+		"max_tailnet_devices": {
+			Type: framework.TypeInt,
+		},
+		"correlation_entity_hash": {
+			Type: framework.TypeBool,
+		},
+		"strict_tags": {
+			Type: framework.TypeBool,
+		},
+		"strict_revocation": {
+			Type: framework.TypeBool,
+		},
 	}
 
 	tt := []struct {
@@ -176,9 +265,10 @@ func TestBackend_UpdateConfiguration(t *testing.T) {
 				},
 			},
 			Expected: backend.Config{
-				Tailnet: "example.com",
-				APIKey:  "12345",
-				APIUrl:  "https://api.tailscale.com",
+				Tailnet:   "example.com",
+				APIKey:    "12345",
+				APIUrl:    "https://api.tailscale.com",
+				IssuerTag: "tag:vault",
 			},
 		},
 		{
@@ -192,6 +282,186 @@ func TestBackend_UpdateConfiguration(t *testing.T) {
 			},
 			ExpectsError: true,
 		},
+		{
+			Name:    "It should return an error if the description prefix contains invalid characters",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":            "12345",
+					"tailnet":            "example.com",
+					"description_prefix": "prod.vault",
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should update the backend configuration with OAuth client credentials",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"tailnet":             "example.com",
+					"oauth_client_id":     "client",
+					"oauth_client_secret": "secret",
+					"oauth_tags":          "tag:vault",
+				},
+			},
+			Expected: backend.Config{
+				Tailnet:           "example.com",
+				APIUrl:            "https://api.tailscale.com",
+				IssuerTag:         "tag:vault",
+				OAuthClientID:     "client",
+				OAuthClientSecret: "secret",
+				OAuthTags:         []string{"tag:vault"},
+			},
+		},
+		{
+			Name:    "It should update the backend configuration with an OAuth refresh margin",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"tailnet":              "example.com",
+					"oauth_client_id":      "client",
+					"oauth_client_secret":  "secret",
+					"oauth_refresh_margin": "5m",
+				},
+			},
+			Expected: backend.Config{
+				Tailnet:            "example.com",
+				APIUrl:             "https://api.tailscale.com",
+				IssuerTag:          "tag:vault",
+				OAuthClientID:      "client",
+				OAuthClientSecret:  "secret",
+				OAuthRefreshMargin: 5 * time.Minute,
+			},
+		},
+		{
+			Name:    "It should return an error if the OAuth refresh margin is too large",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"tailnet":              "example.com",
+					"oauth_client_id":      "client",
+					"oauth_client_secret":  "secret",
+					"oauth_refresh_margin": "1h",
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should update the backend configuration with metric labels",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":       "12345",
+					"tailnet":       "example.com",
+					"metric_labels": map[string]interface{}{"team": "platform", "environment": "prod"},
+				},
+			},
+			Expected: backend.Config{
+				Tailnet:      "example.com",
+				APIKey:       "12345",
+				APIUrl:       "https://api.tailscale.com",
+				IssuerTag:    "tag:vault",
+				MetricLabels: map[string]string{"team": "platform", "environment": "prod"},
+			},
+		},
+		{
+			Name:    "It should return an error if a metric label name is invalid",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":       "12345",
+					"tailnet":       "example.com",
+					"metric_labels": map[string]interface{}{"cost-centre": "123"},
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should return an error if a metric label name is reserved",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":       "12345",
+					"tailnet":       "example.com",
+					"metric_labels": map[string]interface{}{"role": "ci"},
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should return an error if a pinned api address is not an IP address",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":       "12345",
+					"tailnet":       "example.com",
+					"api_addresses": "api.example.com",
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should return an error if both pinned api addresses and a resolver are provided",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":       "12345",
+					"tailnet":       "example.com",
+					"api_addresses": "192.0.2.1",
+					"api_resolver":  "192.0.2.53:53",
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should return an error if both an api key and OAuth client are provided",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":             "12345",
+					"tailnet":             "example.com",
+					"oauth_client_id":     "client",
+					"oauth_client_secret": "secret",
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should return an error if the OAuth client secret is missing",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"tailnet":         "example.com",
+					"oauth_client_id": "client",
+				},
+			},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should return an error if the device limit is negative",
+			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
+			Data: &framework.FieldData{
+				Schema: requestSchema,
+				Raw: map[string]interface{}{
+					"api_key":             "12345",
+					"tailnet":             "example.com",
+					"max_tailnet_devices": -1,
+				},
+			},
+			ExpectsError: true,
+		},
 		{
 			Name:    "It should return an error if the tailnet is missing",
 			Request: logical.TestRequest(t, logical.UpdateOperation, "config"),
@@ -220,6 +490,64 @@ func TestBackend_UpdateConfiguration(t *testing.T) {
 	}
 }
 
+func TestBackend_UpdateConfigurationMerge(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	write := func(data map[string]interface{}) backend.Config {
+		t.Helper()
+
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+
+		return getConfig(t, ctx, &logical.Request{Storage: storage})
+	}
+
+	initial := write(map[string]interface{}{
+		"tailnet":             "example.com",
+		"api_key":             "12345",
+		"api_url":             "http://localhost:1337",
+		"require_role":        true,
+		"read_only":           true,
+		"strict_revocation":   true,
+		"issuer_tag":          "tag:issuer",
+		"max_tailnet_devices": 10,
+	})
+
+	t.Run("It should retain the fields not provided when rotating the API key", func(t *testing.T) {
+		config := write(map[string]interface{}{"api_key": "67890"})
+
+		expected := initial
+		expected.APIKey = "67890"
+		assert.EqualValues(t, expected, config)
+	})
+
+	t.Run("It should replace the API key when switching to an OAuth client", func(t *testing.T) {
+		config := write(map[string]interface{}{
+			"oauth_client_id":     "client",
+			"oauth_client_secret": "secret",
+		})
+
+		assert.Empty(t, config.APIKey)
+		assert.EqualValues(t, "client", config.OAuthClientID)
+		assert.EqualValues(t, "tag:issuer", config.IssuerTag)
+		assert.True(t, config.ReadOnly)
+	})
+
+	t.Run("It should replace the OAuth client when switching to an API key", func(t *testing.T) {
+		config := write(map[string]interface{}{"api_key": "12345"})
+
+		assert.EqualValues(t, "12345", config.APIKey)
+		assert.Empty(t, config.OAuthClientID)
+		assert.Empty(t, config.OAuthClientSecret)
+	})
+}
+
 func setup(t *testing.T) (context.Context, *backend.Backend) {
 	t.Helper()
 
@@ -231,6 +559,18 @@ func setup(t *testing.T) (context.Context, *backend.Backend) {
 	return ctx, b.(*backend.Backend)
 }
 
+// requester returns a function that handles requests to the backend against the given storage.
+func requester(ctx context.Context, b *backend.Backend, storage logical.Storage) func(logical.Operation, string, map[string]interface{}) (*logical.Response, error) {
+	return func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+}
+
 func getConfig(t *testing.T, ctx context.Context, request *logical.Request) backend.Config {
 	t.Helper()
 
@@ -246,22 +586,470 @@ func getConfig(t *testing.T, ctx context.Context, request *logical.Request) back
 func respondWith(t *testing.T, code int, body interface{}) {
 	t.Helper()
 
-	mux := http.NewServeMux()
-	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(code)
 		assert.NoError(t, json.NewEncoder(w).Encode(body))
-	}))
+	})
+}
+
+func serve(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
 
 	svr := &http.Server{
-		Addr:    ":1337",
-		Handler: mux,
+		Handler: handler,
 	}
 
+	// Backends keep their connections to the API between subtests, which would otherwise be reused once the server
+	// serving them has closed.
+	svr.SetKeepAlivesEnabled(false)
+
+	listener, err := net.Listen("tcp", "localhost:1337")
+	require.NoError(t, err)
+
 	go func() {
-		_ = svr.ListenAndServe()
+		_ = svr.Serve(listener)
 	}()
 
 	t.Cleanup(func() {
 		assert.NoError(t, svr.Close())
+		_ = listener.Close()
+	})
+}
+
+// withoutNonce returns the description of a generated key without the nonce the backend adds to it.
+func withoutNonce(description string) string {
+	return regexp.MustCompile(` ?vt-[0-9a-f]{12}$`).ReplaceAllString(description, "")
+}
+
+func putConfig(t *testing.T, ctx context.Context, storage logical.Storage) {
+	t.Helper()
+
+	entry, err := logical.StorageEntryJSON("config", backend.Config{
+		Tailnet: "example",
+		APIUrl:  "http://localhost:1337",
+		APIKey:  "example",
+	})
+	require.NoError(t, err)
+	require.NoError(t, storage.Put(ctx, entry))
+}
+
+type keysAPI struct {
+	mu       sync.Mutex
+	created  int
+	deleted  []string
+	requests []tailscale.CreateKeyRequest
+	headers  []http.Header
+	devices  []tailscale.Device
+	failing  bool
+	expires  time.Time
+	routes   map[string]*tailscale.DeviceRoutes
+
+	tagOwners  map[string][]string
+	aclFetches int
+
+	tokenFetches  int
+	tokenLifetime time.Duration
+
+	failingDeletes bool
+
+	keys    []tailscale.Key
+	missing map[string]bool
+}
+
+func (k *keysAPI) SetRoutes(deviceID string, advertised, enabled []string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.routes[deviceID] = &tailscale.DeviceRoutes{Advertised: advertised, Enabled: enabled}
+}
+
+func (k *keysAPI) SetTagOwners(tagOwners map[string][]string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.tagOwners = tagOwners
+}
+
+func (k *keysAPI) ACLFetches() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.aclFetches
+}
+
+func (k *keysAPI) SetTokenLifetime(lifetime time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.tokenLifetime = lifetime
+}
+
+func (k *keysAPI) TokenFetches() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.tokenFetches
+}
+
+func (k *keysAPI) Authorized(deviceID string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, device := range k.devices {
+		if device.ID == deviceID {
+			return device.Authorized
+		}
+	}
+
+	return false
+}
+
+func (k *keysAPI) Routes(deviceID string) *tailscale.DeviceRoutes {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.routes[deviceID]
+}
+
+// SetMissingKeys causes requests for the given keys to fail as though they no longer exist in the tailnet.
+func (k *keysAPI) SetMissingKeys(ids ...string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.missing = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		k.missing[id] = true
+	}
+}
+
+func (k *keysAPI) SetFailingDeletes(failing bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.failingDeletes = failing
+}
+
+func (k *keysAPI) SetKeyExpiry(expires time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.expires = expires
+}
+
+func (k *keysAPI) SetDevices(devices ...tailscale.Device) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.devices = devices
+}
+
+// SetKeys adds keys to the tailnet that were not created through the API, such as those created using the admin
+// console.
+func (k *keysAPI) SetKeys(keys ...tailscale.Key) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = keys
+}
+
+func (k *keysAPI) Requests() []tailscale.CreateKeyRequest {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return append([]tailscale.CreateKeyRequest(nil), k.requests...)
+}
+
+func (k *keysAPI) Headers() []http.Header {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return append([]http.Header(nil), k.headers...)
+}
+
+func (k *keysAPI) SetFailing(failing bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.failing = failing
+}
+
+func (k *keysAPI) Deleted() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return append([]string(nil), k.deleted...)
+}
+
+// mockKeysAPI serves a minimal implementation of the Tailscale key creation and deletion endpoints, along with the
+// device listing, authorization and routing endpoints, the tailnet policy and OAuth token issuance. Created keys are
+// given sequential identifiers starting at "key-1".
+func mockKeysAPI(t *testing.T) *keysAPI {
+	t.Helper()
+
+	api := &keysAPI{routes: make(map[string]*tailscale.DeviceRoutes)}
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+
+		if api.failing || (api.failingDeletes && r.Method == http.MethodDelete) {
+			w.WriteHeader(http.StatusInternalServerError)
+			assert.NoError(t, json.NewEncoder(w).Encode(tailscale.APIError{Message: "failed"}))
+			return
+		}
+
+		if strings.Contains(r.URL.Path, "/keys/") && api.missing[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]] {
+			w.WriteHeader(http.StatusNotFound)
+			assert.NoError(t, json.NewEncoder(w).Encode(tailscale.APIError{Message: "not found"}))
+			return
+		}
+
+		if r.URL.Path == "/api/v2/oauth/token" {
+			api.tokenFetches++
+
+			lifetime := time.Hour
+			if api.tokenLifetime > 0 {
+				lifetime = api.tokenLifetime
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "token",
+				"token_type":   "Bearer",
+				"expires_in":   int(lifetime.Seconds()),
+			}))
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/authorized") {
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v2/device/"), "/authorized")
+			for i, device := range api.devices {
+				if device.ID == id {
+					api.devices[i].Authorized = true
+				}
+			}
+
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/routes") {
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v2/device/"), "/routes")
+			if api.routes[id] == nil {
+				api.routes[id] = &tailscale.DeviceRoutes{}
+			}
+
+			if r.Method == http.MethodPost {
+				var request map[string][]string
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				api.routes[id].Enabled = request["routes"]
+			}
+
+			assert.NoError(t, json.NewEncoder(w).Encode(api.routes[id]))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if strings.HasSuffix(r.URL.Path, "/acl") {
+				api.aclFetches++
+				assert.NoError(t, json.NewEncoder(w).Encode(tailscale.ACL{TagOwners: api.tagOwners}))
+				return
+			}
+
+			if strings.HasSuffix(r.URL.Path, "/keys") {
+				deleted := make(map[string]bool, len(api.deleted))
+				for _, id := range api.deleted {
+					deleted[id] = true
+				}
+
+				ids := make([]string, 0, api.created+len(api.keys))
+				for i := 1; i <= api.created; i++ {
+					ids = append(ids, fmt.Sprintf("key-%d", i))
+				}
+
+				for _, key := range api.keys {
+					ids = append(ids, key.ID)
+				}
+
+				// Keys are listed without their details, as they are by the Tailscale API.
+				keys := make([]tailscale.Key, 0, len(ids))
+				for _, id := range ids {
+					if !deleted[id] {
+						keys = append(keys, tailscale.Key{ID: id})
+					}
+				}
+
+				assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys}))
+				return
+			}
+
+			if strings.Contains(r.URL.Path, "/keys/") {
+				id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+				for _, key := range api.keys {
+					if key.ID == id {
+						assert.NoError(t, json.NewEncoder(w).Encode(key))
+						return
+					}
+				}
+
+				assert.NoError(t, json.NewEncoder(w).Encode(tailscale.Key{
+					ID:      r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:],
+					Expires: api.expires,
+				}))
+				return
+			}
+
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+				"devices": api.devices,
+			}))
+		case http.MethodPost:
+			var request tailscale.CreateKeyRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+			api.created++
+			api.requests = append(api.requests, request)
+			api.headers = append(api.headers, r.Header.Clone())
+
+			expiry := 90 * 24 * time.Hour
+			if request.ExpirySeconds > 0 {
+				expiry = time.Duration(request.ExpirySeconds) * time.Second
+			}
+
+			created := time.Now().UTC()
+			assert.NoError(t, json.NewEncoder(w).Encode(tailscale.Key{
+				ID:           fmt.Sprintf("key-%d", api.created),
+				Key:          fmt.Sprintf("secret-%d", api.created),
+				Description:  request.Description,
+				Created:      created,
+				Expires:      created.Add(expiry),
+				Capabilities: request.Capabilities,
+			}))
+		case http.MethodDelete:
+			api.deleted = append(api.deleted, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		}
+	})
+
+	return api
+}
+
+func TestBackend_IssuerTag(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		Config       map[string]interface{}
+		Tags         []string
+		ExpectedTags []string
+	}{
+		{
+			Name:         "It should add the default issuer tag",
+			Config:       map[string]interface{}{},
+			Tags:         []string{"tag:test"},
+			ExpectedTags: []string{"tag:test", "tag:vault"},
+		},
+		{
+			Name: "It should add a configured issuer tag",
+			Config: map[string]interface{}{
+				"issuer_tag": "tag:issuer",
+			},
+			ExpectedTags: []string{"tag:issuer"},
+		},
+		{
+			Name: "It should not duplicate a requested issuer tag",
+			Config: map[string]interface{}{
+				"issuer_tag": "tag:issuer",
+			},
+			Tags:         []string{"tag:issuer"},
+			ExpectedTags: []string{"tag:issuer"},
+		},
+		{
+			Name: "It should not add an issuer tag if disabled",
+			Config: map[string]interface{}{
+				"issuer_tag": "",
+			},
+			Tags:         []string{"tag:test"},
+			ExpectedTags: []string{"tag:test"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			config := map[string]interface{}{
+				"tailnet": "example",
+				"api_key": "example",
+				"api_url": "http://localhost:1337",
+			}
+			for k, v := range tc.Config {
+				config[k] = v
+			}
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data:      config,
+			})
+			require.NoError(t, err)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tags": tc.Tags,
+				},
+			})
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.ExpectedTags, response.Data["tags"])
+			assert.EqualValues(t, tc.ExpectedTags, api.Requests()[0].Capabilities.Devices.Create.Tags)
+		})
+	}
+}
+
+func TestBackend_ReadOnly(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	config := map[string]interface{}{
+		"tailnet": "example",
+		"api_key": "example",
+		"api_url": "http://localhost:1337",
+	}
+
+	_, err := request(logical.UpdateOperation, "config", config)
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "static-roles/test", nil)
+	require.NoError(t, err)
+
+	config["read_only"] = true
+	_, err = request(logical.UpdateOperation, "config", config)
+	require.NoError(t, err)
+
+	t.Run("It should refuse to generate keys", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", nil)
+		assert.ErrorIs(t, err, backend.ErrReadOnly)
+
+		_, err = request(logical.UpdateOperation, "rotate-role/test", nil)
+		assert.ErrorIs(t, err, backend.ErrReadOnly)
+		assert.Len(t, api.Requests(), 1)
+	})
+
+	t.Run("It should refuse to delete keys", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "static-roles/test", nil)
+		assert.ErrorIs(t, err, backend.ErrReadOnly)
+		assert.Empty(t, api.Deleted())
+	})
+
+	t.Run("It should continue to serve reads", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "static-creds/test", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "secret-1", response.Data["key"])
 	})
 }
@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	maxBatchSize = 100
+
+	batchCredsDescription     = "Generate one authentication key per host using the settings of a role"
+	batchHostnamesDescription = "The hostnames of the devices to generate keys for. Each key's description contains its hostname"
+
+	batchCredsHelpSynopsis    = "Generate one authentication key per host using a role."
+	batchCredsHelpDescription = `
+Generates one key for each of the given hostnames using the settings of the role, with
+each key's description containing its hostname. If any key cannot be generated, the keys
+already generated for the request are deleted.
+`
+)
+
+func (b *Backend) batchPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "creds/" + framework.GenericNameRegex("name") + "/batch$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: roleNameDescription,
+				},
+				"hostnames": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: batchHostnamesDescription,
+				},
+				"tags": {
+					Type:        framework.TypeStringSlice,
+					Description: roleCredsTagsDescription,
+				},
+				"pgp_key": {
+					Type:        framework.TypeString,
+					Description: pgpKeyDescription,
+				},
+				"retrieval_token": {
+					Type:        framework.TypeBool,
+					Description: retrievalDescription,
+				},
+				"metadata": {
+					Type:        framework.TypeKVPairs,
+					Description: metadataDescription,
+				},
+				"labels": {
+					Type:        framework.TypeKVPairs,
+					Description: labelsDescription,
+				},
+				"config": {
+					Type:        framework.TypeString,
+					Description: requestConfigDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.BatchRoleCreds,
+					Responses: okResponse(batchCredsDescription, batchResponseFields()),
+					Summary:   batchCredsDescription,
+				},
+			},
+			HelpSynopsis:    batchCredsHelpSynopsis,
+			HelpDescription: batchCredsHelpDescription,
+		},
+	}
+}
+
+// BatchRoleCreds generates one authentication key per hostname using the settings of a role, with each key's
+// description containing its hostname so that devices remain attributable. Each key is subject to the same checks as
+// those generated via the creds path. If any key cannot be generated, the keys already generated for the batch are
+// revoked and an error is returned.
+func (b *Backend) BatchRoleCreds(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	hostnames := data.Get("hostnames").([]string)
+	switch {
+	case len(hostnames) == 0:
+		return nil, errors.New("provided hostnames cannot be empty")
+	case len(hostnames) > maxBatchSize:
+		return nil, fmt.Errorf("provided hostnames cannot contain more than %d entries", maxBatchSize)
+	case len(strutil.RemoveDuplicates(hostnames, false)) != len(hostnames):
+		return nil, errors.New("provided hostnames cannot contain duplicates")
+	}
+
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	name := data.Get("name").(string)
+	role, err := b.role(ctx, request.Storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("role %q does not exist", name)
+	}
+
+	if err = role.checkBatch(); err != nil {
+		return nil, err
+	}
+
+	var (
+		keys     = make([]map[string]interface{}, 0, len(hostnames))
+		ids      = make([]string, 0, len(hostnames))
+		warnings []string
+	)
+
+	for _, hostname := range hostnames {
+		response, err := b.issueKey(ctx, request, data, config, role, hostname)
+		if err != nil {
+			b.revokeBatch(ctx, request.Storage, ids)
+			return nil, fmt.Errorf("failed to generate key for %q: %w", hostname, err)
+		}
+
+		// A response may only hold a single lease, so the keys of a batch are returned without one. Roles whose keys
+		// depend on their lease are refused by checkBatch.
+		response.Data["hostname"] = hostname
+		keys = append(keys, response.Data)
+		ids = append(ids, leasedKeyID(response))
+		for _, warning := range response.Warnings {
+			warnings = strutil.AppendIfMissing(warnings, warning)
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"keys": keys,
+		},
+		Warnings: warnings,
+	}, nil
+}
+
+// checkBatch returns an error if the role sets anything enforced through the lease of a key. The keys of a batch are
+// returned without a lease, so a ttl or max_ttl would never be enforced, the keys could not be reissued on renewal and
+// their devices would never be deleted on revocation.
+func (r *Role) checkBatch() error {
+	switch {
+	case r.TTL > 0, r.MaxTTL > 0:
+		return fmt.Errorf("role %q sets a ttl, which cannot be enforced for keys generated in a batch", r.Name)
+	case r.ReissueOnRenew:
+		return fmt.Errorf("role %q sets reissue_on_renew, which is not supported for keys generated in a batch", r.Name)
+	case r.DeleteDevices:
+		return fmt.Errorf("role %q sets delete_devices, which is not supported for keys generated in a batch", r.Name)
+	default:
+		return nil
+	}
+}
+
+// revokeBatch revokes the keys generated for a batch that could not be completed. Keys that cannot be deleted are
+// queued for deletion by the periodic function.
+func (b *Backend) revokeBatch(ctx context.Context, storage logical.Storage, ids []string) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+
+		if err := b.revokeKey(ctx, storage, id); err != nil {
+			b.Logger().Error("failed to revoke key of incomplete batch", "id", id, "error", err)
+			continue
+		}
+
+		b.markRevoked(ctx, storage, id, revokedReasonBatch)
+	}
+}
+
+func batchResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"keys": {
+			Type:        framework.TypeSlice,
+			Description: "The generated keys, each containing the same fields as a single generated key along with its hostname",
+		},
+	}
+}
@@ -0,0 +1,149 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_BatchRoleCreds(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"tags": []string{"tag:web"},
+	})
+	require.NoError(t, err)
+
+	for name, data := range map[string]map[string]interface{}{
+		"leased":   {"ttl": "1h"},
+		"capped":   {"max_ttl": "1h"},
+		"reissued": {"reissue_on_renew": true},
+		"devices":  {"delete_devices": true},
+	} {
+		_, err = request(logical.UpdateOperation, "roles/"+name, data)
+		require.NoError(t, err)
+	}
+
+	tt := []struct {
+		Name        string
+		Role        string
+		Hostnames   string
+		ExpectError bool
+	}{
+		{
+			Name:        "It should return an error if no hostnames are provided",
+			Role:        "web",
+			ExpectError: true,
+		},
+		{
+			Name:        "It should return an error if hostnames are duplicated",
+			Role:        "web",
+			Hostnames:   "web-1,web-1",
+			ExpectError: true,
+		},
+		{
+			Name:        "It should return an error if the role sets a ttl",
+			Role:        "leased",
+			Hostnames:   "web-1",
+			ExpectError: true,
+		},
+		{
+			Name:        "It should return an error if the role sets a max_ttl",
+			Role:        "capped",
+			Hostnames:   "web-1",
+			ExpectError: true,
+		},
+		{
+			Name:        "It should return an error if the role reissues keys on renewal",
+			Role:        "reissued",
+			Hostnames:   "web-1",
+			ExpectError: true,
+		},
+		{
+			Name:        "It should return an error if the role deletes devices on revocation",
+			Role:        "devices",
+			Hostnames:   "web-1",
+			ExpectError: true,
+		},
+		{
+			Name:        "It should return an error if the role does not exist",
+			Role:        "unknown",
+			Hostnames:   "web-1",
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := request(logical.UpdateOperation, "creds/"+tc.Role+"/batch", map[string]interface{}{
+				"hostnames": tc.Hostnames,
+			})
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("It should generate a key per hostname with the hostname in its description", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "creds/web/batch", map[string]interface{}{
+			"hostnames": "web-1,web-2.example.com",
+		})
+		require.NoError(t, err)
+
+		keys := response.Data["keys"].([]map[string]interface{})
+		require.Len(t, keys, 2)
+		assert.EqualValues(t, "web-1", keys[0]["hostname"])
+		assert.EqualValues(t, "key-1", keys[0]["id"])
+		assert.EqualValues(t, "web-2.example.com", keys[1]["hostname"])
+		assert.EqualValues(t, "key-2", keys[1]["id"])
+
+		requests := api.Requests()
+		require.Len(t, requests, 2)
+		assert.EqualValues(t, "web-1", withoutNonce(requests[0].Description))
+		assert.EqualValues(t, "web-2-example-com", withoutNonce(requests[1].Description))
+		assert.EqualValues(t, []string{"tag:web"}, requests[0].Capabilities.Devices.Create.Tags)
+	})
+}
+
+func TestBackend_DescriptionPrefix(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"tailnet":            "example",
+		"api_key":            "example",
+		"api_url":            "http://localhost:1337",
+		"description_prefix": "prod-vault",
+	})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"tags": []string{"tag:web"},
+	})
+	require.NoError(t, err)
+
+	t.Run("It should prefix the description of every key", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+
+		_, err = request(logical.UpdateOperation, "creds/web/batch", map[string]interface{}{
+			"hostnames": "web-1",
+		})
+		require.NoError(t, err)
+
+		requests := api.Requests()
+		require.Len(t, requests, 2)
+		assert.EqualValues(t, "prod-vault", withoutNonce(requests[0].Description))
+		assert.EqualValues(t, "prod-vault web-1", withoutNonce(requests[1].Description))
+	})
+}
@@ -0,0 +1,178 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	controlPlaneTailscale = "tailscale"
+	controlPlaneHeadscale = "headscale"
+	controlPlaneUnknown   = "unknown"
+
+	authAPIKey = "api_key"
+	authOAuth  = "oauth"
+
+	readCapabilitiesDescription = "Report the control plane and authentication in use and which features are usable on this mount"
+
+	capabilitiesHelpSynopsis    = "Report which features are usable on this mount."
+	capabilitiesHelpDescription = `
+Probes the configured control plane and reports whether it is Tailscale or Headscale,
+how the mount authenticates and whether each optional feature is available. Features
+that are unavailable include the error returned when probing them.
+`
+)
+
+func (b *Backend) capabilitiesPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "capabilities$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadCapabilities,
+					Responses: okResponse(readCapabilitiesDescription, capabilitiesResponseFields()),
+					Summary:   readCapabilitiesDescription,
+				},
+			},
+			HelpSynopsis:    capabilitiesHelpSynopsis,
+			HelpDescription: capabilitiesHelpDescription,
+		},
+	}
+}
+
+// ReadCapabilities probes the configured API and reports which features of the Backend are usable, so that tooling can
+// adapt rather than failing on unsupported endpoints. Each feature is probed using a read-only request, and the error
+// returned by the API is included for features that are unavailable. The control plane is reported as headscale when
+// the Tailscale API is not served but the API URL responds to Headscale's health check.
+func (b *Backend) ReadCapabilities(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	logQuery := url.Values{}
+	logQuery.Set("start", now.Add(-time.Minute).Format(time.RFC3339))
+	logQuery.Set("end", now.Format(time.RFC3339))
+
+	probes := map[string]func() error{
+		"devices": func() error {
+			_, err := client.Devices(ctx)
+			return err
+		},
+		"tag_validation": func() error {
+			_, err := client.ACL(ctx)
+			return err
+		},
+		"configuration_log": func() error {
+			return b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("logging", "configuration"), logQuery, nil, nil)
+		},
+		"tailnet_settings": func() error {
+			return b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("settings"), nil, nil, nil)
+		},
+		"tailnet_contacts": func() error {
+			return b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("contacts"), nil, nil, nil)
+		},
+		"user_invites": func() error {
+			return b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("user-invites"), nil, nil, nil)
+		},
+		"vip_services": func() error {
+			return b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("vip-services"), nil, nil, nil)
+		},
+	}
+
+	features := make(map[string]interface{}, len(probes)+1)
+	for name, probe := range probes {
+		feature := map[string]interface{}{"available": true}
+		if err = probe(); err != nil {
+			feature["available"] = false
+			feature["error"] = err.Error()
+		}
+
+		features[name] = feature
+	}
+
+	// The expiry of OAuth client credentials cannot be read, so it is only tracked for API keys.
+	features["api_key_expiry"] = map[string]interface{}{
+		"available": config.OAuthClientID == "" && apiKeyID(config.APIKey) != "",
+	}
+
+	auth := authAPIKey
+	if config.OAuthClientID != "" {
+		auth = authOAuth
+	}
+
+	controlPlane := controlPlaneTailscale
+	if devices := features["devices"].(map[string]interface{}); !devices["available"].(bool) {
+		controlPlane = b.probeControlPlane(ctx, config)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"control_plane": controlPlane,
+			"auth":          auth,
+			"read_only":     config.ReadOnly,
+			"features":      features,
+		},
+	}, nil
+}
+
+// probeControlPlane returns headscale if the configured API URL responds to Headscale's health check, or unknown
+// otherwise.
+func (b *Backend) probeControlPlane(ctx context.Context, config Config) string {
+	base, err := url.Parse(config.APIUrl)
+	if err != nil {
+		return controlPlaneUnknown
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.JoinPath("health").String(), nil)
+	if err != nil {
+		return controlPlaneUnknown
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return controlPlaneUnknown
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return controlPlaneUnknown
+	}
+
+	return controlPlaneHeadscale
+}
+
+func capabilitiesResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"control_plane": {
+			Type:        framework.TypeString,
+			Description: "The control plane in use, either tailscale, headscale or unknown",
+		},
+		"auth": {
+			Type:        framework.TypeString,
+			Description: "How the mount authenticates with the API, either api_key or oauth",
+		},
+		"read_only": {
+			Type:        framework.TypeBool,
+			Description: readOnlyDescription,
+		},
+		"features": {
+			Type:        framework.TypeMap,
+			Description: "Whether each feature is available, along with the error returned when probing unavailable features",
+		},
+	}
+}
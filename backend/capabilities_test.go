@@ -0,0 +1,79 @@
+package backend_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_ReadCapabilities(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	read := func(t *testing.T) map[string]interface{} {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "capabilities",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		return response.Data
+	}
+
+	t.Run("It should report features served by the API as available", func(t *testing.T) {
+		data := read(t)
+		assert.EqualValues(t, "tailscale", data["control_plane"])
+		assert.EqualValues(t, "api_key", data["auth"])
+
+		features := data["features"].(map[string]interface{})
+		for _, name := range []string{"devices", "tag_validation", "tailnet_settings", "vip_services"} {
+			assert.EqualValues(t, true, features[name].(map[string]interface{})["available"], name)
+		}
+
+		assert.EqualValues(t, false, features["api_key_expiry"].(map[string]interface{})["available"])
+	})
+
+	t.Run("It should report features as unavailable when the API fails", func(t *testing.T) {
+		api.SetFailing(true)
+		defer api.SetFailing(false)
+
+		data := read(t)
+		assert.EqualValues(t, "unknown", data["control_plane"])
+
+		vip := data["features"].(map[string]interface{})["vip_services"].(map[string]interface{})
+		assert.EqualValues(t, false, vip["available"])
+		assert.NotEmpty(t, vip["error"])
+	})
+}
+
+func TestBackend_ReadCapabilitiesHeadscale(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	t.Run("It should detect a Headscale control plane", func(t *testing.T) {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "capabilities",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, "headscale", response.Data["control_plane"])
+	})
+}
@@ -0,0 +1,263 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// defaultKeyExpiry is the expiry the Tailscale API gives keys generated without one.
+	defaultKeyExpiry = 90 * 24 * time.Hour
+
+	checkKeyDescription  = "Check whether a key would be generated for the request, without generating it"
+	checkRoleDescription = "The name of the role the key would be generated using. Defaults to the role applied by the key path"
+
+	checkHelpSynopsis    = "Check whether a key would be generated, without generating it."
+	checkHelpDescription = `
+Evaluates a request against the same checks as generating a key, including the role,
+tags, policy, issuance windows and device limit, without generating a key. If the
+request would be refused, allowed is false and the reason is returned instead of an
+error.
+`
+)
+
+func (b *Backend) checkPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "check",
+			Fields: map[string]*framework.FieldSchema{
+				"role": {
+					Type:        framework.TypeString,
+					Description: checkRoleDescription,
+				},
+				"tags": {
+					Type:        framework.TypeStringSlice,
+					Description: tagsDescription,
+				},
+				"preauthorized": {
+					Type:        framework.TypeBool,
+					Description: preauthorizedDescription,
+				},
+				"ephemeral": {
+					Type:        framework.TypeBool,
+					Description: ephemeralDescription,
+				},
+				"pgp_key": {
+					Type:        framework.TypeString,
+					Description: pgpKeyDescription,
+				},
+				"retrieval_token": {
+					Type:        framework.TypeBool,
+					Description: retrievalDescription,
+				},
+				"metadata": {
+					Type:        framework.TypeKVPairs,
+					Description: metadataDescription,
+				},
+				"labels": {
+					Type:        framework.TypeKVPairs,
+					Description: labelsDescription,
+				},
+				"expiry": {
+					Type:        framework.TypeDurationSecond,
+					Description: expiryDescription,
+				},
+				"config": {
+					Type:        framework.TypeString,
+					Description: requestConfigDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.CheckKey,
+					Responses: okResponse(checkKeyDescription, checkResponseFields()),
+					Summary:   checkKeyDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.CheckKey,
+					Responses: okResponse(checkKeyDescription, checkResponseFields()),
+					Summary:   checkKeyDescription,
+				},
+			},
+			HelpSynopsis:    checkHelpSynopsis,
+			HelpDescription: checkHelpDescription,
+		},
+	}
+}
+
+// CheckKey returns whether a key would be generated for the request and, if so, the tags, expiry and other settings
+// it would have. The request is checked as it would be by the key and creds paths, including against the role's
+// issuance windows and policy, the group tag mappings and the tailnet policy, but nothing is generated or recorded and
+// the approval webhook is not called. A request that would be refused is not an error, the reason is returned instead.
+func (b *Backend) CheckKey(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := b.checkedRole(ctx, request.Storage, config, data.Get("role").(string))
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if role, err = role.withRequestedConfig(data); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if config, err = b.roleConfig(ctx, request.Storage, config, role); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if err = b.checkDisabled(ctx, request.Storage); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if err = b.checkDeviceLimit(ctx, config); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if _, err = parseMetadata(data); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if _, err = parseLabels(data); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if value, ok := data.GetOk("pgp_key"); ok && value.(string) != "" {
+		if _, err = parsePGPKey(value.(string)); err != nil {
+			return deniedResponse(fmt.Errorf("provided pgp_key is invalid: %w", err)), nil
+		}
+	}
+
+	role, err = b.templateRole(request, role)
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if err = role.checkWrapping(request); err != nil {
+		return deniedResponse(err), nil
+	}
+
+	capabilities, err := role.capabilities(data)
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	expiry, err := role.expiry(data)
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	capabilities, err = b.resolveCapabilities(ctx, request, config, role, capabilities, expiry)
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	tags, err := b.keyTags(ctx, config, capabilities.Devices.Create.Tags)
+	if err != nil {
+		return deniedResponse(err), nil
+	}
+
+	if expiry == 0 {
+		expiry = defaultKeyExpiry
+	}
+
+	retrieval := role.RetrievalToken
+	if value, ok := data.GetOk("retrieval_token"); ok {
+		retrieval = retrieval || value.(bool)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed":           true,
+			"role":              role.Name,
+			"tags":              tags,
+			"ephemeral":         capabilities.Devices.Create.Ephemeral,
+			"preauthorized":     capabilities.Devices.Create.Preauthorized,
+			"reusable":          capabilities.Devices.Create.Reusable,
+			"expiry_seconds":    int64(expiry.Seconds()),
+			"requires_approval": role.RequireApproval,
+			"retrieval_token":   retrieval,
+		},
+	}, nil
+}
+
+// checkedRole returns the named role, or the role applied by the key path if no name is given.
+func (b *Backend) checkedRole(ctx context.Context, storage logical.Storage, config Config, name string) (*Role, error) {
+	if name == "" {
+		return b.defaultRole(ctx, storage, config)
+	}
+
+	role, err := b.role(ctx, storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("role %q does not exist", name)
+	}
+
+	return role, nil
+}
+
+func deniedResponse(err error) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed": false,
+			"reason":  err.Error(),
+		},
+	}
+}
+
+func checkResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"allowed": {
+			Type:        framework.TypeBool,
+			Description: "Whether a key would be generated for the request",
+		},
+		"reason": {
+			Type:        framework.TypeString,
+			Description: "Why a key would not be generated for the request",
+		},
+		"role": {
+			Type:        framework.TypeString,
+			Description: "The name of the role the key would be generated using",
+		},
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: "The tags the key would be generated with",
+		},
+		"ephemeral": {
+			Type:        framework.TypeBool,
+			Description: ephemeralDescription,
+		},
+		"preauthorized": {
+			Type:        framework.TypeBool,
+			Description: preauthorizedDescription,
+		},
+		"reusable": {
+			Type:        framework.TypeBool,
+			Description: "Whether the key would be reusable",
+		},
+		"expiry_seconds": {
+			Type:        framework.TypeInt64,
+			Description: "How long the key would be valid for, in seconds",
+		},
+		"requires_approval": {
+			Type:        framework.TypeBool,
+			Description: roleRequireApprovalDescription,
+		},
+		"retrieval_token": {
+			Type:        framework.TypeBool,
+			Description: "Whether the key would only be returned via a retrieval token",
+		},
+	}
+}
@@ -0,0 +1,103 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_CheckKey(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/ci",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"tags":             []string{"tag:ci"},
+			"policy":           `!preauthorized`,
+			"require_approval": true,
+		},
+	})
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name           string
+		Data           map[string]interface{}
+		ExpectsAllowed bool
+		ExpectedReason string
+		Expected       map[string]interface{}
+	}{
+		{
+			Name:           "It should return the settings of a key generated using a role",
+			Data:           map[string]interface{}{"role": "ci", "ephemeral": true},
+			ExpectsAllowed: true,
+			Expected: map[string]interface{}{
+				"role":              "ci",
+				"tags":              []string{"tag:ci"},
+				"ephemeral":         true,
+				"preauthorized":     false,
+				"requires_approval": true,
+				"expiry_seconds":    int64(7776000),
+			},
+		},
+		{
+			Name:           "It should return the settings of a key generated using the key path",
+			Data:           map[string]interface{}{"tags": []string{"tag:server"}, "retrieval_token": true},
+			ExpectsAllowed: true,
+			Expected: map[string]interface{}{
+				"role":            "",
+				"tags":            []string{"tag:server"},
+				"retrieval_token": true,
+			},
+		},
+		{
+			Name:           "It should deny a request the role's policy does not allow",
+			Data:           map[string]interface{}{"role": "ci", "preauthorized": true},
+			ExpectedReason: "policy",
+		},
+		{
+			Name:           "It should deny a request for a role that does not exist",
+			Data:           map[string]interface{}{"role": "missing"},
+			ExpectedReason: `role "missing" does not exist`,
+		},
+		{
+			Name:           "It should deny a request with an invalid pgp key",
+			Data:           map[string]interface{}{"pgp_key": "invalid"},
+			ExpectedReason: "provided pgp_key is invalid",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "check",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			require.NoError(t, err)
+			require.NotNil(t, response)
+
+			assert.EqualValues(t, tc.ExpectsAllowed, response.Data["allowed"])
+			if !tc.ExpectsAllowed {
+				assert.Contains(t, response.Data["reason"], tc.ExpectedReason)
+				return
+			}
+
+			for key, value := range tc.Expected {
+				assert.EqualValues(t, value, response.Data[key], key)
+			}
+		})
+	}
+
+	t.Run("It should not generate keys or call the approval webhook", func(t *testing.T) {
+		assert.Empty(t, api.Requests())
+	})
+}
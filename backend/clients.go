@@ -0,0 +1,212 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+type (
+	// The clientCache type holds the clients used to call the Tailscale API, so that OAuth access tokens and
+	// connections are reused across requests rather than created for each one. Vault creates a Backend for each mount,
+	// in each namespace, so the cache is never shared between mounts. The clients are only reused while the
+	// credentials they were created with match the configuration.
+	clientCache struct {
+		credentials clientCredentials
+		transport   *limitedTransport
+		tailscale   *tailscale.Client
+		http        *http.Client
+		tokens      oauth2.TokenSource
+	}
+
+	// The clientCredentials type contains the fields of the Config that determine how the Tailscale API is called and
+	// how connections to it are made.
+	clientCredentials struct {
+		tailnet           string
+		apiURL            string
+		apiKey            string
+		oauthClientID     string
+		oauthClientSecret string
+		apiAddresses      string
+		apiResolver       string
+		refreshMargin     time.Duration
+	}
+)
+
+const (
+	defaultOAuthRefreshMargin = time.Minute
+	maxOAuthRefreshMargin     = 30 * time.Minute
+)
+
+// newClient returns a client for the Tailscale API using the configured credentials, reusing the cached client if the
+// credentials have not changed. When using an OAuth client, the returned client is authenticated using the current
+// access token, which is shared with apiRequest.
+func (b *Backend) newClient(config Config) (*tailscale.Client, error) {
+	clients, err := b.clients(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if clients.tokens == nil {
+		return clients.tailscale, nil
+	}
+
+	token, err := clients.tokens.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain an access token for the oauth client: %w", err)
+	}
+
+	// Access tokens are accepted by the Tailscale API in place of an API key.
+	return tailscale.NewClient(
+		token.AccessToken,
+		config.Tailnet,
+		tailscale.WithBaseURL(config.APIUrl),
+		withHTTPClient(clients.transport.client()),
+	)
+}
+
+// httpClient returns the HTTP client used by apiRequest. When using an OAuth client, requests made with it are
+// authenticated using an access token that is refreshed as it expires.
+func (b *Backend) httpClient(config Config) (*http.Client, error) {
+	clients, err := b.clients(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return clients.http, nil
+}
+
+func (b *Backend) clients(config Config) (*clientCache, error) {
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+
+	credentials := config.credentials()
+	if b.clientCache != nil && b.clientCache.credentials == credentials {
+		return b.clientCache, nil
+	}
+
+	transport, err := newAPITransport(config, &b.apiErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	// Idle connections to the API may have been made to addresses that no longer apply.
+	if b.clientCache != nil {
+		b.clientCache.transport.CloseIdleConnections()
+	}
+
+	clients := &clientCache{
+		credentials: credentials,
+		transport:   transport,
+		http:        transport.client(),
+	}
+
+	if config.OAuthClientID == "" {
+		client, err := tailscale.NewClient(
+			config.APIKey,
+			config.Tailnet,
+			tailscale.WithBaseURL(config.APIUrl),
+			withHTTPClient(transport.client()),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		clients.tailscale = client
+		b.clientCache = clients
+		return clients, nil
+	}
+
+	base, err := url.Parse(config.APIUrl)
+	if err != nil {
+		return nil, fmt.Errorf("configured api_url is invalid: %w", err)
+	}
+
+	oauth := clientcredentials.Config{
+		ClientID:     config.OAuthClientID,
+		ClientSecret: config.OAuthClientSecret,
+		TokenURL:     base.JoinPath("api", "v2", "oauth", "token").String(),
+	}
+
+	// The access token is refreshed once it is within the refresh margin of expiring, rather than once requests using
+	// it begin to fail. Concurrent requests wait for a single refresh. The background context is used as the token is
+	// refreshed long after the request that created the token source. Both the token exchange and the requests
+	// authenticated with the token are made using the transport for the Tailscale API.
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, transport.client())
+	clients.tokens = oauth2.ReuseTokenSourceWithExpiry(nil, oauth.TokenSource(ctx), config.oauthRefreshMargin())
+	clients.http = oauth2.NewClient(ctx, clients.tokens)
+	clients.http.Timeout = apiTimeout
+
+	b.clientCache = clients
+	return clients, nil
+}
+
+// flushClients discards the cached clients, along with any OAuth access tokens they hold.
+func (b *Backend) flushClients() {
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+
+	if b.clientCache != nil {
+		b.clientCache.transport.CloseIdleConnections()
+	}
+
+	b.clientCache = nil
+}
+
+// invalidate discards the cached clients, tailnet policy and device count when the configuration is modified,
+// including by another node of the Vault cluster.
+func (b *Backend) invalidate(_ context.Context, key string) {
+	if key == configPath {
+		b.flushClients()
+		b.flushACL()
+		b.flushDeviceCount()
+	}
+}
+
+// withHTTPClient sets the HTTP client used by the client library for the Tailscale API, which otherwise uses the
+// default transport of the process. The version of the library in use has no option to provide a client, so the
+// unexported field holding it is set directly. An error is returned if the field no longer exists.
+func withHTTPClient(client *http.Client) tailscale.ClientOption {
+	return func(c *tailscale.Client) error {
+		field := reflect.ValueOf(c).Elem().FieldByName("http")
+		if !field.IsValid() || field.Type() != reflect.TypeOf(client) {
+			return errors.New("the tailscale client does not support a custom http client")
+		}
+
+		reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(client))
+		return nil
+	}
+}
+
+func (c Config) credentials() clientCredentials {
+	return clientCredentials{
+		tailnet:           c.Tailnet,
+		apiURL:            c.APIUrl,
+		apiKey:            c.APIKey,
+		oauthClientID:     c.OAuthClientID,
+		oauthClientSecret: c.OAuthClientSecret,
+		apiAddresses:      strings.Join(c.APIAddresses, ","),
+		apiResolver:       c.APIResolver,
+		refreshMargin:     c.oauthRefreshMargin(),
+	}
+}
+
+// oauthRefreshMargin returns how long before it expires the OAuth access token is refreshed, using the default if no
+// margin is configured.
+func (c Config) oauthRefreshMargin() time.Duration {
+	if c.OAuthRefreshMargin <= 0 {
+		return defaultOAuthRefreshMargin
+	}
+
+	return c.OAuthRefreshMargin
+}
@@ -0,0 +1,146 @@
+package backend_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_ClientCache(t *testing.T) {
+	ctx, b := setup(t)
+	_, other := setup(t)
+
+	api := mockKeysAPI(t)
+
+	configure := func(t *testing.T, b *backend.Backend, storage logical.Storage) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"tailnet":             "example",
+				"api_url":             "http://localhost:1337",
+				"issuer_tag":          "",
+				"oauth_client_id":     "client",
+				"oauth_client_secret": "secret",
+				"oauth_tags":          "tag:ci",
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	issue := func(t *testing.T, b *backend.Backend, storage logical.Storage) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": []string{"tag:ci"}},
+		})
+		require.NoError(t, err)
+	}
+
+	storage := &logical.InmemStorage{}
+	configure(t, b, storage)
+
+	t.Run("It should reuse the OAuth access token across requests", func(t *testing.T) {
+		issue(t, b, storage)
+		issue(t, b, storage)
+		assert.EqualValues(t, 1, api.TokenFetches())
+	})
+
+	t.Run("It should discard the access token when the configuration is invalidated", func(t *testing.T) {
+		b.InvalidateKey(context.Background(), "config")
+
+		issue(t, b, storage)
+		assert.EqualValues(t, 2, api.TokenFetches())
+	})
+
+	t.Run("It should not share access tokens between mounts", func(t *testing.T) {
+		otherStorage := &logical.InmemStorage{}
+		configure(t, other, otherStorage)
+
+		issue(t, other, otherStorage)
+		assert.EqualValues(t, 3, api.TokenFetches())
+	})
+}
+
+func TestBackend_OAuthRefreshMargin(t *testing.T) {
+	ctx, b := setup(t)
+
+	api := mockKeysAPI(t)
+	api.SetTokenLifetime(2 * time.Minute)
+
+	storage := &logical.InmemStorage{}
+
+	configure := func(t *testing.T, margin string) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"tailnet":              "example",
+				"api_url":              "http://localhost:1337",
+				"issuer_tag":           "",
+				"oauth_client_id":      "client",
+				"oauth_client_secret":  "secret",
+				"oauth_tags":           "tag:ci",
+				"oauth_refresh_margin": margin,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	issue := func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": []string{"tag:ci"}},
+		})
+		assert.NoError(t, err)
+	}
+
+	t.Run("It should reuse an access token that is not within the refresh margin", func(t *testing.T) {
+		configure(t, "30s")
+		before := api.TokenFetches()
+
+		issue(t)
+		issue(t)
+		assert.EqualValues(t, before+1, api.TokenFetches())
+	})
+
+	t.Run("It should refresh an access token that is within the refresh margin", func(t *testing.T) {
+		configure(t, "5m")
+		before := api.TokenFetches()
+
+		issue(t)
+		first := api.TokenFetches()
+		issue(t)
+		assert.Greater(t, first, before)
+		assert.Greater(t, api.TokenFetches(), first)
+	})
+
+	t.Run("It should refresh the access token once for concurrent requests", func(t *testing.T) {
+		configure(t, "30s")
+		before := api.TokenFetches()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				issue(t)
+			}()
+		}
+
+		wg.Wait()
+		assert.EqualValues(t, before+1, api.TokenFetches())
+	})
+}
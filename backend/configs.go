@@ -0,0 +1,308 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	namedConfigPrefix = "configs/"
+
+	listConfigsDescription       = "List the names of all named configurations"
+	readNamedConfigDescription   = "Read a named configuration"
+	updateNamedConfigDescription = "Create or update a named configuration"
+	deleteNamedConfigDescription = "Delete a named configuration"
+	namedConfigNameDescription   = "The name of the configuration"
+
+	listConfigsHelpSynopsis    = "List the names of all named configurations."
+	listConfigsHelpDescription = `
+Lists the names of the configurations that roles can use in place of the configuration
+of the mount.
+`
+	namedConfigHelpSynopsis    = "Manage configurations for other tailnets."
+	namedConfigHelpDescription = `
+Named configurations take the same fields as the configuration of the mount, so that one
+mount can generate keys for several tailnets. Roles whose config field names a
+configuration generate their keys using its tailnet, credentials and settings instead
+of those of the mount. The OAuth client secret is not returned when it is read.
+`
+)
+
+func (b *Backend) namedConfigPaths() []*framework.Path {
+	fields := configFields()
+	fields["name"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: namedConfigNameDescription,
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: "configs/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListNamedConfigs,
+					Responses: listResponse(listConfigsDescription),
+					Summary:   listConfigsDescription,
+				},
+			},
+			HelpSynopsis:    listConfigsHelpSynopsis,
+			HelpDescription: listConfigsHelpDescription,
+		},
+		{
+			Pattern: "configs/" + framework.GenericNameRegex("name"),
+			Fields:  fields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadNamedConfig,
+					Responses: okResponse(readNamedConfigDescription, configResponseFields()),
+					Summary:   readNamedConfigDescription,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback:  b.UpdateNamedConfig,
+					Responses: noContentResponse(),
+					Summary:   updateNamedConfigDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateNamedConfig,
+					Responses: noContentResponse(),
+					Summary:   updateNamedConfigDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteNamedConfig,
+					Responses: noContentResponse(),
+					Summary:   deleteNamedConfigDescription,
+				},
+			},
+			ExistenceCheck:  b.namedConfigExists,
+			HelpSynopsis:    namedConfigHelpSynopsis,
+			HelpDescription: namedConfigHelpDescription,
+		},
+	}
+}
+
+// ListNamedConfigs returns the names of all named configurations.
+func (b *Backend) ListNamedConfigs(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	names, err := request.Storage.List(ctx, namedConfigPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+// ReadNamedConfig returns the values of a named configuration.
+func (b *Backend) ReadNamedConfig(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.namedConfig(ctx, request.Storage, data.Get("name").(string))
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return configResponse(*config), nil
+}
+
+// namedConfigExists returns true if the named configuration exists, so that writes to a new configuration are create
+// operations and writes to an existing configuration are update operations.
+func (b *Backend) namedConfigExists(ctx context.Context, request *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.namedConfig(ctx, request.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return config != nil, nil
+}
+
+// UpdateNamedConfig creates or modifies a named configuration. When modifying an existing configuration, any fields not
+// provided retain their values. Returns an error if any required fields are missing.
+func (b *Backend) UpdateNamedConfig(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	existing, err := b.namedConfig(ctx, request.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := parseConfig(data, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := logical.StorageEntryJSON(namedConfigPrefix+data.Get("name").(string), config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteNamedConfig removes a named configuration. Returns an error while the configuration is in use, as keys could no
+// longer be generated using the roles that name it, nor deleted from its tailnet once generated.
+func (b *Backend) DeleteNamedConfig(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if err := b.checkConfigUnused(ctx, request.Storage, name); err != nil {
+		return nil, err
+	}
+
+	if err := request.Storage.Delete(ctx, namedConfigPrefix+name); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// checkConfigUnused returns an error if a role names the configuration in its config or allowed_configs, or a key
+// generated using it has neither expired nor been revoked, or is still waiting to be deleted from its tailnet.
+func (b *Backend) checkConfigUnused(ctx context.Context, storage logical.Storage, name string) error {
+	roles, err := storage.List(ctx, rolePrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, roleName := range roles {
+		role, err := b.role(ctx, storage, roleName)
+		switch {
+		case err != nil:
+			return err
+		case role == nil:
+			continue
+		case role.Config == name, strutil.StrListContains(role.AllowedConfigs, name):
+			return fmt.Errorf("configuration %q is used by role %q", name, role.Name)
+		}
+	}
+
+	ids, err := storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, storage, id)
+		switch {
+		case err != nil:
+			return err
+		case issued == nil, issued.Config != name, !issued.Revoked.IsZero():
+			continue
+		case issued.Expires.IsZero() || now.Before(issued.Expires):
+			return fmt.Errorf("configuration %q is used by outstanding key %q", name, id)
+		}
+	}
+
+	pending, err := storage.List(ctx, pendingRevocationPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range pending {
+		revocation, err := b.pendingRevocation(ctx, storage, id)
+		switch {
+		case err != nil:
+			return err
+		case revocation == nil:
+			continue
+		}
+
+		// Revocations queued without a configuration are retried using that of the record of the key.
+		configName := revocation.Config
+		if configName == "" {
+			issued, err := b.issuedKey(ctx, storage, id)
+			if err != nil {
+				return err
+			}
+			if issued != nil {
+				configName = issued.Config
+			}
+		}
+
+		if configName == name {
+			return fmt.Errorf("configuration %q is used by key %q, which is waiting to be revoked", name, id)
+		}
+	}
+
+	return nil
+}
+
+// roleConfig returns the configuration keys generated using the role are generated with. This is the named
+// configuration of the role if it has one, otherwise the given configuration of the mount. Returns an error if the
+// named configuration does not exist.
+func (b *Backend) roleConfig(ctx context.Context, storage logical.Storage, config Config, role *Role) (Config, error) {
+	if role.Config == "" {
+		return config, nil
+	}
+
+	named, err := b.namedConfig(ctx, storage, role.Config)
+	switch {
+	case err != nil:
+		return Config{}, err
+	case named == nil:
+		return Config{}, fmt.Errorf("configuration %q of role %q does not exist", role.Config, role.Name)
+	}
+
+	return *named, nil
+}
+
+// keyConfig returns the configuration of the tailnet a key was generated in. This is the named configuration of the
+// role it was generated using, if any, otherwise the configuration of the mount.
+func (b *Backend) keyConfig(ctx context.Context, storage logical.Storage, id string) (Config, error) {
+	issued, err := b.issuedKey(ctx, storage, id)
+	switch {
+	case err != nil:
+		return Config{}, err
+	case issued == nil, issued.Config == "":
+		return b.config(ctx, storage)
+	}
+
+	named, err := b.namedConfig(ctx, storage, issued.Config)
+	switch {
+	case err != nil:
+		return Config{}, err
+	case named == nil:
+		return Config{}, fmt.Errorf("configuration %q of key %q does not exist", issued.Config, id)
+	}
+
+	return *named, nil
+}
+
+// revocationConfig returns the configuration of the tailnet a key is deleted from. This is the named configuration if
+// one is given, otherwise the configuration of the tailnet the key was recorded as being generated in.
+func (b *Backend) revocationConfig(ctx context.Context, storage logical.Storage, configName, id string) (Config, error) {
+	if configName == "" {
+		return b.keyConfig(ctx, storage, id)
+	}
+
+	named, err := b.namedConfig(ctx, storage, configName)
+	switch {
+	case err != nil:
+		return Config{}, err
+	case named == nil:
+		return Config{}, fmt.Errorf("configuration %q of key %q does not exist", configName, id)
+	}
+
+	return *named, nil
+}
+
+func (b *Backend) namedConfig(ctx context.Context, storage logical.Storage, name string) (*Config, error) {
+	entry, err := storage.Get(ctx, namedConfigPrefix+name)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config Config
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
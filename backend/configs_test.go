@@ -0,0 +1,167 @@
+package backend_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_NamedConfigs(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should store a named configuration", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "configs/other", map[string]interface{}{
+			"tailnet": "other",
+			"api_key": "other-key",
+			"api_url": "http://localhost:1337",
+		})
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "configs/other", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "other", response.Data["tailnet"])
+
+		response, err = request(logical.ListOperation, "configs/", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"other"}, response.Data["keys"])
+	})
+
+	t.Run("It should return an error if a role names a configuration that does not exist", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "roles/other", map[string]interface{}{"config": "missing"})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should generate keys using the configuration of the role", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "roles/other", map[string]interface{}{
+			"tags":   "tag:ci",
+			"config": "other",
+		})
+		require.NoError(t, err)
+
+		_, err = request(logical.ReadOperation, "creds/other", nil)
+		require.NoError(t, err)
+
+		headers := api.Headers()
+		require.Len(t, headers, 1)
+
+		username, _, ok := (&http.Request{Header: headers[0]}).BasicAuth()
+		require.True(t, ok)
+		assert.EqualValues(t, "other-key", username)
+	})
+
+	t.Run("It should not delete a named configuration used by a role", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "configs/other", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should not delete a named configuration used by an outstanding key", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "roles/other", nil)
+		require.NoError(t, err)
+
+		_, err = request(logical.DeleteOperation, "configs/other", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should delete a named configuration", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "issued-keys/revoke", map[string]interface{}{"role": "other"})
+		require.NoError(t, err)
+
+		_, err = request(logical.DeleteOperation, "configs/other", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "configs/other", nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+}
+
+func TestBackend_AllowedConfigs(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	for _, name := range []string{"staging", "production"} {
+		_, err := request(logical.UpdateOperation, "configs/"+name, map[string]interface{}{
+			"tailnet": name,
+			"api_key": name + "-key",
+			"api_url": "http://localhost:1337",
+		})
+		require.NoError(t, err)
+	}
+
+	tt := []struct {
+		Name string
+		Data map[string]interface{}
+	}{
+		{
+			Name: "It should return an error if an allowed configuration does not exist",
+			Data: map[string]interface{}{"allowed_configs": "staging,missing"},
+		},
+		{
+			Name: "It should return an error if the configuration of the role is not allowed",
+			Data: map[string]interface{}{"config": "production", "allowed_configs": "staging"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := request(logical.UpdateOperation, "roles/invalid", tc.Data)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := request(logical.UpdateOperation, "roles/deploy", map[string]interface{}{
+		"tags":            "tag:deploy",
+		"config":          "staging",
+		"allowed_configs": "staging,production",
+	})
+	require.NoError(t, err)
+
+	t.Run("It should not delete a named configuration allowed by a role", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "configs/production", nil)
+		assert.Error(t, err)
+	})
+
+	username := func(t *testing.T) string {
+		t.Helper()
+
+		headers := api.Headers()
+		require.NotEmpty(t, headers)
+
+		username, _, ok := (&http.Request{Header: headers[len(headers)-1]}).BasicAuth()
+		require.True(t, ok)
+
+		return username
+	}
+
+	t.Run("It should generate keys using the configuration of the role by default", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "creds/deploy", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "staging-key", username(t))
+	})
+
+	t.Run("It should generate keys using an allowed configuration chosen by the request", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/deploy", map[string]interface{}{"config": "production"})
+		require.NoError(t, err)
+		assert.EqualValues(t, "production-key", username(t))
+		assert.EqualValues(t, "production", response.Secret.InternalData["config"])
+	})
+
+	t.Run("It should return an error if the chosen configuration is not allowed", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "creds/deploy", map[string]interface{}{"config": "other"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The correlation type contains the identifiers of the Vault request being handled, which are sent to the Tailscale
+	// API with each request made while handling it. This allows events in the tailnet, such as the creation of a key,
+	// to be tied back to the Vault request that caused them.
+	correlation struct {
+		requestID  string
+		entityHash string
+		logger     hclog.Logger
+	}
+
+	correlationKey struct{}
+)
+
+const (
+	requestIDHeader  = "X-Vault-Tailscale-Request-Id"
+	entityHashHeader = "X-Vault-Tailscale-Entity-Hash"
+)
+
+// HandleRequest handles a request from Vault, forwarding its identifiers to the Tailscale API with each request made
+// while handling it. Any errors returned by the API while handling it are then added to the usage counters.
+func (b *Backend) HandleRequest(ctx context.Context, request *logical.Request) (*logical.Response, error) {
+	resp, err := b.Backend.HandleRequest(b.correlate(ctx, request), request)
+	b.flushAPIErrors(ctx, request.Storage)
+
+	return resp, err
+}
+
+// correlate returns a context containing the identifiers of the request. The hash of the requester's entity is only
+// included if the configuration enables it.
+func (b *Backend) correlate(ctx context.Context, request *logical.Request) context.Context {
+	if request.ID == "" {
+		return ctx
+	}
+
+	c := correlation{
+		requestID: request.ID,
+		logger:    b.Logger(),
+	}
+
+	if request.EntityID != "" && request.Storage != nil {
+		// The configuration may not have been set yet, in which case no requests are made to the Tailscale API.
+		if config, err := b.config(ctx, request.Storage); err == nil && config.CorrelationEntityHash {
+			c.entityHash = hashEntityID(request.EntityID)
+		}
+	}
+
+	return context.WithValue(ctx, correlationKey{}, c)
+}
+
+// requestCorrelation returns the identifiers of the Vault request that an outbound request was made while handling,
+// if any.
+func requestCorrelation(req *http.Request) (correlation, bool) {
+	c, ok := req.Context().Value(correlationKey{}).(correlation)
+	return c, ok
+}
+
+// apply returns a copy of the outbound request with the correlation headers set.
+func (c correlation) apply(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set(requestIDHeader, c.requestID)
+	if c.entityHash != "" {
+		req.Header.Set(entityHashHeader, c.entityHash)
+	}
+
+	return req
+}
+
+// log records a request made to the Tailscale API along with the identifier of the Vault request it was made while
+// handling. Failed requests are logged as warnings.
+func (c correlation) log(req *http.Request, resp *http.Response, err error) {
+	args := []interface{}{"method", req.Method, "path", req.URL.Path, "request_id", c.requestID}
+	if c.entityHash != "" {
+		args = append(args, "entity_hash", c.entityHash)
+	}
+
+	switch {
+	case err != nil:
+		c.logger.Warn("request to tailscale api failed", append(args, "error", err)...)
+	case resp.StatusCode >= http.StatusBadRequest:
+		c.logger.Warn("request to tailscale api failed", append(args, "status", resp.StatusCode)...)
+	default:
+		c.logger.Debug("request to tailscale api", append(args, "status", resp.StatusCode)...)
+	}
+}
+
+// hashEntityID returns the hex encoded SHA-256 hash of an entity identifier, so that the requester can be identified
+// in the logs of the Tailscale API by those who know the entity identifier, without disclosing it.
+func hashEntityID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,70 @@
+package backend_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_RequestCorrelation(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	sum := sha256.Sum256([]byte("entity-1"))
+	entityHash := hex.EncodeToString(sum[:])
+
+	tt := []struct {
+		Name               string
+		EntityHash         bool
+		ExpectedEntityHash string
+	}{
+		{
+			Name: "It should forward the request identifier to the API",
+		},
+		{
+			Name:               "It should forward the hash of the entity identifier to the API if enabled",
+			EntityHash:         true,
+			ExpectedEntityHash: entityHash,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":                 "example",
+					"api_key":                 "example",
+					"api_url":                 "http://localhost:1337",
+					"correlation_entity_hash": tc.EntityHash,
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				ID:        "request-" + tc.Name,
+				EntityID:  "entity-1",
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data:      map[string]interface{}{"tags": []string{"tag:server"}},
+			})
+			require.NoError(t, err)
+
+			headers := api.Headers()
+			require.NotEmpty(t, headers)
+
+			header := headers[len(headers)-1]
+			assert.EqualValues(t, "request-"+tc.Name, header.Get("X-Vault-Tailscale-Request-Id"))
+			assert.EqualValues(t, tc.ExpectedEntityHash, header.Get("X-Vault-Tailscale-Entity-Hash"))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// The DeviceAuthorizationConfig type describes the policy used to authorize devices added to the tailnet using
+	// keys issued by the Backend. A device satisfies the policy if it is tagged and all of its tags are allowed.
+	DeviceAuthorizationConfig struct {
+		AllowedTags []string `json:"allowed_tags"`
+	}
+)
+
+const (
+	deviceAuthorizationConfigPath = "config/device-authorization"
+
+	readDeviceAuthorizationDescription   = "Read the device authorization policy"
+	updateDeviceAuthorizationDescription = "Update the device authorization policy"
+	deleteDeviceAuthorizationDescription = "Delete the device authorization policy, disabling automatic authorization"
+	deviceAuthorizationTagsDescription   = "Devices added with keys issued by the backend are authorized if all of their tags are within these tags"
+
+	deviceAuthorizationHelpSynopsis    = "Configure automatic authorization of devices added with issued keys."
+	deviceAuthorizationHelpDescription = `
+Devices added to the tailnet with keys issued by the backend are authorized periodically
+if all of their tags are within the allowed tags. Deleting this path disables automatic
+authorization.
+`
+)
+
+func (b *Backend) deviceAuthorizationPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: deviceAuthorizationConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"allowed_tags": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: deviceAuthorizationTagsDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadDeviceAuthorizationConfiguration,
+					Responses: okResponse(readDeviceAuthorizationDescription, deviceAuthorizationResponseFields()),
+					Summary:   readDeviceAuthorizationDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateDeviceAuthorizationConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateDeviceAuthorizationDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteDeviceAuthorizationConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteDeviceAuthorizationDescription,
+				},
+			},
+			HelpSynopsis:    deviceAuthorizationHelpSynopsis,
+			HelpDescription: deviceAuthorizationHelpDescription,
+		},
+	}
+}
+
+// ReadDeviceAuthorizationConfiguration returns the device authorization policy.
+func (b *Backend) ReadDeviceAuthorizationConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.deviceAuthorizationConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed_tags": config.AllowedTags,
+		},
+	}, nil
+}
+
+// UpdateDeviceAuthorizationConfiguration modifies the device authorization policy, enabling automatic authorization
+// of devices. Returns an error if no tags are provided.
+func (b *Backend) UpdateDeviceAuthorizationConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := DeviceAuthorizationConfig{
+		AllowedTags: data.Get("allowed_tags").([]string),
+	}
+
+	if len(config.AllowedTags) == 0 {
+		return nil, errors.New("provided allowed_tags cannot be empty")
+	}
+
+	entry, err := logical.StorageEntryJSON(deviceAuthorizationConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteDeviceAuthorizationConfiguration removes the device authorization policy, disabling automatic authorization
+// of devices.
+func (b *Backend) DeleteDeviceAuthorizationConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, deviceAuthorizationConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// authorizeDevices authorizes the unauthorized devices added to the tailnet using keys issued by the Backend whose
+// tags satisfy the device authorization policy, if one is configured. Nothing is done while the backend is in
+// read-only mode or during a maintenance window.
+func (b *Backend) authorizeDevices(ctx context.Context, storage logical.Storage) error {
+	policy, err := b.deviceAuthorizationConfig(ctx, storage)
+	if err != nil || policy == nil {
+		return err
+	}
+
+	config, err := b.config(ctx, storage)
+	if err != nil || config.ReadOnly {
+		return nil
+	}
+
+	if err = b.checkMaintenance(ctx, storage); err != nil {
+		return nil
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	issued, err := b.issuedDevices(ctx, storage, devices)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	for _, device := range issued {
+		if device.Authorized || !policy.allows(device) {
+			continue
+		}
+
+		if err = client.SetDeviceAuthorized(ctx, device.ID, true); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to authorize device %q: %w", device.ID, err))
+			continue
+		}
+
+		b.Logger().Info("authorized device", "device_id", device.ID, "tags", device.Tags)
+		b.notify(ctx, storage, eventDeviceAuthorized, map[string]string{
+			"device_id": device.ID,
+			"hostname":  device.Hostname,
+		})
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// allows returns true if the device is tagged and all of its tags are allowed by the policy.
+func (c *DeviceAuthorizationConfig) allows(device tailscale.Device) bool {
+	return len(device.Tags) > 0 && strutil.StrListSubset(c.AllowedTags, device.Tags)
+}
+
+func (b *Backend) deviceAuthorizationConfig(ctx context.Context, storage logical.Storage) (*DeviceAuthorizationConfig, error) {
+	entry, err := storage.Get(ctx, deviceAuthorizationConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config DeviceAuthorizationConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func deviceAuthorizationResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"allowed_tags": {
+			Type:        framework.TypeStringSlice,
+			Description: deviceAuthorizationTagsDescription,
+		},
+	}
+}
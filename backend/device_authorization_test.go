@@ -0,0 +1,60 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestBackend_AuthorizeDevices(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	rollback := func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{Operation: logical.RollbackOperation, Storage: storage})
+		require.NoError(t, err)
+	}
+
+	for _, tags := range [][]string{{"tag:server"}, {"tag:server", "tag:admin"}} {
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{"tags": tags})
+		require.NoError(t, err)
+	}
+
+	created := tailscale.Time{Time: time.Now().Add(time.Minute)}
+	api.SetDevices(
+		tailscale.Device{ID: "server", Tags: []string{"tag:server"}, Created: created},
+		tailscale.Device{ID: "admin", Tags: []string{"tag:server", "tag:admin"}, Created: created},
+		tailscale.Device{ID: "unknown", Tags: []string{"tag:web"}, Created: created},
+	)
+
+	t.Run("It should not authorize devices without a policy", func(t *testing.T) {
+		rollback(t)
+		assert.False(t, api.Authorized("server"))
+	})
+
+	t.Run("It should return an error if no tags are allowed", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/device-authorization", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should authorize devices added with issued keys that satisfy the policy", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/device-authorization", map[string]interface{}{
+			"allowed_tags": "tag:server,tag:web",
+		})
+		require.NoError(t, err)
+
+		rollback(t)
+		assert.True(t, api.Authorized("server"))
+		assert.False(t, api.Authorized("admin"))
+		assert.False(t, api.Authorized("unknown"))
+	})
+}
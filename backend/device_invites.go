@@ -0,0 +1,366 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The DeviceInvite type describes an invitation to share a device with a user outside the tailnet.
+	DeviceInvite struct {
+		ID              string    `json:"id"`
+		Created         time.Time `json:"created"`
+		DeviceID        string    `json:"deviceId"`
+		SharerID        string    `json:"sharerId"`
+		MultiUse        bool      `json:"multiUse"`
+		AllowExitNode   bool      `json:"allowExitNode"`
+		Email           string    `json:"email"`
+		LastEmailSentAt time.Time `json:"lastEmailSentAt"`
+		InviteURL       string    `json:"inviteUrl"`
+		Accepted        bool      `json:"accepted"`
+		AcceptedBy      struct {
+			ID        string `json:"id"`
+			LoginName string `json:"loginName"`
+		} `json:"acceptedBy"`
+	}
+)
+
+const (
+	secretTypeDeviceInvite = "device_invite"
+
+	listDeviceInvitesDescription    = "List the device sharing invites of a device"
+	createDeviceInviteDescription   = "Invite a user outside the tailnet to share a device"
+	readDeviceInviteDescription     = "Read a device sharing invite"
+	deleteDeviceInviteDescription   = "Revoke a device sharing invite"
+	deviceInviteSecretDescription   = "A device sharing invite that is revoked when its lease expires"
+	deviceInviteIDDescription       = "The identifier of the device sharing invite"
+	deviceInviteEmailDescription    = "The email address of the user to invite. If omitted, the invite can be used by anyone with its URL"
+	deviceInviteMultiUseDescription = "If true, the invite can be accepted by more than one user"
+	deviceInviteExitNodeDescription = "If true, users who accept the invite can use the device as an exit node"
+	deviceInviteTTLDescription      = "If set, the invite is returned with a lease of this duration and is revoked when the lease expires or is revoked"
+
+	deviceInvitesHelpSynopsis    = "List or create the sharing invites of a device."
+	deviceInvitesHelpDescription = `
+Lists the sharing invites of a device along with who each was sent to and whether it was
+accepted, or invites a user outside the tailnet to share the device. If a ttl is given,
+the invite is returned with a lease and is revoked when the lease expires or is revoked.
+`
+	deviceInviteHelpSynopsis    = "Read or revoke a device sharing invite."
+	deviceInviteHelpDescription = `
+Returns a device sharing invite, including its URL and whether it was accepted, or
+revokes it so that it can no longer be accepted.
+`
+)
+
+func (b *Backend) deviceInvitePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "devices/" + framework.GenericNameRegex("device_id") + "/invites/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"device_id": {
+					Type:        framework.TypeString,
+					Description: deviceIDDescription,
+				},
+				"email": {
+					Type:        framework.TypeString,
+					Description: deviceInviteEmailDescription,
+				},
+				"multi_use": {
+					Type:        framework.TypeBool,
+					Description: deviceInviteMultiUseDescription,
+				},
+				"allow_exit_node": {
+					Type:        framework.TypeBool,
+					Description: deviceInviteExitNodeDescription,
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: deviceInviteTTLDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListDeviceInvites,
+					Responses: listResponse(listDeviceInvitesDescription),
+					Summary:   listDeviceInvitesDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.CreateDeviceInvite,
+					Responses: okResponse(createDeviceInviteDescription, deviceInviteResponseFields()),
+					Summary:   createDeviceInviteDescription,
+				},
+			},
+			HelpSynopsis:    deviceInvitesHelpSynopsis,
+			HelpDescription: deviceInvitesHelpDescription,
+		},
+		{
+			Pattern: "device-invites/" + framework.GenericNameRegex("id"),
+			Fields: map[string]*framework.FieldSchema{
+				"id": {
+					Type:        framework.TypeString,
+					Description: deviceInviteIDDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadDeviceInvite,
+					Responses: okResponse(readDeviceInviteDescription, deviceInviteResponseFields()),
+					Summary:   readDeviceInviteDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteDeviceInvite,
+					Responses: noContentResponse(),
+					Summary:   deleteDeviceInviteDescription,
+				},
+			},
+			HelpSynopsis:    deviceInviteHelpSynopsis,
+			HelpDescription: deviceInviteHelpDescription,
+		},
+	}
+}
+
+func (b *Backend) deviceInviteSecret() *framework.Secret {
+	return &framework.Secret{
+		Type: secretTypeDeviceInvite,
+		Fields: map[string]*framework.FieldSchema{
+			"id": {
+				Type:        framework.TypeString,
+				Description: deviceInviteIDDescription,
+			},
+		},
+		Revoke: b.RevokeDeviceInvite,
+	}
+}
+
+// ListDeviceInvites returns the identifiers of the sharing invites of a device, along with who each was sent to and
+// whether it has been accepted.
+func (b *Backend) ListDeviceInvites(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var invites []DeviceInvite
+	if err = b.apiRequest(ctx, config, http.MethodGet, deviceInvitesURI(data), nil, nil, &invites); err != nil {
+		return nil, fmt.Errorf("failed to list device invites: %w", err)
+	}
+
+	ids := make([]string, 0, len(invites))
+	info := make(map[string]interface{}, len(invites))
+	for _, invite := range invites {
+		ids = append(ids, invite.ID)
+		info[invite.ID] = map[string]interface{}{
+			"email":    invite.Email,
+			"accepted": invite.Accepted,
+		}
+	}
+
+	return logical.ListResponseWithInfo(ids, info), nil
+}
+
+// CreateDeviceInvite invites a user outside the tailnet to share a device, returning the URL of the invite. If a ttl
+// is provided, the invite is returned with a lease and is revoked once the lease expires or is revoked. Returns an
+// error if the backend is in read-only mode or during a maintenance window.
+func (b *Backend) CreateDeviceInvite(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	email := data.Get("email").(string)
+	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+
+	switch {
+	case ttl < 0:
+		return nil, errors.New("provided ttl cannot be negative")
+	case email != "":
+		if _, err = mail.ParseAddress(email); err != nil {
+			return nil, fmt.Errorf("provided email is invalid: %w", err)
+		}
+	}
+
+	body := []map[string]interface{}{{
+		"multiUse":      data.Get("multi_use").(bool),
+		"allowExitNode": data.Get("allow_exit_node").(bool),
+	}}
+	if email != "" {
+		body[0]["email"] = email
+	}
+
+	var invites []DeviceInvite
+	if err = b.apiRequest(ctx, config, http.MethodPost, deviceInvitesURI(data), nil, body, &invites); err != nil {
+		return nil, fmt.Errorf("failed to create device invite: %w", err)
+	}
+
+	if len(invites) == 0 {
+		return nil, errors.New("failed to create device invite: no invite was returned")
+	}
+
+	response := deviceInviteResponse(invites[0])
+	if ttl == 0 {
+		return response, nil
+	}
+
+	response = b.Secret(secretTypeDeviceInvite).Response(response.Data, map[string]interface{}{
+		"id": invites[0].ID,
+	})
+	response.Secret.TTL = ttl
+	response.Secret.MaxTTL = ttl
+
+	return response, nil
+}
+
+// ReadDeviceInvite returns a device sharing invite.
+func (b *Backend) ReadDeviceInvite(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var invite DeviceInvite
+	err = b.apiRequest(ctx, config, http.MethodGet, "device-invites/"+url.PathEscape(data.Get("id").(string)), nil, nil, &invite)
+	switch {
+	case isAPINotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read device invite: %w", err)
+	}
+
+	return deviceInviteResponse(invite), nil
+}
+
+// DeleteDeviceInvite revokes a device sharing invite so that it can no longer be accepted. Users who have already
+// accepted it keep access to the device. Returns an error if the backend is in read-only mode or during a maintenance
+// window.
+func (b *Backend) DeleteDeviceInvite(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.deleteDeviceInvite(ctx, request.Storage, data.Get("id").(string)); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// RevokeDeviceInvite revokes the device sharing invite of an expired or revoked lease. Returns an error if the backend
+// is in read-only mode or during a maintenance window, in which case Vault retries the revocation later.
+func (b *Backend) RevokeDeviceInvite(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	id, ok := request.Secret.InternalData["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("lease does not contain a device invite identifier")
+	}
+
+	if err := b.deleteDeviceInvite(ctx, request.Storage, id); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+func (b *Backend) deleteDeviceInvite(ctx context.Context, storage logical.Storage, id string) error {
+	config, err := b.config(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return err
+	}
+
+	if err = b.checkMaintenance(ctx, storage); err != nil {
+		return err
+	}
+
+	err = b.apiRequest(ctx, config, http.MethodDelete, "device-invites/"+url.PathEscape(id), nil, nil, nil)
+	if err != nil && !isAPINotFound(err) {
+		return fmt.Errorf("failed to revoke device invite: %w", err)
+	}
+
+	return nil
+}
+
+// deviceInvitesURI returns the uri of the sharing invites of the requested device, for use with apiRequest.
+func deviceInvitesURI(data *framework.FieldData) string {
+	return "device/" + url.PathEscape(data.Get("device_id").(string)) + "/device-invites"
+}
+
+func deviceInviteResponse(invite DeviceInvite) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":                 invite.ID,
+			"device_id":          invite.DeviceID,
+			"sharer_id":          invite.SharerID,
+			"email":              invite.Email,
+			"multi_use":          invite.MultiUse,
+			"allow_exit_node":    invite.AllowExitNode,
+			"invite_url":         invite.InviteURL,
+			"accepted":           invite.Accepted,
+			"accepted_by":        invite.AcceptedBy.LoginName,
+			"created":            invite.Created,
+			"last_email_sent_at": invite.LastEmailSentAt,
+		},
+	}
+}
+
+func deviceInviteResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: deviceInviteIDDescription,
+		},
+		"device_id": {
+			Type:        framework.TypeString,
+			Description: deviceIDDescription,
+		},
+		"sharer_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the user that shared the device",
+		},
+		"email": {
+			Type:        framework.TypeString,
+			Description: "The email address the invite was sent to",
+		},
+		"multi_use": {
+			Type:        framework.TypeBool,
+			Description: deviceInviteMultiUseDescription,
+		},
+		"allow_exit_node": {
+			Type:        framework.TypeBool,
+			Description: deviceInviteExitNodeDescription,
+		},
+		"invite_url": {
+			Type:        framework.TypeString,
+			Description: "The URL used to accept the invite",
+		},
+		"accepted": {
+			Type:        framework.TypeBool,
+			Description: "Whether the invite has been accepted",
+		},
+		"accepted_by": {
+			Type:        framework.TypeString,
+			Description: "The login name of the user that accepted the invite",
+		},
+		"created": {
+			Type:        framework.TypeTime,
+			Description: "When the invite was created",
+		},
+		"last_email_sent_at": {
+			Type:        framework.TypeTime,
+			Description: "When the invite was last emailed",
+		},
+	}
+}
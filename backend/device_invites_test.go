@@ -0,0 +1,133 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_DeviceInvites(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+
+	var (
+		mu      sync.Mutex
+		invites = map[string]map[string]interface{}{}
+	)
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/api/v2/device/device-1/device-invites" && r.Method == http.MethodPost:
+			var body []map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+			invite := body[0]
+			invite["id"] = fmt.Sprintf("invite-%d", len(invites)+1)
+			invite["deviceId"] = "device-1"
+			invite["inviteUrl"] = "https://login.tailscale.com/admin/invite/" + invite["id"].(string)
+			invites[invite["id"].(string)] = invite
+			assert.NoError(t, json.NewEncoder(w).Encode([]interface{}{invite}))
+		case r.URL.Path == "/api/v2/device/device-1/device-invites":
+			result := make([]interface{}, 0, len(invites))
+			for _, invite := range invites {
+				result = append(result, invite)
+			}
+			assert.NoError(t, json.NewEncoder(w).Encode(result))
+		case strings.HasPrefix(r.URL.Path, "/api/v2/device-invites/"):
+			id := strings.TrimPrefix(r.URL.Path, "/api/v2/device-invites/")
+			invite, ok := invites[id]
+			switch {
+			case !ok:
+				w.WriteHeader(http.StatusNotFound)
+				assert.NoError(t, json.NewEncoder(w).Encode(map[string]string{"message": "not found"}))
+			case r.Method == http.MethodDelete:
+				delete(invites, id)
+			default:
+				assert.NoError(t, json.NewEncoder(w).Encode(invite))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should return an error if the email is invalid", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "devices/device-1/invites", map[string]interface{}{
+			"email": "not an email",
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should create an invite", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "devices/device-1/invites", map[string]interface{}{
+			"email":           "alice@example.com",
+			"allow_exit_node": true,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, response.Secret)
+		assert.EqualValues(t, "invite-1", response.Data["id"])
+		assert.EqualValues(t, "device-1", response.Data["device_id"])
+		assert.EqualValues(t, true, response.Data["allow_exit_node"])
+		assert.EqualValues(t, false, response.Data["multi_use"])
+		assert.NotEmpty(t, response.Data["invite_url"])
+	})
+
+	t.Run("It should list invites", func(t *testing.T) {
+		response, err := request(logical.ListOperation, "devices/device-1/invites/", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"invite-1"}, response.Data["keys"])
+	})
+
+	t.Run("It should read an invite", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "device-invites/invite-1", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "alice@example.com", response.Data["email"])
+	})
+
+	t.Run("It should revoke an invite", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "device-invites/invite-1", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "device-invites/invite-1", nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+
+	t.Run("It should revoke an invite when its lease is revoked", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "devices/device-1/invites", map[string]interface{}{
+			"multi_use": true,
+			"ttl":       "1h",
+		})
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+		assert.EqualValues(t, time.Hour, response.Secret.TTL)
+		assert.False(t, response.Secret.Renewable)
+
+		id := response.Data["id"].(string)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    response.Secret,
+		})
+		require.NoError(t, err)
+
+		response, err = request(logical.ReadOperation, "device-invites/"+id, nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+}
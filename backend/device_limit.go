@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type (
+	// The deviceCountCache type holds the number of devices in the tailnet, used to enforce the configured device limit
+	// without listing the devices for every key.
+	deviceCountCache struct {
+		credentials clientCredentials
+		count       int
+		fetched     time.Time
+	}
+)
+
+const (
+	deviceCountCacheTTL = time.Minute
+)
+
+// checkDeviceLimit returns an error if a device limit is configured and the tailnet already has at least that many
+// devices. The number of devices is cached for a minute.
+func (b *Backend) checkDeviceLimit(ctx context.Context, config Config) error {
+	if config.MaxTailnetDevices <= 0 {
+		return nil
+	}
+
+	count, err := b.deviceCount(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	if count >= config.MaxTailnetDevices {
+		return fmt.Errorf("keys cannot be generated as the tailnet has %d devices, reaching the limit of %d",
+			count, config.MaxTailnetDevices)
+	}
+
+	return nil
+}
+
+// deviceCount returns the number of devices in the tailnet, listing them if the count is not cached, the cached count
+// is older than a minute or was fetched using different credentials.
+func (b *Backend) deviceCount(ctx context.Context, config Config) (int, error) {
+	b.deviceCountMu.Lock()
+	defer b.deviceCountMu.Unlock()
+
+	if b.devices != nil && b.devices.credentials == config.credentials() && time.Since(b.devices.fetched) < deviceCountCacheTTL {
+		return b.devices.count, nil
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return 0, err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	b.devices = &deviceCountCache{
+		credentials: config.credentials(),
+		count:       len(devices),
+		fetched:     time.Now(),
+	}
+
+	return b.devices.count, nil
+}
+
+func (b *Backend) flushDeviceCount() {
+	b.deviceCountMu.Lock()
+	defer b.deviceCountMu.Unlock()
+
+	b.devices = nil
+}
@@ -0,0 +1,72 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestBackend_DeviceLimit(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+	api.SetDevices(tailscale.Device{ID: "device-1"}, tailscale.Device{ID: "device-2"})
+
+	configure := func(t *testing.T, limit int) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"tailnet":             "example",
+				"api_url":             "http://localhost:1337",
+				"api_key":             "example",
+				"issuer_tag":          "",
+				"max_tailnet_devices": limit,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	issue := func() error {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+		})
+		return err
+	}
+
+	t.Run("It should generate keys while the tailnet is below the limit", func(t *testing.T) {
+		configure(t, 3)
+		assert.NoError(t, issue())
+	})
+
+	t.Run("It should use the cached device count", func(t *testing.T) {
+		api.SetDevices(tailscale.Device{ID: "device-1"}, tailscale.Device{ID: "device-2"}, tailscale.Device{ID: "device-3"})
+		assert.NoError(t, issue())
+	})
+
+	t.Run("It should refuse keys once the tailnet reaches the limit", func(t *testing.T) {
+		configure(t, 3)
+		assert.ErrorContains(t, issue(), "reaching the limit of 3")
+		assert.Len(t, api.Requests(), 2)
+
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "check",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, false, response.Data["allowed"])
+	})
+
+	t.Run("It should generate keys when the limit is removed", func(t *testing.T) {
+		configure(t, 0)
+		assert.NoError(t, issue())
+	})
+}
@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const (
+	defaultInactiveSince = 30 * 24 * time.Hour
+	untaggedDevices      = "untagged"
+
+	readInactiveDevicesDescription = "Report the devices in the tailnet that have not been seen recently"
+	inactiveSinceDescription       = "Devices not seen within this duration are reported as inactive"
+	inactiveIssuedOnlyDescription  = "If true, only devices added to the tailnet using keys issued by the backend are reported"
+
+	inactiveDevicesHelpSynopsis    = "Report the devices in the tailnet that have not been seen recently."
+	inactiveDevicesHelpDescription = `
+Returns the devices not seen within the requested duration, along with the number of
+inactive devices for each tag. Devices without tags are counted as untagged. The report
+can be limited to devices added using keys issued by the backend.
+`
+)
+
+func (b *Backend) devicePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "devices/inactive$",
+			Fields: map[string]*framework.FieldSchema{
+				"since": {
+					Type:        framework.TypeDurationSecond,
+					Description: inactiveSinceDescription,
+					Default:     int(defaultInactiveSince.Seconds()),
+				},
+				"issued_only": {
+					Type:        framework.TypeBool,
+					Description: inactiveIssuedOnlyDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadInactiveDevices,
+					Responses: okResponse(readInactiveDevicesDescription, inactiveDevicesResponseFields()),
+					Summary:   readInactiveDevicesDescription,
+				},
+			},
+			HelpSynopsis:    inactiveDevicesHelpSynopsis,
+			HelpDescription: inactiveDevicesHelpDescription,
+		},
+	}
+}
+
+// ReadInactiveDevices returns the devices in the tailnet that have not been seen within the requested duration, least
+// recently seen first, along with the number of inactive devices with each tag. Devices without tags are counted as
+// untagged. Devices that have never been seen are treated as last seen when they were created.
+func (b *Backend) ReadInactiveDevices(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	since := time.Duration(data.Get("since").(int)) * time.Second
+	if since <= 0 {
+		return nil, errors.New("provided since must be greater than zero")
+	}
+
+	client, err := b.client(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	if data.Get("issued_only").(bool) {
+		if devices, err = b.issuedDevices(ctx, request.Storage, devices); err != nil {
+			return nil, err
+		}
+	}
+
+	cutoff := time.Now().Add(-since)
+
+	var inactive []tailscale.Device
+	for _, device := range devices {
+		if deviceLastSeen(device).Before(cutoff) {
+			inactive = append(inactive, device)
+		}
+	}
+
+	sort.SliceStable(inactive, func(i, j int) bool {
+		return deviceLastSeen(inactive[i]).Before(deviceLastSeen(inactive[j]))
+	})
+
+	results := make([]map[string]interface{}, 0, len(inactive))
+	byTag := make(map[string]int)
+	for _, device := range inactive {
+		results = append(results, map[string]interface{}{
+			"id":        device.ID,
+			"name":      device.Name,
+			"hostname":  device.Hostname,
+			"user":      device.User,
+			"tags":      device.Tags,
+			"last_seen": deviceLastSeen(device),
+		})
+
+		if len(device.Tags) == 0 {
+			byTag[untaggedDevices]++
+		}
+
+		for _, tag := range device.Tags {
+			byTag[tag]++
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"since":   cutoff.UTC(),
+			"count":   len(results),
+			"devices": results,
+			"by_tag":  byTag,
+		},
+	}, nil
+}
+
+// deviceLastSeen returns when the device was last seen, or when it was created if it has never been seen.
+func deviceLastSeen(device tailscale.Device) time.Time {
+	if device.LastSeen.IsZero() {
+		return device.Created.UTC()
+	}
+
+	return device.LastSeen.UTC()
+}
+
+func inactiveDevicesResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"since": {
+			Type:        framework.TypeTime,
+			Description: "Devices not seen since this time are reported as inactive",
+		},
+		"count": {
+			Type:        framework.TypeInt,
+			Description: "The number of inactive devices",
+		},
+		"devices": {
+			Type:        framework.TypeSlice,
+			Description: "The inactive devices, each with its id, name, hostname, user, tags and last_seen",
+		},
+		"by_tag": {
+			Type:        framework.TypeMap,
+			Description: "The number of inactive devices with each tag",
+		},
+	}
+}
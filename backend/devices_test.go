@@ -0,0 +1,93 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestBackend_ReadInactiveDevices(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "key",
+		Storage:   storage,
+		Data:      map[string]interface{}{"tags": []string{"tag:server"}},
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	created := tailscale.Time{Time: now.Add(time.Minute)}
+	api.SetDevices(
+		tailscale.Device{ID: "issued", Tags: []string{"tag:server"}, Created: created, LastSeen: tailscale.Time{Time: now.Add(-60 * 24 * time.Hour)}},
+		tailscale.Device{ID: "other", Created: created, LastSeen: tailscale.Time{Time: now.Add(-40 * 24 * time.Hour)}},
+		tailscale.Device{ID: "active", Tags: []string{"tag:server"}, Created: created, LastSeen: tailscale.Time{Time: now}},
+	)
+
+	tt := []struct {
+		Name          string
+		Data          map[string]interface{}
+		ExpectsError  bool
+		ExpectedIDs   []string
+		ExpectedByTag map[string]int
+	}{
+		{
+			Name:          "It should report devices not seen within the default window",
+			ExpectedIDs:   []string{"issued", "other"},
+			ExpectedByTag: map[string]int{"tag:server": 1, "untagged": 1},
+		},
+		{
+			Name:          "It should report devices not seen within the requested window",
+			Data:          map[string]interface{}{"since": "50d"},
+			ExpectedIDs:   []string{"issued"},
+			ExpectedByTag: map[string]int{"tag:server": 1},
+		},
+		{
+			Name:          "It should only report devices added using issued keys",
+			Data:          map[string]interface{}{"issued_only": true},
+			ExpectedIDs:   []string{"issued"},
+			ExpectedByTag: map[string]int{"tag:server": 1},
+		},
+		{
+			Name:         "It should return an error if the window is not positive",
+			Data:         map[string]interface{}{"since": "0s"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "devices/inactive",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			var ids []string
+			for _, device := range response.Data["devices"].([]map[string]interface{}) {
+				ids = append(ids, device["id"].(string))
+			}
+
+			assert.EqualValues(t, tc.ExpectedIDs, ids)
+			assert.EqualValues(t, len(tc.ExpectedIDs), response.Data["count"])
+			assert.EqualValues(t, tc.ExpectedByTag, response.Data["by_tag"])
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The DisableConfig type describes whether key generation has been disabled across the mount.
+	DisableConfig struct {
+		Disabled   bool      `json:"disabled"`
+		Message    string    `json:"message"`
+		DisabledAt time.Time `json:"disabled_at"`
+	}
+)
+
+const (
+	disableConfigPath     = "config/disable"
+	defaultDisableMessage = "key generation is temporarily disabled for maintenance"
+
+	readDisableDescription    = "Read whether key generation is disabled"
+	updateDisableDescription  = "Disable or enable key generation across the mount"
+	deleteDisableDescription  = "Enable key generation across the mount"
+	disabledDescription       = "If true, all key generation is rejected"
+	disableMessageDescription = "The message returned to callers while key generation is disabled"
+
+	disableHelpSynopsis    = "Disable or enable key generation across the mount."
+	disableHelpDescription = `
+Writing to this path rejects every request that would generate a key with the configured
+message, and stops static roles from being rotated, while configuration and other read
+paths continue to work. Deleting this path enables key generation again.
+`
+)
+
+func (b *Backend) disablePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: disableConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"disabled": {
+					Type:        framework.TypeBool,
+					Description: disabledDescription,
+					Default:     true,
+				},
+				"message": {
+					Type:        framework.TypeString,
+					Description: disableMessageDescription,
+					Default:     defaultDisableMessage,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadDisable,
+					Responses: okResponse(readDisableDescription, disableResponseFields()),
+					Summary:   readDisableDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateDisable,
+					Responses: noContentResponse(),
+					Summary:   updateDisableDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteDisable,
+					Responses: noContentResponse(),
+					Summary:   deleteDisableDescription,
+				},
+			},
+			HelpSynopsis:    disableHelpSynopsis,
+			HelpDescription: disableHelpDescription,
+		},
+	}
+}
+
+// ReadDisable returns whether key generation is currently disabled.
+func (b *Backend) ReadDisable(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.disableConfig(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"disabled":    config.Disabled,
+			"message":     config.Message,
+			"disabled_at": config.DisabledAt,
+		},
+	}, nil
+}
+
+// UpdateDisable disables or enables key generation across the mount. While disabled, all requests that would
+// generate a key are rejected with the configured message and static roles are not rotated.
+func (b *Backend) UpdateDisable(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := DisableConfig{
+		Disabled: data.Get("disabled").(bool),
+		Message:  data.Get("message").(string),
+	}
+
+	if config.Disabled {
+		config.DisabledAt = time.Now().UTC()
+	}
+
+	entry, err := logical.StorageEntryJSON(disableConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteDisable enables key generation across the mount.
+func (b *Backend) DeleteDisable(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, disableConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// checkDisabled returns an error containing the configured maintenance message if key generation is disabled.
+func (b *Backend) checkDisabled(ctx context.Context, storage logical.Storage) error {
+	config, err := b.disableConfig(ctx, storage)
+	switch {
+	case err != nil:
+		return err
+	case !config.Disabled:
+		return nil
+	case config.Message == "":
+		return errors.New(defaultDisableMessage)
+	default:
+		return errors.New(config.Message)
+	}
+}
+
+func (b *Backend) disableConfig(ctx context.Context, storage logical.Storage) (DisableConfig, error) {
+	entry, err := storage.Get(ctx, disableConfigPath)
+	switch {
+	case err != nil:
+		return DisableConfig{}, err
+	case entry == nil:
+		return DisableConfig{}, nil
+	}
+
+	var config DisableConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return DisableConfig{}, err
+	}
+
+	return config, nil
+}
+
+func disableResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"disabled": {
+			Type:        framework.TypeBool,
+			Description: disabledDescription,
+		},
+		"message": {
+			Type:        framework.TypeString,
+			Description: disableMessageDescription,
+		},
+		"disabled_at": {
+			Type:        framework.TypeTime,
+			Description: "When key generation was disabled",
+		},
+	}
+}
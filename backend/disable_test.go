@@ -0,0 +1,101 @@
+package backend_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_Disable(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "roles/ci", nil)
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "config/disable", map[string]interface{}{
+		"message": "incident in progress",
+	})
+	require.NoError(t, err)
+
+	t.Run("It should reject key generation while disabled", func(t *testing.T) {
+		for _, path := range []string{"key", "creds/ci"} {
+			_, err := request(logical.ReadOperation, path, nil)
+			assert.EqualError(t, err, "incident in progress", path)
+		}
+
+		_, err := request(logical.UpdateOperation, "static-roles/test", nil)
+		assert.Error(t, err)
+		assert.Empty(t, api.Requests())
+	})
+
+	t.Run("It should continue to serve configuration while disabled", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "config/disable", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, true, response.Data["disabled"])
+
+		_, err = request(logical.ReadOperation, "config", nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("It should allow key generation once enabled", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "config/disable", nil)
+		require.NoError(t, err)
+
+		_, err = request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+		assert.Len(t, api.Requests(), 1)
+	})
+}
+
+func TestBackend_DisableApproval(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	var calls atomic.Int64
+	webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"approved":true}`))
+	}))
+	t.Cleanup(webhook.Close)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "config/approval", map[string]interface{}{
+		"url":     webhook.URL,
+		"secret":  "secret",
+		"ca_cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: webhook.Certificate().Raw})),
+	})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "roles/sensitive", map[string]interface{}{
+		"require_approval": true,
+	})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "config/disable", map[string]interface{}{
+		"message": "incident in progress",
+	})
+	require.NoError(t, err)
+
+	t.Run("It should not request approval while disabled", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "creds/sensitive", nil)
+		assert.EqualError(t, err, "incident in progress")
+		assert.Zero(t, calls.Load())
+		assert.Empty(t, api.Requests())
+	})
+}
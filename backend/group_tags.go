@@ -0,0 +1,238 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The GroupTags type describes the tags that members of a Vault identity group may request when generating keys,
+	// along with any tags that are always added to their keys.
+	GroupTags struct {
+		Group       string   `json:"group"`
+		AllowedTags []string `json:"allowed_tags"`
+		AutoTags    []string `json:"auto_tags"`
+	}
+)
+
+const (
+	groupTagsPrefix = "config/group-tags/"
+
+	listGroupTagsDescription   = "List the identity groups that have a tag mapping"
+	readGroupTagsDescription   = "Read the tag mapping of an identity group"
+	updateGroupTagsDescription = "Create or update the tag mapping of an identity group"
+	deleteGroupTagsDescription = "Delete the tag mapping of an identity group"
+	groupNameDescription       = "The name of the Vault identity group"
+	allowedTagsDescription     = "Tags that members of the group may request"
+	autoTagsDescription        = "Tags that are always added to keys generated by members of the group"
+
+	listGroupTagsHelpSynopsis    = "List the identity groups that have a tag mapping."
+	listGroupTagsHelpDescription = `
+Lists the names of the Vault identity groups whose members are restricted to, or
+automatically given, specific tags when generating keys.
+`
+	groupTagsHelpSynopsis    = "Manage the tags members of an identity group may request."
+	groupTagsHelpDescription = `
+Maps a Vault identity group to the tags its members may request and the tags always
+added to their keys. Once any mapping exists, each requested tag must be allowed by a
+mapping of one of the requester's groups.
+`
+)
+
+func (b *Backend) groupTagsPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "config/group-tags/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListGroupTags,
+					Responses: listResponse(listGroupTagsDescription),
+					Summary:   listGroupTagsDescription,
+				},
+			},
+			HelpSynopsis:    listGroupTagsHelpSynopsis,
+			HelpDescription: listGroupTagsHelpDescription,
+		},
+		{
+			Pattern: "config/group-tags/" + framework.GenericNameRegex("group"),
+			Fields: map[string]*framework.FieldSchema{
+				"group": {
+					Type:        framework.TypeString,
+					Description: groupNameDescription,
+				},
+				"allowed_tags": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: allowedTagsDescription,
+				},
+				"auto_tags": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: autoTagsDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadGroupTags,
+					Responses: okResponse(readGroupTagsDescription, groupTagsResponseFields()),
+					Summary:   readGroupTagsDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateGroupTags,
+					Responses: noContentResponse(),
+					Summary:   updateGroupTagsDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteGroupTags,
+					Responses: noContentResponse(),
+					Summary:   deleteGroupTagsDescription,
+				},
+			},
+			HelpSynopsis:    groupTagsHelpSynopsis,
+			HelpDescription: groupTagsHelpDescription,
+		},
+	}
+}
+
+// ListGroupTags returns the names of all identity groups that have a tag mapping.
+func (b *Backend) ListGroupTags(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	names, err := request.Storage.List(ctx, groupTagsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+// ReadGroupTags returns the tag mapping of an identity group.
+func (b *Backend) ReadGroupTags(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	mapping, err := b.groupTags(ctx, request.Storage, data.Get("group").(string))
+	switch {
+	case err != nil:
+		return nil, err
+	case mapping == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"group":        mapping.Group,
+			"allowed_tags": mapping.AllowedTags,
+			"auto_tags":    mapping.AutoTags,
+		},
+	}, nil
+}
+
+// UpdateGroupTags creates or modifies the tag mapping of an identity group. Fields not provided in the request retain
+// their existing values.
+func (b *Backend) UpdateGroupTags(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	group := data.Get("group").(string)
+	mapping, err := b.groupTags(ctx, request.Storage, group)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping == nil {
+		mapping = &GroupTags{Group: group}
+	}
+
+	if tags, ok := data.GetOk("allowed_tags"); ok {
+		mapping.AllowedTags = tags.([]string)
+	}
+	if tags, ok := data.GetOk("auto_tags"); ok {
+		mapping.AutoTags = tags.([]string)
+	}
+
+	entry, err := logical.StorageEntryJSON(groupTagsPrefix+mapping.Group, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteGroupTags removes the tag mapping of an identity group.
+func (b *Backend) DeleteGroupTags(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, groupTagsPrefix+data.Get("group").(string)); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// applyGroupTags checks the requested tags against the tag mappings of the requester's identity groups, returning
+// the tags with the auto tags of those groups added. Once any mapping exists, each requested tag must be allowed by
+// at least one of the requester's groups.
+func (b *Backend) applyGroupTags(ctx context.Context, request *logical.Request, tags []string) ([]string, error) {
+	names, err := request.Storage.List(ctx, groupTagsPrefix)
+	if err != nil || len(names) == 0 {
+		return tags, err
+	}
+
+	groups, err := b.entityGroups(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed, auto []string
+	for _, group := range groups {
+		mapping, err := b.groupTags(ctx, request.Storage, group.Name)
+		switch {
+		case err != nil:
+			return nil, err
+		case mapping == nil:
+			continue
+		}
+
+		allowed = append(allowed, mapping.AllowedTags...)
+		auto = append(auto, mapping.AutoTags...)
+	}
+
+	for _, tag := range tags {
+		if !strutil.StrListContains(allowed, tag) && !strutil.StrListContains(auto, tag) {
+			return nil, fmt.Errorf("tag %q is not allowed for the requester's identity groups", tag)
+		}
+	}
+
+	return mergeTags(tags, auto...), nil
+}
+
+func (b *Backend) groupTags(ctx context.Context, storage logical.Storage, group string) (*GroupTags, error) {
+	entry, err := storage.Get(ctx, groupTagsPrefix+group)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var mapping GroupTags
+	if err = entry.DecodeJSON(&mapping); err != nil {
+		return nil, err
+	}
+
+	return &mapping, nil
+}
+
+func groupTagsResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"group": {
+			Type:        framework.TypeString,
+			Description: groupNameDescription,
+		},
+		"allowed_tags": {
+			Type:        framework.TypeStringSlice,
+			Description: allowedTagsDescription,
+		},
+		"auto_tags": {
+			Type:        framework.TypeStringSlice,
+			Description: autoTagsDescription,
+		},
+	}
+}
@@ -0,0 +1,158 @@
+package backend_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_GroupTags(t *testing.T) {
+	ctx := context.Background()
+
+	config := logical.TestBackendConfig()
+	config.System.(*logical.StaticSystemView).GroupsVal = []*logical.Group{
+		{Name: "sre"},
+	}
+
+	b, err := backend.Create(ctx, config)
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name         string
+		Mappings     map[string]map[string]interface{}
+		EntityID     string
+		Tags         []string
+		ExpectedTags []string
+		ExpectsError bool
+	}{
+		{
+			Name:         "It should allow any tags if no mappings exist",
+			EntityID:     "entity",
+			Tags:         []string{"tag:anything"},
+			ExpectedTags: []string{"tag:anything"},
+		},
+		{
+			Name: "It should allow tags permitted by the requester's groups",
+			Mappings: map[string]map[string]interface{}{
+				"sre": {
+					"allowed_tags": "tag:prod,tag:staging",
+				},
+			},
+			EntityID:     "entity",
+			Tags:         []string{"tag:prod"},
+			ExpectedTags: []string{"tag:prod"},
+		},
+		{
+			Name: "It should add the auto tags of the requester's groups",
+			Mappings: map[string]map[string]interface{}{
+				"sre": {
+					"allowed_tags": "tag:prod",
+					"auto_tags":    "tag:sre",
+				},
+			},
+			EntityID:     "entity",
+			Tags:         []string{"tag:prod"},
+			ExpectedTags: []string{"tag:prod", "tag:sre"},
+		},
+		{
+			Name: "It should return an error if a tag is not permitted by the requester's groups",
+			Mappings: map[string]map[string]interface{}{
+				"sre": {
+					"allowed_tags": "tag:staging",
+				},
+			},
+			EntityID:     "entity",
+			Tags:         []string{"tag:prod"},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error if the requester has no mapped groups",
+			Mappings: map[string]map[string]interface{}{
+				"dev": {
+					"allowed_tags": "tag:prod",
+				},
+			},
+			EntityID:     "entity",
+			Tags:         []string{"tag:prod"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			mockKeysAPI(t)
+
+			request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+				return b.HandleRequest(ctx, &logical.Request{
+					Operation: operation,
+					Path:      path,
+					Storage:   storage,
+					EntityID:  tc.EntityID,
+					Data:      data,
+				})
+			}
+
+			_, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+				"tailnet":    "example",
+				"api_key":    "example",
+				"api_url":    "http://localhost:1337",
+				"issuer_tag": "",
+			})
+			require.NoError(t, err)
+
+			for group, mapping := range tc.Mappings {
+				_, err = request(logical.UpdateOperation, "config/group-tags/"+group, mapping)
+				require.NoError(t, err)
+			}
+
+			response, err := request(logical.ReadOperation, "key", map[string]interface{}{
+				"tags": tc.Tags,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.ExpectedTags, response.Data["tags"])
+		})
+	}
+}
+
+func TestBackend_GroupTagsCRUD(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "config/group-tags/sre", map[string]interface{}{
+		"allowed_tags": "tag:prod",
+		"auto_tags":    "tag:sre",
+	})
+	require.NoError(t, err)
+
+	response, err := request(logical.ReadOperation, "config/group-tags/sre", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, map[string]interface{}{
+		"group":        "sre",
+		"allowed_tags": []string{"tag:prod"},
+		"auto_tags":    []string{"tag:sre"},
+	}, response.Data)
+
+	response, err = request(logical.ListOperation, "config/group-tags/", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, []string{"sre"}, response.Data["keys"])
+
+	_, err = request(logical.DeleteOperation, "config/group-tags/sre", nil)
+	require.NoError(t, err)
+
+	response, err = request(logical.ReadOperation, "config/group-tags/sre", nil)
+	require.NoError(t, err)
+	assert.Nil(t, response)
+}
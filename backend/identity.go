@@ -0,0 +1,157 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/helper/identitytpl"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// identityTags returns the tags derived from the identity group memberships of the entity making the request. Each
+// group name is converted into a valid Tailscale tag, so the group "SRE Team" becomes "tag:sre-team".
+func (b *Backend) identityTags(request *logical.Request) ([]string, error) {
+	groups, err := b.entityGroups(request)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if tag := groupTag(group.Name); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// entityGroups returns the identity groups of the entity making the request.
+func (b *Backend) entityGroups(request *logical.Request) ([]*logical.Group, error) {
+	if request.EntityID == "" {
+		return nil, nil
+	}
+
+	return b.System().GroupsForEntity(request.EntityID)
+}
+
+// groupTag converts the name of an identity group into a Tailscale tag. Tag names may only contain letters, numbers
+// and dashes, so any other characters are replaced. Returns an empty string if the name produces no valid tag.
+func groupTag(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.ToLower(name))
+
+	name = strings.Trim(name, "-")
+	if name == "" {
+		return ""
+	}
+
+	return "tag:" + name
+}
+
+// mergeTags returns the tags with any additional tags appended, skipping those already present.
+func mergeTags(tags []string, additional ...string) []string {
+	merged := make([]string, 0, len(tags)+len(additional))
+	merged = append(merged, tags...)
+	for _, tag := range additional {
+		if !strutil.StrListContains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+
+	return merged
+}
+
+// hasAnyTag returns true if the tags contain any of the wanted tags.
+func hasAnyTag(tags []string, wanted []string) bool {
+	for _, tag := range wanted {
+		if strutil.StrListContains(tags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// templateRole returns a copy of the role with any identity templates in its tags and description, such as
+// "tag:team-{{identity.entity.metadata.team}}", populated using the entity making the request. Returns an error if the
+// role uses templates and the request has no entity, or the entity has no value for a template.
+func (b *Backend) templateRole(request *logical.Request, role *Role) (*Role, error) {
+	templates := append([]string{role.Description}, role.Tags...)
+	if !hasTemplate(templates...) {
+		return role, nil
+	}
+
+	if request.EntityID == "" {
+		return nil, fmt.Errorf("role %q uses identity templates, which require the request to have an entity", role.Name)
+	}
+
+	entity, err := b.System().EntityInfo(request.EntityID)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := b.entityGroups(request)
+	if err != nil {
+		return nil, err
+	}
+
+	populated := make([]string, 0, len(templates))
+	for _, template := range templates {
+		_, value, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+			String: template,
+			Entity: entity,
+			Groups: groups,
+			Mode:   identitytpl.ACLTemplating,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to populate template %q of role %q: %w", template, role.Name, err)
+		}
+
+		populated = append(populated, value)
+	}
+
+	templated := *role
+	templated.Description = populated[0]
+	templated.Tags = populated[1:]
+
+	return &templated, nil
+}
+
+// checkTemplates returns an error if any of the values contains an invalid identity template.
+func checkTemplates(values ...string) error {
+	for _, value := range values {
+		if !hasTemplate(value) {
+			continue
+		}
+
+		_, _, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+			String:            value,
+			ValidityCheckOnly: true,
+			Mode:              identitytpl.ACLTemplating,
+		})
+		if err != nil {
+			return fmt.Errorf("template %q is invalid: %w", value, err)
+		}
+	}
+
+	return nil
+}
+
+// hasTemplate returns true if any of the values contains an identity template.
+func hasTemplate(values ...string) bool {
+	for _, value := range values {
+		if strings.Contains(value, "{{") {
+			return true
+		}
+	}
+
+	return false
+}
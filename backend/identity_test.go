@@ -0,0 +1,146 @@
+package backend_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_IdentityTags(t *testing.T) {
+	ctx := context.Background()
+
+	config := logical.TestBackendConfig()
+	config.System.(*logical.StaticSystemView).GroupsVal = []*logical.Group{
+		{Name: "sre"},
+		{Name: "Platform Team"},
+	}
+
+	b, err := backend.Create(ctx, config)
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name         string
+		IdentityTags bool
+		EntityID     string
+		ExpectedTags []string
+	}{
+		{
+			Name:         "It should add tags derived from the requester's groups",
+			IdentityTags: true,
+			EntityID:     "entity",
+			ExpectedTags: []string{"tag:test", "tag:sre", "tag:platform-team"},
+		},
+		{
+			Name:         "It should not add tags if the request has no entity",
+			IdentityTags: true,
+			ExpectedTags: []string{"tag:test"},
+		},
+		{
+			Name:         "It should not add tags if disabled",
+			EntityID:     "entity",
+			ExpectedTags: []string{"tag:test"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":       "example",
+					"api_key":       "example",
+					"api_url":       "http://localhost:1337",
+					"issuer_tag":    "",
+					"identity_tags": tc.IdentityTags,
+				},
+			})
+			require.NoError(t, err)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				EntityID:  tc.EntityID,
+				Data: map[string]interface{}{
+					"tags": "tag:test",
+				},
+			})
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.ExpectedTags, response.Data["tags"])
+		})
+	}
+}
+
+func TestBackend_RoleTemplates(t *testing.T) {
+	ctx := context.Background()
+
+	config := logical.TestBackendConfig()
+	config.System.(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:       "entity",
+		Name:     "alice",
+		Metadata: map[string]string{"team": "platform"},
+	}
+
+	b, err := backend.Create(ctx, config)
+	require.NoError(t, err)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/team",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"tags":        "tag:team-{{identity.entity.metadata.team}}",
+			"description": "{{identity.entity.name}}",
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("It should populate templates using the requester's entity", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/team",
+			Storage:   storage,
+			EntityID:  "entity",
+		})
+		require.NoError(t, err)
+		require.Len(t, api.Requests(), 1)
+
+		request := api.Requests()[0]
+		assert.EqualValues(t, []string{"tag:team-platform"}, request.Capabilities.Devices.Create.Tags)
+		assert.EqualValues(t, "alice", withoutNonce(request.Description))
+	})
+
+	t.Run("It should return an error if the request has no entity", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/team",
+			Storage:   storage,
+		})
+		assert.Error(t, err)
+		assert.Len(t, api.Requests(), 1)
+	})
+
+	t.Run("It should return an error if a template is invalid", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/team",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": "tag:team-{{identity.entity.name"},
+		})
+		assert.Error(t, err)
+	})
+}
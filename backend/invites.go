@@ -0,0 +1,260 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The UserInvite type describes an invitation for a user to join the tailnet.
+	UserInvite struct {
+		ID              string    `json:"id"`
+		Role            string    `json:"role"`
+		Email           string    `json:"email"`
+		InviterID       string    `json:"inviterId"`
+		InviteURL       string    `json:"inviteUrl"`
+		LastEmailSentAt time.Time `json:"lastEmailSentAt"`
+	}
+)
+
+const (
+	defaultInviteRole = "member"
+
+	listInvitesDescription  = "List the outstanding user invites of the tailnet"
+	createInviteDescription = "Invite a user to join the tailnet"
+	readInviteDescription   = "Read a user invite"
+	deleteInviteDescription = "Revoke a user invite"
+	inviteIDDescription     = "The identifier of the invite"
+	inviteEmailDescription  = "The email address of the user to invite. If omitted, the invite can be used by anyone with its URL"
+	inviteRoleDescription   = "The role of the invited user, such as member, admin or it-admin"
+
+	listInvitesHelpSynopsis    = "List or create user invites for the tailnet."
+	listInvitesHelpDescription = `
+Lists the outstanding user invites of the tailnet along with who each was sent to, or
+invites a user to join the tailnet with the given role. Invites without an email address
+can be used by anyone with their URL.
+`
+	inviteHelpSynopsis    = "Read or revoke a user invite."
+	inviteHelpDescription = `
+Returns a user invite, including its role and URL, or revokes it so that it can no
+longer be used to join the tailnet.
+`
+)
+
+func (b *Backend) invitePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "invites/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"email": {
+					Type:        framework.TypeString,
+					Description: inviteEmailDescription,
+				},
+				"role": {
+					Type:        framework.TypeString,
+					Description: inviteRoleDescription,
+					Default:     defaultInviteRole,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListInvites,
+					Responses: listResponse(listInvitesDescription),
+					Summary:   listInvitesDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.CreateInvite,
+					Responses: okResponse(createInviteDescription, inviteResponseFields()),
+					Summary:   createInviteDescription,
+				},
+			},
+			HelpSynopsis:    listInvitesHelpSynopsis,
+			HelpDescription: listInvitesHelpDescription,
+		},
+		{
+			Pattern: "invites/" + framework.GenericNameRegex("id"),
+			Fields: map[string]*framework.FieldSchema{
+				"id": {
+					Type:        framework.TypeString,
+					Description: inviteIDDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadInvite,
+					Responses: okResponse(readInviteDescription, inviteResponseFields()),
+					Summary:   readInviteDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteInvite,
+					Responses: noContentResponse(),
+					Summary:   deleteInviteDescription,
+				},
+			},
+			HelpSynopsis:    inviteHelpSynopsis,
+			HelpDescription: inviteHelpDescription,
+		},
+	}
+}
+
+// ListInvites returns the identifiers of the outstanding user invites of the tailnet, along with who each was sent to.
+func (b *Backend) ListInvites(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var invites []UserInvite
+	if err = b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("user-invites"), nil, nil, &invites); err != nil {
+		return nil, fmt.Errorf("failed to list user invites: %w", err)
+	}
+
+	ids := make([]string, 0, len(invites))
+	info := make(map[string]interface{}, len(invites))
+	for _, invite := range invites {
+		ids = append(ids, invite.ID)
+		info[invite.ID] = map[string]interface{}{
+			"email": invite.Email,
+			"role":  invite.Role,
+		}
+	}
+
+	return logical.ListResponseWithInfo(ids, info), nil
+}
+
+// CreateInvite invites a user to join the tailnet, returning the URL of the invite. Returns an error if the backend
+// is in read-only mode or during a maintenance window.
+func (b *Backend) CreateInvite(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	email := data.Get("email").(string)
+	role := data.Get("role").(string)
+
+	switch {
+	case role == "":
+		return nil, errors.New("provided role cannot be empty")
+	case email != "":
+		if _, err = mail.ParseAddress(email); err != nil {
+			return nil, fmt.Errorf("provided email is invalid: %w", err)
+		}
+	}
+
+	body := []map[string]string{{"role": role}}
+	if email != "" {
+		body[0]["email"] = email
+	}
+
+	var invites []UserInvite
+	if err = b.apiRequest(ctx, config, http.MethodPost, config.tailnetURI("user-invites"), nil, body, &invites); err != nil {
+		return nil, fmt.Errorf("failed to create user invite: %w", err)
+	}
+
+	if len(invites) == 0 {
+		return nil, errors.New("failed to create user invite: no invite was returned")
+	}
+
+	return inviteResponse(invites[0]), nil
+}
+
+// ReadInvite returns a user invite.
+func (b *Backend) ReadInvite(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var invite UserInvite
+	err = b.apiRequest(ctx, config, http.MethodGet, "user-invites/"+data.Get("id").(string), nil, nil, &invite)
+	switch {
+	case isAPINotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read user invite: %w", err)
+	}
+
+	return inviteResponse(invite), nil
+}
+
+// DeleteInvite revokes a user invite so that it can no longer be used to join the tailnet. Returns an error if the
+// backend is in read-only mode or during a maintenance window.
+func (b *Backend) DeleteInvite(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	err = b.apiRequest(ctx, config, http.MethodDelete, "user-invites/"+data.Get("id").(string), nil, nil, nil)
+	if err != nil && !isAPINotFound(err) {
+		return nil, fmt.Errorf("failed to revoke user invite: %w", err)
+	}
+
+	return &logical.Response{}, nil
+}
+
+func inviteResponse(invite UserInvite) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":                 invite.ID,
+			"role":               invite.Role,
+			"email":              invite.Email,
+			"inviter_id":         invite.InviterID,
+			"invite_url":         invite.InviteURL,
+			"last_email_sent_at": invite.LastEmailSentAt,
+		},
+	}
+}
+
+func inviteResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: inviteIDDescription,
+		},
+		"role": {
+			Type:        framework.TypeString,
+			Description: inviteRoleDescription,
+		},
+		"email": {
+			Type:        framework.TypeString,
+			Description: "The email address the invite was sent to",
+		},
+		"inviter_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the user that created the invite",
+		},
+		"invite_url": {
+			Type:        framework.TypeString,
+			Description: "The URL used to accept the invite",
+		},
+		"last_email_sent_at": {
+			Type:        framework.TypeTime,
+			Description: "When the invite was last emailed",
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_Invites(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+
+	var (
+		mu      sync.Mutex
+		invites = map[string]map[string]interface{}{}
+	)
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/api/v2/tailnet/example/user-invites" && r.Method == http.MethodPost:
+			var body []map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+			invite := body[0]
+			invite["id"] = fmt.Sprintf("invite-%d", len(invites)+1)
+			invite["inviteUrl"] = "https://login.tailscale.com/uinv/" + invite["id"].(string)
+			invites[invite["id"].(string)] = invite
+			assert.NoError(t, json.NewEncoder(w).Encode([]interface{}{invite}))
+		case r.URL.Path == "/api/v2/tailnet/example/user-invites":
+			result := make([]interface{}, 0, len(invites))
+			for _, invite := range invites {
+				result = append(result, invite)
+			}
+			assert.NoError(t, json.NewEncoder(w).Encode(result))
+		case strings.HasPrefix(r.URL.Path, "/api/v2/user-invites/"):
+			id := strings.TrimPrefix(r.URL.Path, "/api/v2/user-invites/")
+			invite, ok := invites[id]
+			switch {
+			case !ok:
+				w.WriteHeader(http.StatusNotFound)
+				assert.NoError(t, json.NewEncoder(w).Encode(map[string]string{"message": "not found"}))
+			case r.Method == http.MethodDelete:
+				delete(invites, id)
+			default:
+				assert.NoError(t, json.NewEncoder(w).Encode(invite))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should return an error if the email is invalid", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "invites", map[string]interface{}{
+			"email": "not an email",
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should create an invite", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "invites", map[string]interface{}{
+			"email": "alice@example.com",
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, "invite-1", response.Data["id"])
+		assert.EqualValues(t, "member", response.Data["role"])
+		assert.EqualValues(t, "alice@example.com", response.Data["email"])
+		assert.NotEmpty(t, response.Data["invite_url"])
+	})
+
+	t.Run("It should list invites", func(t *testing.T) {
+		response, err := request(logical.ListOperation, "invites/", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"invite-1"}, response.Data["keys"])
+	})
+
+	t.Run("It should read an invite", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "invites/invite-1", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "alice@example.com", response.Data["email"])
+	})
+
+	t.Run("It should revoke an invite", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "invites/invite-1", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "invites/invite-1", nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+}
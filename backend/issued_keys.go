@@ -0,0 +1,1040 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// The IssuedKey type describes an authentication key generated on behalf of a requester, used to track whether
+	// the key has been used to add a device to the tailnet.
+	IssuedKey struct {
+		ID            string            `json:"id"`
+		Role          string            `json:"role"`
+		Tags          []string          `json:"tags"`
+		Description   string            `json:"description"`
+		Reusable      bool              `json:"reusable"`
+		Ephemeral     bool              `json:"ephemeral"`
+		Preauthorized bool              `json:"preauthorized"`
+		EntityID      string            `json:"entity_id"`
+		EntityName    string            `json:"entity_name"`
+		DisplayName   string            `json:"display_name"`
+		Accessor      string            `json:"accessor"`
+		Created       time.Time         `json:"created"`
+		Expires       time.Time         `json:"expires"`
+		Used          bool              `json:"used"`
+		UsedAt        time.Time         `json:"used_at"`
+		DeviceID      string            `json:"device_id"`
+		Revoked       time.Time         `json:"revoked"`
+		RevokedReason string            `json:"revoked_reason"`
+		Metadata      map[string]string `json:"metadata,omitempty"`
+		Labels        map[string]string `json:"labels,omitempty"`
+		Config        string            `json:"config,omitempty"`
+		KeyAccessor   string            `json:"key_accessor,omitempty"`
+	}
+
+	// The scrubbedKey type is the tombstone left in place of the record of an outstanding key that was scrubbed, so
+	// that the key is still known to the backend without retaining anything about the entity it was issued to.
+	scrubbedKey struct {
+		Expires time.Time `json:"expires"`
+	}
+)
+
+const (
+	issuedKeyPrefix   = "issued-keys/"
+	scrubbedKeyPrefix = "scrubbed-keys/"
+
+	revokedReasonUnused   = "unused"
+	revokedReasonBatch    = "batch-incomplete"
+	revokedReasonReissued = "reissued"
+	revokedReasonLease    = "lease-revoked"
+	revokedReasonBulk     = "bulk-revoked"
+	revokedReasonRollback = "rolled-back"
+
+	defaultRevocationBatchSize = 10
+	maxRevocationBatchSize     = 100
+
+	maxMetadataEntries     = 16
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 512
+
+	maxLabels           = 16
+	maxLabelValueLength = 63
+
+	keyIDDescription         = "The identifier of the key"
+	readKeyUsageDescription  = "Report whether an issued key has been used to add a device to the tailnet"
+	listIssuedDescription    = "List the keys issued by the backend, optionally filtered by requester"
+	entityIDDescription      = "Only list keys issued to the entity with this identifier"
+	entityNameDescription    = "Only list keys issued to the entity with this name"
+	accessorDescription      = "Only list keys issued to the token with this accessor"
+	tagDescription           = "Only list keys with this tag"
+	scrubEntityDescription   = "Delete the records of all keys issued to an entity"
+	scrubEntityIDDescription = "The identifier of the entity whose records are deleted"
+	metadataDescription      = "Key-value pairs stored with the record of the issued key, such as ticket identifiers or image versions"
+	labelsDescription        = "Key-value pairs stored with the record of the issued key that issued keys can be listed by, such as cluster, region or project"
+	labelsFilterDescription  = "Only list keys with all of these labels"
+	revokeIssuedDescription  = "Delete all outstanding issued keys from the tailnet, optionally filtered by role or tag"
+	revokeRoleDescription    = "Only revoke keys generated using this role"
+	revokeTagDescription     = "Only revoke keys with this tag"
+	batchSizeDescription     = "The number of keys deleted from the tailnet at once. Defaults to 10"
+	listKeysDescription      = "List the authentication keys in the tailnet, including whether each was generated by the backend"
+
+	listIssuedHelpSynopsis    = "List the keys issued by the backend."
+	listIssuedHelpDescription = `
+Lists the identifiers of issued keys along with the role, tags, requester, labels and
+status of each. The listing can be filtered by the identity entity, token accessor, tag
+or labels of the requester or key.
+`
+	scrubEntityHelpSynopsis    = "Delete the records of all keys issued to an entity."
+	scrubEntityHelpDescription = `
+Deletes the stored record of every key issued to the given identity entity, for example
+when the entity is removed. The keys themselves are not revoked.
+`
+	revokeIssuedHelpSynopsis    = "Delete all outstanding issued keys from the tailnet."
+	revokeIssuedHelpDescription = `
+Deletes every issued key that has not expired or been revoked from the tailnet, in
+batches, so that all keys issued by the backend can be cut off in one request. This
+includes keys without a lease, such as those generated in a batch. Keys that cannot be
+deleted are reported and queued so that their deletion is retried.
+`
+	listKeysHelpSynopsis    = "List the authentication keys in the tailnet."
+	listKeysHelpDescription = `
+Lists the identifiers of the authentication keys in the tailnet of the configuration,
+along with the description, tags, capabilities and expiry of each, so that outstanding
+credentials can be reviewed without visiting the admin console. Keys generated by the
+backend are marked as managed and include the role they were generated using.
+`
+	keyUsageHelpSynopsis    = "Report whether an issued key has been used."
+	keyUsageHelpDescription = `
+Reports whether an issued key has been used to add a device to the tailnet, matching the
+key against the devices of the tailnet. When the key has been used, the name and
+hostname of the device it added are also returned.
+`
+)
+
+// labelName matches the names of labels, which start with a letter or digit and may contain letters, digits, dots,
+// underscores, hyphens and slashes.
+var labelName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]{0,62}$`)
+
+func (b *Backend) issuedKeyPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issued-keys/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"entity_id": {
+					Type:        framework.TypeString,
+					Description: entityIDDescription,
+				},
+				"entity_name": {
+					Type:        framework.TypeString,
+					Description: entityNameDescription,
+				},
+				"accessor": {
+					Type:        framework.TypeString,
+					Description: accessorDescription,
+				},
+				"tag": {
+					Type:        framework.TypeString,
+					Description: tagDescription,
+				},
+				"labels": {
+					Type:        framework.TypeKVPairs,
+					Description: labelsFilterDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListIssuedKeys,
+					Responses: listResponse(listIssuedDescription),
+					Summary:   listIssuedDescription,
+				},
+			},
+			HelpSynopsis:    listIssuedHelpSynopsis,
+			HelpDescription: listIssuedHelpDescription,
+		},
+		{
+			Pattern: "issued-keys/scrub$",
+			Fields: map[string]*framework.FieldSchema{
+				"entity_id": {
+					Type:        framework.TypeString,
+					Description: scrubEntityIDDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.ScrubEntity,
+					Responses: okResponse(scrubEntityDescription, scrubResponseFields()),
+					Summary:   scrubEntityDescription,
+				},
+			},
+			HelpSynopsis:    scrubEntityHelpSynopsis,
+			HelpDescription: scrubEntityHelpDescription,
+		},
+		{
+			Pattern: "issued-keys/revoke$",
+			Fields: map[string]*framework.FieldSchema{
+				"role": {
+					Type:        framework.TypeString,
+					Description: revokeRoleDescription,
+				},
+				"tag": {
+					Type:        framework.TypeString,
+					Description: revokeTagDescription,
+				},
+				"batch_size": {
+					Type:        framework.TypeInt,
+					Description: batchSizeDescription,
+					Default:     defaultRevocationBatchSize,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.RevokeIssuedKeys,
+					Responses: okResponse(revokeIssuedDescription, revokeIssuedResponseFields()),
+					Summary:   revokeIssuedDescription,
+				},
+			},
+			HelpSynopsis:    revokeIssuedHelpSynopsis,
+			HelpDescription: revokeIssuedHelpDescription,
+		},
+		{
+			Pattern: "keys/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListTailnetKeys,
+					Responses: listResponse(listKeysDescription),
+					Summary:   listKeysDescription,
+				},
+			},
+			HelpSynopsis:    listKeysHelpSynopsis,
+			HelpDescription: listKeysHelpDescription,
+		},
+		{
+			Pattern: "keys/" + framework.GenericNameRegex("id") + "/usage$",
+			Fields: map[string]*framework.FieldSchema{
+				"id": {
+					Type:        framework.TypeString,
+					Description: keyIDDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadKeyUsage,
+					Responses: okResponse(readKeyUsageDescription, keyUsageResponseFields()),
+					Summary:   readKeyUsageDescription,
+				},
+			},
+			HelpSynopsis:    keyUsageHelpSynopsis,
+			HelpDescription: keyUsageHelpDescription,
+		},
+	}
+}
+
+// ListIssuedKeys returns the identifiers of the keys issued by the backend along with who requested them. When an
+// entity identifier, entity name or token accessor is provided, only keys issued to matching requesters are listed.
+// When a tag is provided, only keys with that tag are listed. When labels are provided, only keys with all of them are
+// listed.
+func (b *Backend) ListIssuedKeys(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entityID := data.Get("entity_id").(string)
+	entityName := data.Get("entity_name").(string)
+	accessor := data.Get("accessor").(string)
+	tag := data.Get("tag").(string)
+	labels := data.Get("labels").(map[string]string)
+
+	ids, err := request.Storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	info := make(map[string]interface{}, len(ids))
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, request.Storage, id)
+		switch {
+		case err != nil:
+			return nil, err
+		case issued == nil:
+			continue
+		case entityID != "" && issued.EntityID != entityID:
+			continue
+		case entityName != "" && issued.EntityName != entityName:
+			continue
+		case accessor != "" && issued.Accessor != accessor:
+			continue
+		case tag != "" && !strutil.StrListContains(issued.Tags, tag):
+			continue
+		case !matchLabels(issued.Labels, labels):
+			continue
+		}
+
+		keys = append(keys, issued.ID)
+		info[issued.ID] = map[string]interface{}{
+			"role":         issued.Role,
+			"tags":         issued.Tags,
+			"entity_id":    issued.EntityID,
+			"entity_name":  issued.EntityName,
+			"display_name": issued.DisplayName,
+			"accessor":     issued.Accessor,
+			"created":      issued.Created,
+			"expires":      issued.Expires,
+			"used":         issued.Used,
+			"revoked":      issued.Revoked,
+			"metadata":     issued.Metadata,
+			"labels":       issued.Labels,
+		}
+	}
+
+	return logical.ListResponseWithInfo(keys, info), nil
+}
+
+// ListTailnetKeys returns the identifiers of the authentication keys in the tailnet along with their details. Keys the
+// backend has a record of, including the keys of static roles, are marked as managed. As the Tailscale API lists keys
+// without their details, each key is read individually.
+func (b *Backend) ListTailnetKeys(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	client, err := b.client(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := b.knownKeyIDs(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	listed, err := client.Keys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	ids := make([]string, 0, len(listed))
+	info := make(map[string]interface{}, len(listed))
+	for _, l := range listed {
+		key, err := client.GetKey(ctx, l.ID)
+		switch {
+		case tailscale.IsNotFound(err):
+			// The key was deleted after the keys were listed.
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("failed to read key %q: %w", l.ID, err)
+		}
+
+		_, managed := known[key.ID]
+		details := map[string]interface{}{
+			"description":   key.Description,
+			"tags":          key.Capabilities.Devices.Create.Tags,
+			"reusable":      key.Capabilities.Devices.Create.Reusable,
+			"ephemeral":     key.Capabilities.Devices.Create.Ephemeral,
+			"preauthorized": key.Capabilities.Devices.Create.Preauthorized,
+			"created":       key.Created,
+			"expires":       key.Expires,
+			"managed":       managed,
+		}
+
+		issued, err := b.issuedKey(ctx, request.Storage, key.ID)
+		switch {
+		case err != nil:
+			return nil, err
+		case issued != nil:
+			details["role"] = issued.Role
+		}
+
+		ids = append(ids, key.ID)
+		info[key.ID] = details
+	}
+
+	sort.Strings(ids)
+	return logical.ListResponseWithInfo(ids, info), nil
+}
+
+// ScrubEntity deletes the records of all keys issued to an entity, so that personal identifiers are removed from
+// storage when the entity is offboarded. The keys themselves are not revoked. Returns the number of records deleted.
+func (b *Backend) ScrubEntity(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entityID := data.Get("entity_id").(string)
+	if entityID == "" {
+		return nil, errors.New("provided entity_id cannot be empty")
+	}
+
+	ids, err := request.Storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, request.Storage, id)
+		switch {
+		case err != nil:
+			return nil, err
+		case issued == nil, issued.EntityID != entityID:
+			continue
+		}
+
+		if err = b.scrubIssuedKey(ctx, request.Storage, issued); err != nil {
+			return nil, err
+		}
+
+		deleted++
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"deleted": deleted,
+		},
+	}, nil
+}
+
+// RevokeIssuedKeys deletes every issued key that has not expired or been revoked from the tailnet, optionally only
+// those generated using a role or with a tag. Keys are deleted in batches of the given size. Keys that cannot be
+// deleted are returned alongside the error for each, and are queued so that their deletion is retried by the periodic
+// function.
+func (b *Backend) RevokeIssuedKeys(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role := data.Get("role").(string)
+	tag := data.Get("tag").(string)
+	batchSize := data.Get("batch_size").(int)
+	if batchSize <= 0 || batchSize > maxRevocationBatchSize {
+		return nil, fmt.Errorf("provided batch_size must be between 1 and %d", maxRevocationBatchSize)
+	}
+
+	ids, err := request.Storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	outstanding := make([]string, 0, len(ids))
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, request.Storage, id)
+		switch {
+		case err != nil:
+			return nil, err
+		case issued == nil, !issued.Revoked.IsZero():
+			continue
+		case !issued.Expires.IsZero() && !now.Before(issued.Expires):
+			continue
+		case role != "" && issued.Role != role:
+			continue
+		case tag != "" && !strutil.StrListContains(issued.Tags, tag):
+			continue
+		}
+
+		outstanding = append(outstanding, issued.ID)
+	}
+
+	revoked := make([]string, 0, len(outstanding))
+	failed := make(map[string]interface{})
+	for start := 0; start < len(outstanding); start += batchSize {
+		end := start + batchSize
+		if end > len(outstanding) {
+			end = len(outstanding)
+		}
+
+		for id, err := range b.deleteKeys(ctx, request.Storage, outstanding[start:end]) {
+			if err != nil {
+				failed[id] = err.Error()
+				continue
+			}
+
+			revoked = append(revoked, id)
+			b.markRevoked(ctx, request.Storage, id, revokedReasonBulk)
+		}
+	}
+
+	sort.Strings(revoked)
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"revoked": revoked,
+			"failed":  failed,
+		},
+	}
+
+	if len(failed) > 0 {
+		response.AddWarning(fmt.Sprintf("%d of %d keys could not be deleted and are queued for retry", len(failed), len(outstanding)))
+	}
+
+	return response, nil
+}
+
+// deleteKeys deletes the given keys from the tailnet concurrently, returning the outcome for each. Keys that no longer
+// exist are treated as deleted. Keys that cannot be deleted are queued so that their deletion is retried.
+func (b *Backend) deleteKeys(ctx context.Context, storage logical.Storage, ids []string) map[string]error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(ids))
+	)
+
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			err := b.deleteKey(ctx, storage, id)
+			if err != nil && !tailscale.IsNotFound(err) {
+				if qErr := b.queueRevocation(ctx, storage, "", id, err); qErr != nil {
+					b.Logger().Error("failed to queue key for deletion", "id", id, "error", qErr)
+				}
+			} else {
+				err = nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[id] = err
+		}(id)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// markRevoked records that an issued key has been revoked, and why. Failures are logged rather than returned, as the
+// key has already been deleted from the tailnet.
+func (b *Backend) markRevoked(ctx context.Context, storage logical.Storage, id, reason string) {
+	issued, err := b.issuedKey(ctx, storage, id)
+	if err != nil || issued == nil {
+		return
+	}
+
+	issued.Revoked = time.Now().UTC()
+	issued.RevokedReason = reason
+	if err = b.saveIssuedKey(ctx, storage, issued); err != nil {
+		b.Logger().Warn("failed to record revocation of issued key", "id", id, "error", err)
+	}
+}
+
+// ReadKeyUsage reports whether an issued key has been used to add a device to the tailnet, along with the device
+// and when it was last seen. Returns an error if the key was not issued by the backend.
+func (b *Backend) ReadKeyUsage(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id := data.Get("id").(string)
+	issued, err := b.issuedKey(ctx, request.Storage, id)
+	switch {
+	case err != nil:
+		return nil, err
+	case issued == nil:
+		return nil, fmt.Errorf("key %q was not issued by this backend", id)
+	}
+
+	config, err := b.keyConfig(ctx, request.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	if !issued.Used {
+		if device, ok := issued.matchDevice(devices); ok {
+			issued.Used = true
+			issued.UsedAt = device.Created.UTC()
+			issued.DeviceID = device.ID
+			if err = b.saveIssuedKey(ctx, request.Storage, issued); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	response := map[string]interface{}{
+		"id":             issued.ID,
+		"used":           issued.Used,
+		"used_at":        issued.UsedAt,
+		"device_id":      issued.DeviceID,
+		"revoked":        issued.Revoked,
+		"revoked_reason": issued.RevokedReason,
+		"metadata":       issued.Metadata,
+		"labels":         issued.Labels,
+	}
+
+	for _, device := range devices {
+		if issued.Used && device.ID == issued.DeviceID {
+			response["device_name"] = device.Name
+			response["hostname"] = device.Hostname
+			response["last_seen"] = device.LastSeen.UTC()
+			break
+		}
+	}
+
+	return &logical.Response{Data: response}, nil
+}
+
+// recordIssuedKey stores a record of a key generated on behalf of the requester, returning the accessor that the record
+// can be found using. Failures to store the record are logged rather than returned, as the key has already been
+// generated.
+func (b *Backend) recordIssuedKey(ctx context.Context, request *logical.Request, role *Role, key tailscale.Key, metadata, labels map[string]string) string {
+	accessor, err := uuid.GenerateUUID()
+	if err != nil {
+		b.Logger().Warn("failed to generate accessor of issued key", "id", key.ID, "error", err)
+	}
+
+	created := key.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	issued := &IssuedKey{
+		ID:            key.ID,
+		Role:          role.Name,
+		Tags:          key.Capabilities.Devices.Create.Tags,
+		Description:   withoutKeyNonce(key.Description),
+		Reusable:      key.Capabilities.Devices.Create.Reusable,
+		Ephemeral:     key.Capabilities.Devices.Create.Ephemeral,
+		Preauthorized: key.Capabilities.Devices.Create.Preauthorized,
+		EntityID:      request.EntityID,
+		DisplayName:   request.DisplayName,
+		Accessor:      request.ClientTokenAccessor,
+		Created:       created.UTC(),
+		Expires:       key.Expires.UTC(),
+		Metadata:      metadata,
+		Labels:        labels,
+		Config:        role.Config,
+		KeyAccessor:   accessor,
+	}
+
+	if request.EntityID != "" {
+		entity, err := b.System().EntityInfo(request.EntityID)
+		switch {
+		case err != nil:
+			b.Logger().Warn("failed to look up entity of issued key", "id", key.ID, "error", err)
+		case entity != nil:
+			issued.EntityName = entity.Name
+		}
+	}
+
+	if err = b.saveIssuedKey(ctx, request.Storage, issued); err != nil {
+		b.Logger().Warn("failed to record issued key", "id", key.ID, "error", err)
+		return ""
+	}
+
+	if accessor == "" {
+		return ""
+	}
+
+	if err = b.saveKeyAccessor(ctx, request.Storage, accessor, key.ID); err != nil {
+		b.Logger().Warn("failed to record accessor of issued key", "id", key.ID, "error", err)
+		return ""
+	}
+
+	return accessor
+}
+
+// parseMetadata returns the metadata provided in the request. Returns an error if there are more than 16 entries, or
+// if any key or value is too long.
+func parseMetadata(data *framework.FieldData) (map[string]string, error) {
+	value, ok := data.GetOk("metadata")
+	if !ok {
+		return nil, nil
+	}
+
+	metadata := value.(map[string]string)
+	if len(metadata) > maxMetadataEntries {
+		return nil, fmt.Errorf("provided metadata cannot contain more than %d entries", maxMetadataEntries)
+	}
+
+	for k, v := range metadata {
+		switch {
+		case k == "":
+			return nil, errors.New("provided metadata cannot contain empty keys")
+		case len(k) > maxMetadataKeyLength:
+			return nil, fmt.Errorf("provided metadata key %q exceeds %d characters", k, maxMetadataKeyLength)
+		case len(v) > maxMetadataValueLength:
+			return nil, fmt.Errorf("provided metadata value of %q exceeds %d characters", k, maxMetadataValueLength)
+		}
+	}
+
+	return metadata, nil
+}
+
+// parseLabels returns the labels provided in the request. Returns an error if there are more than 16 labels, or if any
+// name or value is invalid.
+func parseLabels(data *framework.FieldData) (map[string]string, error) {
+	value, ok := data.GetOk("labels")
+	if !ok {
+		return nil, nil
+	}
+
+	labels := value.(map[string]string)
+	if len(labels) > maxLabels {
+		return nil, fmt.Errorf("provided labels cannot contain more than %d entries", maxLabels)
+	}
+
+	for k, v := range labels {
+		switch {
+		case !labelName.MatchString(k):
+			return nil, fmt.Errorf("provided label name %q must start with a letter or digit and contain at most 63 letters, digits, dots, underscores, hyphens or slashes", k)
+		case len(v) > maxLabelValueLength:
+			return nil, fmt.Errorf("provided value of label %q exceeds %d characters", k, maxLabelValueLength)
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return labels, nil
+}
+
+// matchLabels returns true if the labels contain every one of the wanted labels with the same value.
+func matchLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// revokeUnusedKeys checks issued keys against the devices in the tailnet, marking those that have been used to add a
+// device. Keys that remain unused once the configured grace period has elapsed are deleted from the tailnet. A key is
+// considered used when a device carrying all of the key's tags was added to the tailnet after the key was created. Keys
+// generated using a named configuration are not checked, as they belong to another tailnet.
+func (b *Backend) revokeUnusedKeys(ctx context.Context, storage logical.Storage) error {
+	ids, err := storage.List(ctx, issuedKeyPrefix)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	config, err := b.config(ctx, storage)
+	switch {
+	case err != nil:
+		return err
+	case config.RevokeUnusedAfter <= 0, config.ReadOnly:
+		return nil
+	}
+
+	var pending []*IssuedKey
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, storage, id)
+		switch {
+		case err != nil:
+			return err
+		case issued == nil, issued.Used, !issued.Revoked.IsZero(), issued.Config != "":
+			continue
+		}
+
+		pending = append(pending, issued)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	var errs *multierror.Error
+	now := time.Now()
+	for _, issued := range pending {
+		if device, ok := issued.matchDevice(devices); ok {
+			issued.Used = true
+			issued.UsedAt = device.Created.UTC()
+			issued.DeviceID = device.ID
+			errs = multierror.Append(errs, b.saveIssuedKey(ctx, storage, issued))
+			continue
+		}
+
+		if now.Before(issued.Created.Add(config.RevokeUnusedAfter)) {
+			continue
+		}
+
+		if err = b.deleteKey(ctx, storage, issued.ID); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to revoke unused key %q: %w", issued.ID, err))
+			continue
+		}
+
+		issued.Revoked = now.UTC()
+		issued.RevokedReason = revokedReasonUnused
+		b.incrCounter(ctx, storage, []string{"keys", "revoked", "unused"})
+		errs = multierror.Append(errs, b.saveIssuedKey(ctx, storage, issued))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// purgeIssuedKeys deletes the records of issued keys that expired or were revoked longer ago than the configured
+// retention. Records of keys that have neither expired nor been revoked are kept regardless of their age.
+func (b *Backend) purgeIssuedKeys(ctx context.Context, storage logical.Storage) error {
+	ids, err := storage.List(ctx, issuedKeyPrefix)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	config, err := b.config(ctx, storage)
+	switch {
+	case err != nil:
+		return err
+	case config.IssuedKeyRetention <= 0:
+		return nil
+	}
+
+	_, err = b.tidyIssuedKeys(ctx, storage, time.Now().Add(-config.IssuedKeyRetention), false)
+	return err
+}
+
+// matchDevice returns the first device added to the tailnet after the key was created that has all of the key's tags.
+func (k *IssuedKey) matchDevice(devices []tailscale.Device) (tailscale.Device, bool) {
+	for _, device := range devices {
+		if device.Created.Before(k.Created) {
+			continue
+		}
+
+		if strutil.StrListSubset(device.Tags, k.Tags) {
+			return device, true
+		}
+	}
+
+	return tailscale.Device{}, false
+}
+
+// devices returns the devices added to the tailnet using the key. A single-use key adds at most one device, which is
+// the device the key is recorded as being used by, or otherwise the device matching it. A reusable key is matched
+// against every device added to the tailnet after it was created that has all of the key's tags.
+func (k *IssuedKey) devices(devices []tailscale.Device) []tailscale.Device {
+	if !k.Reusable {
+		device, ok := findDevice(devices, k.DeviceID)
+		if !k.Used {
+			device, ok = k.matchDevice(devices)
+		}
+		if !ok {
+			return nil
+		}
+
+		return []tailscale.Device{device}
+	}
+
+	var matched []tailscale.Device
+	for _, device := range devices {
+		if !device.Created.Before(k.Created) && strutil.StrListSubset(device.Tags, k.Tags) {
+			matched = append(matched, device)
+		}
+	}
+
+	return matched
+}
+
+// issuedDevices returns the devices that were added to the tailnet using keys issued by the Backend, according to its
+// records of issued keys. Keys not yet known to be used are matched against the devices, unless they were revoked.
+func (b *Backend) issuedDevices(ctx context.Context, storage logical.Storage, devices []tailscale.Device) ([]tailscale.Device, error) {
+	ids, err := storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var issuedDevices []tailscale.Device
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, storage, id)
+		switch {
+		case err != nil:
+			return nil, err
+		case issued == nil:
+			continue
+		}
+
+		var (
+			device tailscale.Device
+			ok     bool
+		)
+
+		if issued.Used {
+			device, ok = findDevice(devices, issued.DeviceID)
+		} else if issued.Revoked.IsZero() {
+			device, ok = issued.matchDevice(devices)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if _, found := findDevice(issuedDevices, device.ID); !found {
+			issuedDevices = append(issuedDevices, device)
+		}
+	}
+
+	return issuedDevices, nil
+}
+
+func (b *Backend) saveIssuedKey(ctx context.Context, storage logical.Storage, issued *IssuedKey) error {
+	entry, err := logical.StorageEntryJSON(issuedKeyPrefix+issued.ID, issued)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+// deleteIssuedKey deletes the record of an issued key along with its accessor.
+func (b *Backend) deleteIssuedKey(ctx context.Context, storage logical.Storage, issued *IssuedKey) error {
+	if issued.KeyAccessor != "" {
+		if err := storage.Delete(ctx, keyAccessorPrefix+issued.KeyAccessor); err != nil {
+			return err
+		}
+	}
+
+	return storage.Delete(ctx, issuedKeyPrefix+issued.ID)
+}
+
+// scrubIssuedKey deletes the record of an issued key. If the key has neither expired nor been revoked, a tombstone
+// holding only its expiry is left in its place so that key reconciliation does not treat it as unknown.
+func (b *Backend) scrubIssuedKey(ctx context.Context, storage logical.Storage, issued *IssuedKey) error {
+	now := time.Now()
+	if issued.Revoked.IsZero() && (issued.Expires.IsZero() || now.Before(issued.Expires)) {
+		entry, err := logical.StorageEntryJSON(scrubbedKeyPrefix+issued.ID, scrubbedKey{Expires: issued.Expires})
+		if err != nil {
+			return err
+		}
+
+		if err = storage.Put(ctx, entry); err != nil {
+			return err
+		}
+	}
+
+	return b.deleteIssuedKey(ctx, storage, issued)
+}
+
+// tidyScrubbedKeys removes the tombstones of scrubbed keys that have since expired.
+func (b *Backend) tidyScrubbedKeys(ctx context.Context, storage logical.Storage) error {
+	ids, err := storage.List(ctx, scrubbedKeyPrefix)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	now := time.Now()
+	for _, id := range ids {
+		entry, err := storage.Get(ctx, scrubbedKeyPrefix+id)
+		switch {
+		case err != nil:
+			errs = multierror.Append(errs, err)
+			continue
+		case entry == nil:
+			continue
+		}
+
+		var scrubbed scrubbedKey
+		if err = entry.DecodeJSON(&scrubbed); err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+
+		if scrubbed.Expires.IsZero() || now.Before(scrubbed.Expires) {
+			continue
+		}
+
+		errs = multierror.Append(errs, storage.Delete(ctx, scrubbedKeyPrefix+id))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (b *Backend) issuedKey(ctx context.Context, storage logical.Storage, id string) (*IssuedKey, error) {
+	entry, err := storage.Get(ctx, issuedKeyPrefix+id)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var issued IssuedKey
+	if err = entry.DecodeJSON(&issued); err != nil {
+		return nil, err
+	}
+
+	return &issued, nil
+}
+
+func scrubResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"deleted": {
+			Type:        framework.TypeInt,
+			Description: "The number of records deleted",
+		},
+	}
+}
+
+func revokeIssuedResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"revoked": {
+			Type:        framework.TypeStringSlice,
+			Description: "The identifiers of the keys deleted from the tailnet",
+		},
+		"failed": {
+			Type:        framework.TypeMap,
+			Description: "The identifiers of the keys that could not be deleted, each with the error encountered. These keys are queued for retry",
+		},
+	}
+}
+
+func keyUsageResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: keyIDDescription,
+		},
+		"used": {
+			Type:        framework.TypeBool,
+			Description: "Whether the key has been used to add a device to the tailnet",
+		},
+		"used_at": {
+			Type:        framework.TypeTime,
+			Description: "When the device was added using the key",
+		},
+		"device_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the device added using the key",
+		},
+		"revoked": {
+			Type:        framework.TypeTime,
+			Description: "When the key was revoked",
+		},
+		"revoked_reason": {
+			Type:        framework.TypeString,
+			Description: "Why the key was revoked",
+		},
+		"metadata": {
+			Type:        framework.TypeKVPairs,
+			Description: metadataDescription,
+		},
+		"labels": {
+			Type:        framework.TypeKVPairs,
+			Description: labelsDescription,
+		},
+		"device_name": {
+			Type:        framework.TypeString,
+			Description: "The name of the device added using the key",
+		},
+		"hostname": {
+			Type:        framework.TypeString,
+			Description: "The hostname of the device added using the key",
+		},
+		"last_seen": {
+			Type:        framework.TypeTime,
+			Description: "When the device added using the key was last seen",
+		},
+	}
+}
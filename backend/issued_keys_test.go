@@ -0,0 +1,506 @@
+package backend_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_RevokeUnusedKeys(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"tailnet":             "example",
+		"api_key":             "example",
+		"api_url":             "http://localhost:1337",
+		"issuer_tag":          "",
+		"revoke_unused_after": "1s",
+	})
+	require.NoError(t, err)
+
+	for _, tag := range []string{"tag:used", "tag:unused"} {
+		_, err = request(logical.ReadOperation, "key", map[string]interface{}{
+			"tags": tag,
+		})
+		require.NoError(t, err)
+	}
+
+	api.SetDevices(tailscale.Device{
+		ID:      "device-1",
+		Tags:    []string{"tag:used"},
+		Created: tailscale.Time{Time: time.Now().Add(time.Minute)},
+	})
+
+	t.Run("It should not revoke keys within the grace period", func(t *testing.T) {
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+		assert.Empty(t, api.Deleted())
+	})
+
+	t.Run("It should revoke keys unused after the grace period", func(t *testing.T) {
+		time.Sleep(time.Second)
+
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-2"}, api.Deleted())
+	})
+}
+
+func TestBackend_ReadKeyUsage(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.ReadOperation, "key", map[string]interface{}{
+		"tags": "tag:test",
+	})
+	require.NoError(t, err)
+
+	t.Run("It should report a key that has not been used", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "keys/key-1/usage", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, false, response.Data["used"])
+	})
+
+	t.Run("It should report the device that used a key", func(t *testing.T) {
+		lastSeen := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		api.SetDevices(tailscale.Device{
+			ID:       "device-1",
+			Name:     "device-1.example.ts.net",
+			Hostname: "device-1",
+			Tags:     []string{"tag:test"},
+			Created:  tailscale.Time{Time: time.Now().Add(time.Minute)},
+			LastSeen: tailscale.Time{Time: lastSeen},
+		})
+
+		response, err := request(logical.ReadOperation, "keys/key-1/usage", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, true, response.Data["used"])
+		assert.EqualValues(t, "device-1", response.Data["device_id"])
+		assert.EqualValues(t, "device-1", response.Data["hostname"])
+		assert.EqualValues(t, lastSeen, response.Data["last_seen"])
+	})
+
+	t.Run("It should return an error for keys not issued by the backend", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "keys/unknown/usage", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestBackend_ListIssuedKeys(t *testing.T) {
+	ctx := context.Background()
+
+	config := logical.TestBackendConfig()
+	config.System.(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:   "entity-1",
+		Name: "alice",
+	}
+
+	b, err := backend.Create(ctx, config)
+	require.NoError(t, err)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	requesters := []struct {
+		EntityID string
+		Accessor string
+		Tag      string
+	}{
+		{EntityID: "entity-1", Accessor: "accessor-1", Tag: "tag:ci"},
+		{EntityID: "entity-1", Accessor: "accessor-2", Tag: "tag:web"},
+		{Accessor: "accessor-3", Tag: "tag:ci"},
+	}
+
+	for _, requester := range requesters {
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation:           logical.ReadOperation,
+			Path:                "key",
+			Storage:             storage,
+			EntityID:            requester.EntityID,
+			ClientTokenAccessor: requester.Accessor,
+			Data:                map[string]interface{}{"tags": requester.Tag},
+		})
+		require.NoError(t, err)
+	}
+
+	tt := []struct {
+		Name     string
+		Data     map[string]interface{}
+		Expected []string
+	}{
+		{
+			Name:     "It should list all issued keys",
+			Expected: []string{"key-1", "key-2", "key-3"},
+		},
+		{
+			Name: "It should filter issued keys by entity identifier",
+			Data: map[string]interface{}{
+				"entity_id": "entity-1",
+			},
+			Expected: []string{"key-1", "key-2"},
+		},
+		{
+			Name: "It should filter issued keys by entity name",
+			Data: map[string]interface{}{
+				"entity_name": "alice",
+			},
+			Expected: []string{"key-1", "key-2"},
+		},
+		{
+			Name: "It should filter issued keys by token accessor",
+			Data: map[string]interface{}{
+				"accessor": "accessor-3",
+			},
+			Expected: []string{"key-3"},
+		},
+		{
+			Name: "It should filter issued keys by tag",
+			Data: map[string]interface{}{
+				"tag": "tag:ci",
+			},
+			Expected: []string{"key-1", "key-3"},
+		},
+		{
+			Name: "It should return no keys if none match",
+			Data: map[string]interface{}{
+				"entity_id": "entity-2",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ListOperation,
+				Path:      "issued-keys/",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			require.NoError(t, err)
+
+			keys, _ := response.Data["keys"].([]string)
+			assert.EqualValues(t, tc.Expected, keys)
+		})
+	}
+}
+
+func TestBackend_IssuedKeyRetention(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	mockKeysAPI(t)
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"tailnet":              "example",
+			"api_key":              "example",
+			"api_url":              "http://localhost:1337",
+			"issued_key_retention": "24h",
+		},
+	})
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	records := []backend.IssuedKey{
+		{ID: "expired", Expires: now.Add(-48 * time.Hour)},
+		{ID: "revoked", Expires: now.Add(time.Hour), Revoked: now.Add(-48 * time.Hour)},
+		{ID: "recently-expired", Expires: now.Add(-time.Hour)},
+		{ID: "active", Expires: now.Add(time.Hour)},
+	}
+
+	for _, record := range records {
+		entry, err := logical.StorageEntryJSON("issued-keys/"+record.ID, record)
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+	}
+
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   storage,
+	})
+	require.NoError(t, err)
+
+	remaining, err := storage.List(ctx, "issued-keys/")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"recently-expired", "active"}, remaining)
+}
+
+func TestBackend_ScrubEntity(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	for id, entity := range map[string]string{"key-1": "entity-1", "key-2": "entity-1", "key-3": "entity-2"} {
+		entry, err := logical.StorageEntryJSON("issued-keys/"+id, backend.IssuedKey{ID: id, EntityID: entity})
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+	}
+
+	t.Run("It should return an error if no entity is provided", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issued-keys/scrub",
+			Storage:   storage,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should delete the records of the entity", func(t *testing.T) {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issued-keys/scrub",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"entity_id": "entity-1",
+			},
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, response.Data["deleted"])
+
+		remaining, err := storage.List(ctx, "issued-keys/")
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-3"}, remaining)
+	})
+}
+
+func TestBackend_IssuedKeyMetadata(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should return an error if the metadata has too many entries", func(t *testing.T) {
+		metadata := make(map[string]interface{})
+		for i := 0; i < 17; i++ {
+			metadata[fmt.Sprint("key-", i)] = "value"
+		}
+
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{
+			"metadata": metadata,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should return an error if a metadata value is too long", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{
+			"metadata": map[string]interface{}{"ticket": strings.Repeat("a", 513)},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should store the metadata with the issued key", func(t *testing.T) {
+		expected := map[string]string{"ticket": "OPS-123", "image": "v1.2.3"}
+
+		response, err := request(logical.ReadOperation, "key", map[string]interface{}{
+			"metadata": []string{"ticket=OPS-123", "image=v1.2.3"},
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, expected, response.Data["metadata"])
+
+		response, err = request(logical.ReadOperation, "keys/"+response.Data["id"].(string)+"/usage", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, expected, response.Data["metadata"])
+	})
+}
+
+func TestBackend_IssuedKeyLabels(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	for _, labels := range [][]string{
+		{"cluster=prod-1", "region=eu-west-1"},
+		{"cluster=prod-2", "region=eu-west-1"},
+		{"cluster=prod-1", "region=us-east-1"},
+	} {
+		response, err := request(logical.ReadOperation, "key", map[string]interface{}{"labels": labels})
+		require.NoError(t, err)
+		assert.Len(t, response.Data["labels"], 2)
+	}
+
+	_, err := request(logical.ReadOperation, "key", nil)
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name         string
+		Data         map[string]interface{}
+		ExpectedKeys []string
+	}{
+		{
+			Name:         "It should list all keys without a filter",
+			ExpectedKeys: []string{"key-1", "key-2", "key-3", "key-4"},
+		},
+		{
+			Name:         "It should list keys with a label",
+			Data:         map[string]interface{}{"labels": "region=eu-west-1"},
+			ExpectedKeys: []string{"key-1", "key-2"},
+		},
+		{
+			Name:         "It should list keys with all of the labels",
+			Data:         map[string]interface{}{"labels": []string{"cluster=prod-1", "region=us-east-1"}},
+			ExpectedKeys: []string{"key-3"},
+		},
+		{
+			Name:         "It should list no keys if none have the label",
+			Data:         map[string]interface{}{"labels": "project=billing"},
+			ExpectedKeys: []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			response, err := request(logical.ListOperation, "issued-keys/", tc.Data)
+			require.NoError(t, err)
+
+			keys, _ := response.Data["keys"].([]string)
+			if keys == nil {
+				keys = []string{}
+			}
+
+			assert.ElementsMatch(t, tc.ExpectedKeys, keys)
+		})
+	}
+
+	t.Run("It should return an error if a label name is invalid", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{
+			"labels": map[string]interface{}{"-team": "platform"},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should return an error if a label value is too long", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{
+			"labels": map[string]interface{}{"team": strings.Repeat("a", 64)},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestBackend_RevokeIssuedKeys(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	for _, role := range []string{"ci", "web"} {
+		_, err := request(logical.UpdateOperation, "roles/"+role, map[string]interface{}{"tags": "tag:" + role})
+		require.NoError(t, err)
+	}
+
+	for _, role := range []string{"ci", "ci", "ci", "web"} {
+		_, err := request(logical.ReadOperation, "creds/"+role, nil)
+		require.NoError(t, err)
+	}
+
+	t.Run("It should revoke the outstanding keys of a role in batches", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "issued-keys/revoke", map[string]interface{}{
+			"role":       "ci",
+			"batch_size": 2,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-1", "key-2", "key-3"}, response.Data["revoked"])
+		assert.Empty(t, response.Data["failed"])
+		assert.ElementsMatch(t, []string{"key-1", "key-2", "key-3"}, api.Deleted())
+	})
+
+	t.Run("It should not revoke keys that have already been revoked", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "issued-keys/revoke", map[string]interface{}{"tag": "tag:ci"})
+		require.NoError(t, err)
+		assert.Empty(t, response.Data["revoked"])
+	})
+
+	t.Run("It should report and queue keys that could not be deleted", func(t *testing.T) {
+		api.SetFailingDeletes(true)
+		defer api.SetFailingDeletes(false)
+
+		response, err := request(logical.UpdateOperation, "issued-keys/revoke", nil)
+		require.NoError(t, err)
+		assert.Empty(t, response.Data["revoked"])
+		assert.Contains(t, response.Data["failed"], "key-4")
+		assert.NotEmpty(t, response.Warnings)
+
+		queued, err := storage.List(ctx, "revocations/")
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-4"}, queued)
+	})
+
+	t.Run("It should return an error for an invalid batch size", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "issued-keys/revoke", map[string]interface{}{"batch_size": 0})
+		assert.Error(t, err)
+	})
+}
+
+func TestBackend_ListTailnetKeys(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "roles/ci", map[string]interface{}{"tags": "tag:ci"})
+	require.NoError(t, err)
+
+	_, err = request(logical.ReadOperation, "creds/ci", nil)
+	require.NoError(t, err)
+
+	console := tailscale.Key{ID: "key-console", Description: "created in the admin console"}
+	console.Capabilities.Devices.Create.Tags = []string{"tag:server"}
+	console.Capabilities.Devices.Create.Reusable = true
+	api.SetKeys(console)
+
+	response, err := request(logical.ListOperation, "keys/", nil)
+	require.NoError(t, err)
+
+	t.Run("It should list the keys in the tailnet", func(t *testing.T) {
+		assert.EqualValues(t, []string{"key-1", "key-console"}, response.Data["keys"])
+	})
+
+	t.Run("It should mark the keys generated by the backend along with their role", func(t *testing.T) {
+		info := response.Data["key_info"].(map[string]interface{})["key-1"].(map[string]interface{})
+		assert.EqualValues(t, true, info["managed"])
+		assert.EqualValues(t, "ci", info["role"])
+	})
+
+	t.Run("It should include the details of keys created outside of the backend", func(t *testing.T) {
+		info := response.Data["key_info"].(map[string]interface{})["key-console"].(map[string]interface{})
+		assert.EqualValues(t, false, info["managed"])
+		assert.EqualValues(t, "created in the admin console", info["description"])
+		assert.EqualValues(t, []string{"tag:server"}, info["tags"])
+		assert.EqualValues(t, true, info["reusable"])
+		assert.NotContains(t, info, "role")
+	})
+}
@@ -0,0 +1,318 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+const secretTypeKey = "key"
+
+func (b *Backend) keySecret() *framework.Secret {
+	return &framework.Secret{
+		Type:   secretTypeKey,
+		Fields: keyResponseFields(),
+		Revoke: b.RevokeKeyLease,
+		Renew:  b.RenewKeyLease,
+	}
+}
+
+// RevokeKeyLease deletes a key from the tailnet when its lease expires or is revoked. If the deletion fails, it is
+// retried by the periodic function, unless the configuration enables strict revocation, in which case an error is
+// returned and Vault retries the revocation of the lease instead. The key is deleted from the tailnet of the
+// configuration stored with the lease, so that it is revoked even if the record of the key has since been deleted.
+func (b *Backend) RevokeKeyLease(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	id, ok := request.Secret.InternalData["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("lease does not contain a key identifier")
+	}
+
+	// Leases issued before the configuration was stored with them are revoked using the record of the key.
+	configName, _ := request.Secret.InternalData["config"].(string)
+	if err := b.revokeLeasedKey(ctx, request.Storage, configName, id); err != nil {
+		return nil, err
+	}
+
+	if deleteDevices, _ := request.Secret.InternalData["delete_devices"].(bool); deleteDevices {
+		if err := b.deleteKeyDevices(ctx, request.Storage, configName, id); err != nil {
+			return nil, err
+		}
+	}
+
+	b.markRevoked(ctx, request.Storage, id, revokedReasonLease)
+	return &logical.Response{}, nil
+}
+
+// revokeLeasedKey deletes a key whose lease is being revoked from the tailnet. If the configuration enables strict
+// revocation, a failed deletion is returned rather than queued, so that the lease is only revoked once the key has
+// been deleted.
+func (b *Backend) revokeLeasedKey(ctx context.Context, storage logical.Storage, configName, id string) error {
+	config, err := b.config(ctx, storage)
+	if err != nil || !config.StrictRevocation {
+		// Keys generated using named configurations can be revoked without the configuration of the mount.
+		return b.revokeKeyFrom(ctx, storage, configName, id)
+	}
+
+	err = b.deleteKeyFrom(ctx, storage, configName, id)
+	if err == nil || tailscale.IsNotFound(err) {
+		return nil
+	}
+
+	return fmt.Errorf("failed to delete key %q: %w", id, err)
+}
+
+// deleteKeyDevices deletes the devices added to the tailnet using a key, so that workloads using a revoked key are
+// disconnected from the tailnet. Devices are attributed to the key using its record, so none are deleted if the record
+// has since been scrubbed, purged or tidied. Returns ErrMaintenance within a maintenance window, so that the revocation
+// of the lease is retried once the window closes.
+func (b *Backend) deleteKeyDevices(ctx context.Context, storage logical.Storage, configName, id string) error {
+	issued, err := b.issuedKey(ctx, storage, id)
+	switch {
+	case err != nil:
+		return err
+	case issued == nil:
+		// Failing would leave the lease unrevocable, as the record cannot be restored.
+		b.Logger().Warn("no record of revoked key exists, so its devices cannot be deleted", "key_id", id)
+		return nil
+	}
+
+	config, err := b.revocationConfig(ctx, storage, configName, id)
+	if err != nil {
+		return err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return err
+	}
+
+	if err = b.checkMaintenance(ctx, storage); err != nil {
+		return err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	var errs *multierror.Error
+	for _, device := range issued.devices(devices) {
+		err = client.DeleteDevice(ctx, device.ID)
+		if err != nil && !tailscale.IsNotFound(err) {
+			errs = multierror.Append(errs, fmt.Errorf("failed to delete device %q: %w", device.ID, err))
+			continue
+		}
+
+		b.Logger().Info("deleted device added using revoked key", "key_id", id, "device_id", device.ID)
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// RenewKeyLease extends the lease of a key, up to the time the key expires. If the role the key was generated using
+// reissues keys on renewal, the key is instead replaced by a new one with the same capabilities and lifetime, which is
+// returned in the response, and the original key is deleted from the tailnet.
+func (b *Backend) RenewKeyLease(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	id, ok := request.Secret.InternalData["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("lease does not contain a key identifier")
+	}
+
+	issued, err := b.issuedKey(ctx, request.Storage, id)
+	switch {
+	case err != nil:
+		return nil, err
+	case issued == nil:
+		return nil, fmt.Errorf("no record of key %q exists", id)
+	case !issued.Revoked.IsZero():
+		return nil, fmt.Errorf("key %q has been revoked", id)
+	}
+
+	role := &Role{}
+	if issued.Role != "" {
+		if role, err = b.role(ctx, request.Storage, issued.Role); err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, fmt.Errorf("role %q no longer exists", issued.Role)
+		}
+	}
+
+	// An expired key is never renewed, nor replaced by a new key.
+	now := time.Now()
+	if !issued.Expires.IsZero() && !now.Before(issued.Expires) {
+		return nil, fmt.Errorf("key %q has expired", id)
+	}
+
+	if role.ReissueOnRenew {
+		return b.reissueKey(ctx, request, role, issued)
+	}
+
+	response := &logical.Response{Secret: request.Secret}
+	response.Secret.TTL, response.Secret.MaxTTL = renewedLeaseDuration(request.Secret, role, issued.Expires, now)
+
+	return response, nil
+}
+
+// reissueKey replaces a key whose lease is being renewed with a new key with the same capabilities, description and
+// lifetime. The lease is moved to the new key, which is recorded alongside the original, and the original key is
+// deleted from the tailnet. The checks of the role that do not depend on the requester are applied as they are when a
+// key is generated.
+func (b *Backend) reissueKey(ctx context.Context, request *logical.Request, role *Role, issued *IssuedKey) (*logical.Response, error) {
+	// Roles stored before their settings were validated against reissue_on_renew are checked again.
+	if err := role.checkReissue(); err != nil {
+		return nil, fmt.Errorf("key %q cannot be reissued: %w", issued.ID, err)
+	}
+
+	if err := role.checkIssuanceWindows(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	config, err := b.keyConfig(ctx, request.Storage, issued.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.checkDeviceLimit(ctx, config); err != nil {
+		return nil, err
+	}
+
+	var capabilities tailscale.KeyCapabilities
+	capabilities.Devices.Create.Tags = issued.Tags
+	capabilities.Devices.Create.Reusable = issued.Reusable
+	capabilities.Devices.Create.Ephemeral = issued.Ephemeral
+	capabilities.Devices.Create.Preauthorized = issued.Preauthorized
+
+	var expiry time.Duration
+	if !issued.Expires.IsZero() {
+		expiry = issued.Expires.Sub(issued.Created).Round(time.Second)
+	}
+
+	// The issuer tag is added again by createKey, and the description prefix is already part of the description.
+	config.DescriptionPrefix = ""
+	key, err := b.createKey(ctx, request.Storage, config, capabilities, expiry, issued.Description, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reissue key %q: %w", issued.ID, err)
+	}
+
+	reissued := *issued
+	reissued.ID = key.ID
+	reissued.Tags = key.Capabilities.Devices.Create.Tags
+	reissued.Created = time.Now().UTC()
+	reissued.Expires = key.Expires.UTC()
+	reissued.Used = false
+	reissued.UsedAt = time.Time{}
+	reissued.DeviceID = ""
+	if err = b.saveIssuedKey(ctx, request.Storage, &reissued); err != nil {
+		b.Logger().Warn("failed to record reissued key", "id", key.ID, "error", err)
+	}
+
+	// The accessor of the original key continues to refer to the key that replaced it.
+	if reissued.KeyAccessor != "" {
+		if err = b.saveKeyAccessor(ctx, request.Storage, reissued.KeyAccessor, key.ID); err != nil {
+			b.Logger().Warn("failed to record accessor of reissued key", "id", key.ID, "error", err)
+		}
+	}
+
+	if err = b.revokeKey(ctx, request.Storage, issued.ID); err != nil {
+		b.Logger().Warn("failed to revoke key replaced on renewal", "id", issued.ID, "error", err)
+	}
+
+	b.markRevoked(ctx, request.Storage, issued.ID, revokedReasonReissued)
+
+	response := keyResponse(key)
+	if reissued.KeyAccessor != "" {
+		response.Data["key_accessor"] = reissued.KeyAccessor
+	}
+	if len(issued.Metadata) > 0 {
+		response.Data["metadata"] = issued.Metadata
+	}
+	if len(issued.Labels) > 0 {
+		response.Data["labels"] = issued.Labels
+	}
+
+	response.Data = role.filterResponse(response.Data)
+	response.Secret = request.Secret
+	response.Secret.InternalData["id"] = key.ID
+	response.Secret.TTL, response.Secret.MaxTTL = renewedLeaseDuration(request.Secret, role, key.Expires, time.Now())
+
+	return response, nil
+}
+
+// renewedLeaseDuration returns the ttl and max_ttl of a renewed lease of a key expiring at the given time. Vault
+// measures the max_ttl of a renewed lease from when it was issued, whereas its ttl is measured from now.
+func renewedLeaseDuration(secret *logical.Secret, role *Role, expires time.Time, now time.Time) (time.Duration, time.Duration) {
+	issuedAt := secret.IssueTime
+	if issuedAt.IsZero() {
+		issuedAt = now
+	}
+
+	key := tailscale.Key{Expires: expires}
+	_, maxTTL := leaseDuration(role, key, issuedAt)
+	ttl, _ := leaseDuration(role, key, now)
+
+	return ttl, maxTTL
+}
+
+// leaseKey returns the response for a key generated using the role with a lease of the role's ttl and max_ttl, so that
+// the key is deleted from the tailnet when the lease expires or is revoked. The lease never outlives the key, lasting
+// until it expires if the role sets no ttl. The identifier of the key, along with the role and the named configuration
+// it was generated using, are stored with the lease.
+func (b *Backend) leaseKey(response *logical.Response, role *Role, key tailscale.Key) *logical.Response {
+	response = b.Secret(secretTypeKey).Response(response.Data, map[string]interface{}{
+		"id":             key.ID,
+		"role":           role.Name,
+		"config":         role.Config,
+		"delete_devices": role.DeleteDevices,
+	})
+	response.Secret.TTL, response.Secret.MaxTTL = leaseDuration(role, key, time.Now())
+
+	return response
+}
+
+// leaseDuration returns the ttl and max_ttl of the lease of a key generated using the role, capped at the time
+// remaining until the key expires. The ttl and max_ttl of the role are returned unchanged if the key does not expire.
+func leaseDuration(role *Role, key tailscale.Key, now time.Time) (time.Duration, time.Duration) {
+	if key.Expires.IsZero() {
+		return role.TTL, role.MaxTTL
+	}
+
+	// Leases are measured in whole seconds, so the remaining lifetime is rounded down to avoid outliving the key.
+	remaining := key.Expires.Sub(now).Truncate(time.Second)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+
+	maxTTL := role.MaxTTL
+	if maxTTL == 0 || maxTTL > remaining {
+		maxTTL = remaining
+	}
+
+	ttl := role.TTL
+	if ttl == 0 || ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	return ttl, maxTTL
+}
+
+// leasedKeyID returns the identifier of the key leased by a response returned from issueKey. Unlike the response data,
+// this is available regardless of the fields returned by the role.
+func leasedKeyID(response *logical.Response) string {
+	if response.Secret == nil {
+		return ""
+	}
+
+	id, _ := response.Secret.InternalData["id"].(string)
+	return id
+}
@@ -0,0 +1,459 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_KeyLeases(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "roles/unleased", map[string]interface{}{"tags": "tag:ci"})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "roles/leased", map[string]interface{}{
+		"tags":    "tag:ci",
+		"ttl":     "1h",
+		"max_ttl": "2h",
+	})
+	require.NoError(t, err)
+
+	t.Run("It should lease keys until they expire if the role does not set a ttl", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/unleased", map[string]interface{}{"expiry": "3h"})
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+		assert.InDelta(t, 3*time.Hour, response.Secret.TTL, float64(2*time.Second))
+		assert.InDelta(t, 3*time.Hour, response.Secret.MaxTTL, float64(2*time.Second))
+		assert.EqualValues(t, response.Data["id"], response.Secret.InternalData["id"])
+	})
+
+	t.Run("It should not lease keys beyond their expiry", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/leased", map[string]interface{}{"expiry": "90m"})
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+		assert.EqualValues(t, time.Hour, response.Secret.TTL)
+		assert.InDelta(t, 90*time.Minute, response.Secret.MaxTTL, float64(2*time.Second))
+	})
+
+	t.Run("It should lease keys generated without a role", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "key", map[string]interface{}{"tags": []string{"tag:server"}})
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    response.Secret,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, api.Deleted(), response.Data["id"])
+	})
+
+	t.Run("It should lease keys using the ttl of the role", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/leased", nil)
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+		assert.EqualValues(t, time.Hour, response.Secret.TTL)
+		assert.EqualValues(t, 2*time.Hour, response.Secret.MaxTTL)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    response.Secret,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, api.Deleted(), response.Data["id"])
+	})
+
+	t.Run("It should return an error if the ttl exceeds the max_ttl", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "roles/leased", map[string]interface{}{"ttl": "3h"})
+		assert.Error(t, err)
+	})
+}
+
+func TestBackend_KeyLeaseRenewal(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	renew := func(secret *logical.Secret) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RenewOperation,
+			Storage:   storage,
+			Secret:    secret,
+		})
+	}
+
+	_, err := request(logical.UpdateOperation, "roles/renewed", map[string]interface{}{
+		"tags": "tag:ci",
+		"ttl":  "1h",
+	})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "roles/reissued", map[string]interface{}{
+		"tags":             "tag:ci",
+		"ttl":              "1h",
+		"reissue_on_renew": true,
+	})
+	require.NoError(t, err)
+
+	t.Run("It should not renew leases beyond the expiry of the key", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/renewed", map[string]interface{}{"expiry": "90m"})
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+		assert.True(t, response.Secret.Renewable)
+
+		secret := response.Secret
+		secret.IssueTime = time.Now()
+
+		response, err = renew(secret)
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+		assert.EqualValues(t, time.Hour, response.Secret.TTL)
+		assert.InDelta(t, 90*time.Minute, response.Secret.MaxTTL, float64(2*time.Second))
+	})
+
+	t.Run("It should replace the key if the role reissues keys on renewal", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/reissued", map[string]interface{}{"expiry": "2h"})
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+
+		original := response.Data["id"]
+		response, err = renew(response.Secret)
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+
+		assert.NotEqual(t, original, response.Data["id"])
+		assert.NotEmpty(t, response.Data["key"])
+		assert.EqualValues(t, response.Data["id"], response.Secret.InternalData["id"])
+		assert.Contains(t, api.Deleted(), original)
+
+		requests := api.Requests()
+		assert.EqualValues(t, 2*60*60, requests[len(requests)-1].ExpirySeconds)
+		assert.EqualValues(t, []string{"tag:ci"}, requests[len(requests)-1].Capabilities.Devices.Create.Tags)
+
+		_, err = renew(&logical.Secret{InternalData: map[string]interface{}{
+			"secret_type": "key",
+			"id":          original,
+		}})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should return an error if the key was not issued by the backend", func(t *testing.T) {
+		_, err := renew(&logical.Secret{InternalData: map[string]interface{}{
+			"secret_type": "key",
+			"id":          "unknown",
+		}})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should not reissue keys that have expired", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/reissued", nil)
+		require.NoError(t, err)
+		require.NotNil(t, response.Secret)
+
+		id := response.Data["id"].(string)
+		entry, err := storage.Get(ctx, "issued-keys/"+id)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+
+		var issued backend.IssuedKey
+		require.NoError(t, entry.DecodeJSON(&issued))
+		issued.Expires = time.Now().Add(-time.Minute)
+
+		entry, err = logical.StorageEntryJSON("issued-keys/"+id, issued)
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+
+		created := len(api.Requests())
+		_, err = renew(response.Secret)
+		assert.Error(t, err)
+		assert.Len(t, api.Requests(), created)
+	})
+
+	t.Run("It should not return keys reissued on renewal via a retrieval token", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "creds/reissued", map[string]interface{}{"retrieval_token": true})
+		assert.Error(t, err)
+	})
+
+	roles := []struct {
+		Name string
+		Data map[string]interface{}
+	}{
+		{
+			Name: "It should not reissue keys on renewal for roles requiring wrapping",
+			Data: map[string]interface{}{"wrap_required": true},
+		},
+		{
+			Name: "It should not reissue keys on renewal for roles returning retrieval tokens",
+			Data: map[string]interface{}{"retrieval_token": true},
+		},
+		{
+			Name: "It should not reissue keys on renewal for roles requiring approval",
+			Data: map[string]interface{}{"require_approval": true},
+		},
+		{
+			Name: "It should not reissue keys on renewal for roles bound to entities",
+			Data: map[string]interface{}{"bound_entity_ids": "entity-1"},
+		},
+		{
+			Name: "It should not reissue keys on renewal for roles with a policy",
+			Data: map[string]interface{}{"policy": "true"},
+		},
+	}
+
+	for _, tc := range roles {
+		t.Run(tc.Name, func(t *testing.T) {
+			data := map[string]interface{}{
+				"tags":             "tag:ci",
+				"reissue_on_renew": true,
+			}
+			for k, v := range tc.Data {
+				data[k] = v
+			}
+
+			_, err := request(logical.UpdateOperation, "roles/invalid", data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestBackend_KeyLeaseInternalData(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	otherConfig := map[string]interface{}{
+		"tailnet": "other",
+		"api_key": "other-key",
+		"api_url": "http://localhost:1337",
+	}
+
+	_, err := request(logical.UpdateOperation, "configs/other", otherConfig)
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "roles/other", map[string]interface{}{
+		"tags":   "tag:ci",
+		"config": "other",
+	})
+	require.NoError(t, err)
+
+	response, err := request(logical.ReadOperation, "creds/other", nil)
+	require.NoError(t, err)
+	require.NotNil(t, response.Secret)
+
+	t.Run("It should store the key, role and configuration with the lease", func(t *testing.T) {
+		assert.EqualValues(t, response.Data["id"], response.Secret.InternalData["id"])
+		assert.EqualValues(t, "other", response.Secret.InternalData["role"])
+		assert.EqualValues(t, "other", response.Secret.InternalData["config"])
+	})
+
+	t.Run("It should revoke the key in the configuration of the lease once its record is deleted", func(t *testing.T) {
+		id := response.Data["id"].(string)
+		require.NoError(t, storage.Delete(ctx, "issued-keys/"+id))
+
+		// A read-only configuration refuses deletions, so the key is queued against the configuration it was
+		// revoked using rather than deleted using the configuration of the mount.
+		otherConfig["read_only"] = true
+		_, err := request(logical.UpdateOperation, "configs/other", otherConfig)
+		require.NoError(t, err)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    response.Secret,
+		})
+		require.NoError(t, err)
+		assert.NotContains(t, api.Deleted(), id)
+
+		entry, err := storage.Get(ctx, "revocations/"+id)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+
+		var pending backend.PendingRevocation
+		require.NoError(t, entry.DecodeJSON(&pending))
+		assert.EqualValues(t, "other", pending.Config)
+	})
+}
+
+func TestBackend_KeyLeaseDeviceDeletion(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	revoke := func(secret *logical.Secret) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    secret,
+		})
+		require.NoError(t, err)
+	}
+
+	_, err := request(logical.UpdateOperation, "roles/kept", map[string]interface{}{"tags": "tag:kept"})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "roles/deleted", map[string]interface{}{
+		"tags":           "tag:deleted",
+		"reusable":       true,
+		"delete_devices": true,
+	})
+	require.NoError(t, err)
+
+	kept, err := request(logical.ReadOperation, "creds/kept", nil)
+	require.NoError(t, err)
+
+	deleted, err := request(logical.ReadOperation, "creds/deleted", nil)
+	require.NoError(t, err)
+
+	created := tailscale.Time{Time: time.Now().Add(time.Minute)}
+	api.SetDevices(
+		tailscale.Device{ID: "device-1", Tags: []string{"tag:kept"}, Created: created},
+		tailscale.Device{ID: "device-2", Tags: []string{"tag:deleted"}, Created: created},
+		tailscale.Device{ID: "device-3", Tags: []string{"tag:deleted"}, Created: created},
+		tailscale.Device{ID: "device-4", Tags: []string{"tag:other"}, Created: created},
+	)
+
+	t.Run("It should not delete devices unless the role requires it", func(t *testing.T) {
+		revoke(kept.Secret)
+		assert.Contains(t, api.Deleted(), kept.Data["id"])
+		assert.NotContains(t, api.Deleted(), "device-1")
+	})
+
+	t.Run("It should delete the devices added using the key if the role requires it", func(t *testing.T) {
+		revoke(deleted.Secret)
+		assert.Contains(t, api.Deleted(), deleted.Data["id"])
+		assert.Contains(t, api.Deleted(), "device-2")
+		assert.Contains(t, api.Deleted(), "device-3")
+		assert.NotContains(t, api.Deleted(), "device-4")
+	})
+
+	t.Run("It should not delete devices during a maintenance window", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/deleted", nil)
+		require.NoError(t, err)
+
+		_, err = request(logical.UpdateOperation, "config/maintenance", map[string]interface{}{"windows": "* * * * *"})
+		require.NoError(t, err)
+
+		deletions := len(api.Deleted())
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    response.Secret,
+		})
+		assert.ErrorIs(t, err, backend.ErrMaintenance)
+
+		// Only the key itself is deleted, the devices are deleted once the revocation is retried.
+		assert.Len(t, api.Deleted(), deletions+1)
+
+		_, err = request(logical.DeleteOperation, "config/maintenance", nil)
+		require.NoError(t, err)
+
+		revoke(response.Secret)
+		assert.Greater(t, len(api.Deleted()), deletions+1)
+	})
+
+	t.Run("It should revoke the lease if the record of the key no longer exists", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "creds/deleted", nil)
+		require.NoError(t, err)
+
+		id := response.Data["id"].(string)
+		require.NoError(t, storage.Delete(ctx, "issued-keys/"+id))
+
+		revoke(response.Secret)
+		assert.Contains(t, api.Deleted(), id)
+	})
+}
+
+func TestBackend_KeyLeaseStrictRevocation(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	tt := []struct {
+		Name        string
+		Strict      bool
+		ExpectError bool
+		ExpectQueue bool
+	}{
+		{
+			Name:        "It should queue keys that cannot be deleted by default",
+			ExpectQueue: true,
+		},
+		{
+			Name:        "It should return an error for keys that cannot be deleted if revocation is strict",
+			Strict:      true,
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":           "example",
+					"api_key":           "example",
+					"api_url":           "http://localhost:1337",
+					"strict_revocation": tc.Strict,
+				},
+			})
+			require.NoError(t, err)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data:      map[string]interface{}{"tags": []string{"tag:server"}},
+			})
+			require.NoError(t, err)
+			require.NotNil(t, response.Secret)
+
+			api.SetFailingDeletes(true)
+			defer api.SetFailingDeletes(false)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.RevokeOperation,
+				Storage:   storage,
+				Secret:    response.Secret,
+			})
+			if tc.ExpectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			entry, err := storage.Get(ctx, "revocations/"+response.Data["id"].(string))
+			require.NoError(t, err)
+			assert.Equal(t, tc.ExpectQueue, entry != nil)
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The Checkout type describes a single check-out of the key managed by a static role in library mode.
+	Checkout struct {
+		ID            string    `json:"id"`
+		EntityID      string    `json:"entity_id"`
+		DisplayName   string    `json:"display_name"`
+		TokenAccessor string    `json:"token_accessor"`
+		CheckedOut    time.Time `json:"checked_out"`
+		Expires       time.Time `json:"expires"`
+	}
+)
+
+const (
+	defaultMaxCheckouts = 1
+	defaultCheckoutTTL  = time.Hour
+
+	checkOutDescription           = "Check out the key managed by a static role in library mode"
+	checkInDescription            = "Check in a previously checked out key"
+	checkoutStatusDescription     = "Read the current check-outs of the key managed by a static role in library mode"
+	checkoutRequestTTLDescription = "How long the key is checked out for. Cannot exceed the static role's checkout_ttl"
+	checkoutIDDescription         = "The identifier of the check-out returned when the key was checked out"
+
+	checkOutHelpSynopsis    = "Check out the key managed by a static role in library mode."
+	checkOutHelpDescription = `
+Checks out the key managed by a static role in library mode for the requested duration,
+which cannot exceed the role's checkout_ttl. Check-outs are refused once max_checkouts
+are active.
+`
+	checkInHelpSynopsis    = "Check in a previously checked out key."
+	checkInHelpDescription = `
+Removes a check-out using the identifier returned when the key was checked out, freeing
+it for another consumer. Expired check-outs are removed automatically.
+`
+	checkoutStatusHelpSynopsis    = "Read the current check-outs of a static role in library mode."
+	checkoutStatusHelpDescription = `
+Returns the active check-outs of the key managed by the static role, including who
+checked the key out and when each check-out expires, along with how many further check-
+outs are available.
+`
+)
+
+func (b *Backend) libraryPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "static-roles/" + framework.GenericNameRegex("name") + "/check-out$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: staticRoleNameDescription,
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: checkoutRequestTTLDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.CheckOut,
+					Responses: okResponse(checkOutDescription, checkOutResponseFields()),
+					Summary:   checkOutDescription,
+				},
+			},
+			HelpSynopsis:    checkOutHelpSynopsis,
+			HelpDescription: checkOutHelpDescription,
+		},
+		{
+			Pattern: "static-roles/" + framework.GenericNameRegex("name") + "/check-in$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: staticRoleNameDescription,
+				},
+				"checkout_id": {
+					Type:        framework.TypeString,
+					Description: checkoutIDDescription,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.CheckIn,
+					Responses: noContentResponse(),
+					Summary:   checkInDescription,
+				},
+			},
+			HelpSynopsis:    checkInHelpSynopsis,
+			HelpDescription: checkInHelpDescription,
+		},
+		{
+			Pattern: "static-roles/" + framework.GenericNameRegex("name") + "/status$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: staticRoleNameDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadCheckoutStatus,
+					Responses: okResponse(checkoutStatusDescription, checkoutStatusResponseFields()),
+					Summary:   checkoutStatusDescription,
+				},
+			},
+			HelpSynopsis:    checkoutStatusHelpSynopsis,
+			HelpDescription: checkoutStatusHelpDescription,
+		},
+	}
+}
+
+// CheckOut records a check-out of the key managed by a static role in library mode, returning the key along with
+// the check-out identifier required to check it back in. The identity of the requester is recorded with the
+// check-out. Returns an error if the role's maximum number of concurrent check-outs has been reached.
+func (b *Backend) CheckOut(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.staticMu.Lock()
+	defer b.staticMu.Unlock()
+
+	role, err := b.libraryRole(ctx, request.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := role.CheckoutTTL
+	if value, ok := data.GetOk("ttl"); ok {
+		ttl = time.Duration(value.(int)) * time.Second
+	}
+
+	switch {
+	case ttl <= 0:
+		return nil, errors.New("provided ttl must be greater than zero")
+	case ttl > role.CheckoutTTL:
+		return nil, fmt.Errorf("provided ttl cannot exceed %s", role.CheckoutTTL)
+	case len(role.Checkouts) >= role.MaxCheckouts:
+		return nil, fmt.Errorf("static role %q has reached its maximum of %d check-outs", role.Name, role.MaxCheckouts)
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	checkout := Checkout{
+		ID:            id,
+		EntityID:      request.EntityID,
+		DisplayName:   request.DisplayName,
+		TokenAccessor: request.ClientTokenAccessor,
+		CheckedOut:    now,
+		Expires:       now.Add(ttl),
+	}
+
+	role.Checkouts = append(role.Checkouts, checkout)
+	if err = b.saveStaticRole(ctx, request.Storage, role); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"checkout_id": checkout.ID,
+			"id":          role.KeyID,
+			"key":         role.Key,
+			"expires":     checkout.Expires,
+		},
+	}, nil
+}
+
+// CheckIn removes a check-out of the key managed by a static role in library mode, freeing it for another consumer.
+func (b *Backend) CheckIn(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.staticMu.Lock()
+	defer b.staticMu.Unlock()
+
+	role, err := b.libraryRole(ctx, request.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	id := data.Get("checkout_id").(string)
+	for i, checkout := range role.Checkouts {
+		if checkout.ID != id {
+			continue
+		}
+
+		role.Checkouts = append(role.Checkouts[:i], role.Checkouts[i+1:]...)
+		if err = b.saveStaticRole(ctx, request.Storage, role); err != nil {
+			return nil, err
+		}
+
+		return &logical.Response{}, nil
+	}
+
+	return nil, fmt.Errorf("check-out %q does not exist or has expired", id)
+}
+
+// ReadCheckoutStatus returns the active check-outs of the key managed by a static role in library mode.
+func (b *Backend) ReadCheckoutStatus(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.staticMu.Lock()
+	defer b.staticMu.Unlock()
+
+	role, err := b.libraryRole(ctx, request.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	checkouts := make([]map[string]interface{}, 0, len(role.Checkouts))
+	for _, checkout := range role.Checkouts {
+		checkouts = append(checkouts, map[string]interface{}{
+			"entity_id":    checkout.EntityID,
+			"display_name": checkout.DisplayName,
+			"checked_out":  checkout.CheckedOut,
+			"expires":      checkout.Expires,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"max_checkouts": role.MaxCheckouts,
+			"available":     role.MaxCheckouts - len(role.Checkouts),
+			"checkouts":     checkouts,
+		},
+	}, nil
+}
+
+// libraryRole returns the named static role, ensuring it is in library mode and discarding any expired check-outs.
+func (b *Backend) libraryRole(ctx context.Context, storage logical.Storage, name string) (*StaticRole, error) {
+	role, err := b.staticRole(ctx, storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("static role %q does not exist", name)
+	case !role.Library:
+		return nil, fmt.Errorf("static role %q is not in library mode", name)
+	}
+
+	now := time.Now()
+	active := role.Checkouts[:0]
+	for _, checkout := range role.Checkouts {
+		if checkout.Expires.After(now) {
+			active = append(active, checkout)
+		}
+	}
+	role.Checkouts = active
+
+	return role, nil
+}
+
+func checkOutResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"checkout_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the check-out, used to check the key back in",
+		},
+		"id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the managed key",
+		},
+		"key": {
+			Type:        framework.TypeString,
+			Description: "The managed authentication key",
+		},
+		"expires": {
+			Type:        framework.TypeTime,
+			Description: "When the check-out expires",
+		},
+	}
+}
+
+func checkoutStatusResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"max_checkouts": {
+			Type:        framework.TypeInt,
+			Description: maxCheckoutsDescription,
+		},
+		"available": {
+			Type:        framework.TypeInt,
+			Description: "The number of further check-outs that can be made",
+		},
+		"checkouts": {
+			Type:        framework.TypeSlice,
+			Description: "The active check-outs, each with the entity_id, display_name, checked_out and expires of the consumer",
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_Library(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"library":       true,
+			"max_checkouts": 1,
+			"checkout_ttl":  "1h",
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("It should not return the key from static-creds", func(t *testing.T) {
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "static-creds/test",
+			Storage:   storage,
+		})
+		assert.Error(t, err)
+	})
+
+	var checkoutID string
+	t.Run("It should check out the key", func(t *testing.T) {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "static-roles/test/check-out",
+			Storage:   storage,
+			EntityID:  "entity",
+			Data: map[string]interface{}{
+				"ttl": "30m",
+			},
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, "secret-1", response.Data["key"])
+
+		checkoutID = response.Data["checkout_id"].(string)
+	})
+
+	t.Run("It should not allow more than the maximum number of check-outs", func(t *testing.T) {
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "static-roles/test/check-out",
+			Storage:   storage,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should report the holder of the check-out", func(t *testing.T) {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "static-roles/test/status",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, 0, response.Data["available"])
+
+		checkouts := response.Data["checkouts"].([]map[string]interface{})
+		require.Len(t, checkouts, 1)
+		assert.EqualValues(t, "entity", checkouts[0]["entity_id"])
+	})
+
+	t.Run("It should check the key back in", func(t *testing.T) {
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "static-roles/test/check-in",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"checkout_id": checkoutID,
+			},
+		})
+		require.NoError(t, err)
+
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "static-roles/test/status",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, response.Data["available"])
+	})
+}
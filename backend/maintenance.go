@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/robfig/cron/v3"
+)
+
+type (
+	// The MaintenanceConfig type describes the windows during which the Backend refuses to modify the tailnet, other
+	// than by issuing and revoking keys.
+	MaintenanceConfig struct {
+		Windows []string `json:"windows"`
+	}
+)
+
+const (
+	maintenanceConfigPath = "config/maintenance"
+
+	readMaintenanceDescription    = "Read the maintenance windows"
+	updateMaintenanceDescription  = "Update the maintenance windows"
+	deleteMaintenanceDescription  = "Delete the maintenance windows, allowing the tailnet to be modified at any time"
+	maintenanceWindowsDescription = "Cron expressions describing when the tailnet may not be modified. The tailnet may not be modified when the current minute matches any expression"
+
+	maintenanceHelpSynopsis    = "Configure windows during which the tailnet may not be modified."
+	maintenanceHelpDescription = `
+During a maintenance window, operations that modify the tailnet, such as generating keys
+or approving routes, are refused while reads continue to work. Windows are described
+using cron expressions matched against the current minute.
+`
+)
+
+// ErrMaintenance is the error returned when attempting to modify the tailnet during a maintenance window.
+var ErrMaintenance = errors.New("the tailnet cannot be modified during a maintenance window")
+
+func (b *Backend) maintenancePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: maintenanceConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"windows": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: maintenanceWindowsDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadMaintenanceConfiguration,
+					Responses: okResponse(readMaintenanceDescription, maintenanceResponseFields()),
+					Summary:   readMaintenanceDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateMaintenanceConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateMaintenanceDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteMaintenanceConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteMaintenanceDescription,
+				},
+			},
+			HelpSynopsis:    maintenanceHelpSynopsis,
+			HelpDescription: maintenanceHelpDescription,
+		},
+	}
+}
+
+// ReadMaintenanceConfiguration returns the maintenance windows, along with whether one is currently in effect.
+func (b *Backend) ReadMaintenanceConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.maintenanceConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	active, _, err := matchWindows(config.Windows, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"windows": config.Windows,
+			"active":  active,
+		},
+	}, nil
+}
+
+// UpdateMaintenanceConfiguration modifies the maintenance windows. Returns an error if no windows are provided or any
+// of them is not a valid cron expression.
+func (b *Backend) UpdateMaintenanceConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := MaintenanceConfig{
+		Windows: data.Get("windows").([]string),
+	}
+
+	if len(config.Windows) == 0 {
+		return nil, errors.New("provided windows cannot be empty")
+	}
+
+	for _, window := range config.Windows {
+		if _, err := cron.ParseStandard(window); err != nil {
+			return nil, fmt.Errorf("provided maintenance window %q is invalid: %w", window, err)
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(maintenanceConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteMaintenanceConfiguration removes the maintenance windows, allowing the tailnet to be modified at any time.
+func (b *Backend) DeleteMaintenanceConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, maintenanceConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// checkMaintenance returns ErrMaintenance if the current time is within a maintenance window. Keys are issued and
+// revoked regardless of maintenance windows, so this is only checked before other modifications to the tailnet.
+func (b *Backend) checkMaintenance(ctx context.Context, storage logical.Storage) error {
+	config, err := b.maintenanceConfig(ctx, storage)
+	if err != nil || config == nil {
+		return err
+	}
+
+	active, _, err := matchWindows(config.Windows, time.Now().UTC())
+	switch {
+	case err != nil:
+		return err
+	case active:
+		return ErrMaintenance
+	default:
+		return nil
+	}
+}
+
+func (b *Backend) maintenanceConfig(ctx context.Context, storage logical.Storage) (*MaintenanceConfig, error) {
+	entry, err := storage.Get(ctx, maintenanceConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config MaintenanceConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func maintenanceResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"windows": {
+			Type:        framework.TypeStringSlice,
+			Description: maintenanceWindowsDescription,
+		},
+		"active": {
+			Type:        framework.TypeBool,
+			Description: "Whether a maintenance window is currently active",
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_Maintenance(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should return an error if no windows are provided", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/maintenance", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should return an error if a window is invalid", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/maintenance", map[string]interface{}{
+			"windows": "not a cron expression",
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should store the maintenance windows", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/maintenance", map[string]interface{}{
+			"windows": "* * * * *",
+		})
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "config/maintenance", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"* * * * *"}, response.Data["windows"])
+		assert.EqualValues(t, true, response.Data["active"])
+	})
+
+	t.Run("It should refuse to modify the tailnet during a maintenance window", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "vip-services/web", map[string]interface{}{
+			"ports": "tcp:443",
+		})
+		assert.ErrorIs(t, err, backend.ErrMaintenance)
+	})
+
+	t.Run("It should issue keys during a maintenance window", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", map[string]interface{}{"tags": []string{"tag:server"}})
+		require.NoError(t, err)
+	})
+
+	t.Run("It should defer device authorization until the maintenance window ends", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/device-authorization", map[string]interface{}{
+			"allowed_tags": "tag:server",
+		})
+		require.NoError(t, err)
+
+		api.SetDevices(tailscale.Device{
+			ID:      "server",
+			Tags:    []string{"tag:server"},
+			Created: tailscale.Time{Time: time.Now().Add(time.Minute)},
+		})
+
+		_, err = b.HandleRequest(ctx, &logical.Request{Operation: logical.RollbackOperation, Storage: storage})
+		require.NoError(t, err)
+		assert.False(t, api.Authorized("server"))
+
+		_, err = request(logical.DeleteOperation, "config/maintenance", nil)
+		require.NoError(t, err)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{Operation: logical.RollbackOperation, Storage: storage})
+		require.NoError(t, err)
+		assert.True(t, api.Authorized("server"))
+	})
+}
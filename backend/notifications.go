@@ -0,0 +1,301 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The NotificationConfig type describes the webhook that is notified of key issuance, revocation failures and
+	// static role rotations.
+	NotificationConfig struct {
+		URL     string        `json:"url"`
+		Format  string        `json:"format"`
+		Timeout time.Duration `json:"timeout"`
+	}
+
+	// The Notification type is the payload sent to the notification webhook when using the json format.
+	Notification struct {
+		Event     string            `json:"event"`
+		Timestamp time.Time         `json:"timestamp"`
+		Data      map[string]string `json:"data"`
+	}
+)
+
+const (
+	notificationConfigPath     = "config/notifications"
+	notificationFormatJSON     = "json"
+	notificationFormatSlack    = "slack"
+	defaultNotificationTimeout = 10 * time.Second
+
+	// maxPendingNotifications is the most notifications that are sent at once. Further notifications are dropped
+	// rather than queued, so that an unresponsive webhook cannot cause unbounded growth in memory.
+	maxPendingNotifications = 32
+
+	eventKeyIssued           = "key-issued"
+	eventKeyRevocationFailed = "key-revocation-failed"
+	eventStaticRoleRotated   = "static-role-rotated"
+	eventDeviceAuthorized    = "device-authorized"
+
+	readNotificationsDescription   = "Read the notification webhook configuration"
+	updateNotificationsDescription = "Update the notification webhook configuration"
+	deleteNotificationsDescription = "Delete the notification webhook configuration"
+	notificationURLDescription     = "The URL of the webhook that is notified of key issuance, revocation failures and rotations"
+	notificationFormatDescription  = "The format of notification payloads, either json or slack"
+	notificationTimeoutDescription = "How long to wait for the webhook to respond"
+
+	notificationHelpSynopsis    = "Configure the webhook notified of key issuance, revocation failures and rotations."
+	notificationHelpDescription = `
+Configures a webhook that is notified when keys are issued, static roles are rotated,
+devices are authorized or keys cannot be revoked. Payloads are sent either as JSON or in
+a format accepted by Slack incoming webhooks. Notifications are best-effort and failures
+to send them are logged.
+`
+)
+
+func (b *Backend) notificationPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: notificationConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"url": {
+					Type:        framework.TypeString,
+					Description: notificationURLDescription,
+				},
+				"format": {
+					Type:          framework.TypeString,
+					Description:   notificationFormatDescription,
+					Default:       notificationFormatJSON,
+					AllowedValues: []interface{}{notificationFormatJSON, notificationFormatSlack},
+				},
+				"timeout": {
+					Type:        framework.TypeDurationSecond,
+					Description: notificationTimeoutDescription,
+					Default:     int(defaultNotificationTimeout.Seconds()),
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadNotificationConfiguration,
+					Responses: okResponse(readNotificationsDescription, notificationResponseFields()),
+					Summary:   readNotificationsDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateNotificationConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateNotificationsDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteNotificationConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteNotificationsDescription,
+				},
+			},
+			HelpSynopsis:    notificationHelpSynopsis,
+			HelpDescription: notificationHelpDescription,
+		},
+	}
+}
+
+// ReadNotificationConfiguration returns the notification webhook configuration.
+func (b *Backend) ReadNotificationConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.notificationConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url":     config.URL,
+			"format":  config.Format,
+			"timeout": int64(config.Timeout.Seconds()),
+		},
+	}, nil
+}
+
+// UpdateNotificationConfiguration modifies the notification webhook configuration. Returns an error if the URL or
+// format are invalid.
+func (b *Backend) UpdateNotificationConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := NotificationConfig{
+		URL:     data.Get("url").(string),
+		Format:  data.Get("format").(string),
+		Timeout: time.Duration(data.Get("timeout").(int)) * time.Second,
+	}
+
+	u, err := url.Parse(config.URL)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("provided url is invalid: %w", err)
+	case u.Scheme != "https" && u.Scheme != "http":
+		return nil, errors.New("provided url must use http or https")
+	case config.Format != notificationFormatJSON && config.Format != notificationFormatSlack:
+		return nil, fmt.Errorf("provided format must be %q or %q", notificationFormatJSON, notificationFormatSlack)
+	case config.Timeout <= 0:
+		return nil, errors.New("provided timeout must be greater than zero")
+	}
+
+	entry, err := logical.StorageEntryJSON(notificationConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteNotificationConfiguration removes the notification webhook configuration.
+func (b *Backend) DeleteNotificationConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, notificationConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// notify sends an event to the notification webhook, if one is configured. Notifications are sent in the background,
+// so that a slow webhook never delays the request that caused them. Notifications are best-effort, failures to send
+// them are logged and otherwise ignored.
+func (b *Backend) notify(ctx context.Context, storage logical.Storage, event string, data map[string]string) {
+	config, err := b.notificationConfig(ctx, storage)
+	switch {
+	case err != nil:
+		b.Logger().Warn("failed to send notification", "event", event, "error", err)
+		return
+	case config == nil:
+		return
+	}
+
+	select {
+	case b.notifications <- struct{}{}:
+	default:
+		b.Logger().Warn("dropping notification as too many are being sent", "event", event)
+		return
+	}
+
+	go func() {
+		defer func() { <-b.notifications }()
+
+		if err := b.sendNotification(config, event, data); err != nil {
+			b.Logger().Warn("failed to send notification", "event", event, "error", err)
+		}
+	}()
+}
+
+func (b *Backend) sendNotification(config *NotificationConfig, event string, data map[string]string) error {
+	notification := Notification{
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+
+	var payload interface{} = notification
+	if config.Format == notificationFormatSlack {
+		payload = map[string]string{"text": notification.text()}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// The notification outlives the request that caused it, so is bounded only by the configured timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.notificationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// newNotificationClient returns the HTTP client used to call the notification webhook. Redirects are refused so that
+// notifications, which may identify requesters, are only ever sent to the configured URL.
+func newNotificationClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errors.New("notification webhook redirects are not followed")
+		},
+	}
+}
+
+// text returns a human-readable summary of the notification, used for Slack-compatible payloads.
+func (n Notification) text() string {
+	keys := make([]string, 0, len(n.Data))
+	for key := range n.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%s", key, n.Data[key]))
+	}
+
+	return fmt.Sprintf("[vault-plugin-tailscale] %s: %s", n.Event, strings.Join(fields, " "))
+}
+
+func (b *Backend) notificationConfig(ctx context.Context, storage logical.Storage) (*NotificationConfig, error) {
+	entry, err := storage.Get(ctx, notificationConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config NotificationConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func notificationResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"url": {
+			Type:        framework.TypeString,
+			Description: notificationURLDescription,
+		},
+		"format": {
+			Type:        framework.TypeString,
+			Description: notificationFormatDescription,
+		},
+		"timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: notificationTimeoutDescription,
+		},
+	}
+}
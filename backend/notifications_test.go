@@ -0,0 +1,245 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_Notifications(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	var (
+		mu            sync.Mutex
+		notifications []map[string]interface{}
+		headers       http.Header
+	)
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+
+		mu.Lock()
+		notifications = append(notifications, notification)
+		headers = r.Header.Clone()
+		mu.Unlock()
+	}))
+	t.Cleanup(webhook.Close)
+
+	// Notifications are sent in the background, so wait for the expected number to arrive.
+	received := func(t *testing.T, count int) []map[string]interface{} {
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return len(notifications) >= count
+		}, time.Second, 10*time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		result := notifications
+		notifications = nil
+		return result
+	}
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "config/notifications", map[string]interface{}{
+		"url": webhook.URL,
+	})
+	require.NoError(t, err)
+
+	t.Run("It should notify of key issuance", func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+
+		result := received(t, 1)
+		require.Len(t, result, 1)
+		assert.EqualValues(t, "key-issued", result[0]["event"])
+		assert.EqualValues(t, "key-1", result[0]["data"].(map[string]interface{})["key_id"])
+	})
+
+	t.Run("It should notify of static role rotation", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "static-roles/test", nil)
+		require.NoError(t, err)
+
+		result := received(t, 1)
+		require.Len(t, result, 1)
+		assert.EqualValues(t, "static-role-rotated", result[0]["event"])
+		assert.EqualValues(t, "test", result[0]["data"].(map[string]interface{})["role"])
+	})
+
+	t.Run("It should notify of revocation failures", func(t *testing.T) {
+		api.SetFailing(true)
+		t.Cleanup(func() { api.SetFailing(false) })
+
+		_, err := request(logical.DeleteOperation, "static-roles/test", nil)
+		require.Error(t, err)
+
+		result := received(t, 1)
+		require.Len(t, result, 1)
+		assert.EqualValues(t, "key-revocation-failed", result[0]["event"])
+		assert.EqualValues(t, "key-2", result[0]["data"].(map[string]interface{})["key_id"])
+	})
+
+	t.Run("It should send Slack-compatible notifications", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/notifications", map[string]interface{}{
+			"url":    webhook.URL,
+			"format": "slack",
+		})
+		require.NoError(t, err)
+
+		_, err = request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+
+		result := received(t, 1)
+		require.Len(t, result, 1)
+		assert.Contains(t, result[0]["text"], "key-issued")
+	})
+
+	t.Run("It should not send the correlation headers to the webhook", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			ID:        "request-1",
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		require.Len(t, received(t, 1), 1)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.Empty(t, headers.Get("X-Vault-Tailscale-Request-Id"))
+		assert.Equal(t, "request-1", api.Headers()[len(api.Headers())-1].Get("X-Vault-Tailscale-Request-Id"))
+	})
+}
+
+func TestBackend_NotificationDelivery(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should not wait for the webhook to respond", func(t *testing.T) {
+		release := make(chan struct{})
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		t.Cleanup(webhook.Close)
+		t.Cleanup(func() { close(release) })
+
+		_, err := request(logical.UpdateOperation, "config/notifications", map[string]interface{}{
+			"url":     webhook.URL,
+			"timeout": 5,
+		})
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("It should not follow redirects from the webhook", func(t *testing.T) {
+		var redirected atomic.Int64
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			redirected.Add(1)
+		}))
+		t.Cleanup(target.Close)
+
+		var calls atomic.Int64
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+		}))
+		t.Cleanup(webhook.Close)
+
+		_, err := request(logical.UpdateOperation, "config/notifications", map[string]interface{}{
+			"url": webhook.URL,
+		})
+		require.NoError(t, err)
+
+		_, err = request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 10*time.Millisecond)
+		assert.Zero(t, redirected.Load())
+	})
+}
+
+func TestBackend_UpdateNotificationConfiguration(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		Data         map[string]interface{}
+		ExpectsError bool
+	}{
+		{
+			Name: "It should store the notification configuration",
+			Data: map[string]interface{}{
+				"url": "https://hooks.slack.com/services/example",
+			},
+		},
+		{
+			Name: "It should return an error if the format is unknown",
+			Data: map[string]interface{}{
+				"url":    "https://hooks.slack.com/services/example",
+				"format": "xml",
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error if the url is invalid",
+			Data: map[string]interface{}{
+				"url": "ftp://example.com",
+			},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config/notifications",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "config/notifications",
+				Storage:   storage,
+			})
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.Data["url"], response.Data["url"])
+			assert.EqualValues(t, "json", response.Data["format"])
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+)
+
+// checkGrantableTags returns an error if the backend uses OAuth client credentials and the tags cannot be granted by
+// the OAuth client. Keys generated by an OAuth client must be tagged, and each tag must be one of the client's tags
+// or owned by one of them in the tailnet policy. The client's tags cannot be discovered via the API, so the tags are
+// only checked when they are configured. If the tailnet policy cannot be read, ownership is left for the Tailscale
+// API to decide.
+func (b *Backend) checkGrantableTags(ctx context.Context, config Config, tags []string) error {
+	switch {
+	case config.OAuthClientID == "":
+		return nil
+	case len(tags) == 0:
+		return errors.New("keys generated using an OAuth client must have at least one tag")
+	case len(config.OAuthTags) == 0:
+		return nil
+	}
+
+	var owners map[string][]string
+	for _, tag := range tags {
+		if strutil.StrListContains(config.OAuthTags, tag) {
+			continue
+		}
+
+		if owners == nil {
+			var err error
+			if owners, err = b.tagOwners(ctx, config); err != nil {
+				b.Logger().Warn("failed to fetch tailnet policy to check grantable tags", "error", err)
+				return nil
+			}
+		}
+
+		if !hasAnyTag(owners[tag], config.OAuthTags) {
+			return fmt.Errorf("tag %q cannot be granted by the OAuth client, which may only grant %s and the tags they own",
+				tag, strings.Join(config.OAuthTags, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_GrantableTags(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"tailnet":             "example",
+			"api_url":             "http://localhost:1337",
+			"issuer_tag":          "",
+			"oauth_client_id":     "client",
+			"oauth_client_secret": "secret",
+			"oauth_tags":          "tag:ci",
+		},
+	})
+	require.NoError(t, err)
+
+	api.SetTagOwners(map[string][]string{
+		"tag:ci-web": {"tag:ci"},
+		"tag:prod":   {"autogroup:admin"},
+	})
+
+	tt := []struct {
+		Name        string
+		Tags        string
+		ExpectError bool
+	}{
+		{
+			Name:        "It should return an error if no tags are requested",
+			ExpectError: true,
+		},
+		{
+			Name: "It should generate keys with the OAuth client's tags",
+			Tags: "tag:ci",
+		},
+		{
+			Name: "It should generate keys with tags owned by the OAuth client's tags",
+			Tags: "tag:ci-web",
+		},
+		{
+			Name:        "It should return an error for tags the OAuth client cannot grant",
+			Tags:        "tag:prod",
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			data := map[string]interface{}{}
+			if tc.Tags != "" {
+				data["tags"] = tc.Tags
+			}
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data:      data,
+			})
+
+			if tc.ExpectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotEmpty(t, response.Data["key"])
+		})
+	}
+}
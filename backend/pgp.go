@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const (
+	pgpKeyDescription = "A PGP public key, either ASCII armored or base64 encoded, used to encrypt the returned key"
+)
+
+// parsePGPKey parses a PGP public key that is either ASCII armored or base64 encoded, as accepted by Vault when
+// generating root tokens.
+func parsePGPKey(value string) (*openpgp.Entity, error) {
+	if strings.Contains(value, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(value))
+		switch {
+		case err != nil:
+			return nil, err
+		case len(entities) != 1:
+			return nil, errors.New("expected a single public key")
+		}
+
+		return entities[0], nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return openpgp.ReadEntity(packet.NewReader(bytes.NewReader(data)))
+}
+
+// encryptPGP encrypts the value to the given PGP public key, returning the base64 encoded message.
+func encryptPGP(entity *openpgp.Entity, value string) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	writer, err := openpgp.Encrypt(buf, []*openpgp.Entity{entity}, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt key: %w", err)
+	}
+
+	if _, err = writer.Write([]byte(value)); err != nil {
+		return "", fmt.Errorf("failed to encrypt key: %w", err)
+	}
+
+	if err = writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt key: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// pgpFingerprint returns the hex encoded fingerprint of the PGP public key.
+func pgpFingerprint(entity *openpgp.Entity) string {
+	return hex.EncodeToString(entity.PrimaryKey.Fingerprint)
+}
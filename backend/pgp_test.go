@@ -0,0 +1,75 @@
+package backend_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_PGPKey(t *testing.T) {
+	ctx, b := setup(t)
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	require.NoError(t, err)
+
+	public := bytes.NewBuffer(nil)
+	require.NoError(t, entity.Serialize(public))
+
+	tt := []struct {
+		Name         string
+		PGPKey       string
+		ExpectsError bool
+	}{
+		{
+			Name:   "It should encrypt the key to the provided PGP key",
+			PGPKey: base64.StdEncoding.EncodeToString(public.Bytes()),
+		},
+		{
+			Name:         "It should return an error if the PGP key is invalid",
+			PGPKey:       "not a key",
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			putConfig(t, ctx, storage)
+			api := mockKeysAPI(t)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"pgp_key": tc.PGPKey,
+				},
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotEqual(t, "secret-1", response.Data["key"])
+			assert.NotEmpty(t, response.Data["pgp_fingerprint"])
+
+			encrypted, err := base64.StdEncoding.DecodeString(response.Data["key"].(string))
+			require.NoError(t, err)
+
+			message, err := openpgp.ReadMessage(bytes.NewReader(encrypted), openpgp.EntityList{entity}, nil, nil)
+			require.NoError(t, err)
+
+			decrypted, err := io.ReadAll(message.UnverifiedBody)
+			require.NoError(t, err)
+			assert.Equal(t, "secret-1", string(decrypted))
+		})
+	}
+}
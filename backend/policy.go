@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// newPolicyEnv returns the CEL environment that role policies are evaluated in. Policies have access to the key
+// being requested via the tags, ephemeral, preauthorized and ttl variables, the identity of the requester via the
+// entity variable and the address of the client via the client_ip variable. The in_cidr function can be used to check
+// the client address against a network.
+func newPolicyEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("tags", cel.ListType(cel.StringType)),
+		cel.Variable("ephemeral", cel.BoolType),
+		cel.Variable("preauthorized", cel.BoolType),
+		cel.Variable("ttl", cel.IntType),
+		cel.Variable("entity", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("client_ip", cel.StringType),
+		cel.Function("in_cidr",
+			cel.Overload("in_cidr_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(inCIDR),
+			),
+		),
+	)
+}
+
+// compilePolicy parses and checks a CEL policy expression, ensuring that it evaluates to a boolean.
+func compilePolicy(expression string) (cel.Program, error) {
+	env, err := newPolicyEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("policy must evaluate to a bool, not %s", ast.OutputType())
+	}
+
+	return env.Program(ast)
+}
+
+// checkPolicy evaluates the role's policy against the key being requested, returning an error if the policy does not
+// allow it. The expiry is zero when the Tailscale default applies.
+func (b *Backend) checkPolicy(request *logical.Request, role *Role, capabilities tailscale.KeyCapabilities, expiry time.Duration) error {
+	if role.Policy == "" {
+		return nil
+	}
+
+	program, err := compilePolicy(role.Policy)
+	if err != nil {
+		return fmt.Errorf("failed to compile policy of role %q: %w", role.Name, err)
+	}
+
+	entity, err := b.policyEntity(request)
+	if err != nil {
+		return err
+	}
+
+	var clientIP string
+	if request.Connection != nil {
+		clientIP = request.Connection.RemoteAddr
+	}
+
+	tags := capabilities.Devices.Create.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	result, _, err := program.Eval(map[string]interface{}{
+		"tags":          tags,
+		"ephemeral":     capabilities.Devices.Create.Ephemeral,
+		"preauthorized": capabilities.Devices.Create.Preauthorized,
+		"ttl":           int64(expiry.Seconds()),
+		"entity":        entity,
+		"client_ip":     clientIP,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to evaluate policy of role %q: %w", role.Name, err)
+	}
+
+	if allowed, ok := result.Value().(bool); !ok || !allowed {
+		return errors.New("request denied by role policy")
+	}
+
+	return nil
+}
+
+// policyEntity returns the identity of the requester as made available to role policies.
+func (b *Backend) policyEntity(request *logical.Request) (map[string]interface{}, error) {
+	entity := map[string]interface{}{
+		"id":       request.EntityID,
+		"name":     "",
+		"metadata": map[string]string{},
+		"groups":   []string{},
+	}
+
+	if request.EntityID == "" {
+		return entity, nil
+	}
+
+	info, err := b.System().EntityInfo(request.EntityID)
+	if err != nil {
+		return nil, err
+	}
+
+	if info != nil {
+		entity["name"] = info.Name
+		if info.Metadata != nil {
+			entity["metadata"] = info.Metadata
+		}
+	}
+
+	groups, err := b.entityGroups(request)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	entity["groups"] = names
+
+	return entity, nil
+}
+
+func inCIDR(lhs, rhs ref.Val) ref.Val {
+	address, ok := lhs.Value().(string)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(lhs)
+	}
+
+	cidr, ok := rhs.Value().(string)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(rhs)
+	}
+
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return types.NewErr("invalid cidr %q: %v", cidr, err)
+	}
+
+	ip := net.ParseIP(address)
+	return types.Bool(ip != nil && network.Contains(ip))
+}
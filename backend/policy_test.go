@@ -0,0 +1,119 @@
+package backend_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_RolePolicy(t *testing.T) {
+	ctx := context.Background()
+
+	config := logical.TestBackendConfig()
+	config.System.(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:       "entity",
+		Name:     "alice",
+		Metadata: map[string]string{"team": "sre"},
+	}
+	config.System.(*logical.StaticSystemView).GroupsVal = []*logical.Group{
+		{Name: "sre"},
+	}
+
+	b, err := backend.Create(ctx, config)
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name              string
+		Policy            string
+		EntityID          string
+		RemoteAddr        string
+		ExpectsWriteError bool
+		ExpectsError      bool
+	}{
+		{
+			Name:   "It should generate a key if the policy allows it",
+			Policy: `"tag:ci" in tags && !preauthorized`,
+		},
+		{
+			Name:         "It should return an error if the policy denies the request",
+			Policy:       `ephemeral`,
+			ExpectsError: true,
+		},
+		{
+			Name:     "It should expose the requester's identity to the policy",
+			Policy:   `entity.name == "alice" && entity.metadata.team == "sre" && "sre" in entity.groups`,
+			EntityID: "entity",
+		},
+		{
+			Name:       "It should allow checking the client address against a network",
+			Policy:     `in_cidr(client_ip, "10.0.0.0/8")`,
+			RemoteAddr: "10.1.2.3",
+		},
+		{
+			Name:         "It should deny clients outside of a network",
+			Policy:       `in_cidr(client_ip, "10.0.0.0/8")`,
+			RemoteAddr:   "192.168.1.1",
+			ExpectsError: true,
+		},
+		{
+			Name:              "It should return an error if the policy is invalid",
+			Policy:            `tags +`,
+			ExpectsWriteError: true,
+		},
+		{
+			Name:              "It should return an error if the policy does not return a bool",
+			Policy:            `tags`,
+			ExpectsWriteError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+				return b.HandleRequest(ctx, &logical.Request{
+					Operation:  operation,
+					Path:       path,
+					Storage:    storage,
+					EntityID:   tc.EntityID,
+					Connection: &logical.Connection{RemoteAddr: tc.RemoteAddr},
+					Data:       data,
+				})
+			}
+
+			_, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+				"tailnet": "example",
+				"api_key": "example",
+				"api_url": "http://localhost:1337",
+			})
+			require.NoError(t, err)
+
+			_, err = request(logical.UpdateOperation, "roles/ci", map[string]interface{}{
+				"tags":   "tag:ci",
+				"policy": tc.Policy,
+			})
+			if tc.ExpectsWriteError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = request(logical.ReadOperation, "creds/ci", nil)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, api.Requests(), 1)
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The ReconcileConfig type describes how often the authentication keys in the tailnet are compared to those known
+	// to the Backend, and whether unknown keys are deleted.
+	ReconcileConfig struct {
+		Interval      time.Duration `json:"interval"`
+		DeleteUnknown bool          `json:"delete_unknown"`
+	}
+
+	// The ReconcileStatus type describes the outcome of the latest comparison of the authentication keys in the
+	// tailnet with those known to the Backend.
+	ReconcileStatus struct {
+		LastRun time.Time    `json:"last_run"`
+		Known   int          `json:"known"`
+		Unknown []UnknownKey `json:"unknown"`
+		Error   string       `json:"error,omitempty"`
+	}
+
+	// The UnknownKey type describes an authentication key that exists in the tailnet but was not generated by the
+	// Backend.
+	UnknownKey struct {
+		ID          string    `json:"id"`
+		Description string    `json:"description"`
+		Tags        []string  `json:"tags"`
+		Created     time.Time `json:"created"`
+		Expires     time.Time `json:"expires"`
+		Deleted     bool      `json:"deleted"`
+		Error       string    `json:"error,omitempty"`
+	}
+)
+
+const (
+	reconcileConfigPath      = "config/reconcile"
+	reconcileStatusPath      = "reconcile/status"
+	defaultReconcileInterval = time.Hour
+
+	// Keys created within the grace period are never reported, as they may still be being issued by the Backend and
+	// not yet recorded.
+	reconcileGracePeriod = 5 * time.Minute
+
+	readReconcileConfigDescription   = "Read the key reconciliation configuration"
+	updateReconcileConfigDescription = "Update the key reconciliation configuration"
+	deleteReconcileConfigDescription = "Delete the key reconciliation configuration, disabling reconciliation"
+	reconcileIntervalDescription     = "How often the keys in the tailnet are compared to those generated by the backend"
+	reconcileDeleteDescription       = "If true, unknown keys that carry the issuer tag are deleted from the tailnet"
+	readReconcileStatusDescription   = "Read the outcome of the latest key reconciliation"
+
+	reconcileConfigHelpSynopsis    = "Configure periodic reconciliation of the keys in the tailnet."
+	reconcileConfigHelpDescription = `
+When configured, the authentication keys in the tailnet are compared to those generated by
+the backend at the given interval. Keys that exist in the tailnet but are unknown to the
+backend are reported at the reconcile/status path. If delete_unknown is set, unknown keys
+that carry the configured issuer tag are also deleted. Deleting this path disables
+reconciliation.
+`
+	reconcileStatusHelpSynopsis    = "Read the outcome of the latest key reconciliation."
+	reconcileStatusHelpDescription = `
+Returns when the keys in the tailnet were last reconciled, how many were known to the
+backend and the details of those that were not, including whether they were deleted.
+`
+)
+
+func (b *Backend) reconcilePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: reconcileConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"interval": {
+					Type:        framework.TypeDurationSecond,
+					Description: reconcileIntervalDescription,
+					Default:     int(defaultReconcileInterval.Seconds()),
+				},
+				"delete_unknown": {
+					Type:        framework.TypeBool,
+					Description: reconcileDeleteDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadReconcileConfiguration,
+					Responses: okResponse(readReconcileConfigDescription, reconcileConfigResponseFields()),
+					Summary:   readReconcileConfigDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateReconcileConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateReconcileConfigDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteReconcileConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteReconcileConfigDescription,
+				},
+			},
+			HelpSynopsis:    reconcileConfigHelpSynopsis,
+			HelpDescription: reconcileConfigHelpDescription,
+		},
+		{
+			Pattern: reconcileStatusPath + "$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadReconcileStatus,
+					Responses: okResponse(readReconcileStatusDescription, reconcileStatusResponseFields()),
+					Summary:   readReconcileStatusDescription,
+				},
+			},
+			HelpSynopsis:    reconcileStatusHelpSynopsis,
+			HelpDescription: reconcileStatusHelpDescription,
+		},
+	}
+}
+
+// ReadReconcileConfiguration returns the key reconciliation configuration.
+func (b *Backend) ReadReconcileConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.reconcileConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"interval":       int64(config.Interval.Seconds()),
+			"delete_unknown": config.DeleteUnknown,
+		},
+	}, nil
+}
+
+// UpdateReconcileConfiguration enables key reconciliation, or modifies how often it runs and whether unknown keys are
+// deleted. Returns an error if the interval is not positive.
+func (b *Backend) UpdateReconcileConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := ReconcileConfig{
+		Interval:      time.Duration(data.Get("interval").(int)) * time.Second,
+		DeleteUnknown: data.Get("delete_unknown").(bool),
+	}
+
+	if config.Interval <= 0 {
+		return nil, errors.New("provided interval must be greater than zero")
+	}
+
+	entry, err := logical.StorageEntryJSON(reconcileConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteReconcileConfiguration disables key reconciliation. The status of the latest reconciliation is kept.
+func (b *Backend) DeleteReconcileConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, reconcileConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// ReadReconcileStatus returns the outcome of the latest key reconciliation.
+func (b *Backend) ReadReconcileStatus(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	status, err := b.reconcileStatus(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case status == nil:
+		return nil, nil
+	}
+
+	unknown := make([]map[string]interface{}, 0, len(status.Unknown))
+	for _, key := range status.Unknown {
+		unknown = append(unknown, map[string]interface{}{
+			"id":          key.ID,
+			"description": key.Description,
+			"tags":        key.Tags,
+			"created":     key.Created,
+			"expires":     key.Expires,
+			"deleted":     key.Deleted,
+			"error":       key.Error,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"last_run": status.LastRun,
+			"known":    status.Known,
+			"unknown":  unknown,
+			"error":    status.Error,
+		},
+	}, nil
+}
+
+// reconcileKeys compares the authentication keys in the tailnet to those known to the Backend if reconciliation is
+// enabled and the configured interval has elapsed since it last ran. The outcome is stored, including any error, so
+// that it can be read from the reconcile/status path.
+func (b *Backend) reconcileKeys(ctx context.Context, storage logical.Storage) error {
+	config, err := b.reconcileConfig(ctx, storage)
+	if err != nil || config == nil {
+		return err
+	}
+
+	previous, err := b.reconcileStatus(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if previous != nil && now.Sub(previous.LastRun) < config.Interval {
+		return nil
+	}
+
+	status, err := b.reconcile(ctx, storage, *config, now)
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	entry, pErr := logical.StorageEntryJSON(reconcileStatusPath, status)
+	if pErr != nil {
+		return multierror.Append(err, pErr).ErrorOrNil()
+	}
+
+	return multierror.Append(err, storage.Put(ctx, entry)).ErrorOrNil()
+}
+
+func (b *Backend) reconcile(ctx context.Context, storage logical.Storage, config ReconcileConfig, now time.Time) (ReconcileStatus, error) {
+	status := ReconcileStatus{
+		LastRun: now,
+		Unknown: make([]UnknownKey, 0),
+	}
+
+	mount, err := b.config(ctx, storage)
+	if err != nil {
+		return status, err
+	}
+
+	client, err := b.newClient(mount)
+	if err != nil {
+		return status, err
+	}
+
+	known, err := b.knownKeyIDs(ctx, storage)
+	if err != nil {
+		return status, err
+	}
+
+	keys, err := client.Keys(ctx)
+	if err != nil {
+		return status, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	var errs *multierror.Error
+	for _, listed := range keys {
+		if _, ok := known[listed.ID]; ok {
+			status.Known++
+			continue
+		}
+
+		// The keys are listed without their details, so each unknown key is read individually.
+		key, err := client.GetKey(ctx, listed.ID)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to read key %q: %w", listed.ID, err))
+			continue
+		}
+
+		if !key.Revoked.IsZero() || key.Invalid || now.Sub(key.Created) < reconcileGracePeriod {
+			continue
+		}
+
+		unknown := UnknownKey{
+			ID:          key.ID,
+			Description: key.Description,
+			Tags:        key.Capabilities.Devices.Create.Tags,
+			Created:     key.Created,
+			Expires:     key.Expires,
+		}
+
+		// Only keys carrying the issuer tag are deleted, so that keys created outside of Vault, such as API keys,
+		// are reported but never removed.
+		if config.DeleteUnknown && mount.IssuerTag != "" && strutil.StrListContains(unknown.Tags, mount.IssuerTag) {
+			if err = b.deleteKey(ctx, storage, key.ID); err != nil {
+				unknown.Error = err.Error()
+			} else {
+				unknown.Deleted = true
+			}
+		}
+
+		status.Unknown = append(status.Unknown, unknown)
+	}
+
+	return status, errs.ErrorOrNil()
+}
+
+// knownKeyIDs returns the identifiers of every key the Backend has a record of. This includes issued keys, outstanding
+// keys whose records were scrubbed, the current and previous keys of static roles, keys waiting to be revoked and keys
+// that were generated but whose write-ahead log entries have not yet been rolled back.
+func (b *Backend) knownKeyIDs(ctx context.Context, storage logical.Storage) (map[string]struct{}, error) {
+	known := make(map[string]struct{})
+
+	issued, err := storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range issued {
+		known[id] = struct{}{}
+	}
+
+	scrubbed, err := storage.List(ctx, scrubbedKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range scrubbed {
+		known[id] = struct{}{}
+	}
+
+	pending, err := storage.List(ctx, pendingRevocationPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range pending {
+		known[id] = struct{}{}
+	}
+
+	names, err := storage.List(ctx, staticRolePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		role, err := b.staticRole(ctx, storage, name)
+		switch {
+		case err != nil:
+			return nil, err
+		case role == nil:
+			continue
+		}
+
+		for _, id := range []string{role.KeyID, role.PreviousKeyID} {
+			if id != "" {
+				known[id] = struct{}{}
+			}
+		}
+	}
+
+	wals, err := framework.ListWAL(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, walID := range wals {
+		entry, err := framework.GetWAL(ctx, storage, walID)
+		switch {
+		case err != nil:
+			return nil, err
+		case entry == nil, entry.Kind != walKindKey:
+			continue
+		}
+
+		encoded, err := json.Marshal(entry.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		var key keyWAL
+		if err = json.Unmarshal(encoded, &key); err != nil {
+			return nil, err
+		}
+
+		// Entries stored before their key was generated have no identifier, and their keys are within the grace period.
+		if key.ID != "" {
+			known[key.ID] = struct{}{}
+		}
+	}
+
+	return known, nil
+}
+
+func (b *Backend) reconcileConfig(ctx context.Context, storage logical.Storage) (*ReconcileConfig, error) {
+	entry, err := storage.Get(ctx, reconcileConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config ReconcileConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func (b *Backend) reconcileStatus(ctx context.Context, storage logical.Storage) (*ReconcileStatus, error) {
+	entry, err := storage.Get(ctx, reconcileStatusPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var status ReconcileStatus
+	if err = entry.DecodeJSON(&status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func reconcileConfigResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"interval": {
+			Type:        framework.TypeDurationSecond,
+			Description: reconcileIntervalDescription,
+		},
+		"delete_unknown": {
+			Type:        framework.TypeBool,
+			Description: reconcileDeleteDescription,
+		},
+	}
+}
+
+func reconcileStatusResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"last_run": {
+			Type:        framework.TypeTime,
+			Description: "When the keys in the tailnet were last reconciled",
+		},
+		"known": {
+			Type:        framework.TypeInt,
+			Description: "The number of keys in the tailnet that were generated by the backend",
+		},
+		"unknown": {
+			Type:        framework.TypeSlice,
+			Description: "The keys in the tailnet that were not generated by the backend",
+		},
+		"error": {
+			Type:        framework.TypeString,
+			Description: "The error that stopped the latest reconciliation from completing, if any",
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_ReconcileKeys(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	entry, err := logical.StorageEntryJSON("config", backend.Config{
+		Tailnet:   "example",
+		APIUrl:    "http://localhost:1337",
+		APIKey:    "example",
+		IssuerTag: "tag:vault",
+	})
+	require.NoError(t, err)
+	require.NoError(t, storage.Put(ctx, entry))
+
+	request := requester(ctx, b, storage)
+
+	unknownIDs := func(t *testing.T, response *logical.Response) map[string]bool {
+		t.Helper()
+
+		ids := make(map[string]bool)
+		for _, key := range response.Data["unknown"].([]map[string]interface{}) {
+			ids[key["id"].(string)] = key["deleted"].(bool)
+		}
+
+		return ids
+	}
+
+	_, err = request(logical.ReadOperation, "key", map[string]interface{}{"tags": []string{"tag:server"}})
+	require.NoError(t, err)
+
+	created := time.Now().UTC().Add(-time.Hour)
+	key := func(id string, tags ...string) tailscale.Key {
+		k := tailscale.Key{ID: id, Created: created, Expires: created.Add(24 * time.Hour)}
+		k.Capabilities.Devices.Create.Tags = tags
+		return k
+	}
+
+	fresh := key("key-fresh", "tag:vault")
+	fresh.Created = time.Now().UTC()
+
+	api.SetKeys(key("key-console", "tag:vault"), key("key-api"), fresh)
+
+	t.Run("It should not reconcile keys unless configured", func(t *testing.T) {
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "reconcile/status", nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+
+	_, err = request(logical.UpdateOperation, "config/reconcile", map[string]interface{}{"interval": "1h"})
+	require.NoError(t, err)
+
+	t.Run("It should report keys that are unknown to the backend", func(t *testing.T) {
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "reconcile/status", nil)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+
+		assert.EqualValues(t, 1, response.Data["known"])
+		assert.EqualValues(t, map[string]bool{"key-console": false, "key-api": false}, unknownIDs(t, response))
+		assert.Empty(t, response.Data["error"])
+		assert.Empty(t, api.Deleted())
+	})
+
+	t.Run("It should not reconcile keys again until the interval has elapsed", func(t *testing.T) {
+		before, err := request(logical.ReadOperation, "reconcile/status", nil)
+		require.NoError(t, err)
+
+		_, err = request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		after, err := request(logical.ReadOperation, "reconcile/status", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, before.Data["last_run"], after.Data["last_run"])
+	})
+
+	_, err = request(logical.UpdateOperation, "config/reconcile", map[string]interface{}{
+		"interval":       "1h",
+		"delete_unknown": true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, storage.Delete(ctx, "reconcile/status"))
+
+	t.Run("It should only delete unknown keys that carry the issuer tag", func(t *testing.T) {
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "reconcile/status", nil)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+
+		assert.EqualValues(t, map[string]bool{"key-console": true, "key-api": false}, unknownIDs(t, response))
+		assert.EqualValues(t, []string{"key-console"}, api.Deleted())
+	})
+
+	t.Run("It should not delete keys whose records were scrubbed", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+			EntityID:  "entity-1",
+			Data:      map[string]interface{}{"tags": []string{"tag:server"}},
+		})
+		require.NoError(t, err)
+
+		response, err := request(logical.UpdateOperation, "issued-keys/scrub", map[string]interface{}{"entity_id": "entity-1"})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, response.Data["deleted"])
+		require.NoError(t, storage.Delete(ctx, "reconcile/status"))
+
+		_, err = request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err = request(logical.ReadOperation, "reconcile/status", nil)
+		require.NoError(t, err)
+		require.NotNil(t, response)
+
+		assert.NotContains(t, unknownIDs(t, response), "key-2")
+		assert.EqualValues(t, []string{"key-console"}, api.Deleted())
+	})
+
+	t.Run("It should return an error if the interval is not positive", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/reconcile", map[string]interface{}{"interval": 0})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+type (
+	// The hostOverride type describes how connections to the host of the configured API URL are made, for environments
+	// where the API hostname cannot be resolved using the system resolver. The host is either pinned to fixed addresses
+	// or resolved using a specific DNS server.
+	hostOverride struct {
+		host      string
+		addresses []string
+		resolver  string
+	}
+)
+
+// apiHostOverride returns the override for the host of the configured API URL, or nil if neither addresses nor a
+// resolver are configured.
+func apiHostOverride(config Config) (*hostOverride, error) {
+	if len(config.APIAddresses) == 0 && config.APIResolver == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(config.APIUrl)
+	if err != nil {
+		return nil, fmt.Errorf("configured api_url is invalid: %w", err)
+	}
+
+	return &hostOverride{
+		host:      u.Hostname(),
+		addresses: config.APIAddresses,
+		resolver:  config.APIResolver,
+	}, nil
+}
+
+// dialContext wraps a dial function so that connections to the overridden host are made to the pinned addresses, in
+// order until one succeeds, or resolved using the configured DNS server. Other hosts are dialled as normal.
+func (o *hostOverride) dialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || host != o.host {
+			return dial(ctx, network, address)
+		}
+
+		if o.resolver != "" {
+			dialer := &net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				Resolver: &net.Resolver{
+					PreferGo: true,
+					Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+						return dial(ctx, network, o.resolver)
+					},
+				},
+			}
+
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		var errs *multierror.Error
+		for _, addr := range o.addresses {
+			conn, err := dial(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+
+			errs = multierror.Append(errs, err)
+		}
+
+		return nil, fmt.Errorf("failed to connect to any pinned address of %s: %w", host, errs.ErrorOrNil())
+	}
+}
+
+// validateAPIHostOverride returns an error if both pinned addresses and a resolver are configured, any pinned address
+// is not an IP address or the resolver is not a host and port.
+func validateAPIHostOverride(addresses []string, resolver string) error {
+	if len(addresses) > 0 && resolver != "" {
+		return errors.New("provided api_addresses and api_resolver cannot both be set")
+	}
+
+	for _, address := range addresses {
+		if _, err := netip.ParseAddr(address); err != nil {
+			return fmt.Errorf("provided api address %q must be an IP address", address)
+		}
+	}
+
+	if resolver == "" {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		return fmt.Errorf("provided api_resolver must be a host and port: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_PinnedAPIAddresses(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	configure := func(t *testing.T, addresses string) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"tailnet":       "example",
+				"api_key":       "example",
+				"api_url":       "http://api.tailscale.invalid:1337",
+				"api_addresses": addresses,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	issue := func() error {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+		})
+		return err
+	}
+
+	t.Run("It should connect to the pinned addresses of the api", func(t *testing.T) {
+		configure(t, "::1,127.0.0.1")
+
+		require.NoError(t, issue())
+		assert.Len(t, api.Requests(), 1)
+	})
+
+	t.Run("It should resolve the api host once the addresses are removed", func(t *testing.T) {
+		configure(t, "")
+
+		assert.Error(t, issue())
+	})
+}
+
+func TestBackend_PinnedAPIAddressesPerMount(t *testing.T) {
+	ctx, pinned := setup(t)
+	_, unpinned := setup(t)
+
+	pinnedStorage := &logical.InmemStorage{}
+	unpinnedStorage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	configure := func(t *testing.T, b *backend.Backend, storage logical.Storage, addresses string) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"tailnet":       "example",
+				"api_key":       "example",
+				"api_url":       "http://api.tailscale.invalid:1337",
+				"api_addresses": addresses,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	issue := func(b *backend.Backend, storage logical.Storage) error {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+		})
+		return err
+	}
+
+	configure(t, pinned, pinnedStorage, "127.0.0.1")
+	require.NoError(t, issue(pinned, pinnedStorage))
+
+	configure(t, unpinned, unpinnedStorage, "")
+
+	t.Run("It should not apply the pinned addresses of one mount to another", func(t *testing.T) {
+		assert.Error(t, issue(unpinned, unpinnedStorage))
+	})
+
+	t.Run("It should keep the pinned addresses of a mount when another mount is configured", func(t *testing.T) {
+		require.NoError(t, issue(pinned, pinnedStorage))
+		assert.Len(t, api.Requests(), 2)
+	})
+}
@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The Retrieval type describes a generated key that is stored until it is retrieved using a single-use token.
+	Retrieval struct {
+		Data    map[string]interface{} `json:"data"`
+		Expires time.Time              `json:"expires"`
+	}
+)
+
+const (
+	retrievalPrefix     = "retrieval/"
+	defaultRetrievalTTL = time.Hour
+
+	retrieveDescription       = "Retrieve a generated key using a single-use retrieval token"
+	retrievalTokenDescription = "The single-use token returned when the key was generated"
+	retrievalDescription      = "If true, the generated key is stored and a single-use token is returned that can be used to retrieve it via the retrieve path"
+
+	retrieveHelpSynopsis    = "Retrieve a generated key using a single-use retrieval token."
+	retrieveHelpDescription = `
+Returns a key generated with a retrieval token. Each token can only be used once and
+expires if it is not used, after which the key can no longer be retrieved.
+`
+)
+
+func (b *Backend) retrievalPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "retrieve/" + framework.GenericNameRegex("token"),
+			Fields: map[string]*framework.FieldSchema{
+				"token": {
+					Type:        framework.TypeString,
+					Description: retrievalTokenDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.Retrieve,
+					Responses: okResponse(retrieveDescription, keyResponseFields()),
+					Summary:   retrieveDescription,
+				},
+			},
+			HelpSynopsis:    retrieveHelpSynopsis,
+			HelpDescription: retrieveHelpDescription,
+		},
+	}
+}
+
+// Retrieve returns a generated key using its single-use retrieval token. The key is removed from storage once it has
+// been retrieved, so subsequent attempts using the same token fail.
+func (b *Backend) Retrieve(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.retrievalMu.Lock()
+	defer b.retrievalMu.Unlock()
+
+	path := retrievalPath(data.Get("token").(string))
+	entry, err := request.Storage.Get(ctx, path)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, fmt.Errorf("retrieval token is invalid, expired or has already been used")
+	}
+
+	var retrieval Retrieval
+	if err = entry.DecodeJSON(&retrieval); err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Delete(ctx, path); err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(retrieval.Expires) {
+		return nil, fmt.Errorf("retrieval token is invalid, expired or has already been used")
+	}
+
+	return &logical.Response{Data: retrieval.Data}, nil
+}
+
+// storeForRetrieval stores the response of a generated key, returning a response containing the single-use token
+// required to retrieve it in place of the key itself.
+func (b *Backend) storeForRetrieval(ctx context.Context, storage logical.Storage, response *logical.Response) (*logical.Response, error) {
+	token, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	retrieval := Retrieval{
+		Data:    response.Data,
+		Expires: time.Now().UTC().Add(defaultRetrievalTTL),
+	}
+
+	entry, err := logical.StorageEntryJSON(retrievalPath(token), retrieval)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":                response.Data["id"],
+			"expires":           response.Data["expires"],
+			"retrieval_token":   token,
+			"retrieval_expires": retrieval.Expires,
+		},
+	}, nil
+}
+
+// tidyRetrievals removes any stored keys whose retrieval tokens have expired.
+func (b *Backend) tidyRetrievals(ctx context.Context, storage logical.Storage) error {
+	b.retrievalMu.Lock()
+	defer b.retrievalMu.Unlock()
+
+	hashes, err := storage.List(ctx, retrievalPrefix)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	now := time.Now()
+	for _, hash := range hashes {
+		entry, err := storage.Get(ctx, retrievalPrefix+hash)
+		switch {
+		case err != nil:
+			errs = multierror.Append(errs, err)
+			continue
+		case entry == nil:
+			continue
+		}
+
+		var retrieval Retrieval
+		if err = entry.DecodeJSON(&retrieval); err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+
+		if now.After(retrieval.Expires) {
+			errs = multierror.Append(errs, storage.Delete(ctx, retrievalPrefix+hash))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// retrievalPath returns the storage path of a retrieval. Tokens are hashed so they cannot be recovered from storage.
+func retrievalPath(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return retrievalPrefix + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,61 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_Retrieve(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name string
+		Path string
+		Data map[string]interface{}
+	}{
+		{
+			Name: "It should return a retrieval token when requested",
+			Path: "key",
+			Data: map[string]interface{}{
+				"retrieval_token": true,
+			},
+		},
+		{
+			Name: "It should return a retrieval token when required by the role",
+			Path: "creds/test",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			putConfig(t, ctx, storage)
+			mockKeysAPI(t)
+
+			request := requester(ctx, b, storage)
+
+			_, err := request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+				"retrieval_token": true,
+			})
+			require.NoError(t, err)
+
+			response, err := request(logical.ReadOperation, tc.Path, tc.Data)
+			require.NoError(t, err)
+			assert.NotContains(t, response.Data, "key")
+			assert.EqualValues(t, "key-1", response.Data["id"])
+
+			token := response.Data["retrieval_token"].(string)
+			require.NotEmpty(t, token)
+
+			response, err = request(logical.ReadOperation, "retrieve/"+token, nil)
+			require.NoError(t, err)
+			assert.EqualValues(t, "secret-1", response.Data["key"])
+
+			_, err = request(logical.ReadOperation, "retrieve/"+token, nil)
+			assert.Error(t, err)
+		})
+	}
+}
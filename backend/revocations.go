@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// The PendingRevocation type describes a key that could not be deleted from the tailnet and is waiting to be
+	// retried.
+	PendingRevocation struct {
+		KeyID       string    `json:"key_id"`
+		Config      string    `json:"config,omitempty"`
+		Attempts    int       `json:"attempts"`
+		LastError   string    `json:"last_error"`
+		Queued      time.Time `json:"queued"`
+		NextAttempt time.Time `json:"next_attempt"`
+	}
+)
+
+const (
+	pendingRevocationPrefix = "revocations/"
+
+	minRevocationBackoff = time.Minute
+	maxRevocationBackoff = time.Hour
+)
+
+// revokeKey deletes a key from the tailnet. If the deletion fails, the key is queued so that the deletion is retried
+// by the periodic function rather than being lost. An error is only returned if the key could not be queued.
+func (b *Backend) revokeKey(ctx context.Context, storage logical.Storage, id string) error {
+	return b.revokeKeyFrom(ctx, storage, "", id)
+}
+
+// revokeKeyFrom deletes a key from the tailnet of the named configuration, as revokeKey does. If no configuration is
+// named, the key is deleted from the tailnet it was recorded as being generated in.
+func (b *Backend) revokeKeyFrom(ctx context.Context, storage logical.Storage, configName, id string) error {
+	err := b.deleteKeyFrom(ctx, storage, configName, id)
+	if err == nil || tailscale.IsNotFound(err) {
+		return nil
+	}
+
+	return b.queueRevocation(ctx, storage, configName, id, err)
+}
+
+// queueRevocation queues a key that could not be deleted from the tailnet of the named configuration, so that the
+// deletion is retried by the periodic function.
+func (b *Backend) queueRevocation(ctx context.Context, storage logical.Storage, configName, id string, err error) error {
+	b.Logger().Warn("failed to delete key, queueing for retry", "id", id, "error", err)
+
+	now := time.Now().UTC()
+	return b.savePendingRevocation(ctx, storage, &PendingRevocation{
+		KeyID:       id,
+		Config:      configName,
+		Attempts:    1,
+		LastError:   err.Error(),
+		Queued:      now,
+		NextAttempt: now.Add(revocationBackoff(1)),
+	})
+}
+
+// retryRevocations attempts to delete any queued keys that are due a retry, or all queued keys if force is true. Each
+// failed attempt doubles the time until the next, up to a maximum of an hour. Keys that no longer exist in the tailnet
+// are removed from the queue.
+func (b *Backend) retryRevocations(ctx context.Context, storage logical.Storage, force bool) error {
+	ids, err := storage.List(ctx, pendingRevocationPrefix)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	var errs *multierror.Error
+	now := time.Now()
+	for _, id := range ids {
+		pending, err := b.pendingRevocation(ctx, storage, id)
+		switch {
+		case err != nil:
+			errs = multierror.Append(errs, err)
+			continue
+		case pending == nil, !force && now.Before(pending.NextAttempt):
+			continue
+		}
+
+		err = b.deleteKeyFrom(ctx, storage, pending.Config, pending.KeyID)
+		if err == nil || tailscale.IsNotFound(err) {
+			errs = multierror.Append(errs, storage.Delete(ctx, pendingRevocationPrefix+id))
+			continue
+		}
+
+		pending.Attempts++
+		pending.LastError = err.Error()
+		pending.NextAttempt = now.UTC().Add(revocationBackoff(pending.Attempts))
+		errs = multierror.Append(errs, b.savePendingRevocation(ctx, storage, pending))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// revocationBackoff returns how long to wait before the next attempt to delete a key that has failed the given
+// number of times.
+func revocationBackoff(attempts int) time.Duration {
+	backoff := minRevocationBackoff
+	for i := 1; i < attempts && backoff < maxRevocationBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxRevocationBackoff {
+		return maxRevocationBackoff
+	}
+
+	return backoff
+}
+
+func (b *Backend) savePendingRevocation(ctx context.Context, storage logical.Storage, pending *PendingRevocation) error {
+	entry, err := logical.StorageEntryJSON(pendingRevocationPrefix+pending.KeyID, pending)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *Backend) pendingRevocation(ctx context.Context, storage logical.Storage, id string) (*PendingRevocation, error) {
+	entry, err := storage.Get(ctx, pendingRevocationPrefix+id)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var pending PendingRevocation
+	if err = entry.DecodeJSON(&pending); err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
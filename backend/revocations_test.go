@@ -0,0 +1,85 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_RevocationRetries(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "static-roles/test", nil)
+	require.NoError(t, err)
+
+	t.Run("It should queue keys that fail to be deleted", func(t *testing.T) {
+		api.SetFailingDeletes(true)
+
+		_, err := request(logical.UpdateOperation, "rotate-role/test", nil)
+		require.NoError(t, err)
+
+		queued, err := storage.List(ctx, "revocations/")
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-1"}, queued)
+	})
+
+	t.Run("It should not retry before the backoff has elapsed", func(t *testing.T) {
+		api.SetFailingDeletes(false)
+
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+		assert.Empty(t, api.Deleted())
+	})
+
+	t.Run("It should delete queued keys once due", func(t *testing.T) {
+		entry, err := logical.StorageEntryJSON("revocations/key-1", backend.PendingRevocation{
+			KeyID:       "key-1",
+			Attempts:    1,
+			NextAttempt: time.Now().Add(-time.Second),
+		})
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+
+		_, err = request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-1"}, api.Deleted())
+
+		queued, err := storage.List(ctx, "revocations/")
+		require.NoError(t, err)
+		assert.Empty(t, queued)
+	})
+}
+
+func TestBackend_InitializeRevocations(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	entry, err := logical.StorageEntryJSON("revocations/key-1", backend.PendingRevocation{
+		KeyID:       "key-1",
+		Attempts:    3,
+		NextAttempt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.NoError(t, storage.Put(ctx, entry))
+
+	require.NoError(t, b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}))
+	assert.EqualValues(t, []string{"key-1"}, api.Deleted())
+
+	queued, err := storage.List(ctx, "revocations/")
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+}
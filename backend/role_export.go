@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	exportRolesDescription = "Export the definitions of all roles as JSON"
+	importRolesDescription = "Create or replace roles from exported definitions"
+	importRolesField       = "The role definitions to import, as returned by roles/export"
+
+	exportRolesHelpSynopsis    = "Export all role definitions."
+	exportRolesHelpDescription = `
+Returns the definitions of every role, so that they can be imported into another mount
+or cluster using roles/import.
+`
+	importRolesHelpSynopsis    = "Import role definitions."
+	importRolesHelpDescription = `
+Creates or replaces roles from definitions returned by roles/export. Every role is
+validated before any are written, so an import containing an invalid role changes
+nothing. Roles that are not part of the import are left unchanged.
+`
+)
+
+// roleName matches valid role names, which are those accepted by the roles path.
+var roleName = regexp.MustCompile("^" + framework.GenericNameRegex("name") + "$")
+
+// roleExportPaths returns the paths used to export and import roles. They must be registered before the paths of
+// individual roles, whose pattern would otherwise match them.
+func (b *Backend) roleExportPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "roles/export$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ExportRoles,
+					Responses: okResponse(exportRolesDescription, roleExportResponseFields()),
+					Summary:   exportRolesDescription,
+				},
+			},
+			HelpSynopsis:    exportRolesHelpSynopsis,
+			HelpDescription: exportRolesHelpDescription,
+		},
+		{
+			Pattern: "roles/import$",
+			Fields: map[string]*framework.FieldSchema{
+				"roles": {
+					Type:        framework.TypeSlice,
+					Description: importRolesField,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.ImportRoles,
+					Responses: okResponse(importRolesDescription, roleImportResponseFields()),
+					Summary:   importRolesDescription,
+				},
+			},
+			HelpSynopsis:    importRolesHelpSynopsis,
+			HelpDescription: importRolesHelpDescription,
+		},
+	}
+}
+
+// ExportRoles returns the definitions of all roles.
+func (b *Backend) ExportRoles(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	names, err := request.Storage.List(ctx, rolePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]*Role, 0, len(names))
+	for _, name := range names {
+		role, err := b.role(ctx, request.Storage, name)
+		switch {
+		case err != nil:
+			return nil, err
+		case role == nil:
+			continue
+		}
+
+		roles = append(roles, role)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"roles": roles,
+		},
+	}, nil
+}
+
+// ImportRoles creates or replaces the roles in the request. Every role is validated before any are stored, so that an
+// invalid role causes none of them to be imported.
+func (b *Backend) ImportRoles(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// The roles are decoded via JSON so that they are read in the same form as they are exported.
+	encoded, err := json.Marshal(data.Get("roles"))
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []*Role
+	if err = json.Unmarshal(encoded, &roles); err != nil {
+		return nil, fmt.Errorf("provided roles are invalid: %w", err)
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		switch {
+		case role == nil, !roleName.MatchString(role.Name):
+			return nil, fmt.Errorf("provided roles are invalid: each role must have a valid name")
+		}
+
+		if err = b.validateRole(ctx, request.Storage, role); err != nil {
+			return nil, fmt.Errorf("provided role %q is invalid: %w", role.Name, err)
+		}
+
+		names = append(names, role.Name)
+	}
+
+	for _, role := range roles {
+		if err = b.saveRole(ctx, request.Storage, role); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"imported": names,
+		},
+	}, nil
+}
+
+func roleExportResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"roles": {
+			Type:        framework.TypeSlice,
+			Description: "The definitions of every role",
+		},
+	}
+}
+
+func roleImportResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"imported": {
+			Type:        framework.TypeStringSlice,
+			Description: "The names of the imported roles",
+		},
+	}
+}
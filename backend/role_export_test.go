@@ -0,0 +1,87 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_RoleExport(t *testing.T) {
+	ctx, b := setup(t)
+
+	source := &logical.InmemStorage{}
+	destination := &logical.InmemStorage{}
+
+	for name, tags := range map[string]string{"ci": "tag:ci", "prod": "tag:prod"} {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/" + name,
+			Storage:   source,
+			Data:      map[string]interface{}{"tags": tags, "max_expiry": "24h"},
+		})
+		require.NoError(t, err)
+	}
+
+	response, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/export",
+		Storage:   source,
+	})
+	require.NoError(t, err)
+
+	// The exported roles are passed through JSON, as they would be by the Vault API.
+	encoded, err := json.Marshal(response.Data)
+	require.NoError(t, err)
+
+	var exported map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &exported))
+
+	t.Run("It should not import any roles if one is invalid", func(t *testing.T) {
+		roles := append([]interface{}{map[string]interface{}{"name": "bad", "policy": "not cel"}}, exported["roles"].([]interface{})...)
+
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/import",
+			Storage:   destination,
+			Data:      map[string]interface{}{"roles": roles},
+		})
+		assert.Error(t, err)
+
+		names, err := destination.List(ctx, "roles/")
+		require.NoError(t, err)
+		assert.Empty(t, names)
+	})
+
+	t.Run("It should not import roles with reserved names", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/import",
+			Storage:   destination,
+			Data:      map[string]interface{}{"roles": []interface{}{map[string]interface{}{"name": "export"}}},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should import exported roles", func(t *testing.T) {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/import",
+			Storage:   destination,
+			Data:      exported,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"ci", "prod"}, response.Data["imported"])
+
+		response, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "roles/prod",
+			Storage:   destination,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"tag:prod"}, response.Data["tags"])
+		assert.EqualValues(t, 86400, response.Data["max_expiry"])
+	})
+}
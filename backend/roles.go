@@ -0,0 +1,1088 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/robfig/cron/v3"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// The Role type describes a named set of key settings that are applied to authentication keys generated by the
+	// Backend.
+	Role struct {
+		Name                   string        `json:"name"`
+		Tags                   []string      `json:"tags"`
+		Ephemeral              bool          `json:"ephemeral"`
+		Preauthorized          bool          `json:"preauthorized"`
+		Policy                 string        `json:"policy"`
+		RequireApproval        bool          `json:"require_approval"`
+		AllowedIssuanceWindows []string      `json:"allowed_issuance_windows"`
+		RetrievalToken         bool          `json:"retrieval_token"`
+		Reusable               bool          `json:"reusable"`
+		AllowedTags            []string      `json:"allowed_tags,omitempty"`
+		DeniedTags             []string      `json:"denied_tags,omitempty"`
+		LockPreauthorized      bool          `json:"lock_preauthorized,omitempty"`
+		LockEphemeral          bool          `json:"lock_ephemeral,omitempty"`
+		DefaultExpiry          time.Duration `json:"default_expiry,omitempty"`
+		MaxExpiry              time.Duration `json:"max_expiry,omitempty"`
+		TTL                    time.Duration `json:"ttl,omitempty"`
+		MaxTTL                 time.Duration `json:"max_ttl,omitempty"`
+		Description            string        `json:"description,omitempty"`
+		Config                 string        `json:"config,omitempty"`
+		AllowedConfigs         []string      `json:"allowed_configs,omitempty"`
+		BoundEntityIDs         []string      `json:"bound_entity_ids,omitempty"`
+		BoundGroupIDs          []string      `json:"bound_group_ids,omitempty"`
+		WrapRequired           bool          `json:"wrap_required,omitempty"`
+		DescriptionTemplate    string        `json:"description_template,omitempty"`
+		ResponseFields         []string      `json:"response_fields,omitempty"`
+		DeleteDevices          bool          `json:"delete_devices,omitempty"`
+		ReissueOnRenew         bool          `json:"reissue_on_renew,omitempty"`
+	}
+
+	// The descriptionData type contains the values available to the description template of a role.
+	descriptionData struct {
+		Role        string
+		RequestID   string
+		EntityName  string
+		DisplayName string
+		Time        time.Time
+	}
+)
+
+// reservedRoleNames are the names of paths under roles/ that are not roles.
+var reservedRoleNames = []string{"export", "import"}
+
+const (
+	rolePrefix = "roles/"
+
+	listRolesDescription           = "List the names of all roles"
+	listRolesPrefixDescription     = "If set, only the names of roles beginning with this prefix are listed"
+	readRoleDescription            = "Read the configuration of a role"
+	createRoleDescription          = "Create a role"
+	updateRoleDescription          = "Update a role, retaining the existing values of fields not provided"
+	patchRoleDescription           = "Modify the provided fields of an existing role"
+	deleteRoleDescription          = "Delete a role"
+	readRoleCredsDescription       = "Generate an authentication key using the settings of a role"
+	roleNameDescription            = "The name of the role"
+	roleTagsDescription            = "Tags applied to keys generated using the role when the request does not specify any. May contain identity templates, such as tag:team-{{identity.entity.metadata.team}}"
+	roleConfigDescription          = "The name of a configuration, stored under configs/, that keys generated using the role are generated with instead of the configuration of the mount"
+	roleAllowedConfigsDescription  = "Named configurations, stored under configs/, that requests may choose to generate keys with using the config field. Keys are generated with the config of the role if the request does not choose one"
+	roleBoundEntitiesDescription   = "If set, only these entities, or members of the bound groups, may generate keys using the role"
+	roleBoundGroupsDescription     = "If set, only members of these identity groups, or the bound entities, may generate keys using the role"
+	roleWrapRequiredDescription    = "If true, keys are only generated using the role if the response is wrapped, so that they can only be retrieved via a response wrapping token"
+	roleDescriptionTmplDescription = "A Go template rendering the description of keys generated using the role, which may use {{.Role}}, {{.RequestID}}, {{.EntityName}}, {{.DisplayName}} and {{.Time}}. Takes precedence over description"
+	roleResponseFieldsDescription  = "If set, only these fields, such as key and expires, are returned when a key is generated using the role"
+	roleDeleteDevicesDescription   = "If true, devices added to the tailnet using keys generated with the role are deleted when the lease of the key is revoked"
+	roleReissueOnRenewDescription  = "If true, renewing the lease of a key generated using the role replaces it with a new key, which is returned in the renewal response"
+	roleDescriptionDescription     = "A description set on keys generated using the role. May contain identity templates, such as {{identity.entity.name}}"
+	rolePreauthorizedDescription   = "Whether keys generated using the role are preauthorized when the request does not specify it"
+	rolePolicyDescription          = "A CEL expression that must evaluate to true for a key to be generated using the role"
+	roleRequireApprovalDescription = "If true, the approval webhook must approve each key generated using the role"
+	roleIssuanceWindowsDescription = "Cron expressions describing when keys may be generated using the role. A key may be generated when the current minute matches any expression"
+	roleRetrievalTokenDescription  = "If true, keys generated using the role are only returned via single-use retrieval tokens"
+	roleEphemeralDescription       = "Whether keys generated using the role are ephemeral when the request does not specify it"
+	roleReusableDescription        = "If true, keys generated using the role can be used to add more than one device. Cannot be set by the request"
+	roleCredsTagsDescription       = "Tags to apply to the device that uses the authentication key, replacing those of the role. Each must match the role's allowed_tags"
+	roleAllowedTagsDescription     = "Glob patterns, such as tag:ci-*, that each tag of keys generated using the role must match. Any tag is allowed if empty"
+	roleDeniedTagsDescription      = "Glob patterns, such as tag:admin, that no tag of keys generated using the role may match, even if allowed by allowed_tags"
+	lockPreauthorizedDescription   = "If true, requests cannot override the preauthorized setting of the role"
+	lockEphemeralDescription       = "If true, requests cannot override the ephemeral setting of the role"
+	roleDefaultExpiryDescription   = "How long keys generated using the role are valid for when the request does not specify it. Defaults to the expiry given by the Tailscale API"
+	roleMaxExpiryDescription       = "If set, requests for keys valid for longer than this duration are refused"
+	roleTTLDescription             = "The duration of the lease of keys generated using the role, after which they are deleted from the tailnet. Leases last until the key expires if unset"
+	roleMaxTTLDescription          = "If set, the maximum duration of the lease of keys generated using the role. Leases never outlive the key"
+
+	listRolesHelpSynopsis    = "List the names of all roles."
+	listRolesHelpDescription = `
+Lists the names of the roles keys can be generated with, optionally only those beginning
+with the given prefix.
+`
+	roleHelpSynopsis    = "Manage the roles keys can be generated with."
+	roleHelpDescription = `
+Roles describe the tags, flags, policy and issuance windows of keys generated using
+them. Access to individual roles can then be granted using Vault policies on the creds
+path of each role.
+`
+	roleCredsHelpSynopsis    = "Generate an authentication key using a role."
+	roleCredsHelpDescription = `
+Generates an authentication key using the settings of the role. The key may be encrypted
+to a PGP key or only returned via a single-use retrieval token, and metadata and labels
+may be stored with the record of the issued key.
+`
+)
+
+func (b *Backend) rolePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "roles/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"prefix": {
+					Type:        framework.TypeString,
+					Description: listRolesPrefixDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListRoles,
+					Responses: listResponse(listRolesDescription),
+					Summary:   listRolesDescription,
+				},
+			},
+			HelpSynopsis:    listRolesHelpSynopsis,
+			HelpDescription: listRolesHelpDescription,
+		},
+		{
+			Pattern: "roles/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: roleNameDescription,
+				},
+				"tags": {
+					Type:        framework.TypeStringSlice,
+					Description: roleTagsDescription,
+				},
+				"preauthorized": {
+					Type:        framework.TypeBool,
+					Description: rolePreauthorizedDescription,
+				},
+				"ephemeral": {
+					Type:        framework.TypeBool,
+					Description: roleEphemeralDescription,
+				},
+				"policy": {
+					Type:        framework.TypeString,
+					Description: rolePolicyDescription,
+				},
+				"require_approval": {
+					Type:        framework.TypeBool,
+					Description: roleRequireApprovalDescription,
+				},
+				"allowed_issuance_windows": {
+					Type:        framework.TypeStringSlice,
+					Description: roleIssuanceWindowsDescription,
+				},
+				"retrieval_token": {
+					Type:        framework.TypeBool,
+					Description: roleRetrievalTokenDescription,
+				},
+				"reusable": {
+					Type:        framework.TypeBool,
+					Description: roleReusableDescription,
+				},
+				"allowed_tags": {
+					Type:        framework.TypeStringSlice,
+					Description: roleAllowedTagsDescription,
+				},
+				"denied_tags": {
+					Type:        framework.TypeStringSlice,
+					Description: roleDeniedTagsDescription,
+				},
+				"lock_preauthorized": {
+					Type:        framework.TypeBool,
+					Description: lockPreauthorizedDescription,
+				},
+				"lock_ephemeral": {
+					Type:        framework.TypeBool,
+					Description: lockEphemeralDescription,
+				},
+				"default_expiry": {
+					Type:        framework.TypeDurationSecond,
+					Description: roleDefaultExpiryDescription,
+				},
+				"max_expiry": {
+					Type:        framework.TypeDurationSecond,
+					Description: roleMaxExpiryDescription,
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: roleTTLDescription,
+				},
+				"max_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: roleMaxTTLDescription,
+				},
+				"description": {
+					Type:        framework.TypeString,
+					Description: roleDescriptionDescription,
+				},
+				"config": {
+					Type:        framework.TypeString,
+					Description: roleConfigDescription,
+				},
+				"allowed_configs": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: roleAllowedConfigsDescription,
+				},
+				"bound_entity_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: roleBoundEntitiesDescription,
+				},
+				"bound_group_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: roleBoundGroupsDescription,
+				},
+				"wrap_required": {
+					Type:        framework.TypeBool,
+					Description: roleWrapRequiredDescription,
+				},
+				"description_template": {
+					Type:        framework.TypeString,
+					Description: roleDescriptionTmplDescription,
+				},
+				"response_fields": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: roleResponseFieldsDescription,
+				},
+				"delete_devices": {
+					Type:        framework.TypeBool,
+					Description: roleDeleteDevicesDescription,
+				},
+				"reissue_on_renew": {
+					Type:        framework.TypeBool,
+					Description: roleReissueOnRenewDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadRole,
+					Responses: okResponse(readRoleDescription, roleResponseFields()),
+					Summary:   readRoleDescription,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback:  b.UpdateRole,
+					Responses: noContentResponse(),
+					Summary:   createRoleDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateRole,
+					Responses: noContentResponse(),
+					Summary:   updateRoleDescription,
+				},
+				logical.PatchOperation: &framework.PathOperation{
+					Callback:  b.PatchRole,
+					Responses: noContentResponse(),
+					Summary:   patchRoleDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteRole,
+					Responses: noContentResponse(),
+					Summary:   deleteRoleDescription,
+				},
+			},
+			ExistenceCheck:  b.roleExists,
+			HelpSynopsis:    roleHelpSynopsis,
+			HelpDescription: roleHelpDescription,
+		},
+		{
+			Pattern: "creds/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: roleNameDescription,
+				},
+				"tags": {
+					Type:        framework.TypeStringSlice,
+					Description: roleCredsTagsDescription,
+				},
+				"pgp_key": {
+					Type:        framework.TypeString,
+					Description: pgpKeyDescription,
+				},
+				"retrieval_token": {
+					Type:        framework.TypeBool,
+					Description: retrievalDescription,
+				},
+				"metadata": {
+					Type:        framework.TypeKVPairs,
+					Description: metadataDescription,
+				},
+				"labels": {
+					Type:        framework.TypeKVPairs,
+					Description: labelsDescription,
+				},
+				"expiry": {
+					Type:        framework.TypeDurationSecond,
+					Description: expiryDescription,
+				},
+				"config": {
+					Type:        framework.TypeString,
+					Description: requestConfigDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadRoleCreds,
+					Responses: okResponse(readRoleCredsDescription, keyResponseFields()),
+					Summary:   readRoleCredsDescription,
+				},
+			},
+			HelpSynopsis:    roleCredsHelpSynopsis,
+			HelpDescription: roleCredsHelpDescription,
+		},
+	}
+}
+
+// ListRoles returns the names of all roles, or only those beginning with the requested prefix.
+func (b *Backend) ListRoles(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := request.Storage.List(ctx, rolePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := data.Get("prefix").(string)
+	if prefix == "" {
+		return logical.ListResponse(names), nil
+	}
+
+	filtered := make([]string, 0, len(names))
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			filtered = append(filtered, name)
+		}
+	}
+
+	return logical.ListResponse(filtered), nil
+}
+
+// ReadRole returns the configuration of a role.
+func (b *Backend) ReadRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(ctx, request.Storage, data.Get("name").(string))
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":                     role.Name,
+			"tags":                     role.Tags,
+			"ephemeral":                role.Ephemeral,
+			"preauthorized":            role.Preauthorized,
+			"policy":                   role.Policy,
+			"require_approval":         role.RequireApproval,
+			"allowed_issuance_windows": role.AllowedIssuanceWindows,
+			"retrieval_token":          role.RetrievalToken,
+			"reusable":                 role.Reusable,
+			"allowed_tags":             role.AllowedTags,
+			"denied_tags":              role.DeniedTags,
+			"lock_preauthorized":       role.LockPreauthorized,
+			"lock_ephemeral":           role.LockEphemeral,
+			"default_expiry":           int64(role.DefaultExpiry.Seconds()),
+			"max_expiry":               int64(role.MaxExpiry.Seconds()),
+			"ttl":                      int64(role.TTL.Seconds()),
+			"max_ttl":                  int64(role.MaxTTL.Seconds()),
+			"description":              role.Description,
+			"config":                   role.Config,
+			"allowed_configs":          role.AllowedConfigs,
+			"bound_entity_ids":         role.BoundEntityIDs,
+			"bound_group_ids":          role.BoundGroupIDs,
+			"wrap_required":            role.WrapRequired,
+			"description_template":     role.DescriptionTemplate,
+			"response_fields":          role.ResponseFields,
+			"delete_devices":           role.DeleteDevices,
+			"reissue_on_renew":         role.ReissueOnRenew,
+		},
+	}, nil
+}
+
+// roleExists returns true if the role exists, so that writes to a new role are create operations and writes to an
+// existing role are update operations.
+func (b *Backend) roleExists(ctx context.Context, request *logical.Request, data *framework.FieldData) (bool, error) {
+	role, err := b.role(ctx, request.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return role != nil, nil
+}
+
+// UpdateRole creates or modifies a role. Fields not provided in the request retain their existing values.
+func (b *Backend) UpdateRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	role, err := b.role(ctx, request.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		role = &Role{Name: name}
+	}
+
+	if tags, ok := data.GetOk("tags"); ok {
+		role.Tags = tags.([]string)
+	}
+	if preauthorized, ok := data.GetOk("preauthorized"); ok {
+		role.Preauthorized = preauthorized.(bool)
+	}
+	if ephemeral, ok := data.GetOk("ephemeral"); ok {
+		role.Ephemeral = ephemeral.(bool)
+	}
+	if policy, ok := data.GetOk("policy"); ok {
+		role.Policy = policy.(string)
+	}
+	if requireApproval, ok := data.GetOk("require_approval"); ok {
+		role.RequireApproval = requireApproval.(bool)
+	}
+	if windows, ok := data.GetOk("allowed_issuance_windows"); ok {
+		role.AllowedIssuanceWindows = windows.([]string)
+	}
+	if retrieval, ok := data.GetOk("retrieval_token"); ok {
+		role.RetrievalToken = retrieval.(bool)
+	}
+	if reusable, ok := data.GetOk("reusable"); ok {
+		role.Reusable = reusable.(bool)
+	}
+	if allowed, ok := data.GetOk("allowed_tags"); ok {
+		role.AllowedTags = allowed.([]string)
+	}
+	if denied, ok := data.GetOk("denied_tags"); ok {
+		role.DeniedTags = denied.([]string)
+	}
+	if lock, ok := data.GetOk("lock_preauthorized"); ok {
+		role.LockPreauthorized = lock.(bool)
+	}
+	if lock, ok := data.GetOk("lock_ephemeral"); ok {
+		role.LockEphemeral = lock.(bool)
+	}
+	if expiry, ok := data.GetOk("default_expiry"); ok {
+		role.DefaultExpiry = time.Duration(expiry.(int)) * time.Second
+	}
+	if expiry, ok := data.GetOk("max_expiry"); ok {
+		role.MaxExpiry = time.Duration(expiry.(int)) * time.Second
+	}
+	if ttl, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if ttl, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if description, ok := data.GetOk("description"); ok {
+		role.Description = description.(string)
+	}
+	if config, ok := data.GetOk("config"); ok {
+		role.Config = config.(string)
+	}
+	if configs, ok := data.GetOk("allowed_configs"); ok {
+		role.AllowedConfigs = configs.([]string)
+	}
+	if entities, ok := data.GetOk("bound_entity_ids"); ok {
+		role.BoundEntityIDs = entities.([]string)
+	}
+	if groups, ok := data.GetOk("bound_group_ids"); ok {
+		role.BoundGroupIDs = groups.([]string)
+	}
+	if wrap, ok := data.GetOk("wrap_required"); ok {
+		role.WrapRequired = wrap.(bool)
+	}
+	if description, ok := data.GetOk("description_template"); ok {
+		role.DescriptionTemplate = description.(string)
+	}
+	if fields, ok := data.GetOk("response_fields"); ok {
+		role.ResponseFields = fields.([]string)
+	}
+	if value, ok := data.GetOk("delete_devices"); ok {
+		role.DeleteDevices = value.(bool)
+	}
+	if value, ok := data.GetOk("reissue_on_renew"); ok {
+		role.ReissueOnRenew = value.(bool)
+	}
+
+	if err = b.validateRole(ctx, request.Storage, role); err != nil {
+		return nil, err
+	}
+
+	if err = b.saveRole(ctx, request.Storage, role); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// PatchRole modifies the fields of an existing role that are provided in the request, leaving the others unchanged.
+// Returns an error if the role does not exist.
+func (b *Backend) PatchRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	role, err := b.role(ctx, request.Storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("role %q does not exist", name)
+	}
+
+	return b.UpdateRole(ctx, request, data)
+}
+
+// DeleteRole removes a role.
+func (b *Backend) DeleteRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, rolePrefix+data.Get("name").(string)); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// ReadRoleCreds generates a new authentication key using the settings of a role. Returns an error if the role does
+// not exist.
+func (b *Backend) ReadRoleCreds(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	name := data.Get("name").(string)
+	role, err := b.role(ctx, request.Storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("role %q does not exist", name)
+	}
+
+	return b.issueKey(ctx, request, data, config, role, "")
+}
+
+// validateRole returns an error if any of the fields of the role are invalid, or it names a configuration that does not
+// exist.
+func (b *Backend) validateRole(ctx context.Context, storage logical.Storage, role *Role) error {
+	if err := checkRoleName(role.Name); err != nil {
+		return err
+	}
+
+	if role.Policy != "" {
+		if _, err := compilePolicy(role.Policy); err != nil {
+			return fmt.Errorf("provided policy is invalid: %w", err)
+		}
+	}
+
+	for _, window := range role.AllowedIssuanceWindows {
+		if _, err := cron.ParseStandard(window); err != nil {
+			return fmt.Errorf("provided issuance window %q is invalid: %w", window, err)
+		}
+	}
+
+	if role.Config != "" {
+		config, err := b.namedConfig(ctx, storage, role.Config)
+		switch {
+		case err != nil:
+			return err
+		case config == nil:
+			return fmt.Errorf("provided config %q does not exist", role.Config)
+		}
+	}
+
+	for _, name := range role.AllowedConfigs {
+		config, err := b.namedConfig(ctx, storage, name)
+		switch {
+		case err != nil:
+			return err
+		case config == nil:
+			return fmt.Errorf("provided allowed config %q does not exist", name)
+		}
+	}
+
+	if role.Config != "" && len(role.AllowedConfigs) > 0 && !strutil.StrListContains(role.AllowedConfigs, role.Config) {
+		return fmt.Errorf("provided config %q must be one of allowed_configs", role.Config)
+	}
+
+	if err := checkTemplates(append([]string{role.Description}, role.Tags...)...); err != nil {
+		return fmt.Errorf("provided role is invalid: %w", err)
+	}
+
+	if role.DescriptionTemplate != "" {
+		if _, err := role.renderDescription(descriptionData{}); err != nil {
+			return fmt.Errorf("provided description_template is invalid: %w", err)
+		}
+	}
+
+	if err := role.checkAllowedTags(role.Tags); err != nil {
+		return fmt.Errorf("provided tags are invalid: %w", err)
+	}
+
+	fields := keyResponseFields()
+	for _, field := range role.ResponseFields {
+		if _, ok := fields[field]; !ok {
+			return fmt.Errorf("provided response field %q is not a field of generated keys", field)
+		}
+	}
+
+	switch {
+	case role.DefaultExpiry < 0:
+		return fmt.Errorf("provided default_expiry cannot be negative")
+	case role.MaxExpiry < 0:
+		return fmt.Errorf("provided max_expiry cannot be negative")
+	case role.MaxExpiry > 0 && role.DefaultExpiry > role.MaxExpiry:
+		return fmt.Errorf("provided default_expiry cannot be greater than max_expiry")
+	case role.TTL < 0:
+		return fmt.Errorf("provided ttl cannot be negative")
+	case role.MaxTTL < 0:
+		return fmt.Errorf("provided max_ttl cannot be negative")
+	case role.MaxTTL > 0 && role.TTL > role.MaxTTL:
+		return fmt.Errorf("provided ttl cannot be greater than max_ttl")
+	}
+
+	if err := role.checkDeniedTags(role.Tags); err != nil {
+		return fmt.Errorf("provided tags are invalid: %w", err)
+	}
+
+	if role.ReissueOnRenew {
+		return role.checkReissue()
+	}
+
+	return nil
+}
+
+// checkReissue returns an error if the role enables reissue_on_renew alongside a setting that cannot be enforced when
+// a key is reissued. Reissued keys are returned unwrapped in the renewal response, which is made by Vault on behalf
+// of the lease rather than by the requester, so neither the delivery of the key nor the requester can be checked.
+func (r *Role) checkReissue() error {
+	switch {
+	case r.WrapRequired:
+		return fmt.Errorf("provided reissue_on_renew cannot be used with wrap_required")
+	case r.RetrievalToken:
+		return fmt.Errorf("provided reissue_on_renew cannot be used with retrieval_token")
+	case r.RequireApproval:
+		return fmt.Errorf("provided reissue_on_renew cannot be used with require_approval")
+	case len(r.BoundEntityIDs) > 0 || len(r.BoundGroupIDs) > 0:
+		return fmt.Errorf("provided reissue_on_renew cannot be used with bound_entity_ids or bound_group_ids")
+	case r.Policy != "":
+		return fmt.Errorf("provided reissue_on_renew cannot be used with policy")
+	}
+
+	return nil
+}
+
+// checkReissueRequest returns an error if a key requested using a role that reissues keys on renewal asks for the key
+// to be encrypted or returned via a retrieval token, as keys reissued on renewal are returned as they are.
+func (r *Role) checkReissueRequest(data *framework.FieldData) error {
+	if !r.ReissueOnRenew {
+		return nil
+	}
+
+	if value, ok := data.GetOk("pgp_key"); ok && value.(string) != "" {
+		return fmt.Errorf("provided pgp_key cannot be used with role %q, which reissues keys on renewal", r.Name)
+	}
+
+	if value, ok := data.GetOk("retrieval_token"); ok && value.(bool) {
+		return fmt.Errorf("provided retrieval_token cannot be used with role %q, which reissues keys on renewal", r.Name)
+	}
+
+	return nil
+}
+
+// checkRoleName returns an error if the name of a role is reserved by another path under roles/, as the role would be
+// shadowed by it.
+func checkRoleName(name string) error {
+	if strutil.StrListContains(reservedRoleNames, name) {
+		return fmt.Errorf("provided role name %q is reserved", name)
+	}
+
+	return nil
+}
+
+// withRequestedConfig returns the role with the named configuration chosen by the request, which must be one of the
+// allowed configurations of the role. The role is returned unchanged if the request does not choose one.
+func (r *Role) withRequestedConfig(data *framework.FieldData) (*Role, error) {
+	value, ok := data.GetOk("config")
+	if !ok || value.(string) == "" {
+		return r, nil
+	}
+
+	name := value.(string)
+	if !strutil.StrListContains(r.AllowedConfigs, name) {
+		return nil, fmt.Errorf("configuration %q is not allowed by role %q", name, r.Name)
+	}
+
+	selected := *r
+	selected.Config = name
+
+	return &selected, nil
+}
+
+// checkAllowedTags returns an error if the role restricts the tags of its keys and any of the given tags does not match
+// one of its allowed tag patterns.
+func (r *Role) checkAllowedTags(tags []string) error {
+	if len(r.AllowedTags) == 0 {
+		return nil
+	}
+
+	for _, tag := range tags {
+		if !strutil.StrListContainsGlob(r.AllowedTags, tag) {
+			return fmt.Errorf("tag %q is not allowed by role %q", tag, r.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkRequestedTags returns an error if any of the tags provided in the request does not match one of the role's
+// allowed tag patterns, or is invalid. Tags are matched in their normalized form.
+func (r *Role) checkRequestedTags(tags []string) error {
+	normalized, err := normalizeTags(tags, false)
+	if err != nil {
+		return err
+	}
+
+	return r.checkAllowedTags(normalized)
+}
+
+// checkBoundIdentity returns an error if the role is bound to specific entities or groups and the requester is not one
+// of the bound entities or a member of any of the bound groups.
+func (b *Backend) checkBoundIdentity(request *logical.Request, role *Role) error {
+	if len(role.BoundEntityIDs) == 0 && len(role.BoundGroupIDs) == 0 {
+		return nil
+	}
+
+	if request.EntityID != "" && strutil.StrListContains(role.BoundEntityIDs, request.EntityID) {
+		return nil
+	}
+
+	groups, err := b.entityGroups(request)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if strutil.StrListContains(role.BoundGroupIDs, group.ID) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the requester is not bound to role %q", role.Name)
+}
+
+// description returns the description of a key generated using the role for the request. If the role has a
+// description template, it is rendered using the role name, request identifier, requester and current time. Otherwise,
+// the role's description is returned.
+func (b *Backend) description(request *logical.Request, role *Role) (string, error) {
+	if role.DescriptionTemplate == "" {
+		return role.Description, nil
+	}
+
+	data := descriptionData{
+		Role:        role.Name,
+		RequestID:   request.ID,
+		DisplayName: request.DisplayName,
+		Time:        time.Now().UTC(),
+	}
+
+	if request.EntityID != "" {
+		entity, err := b.System().EntityInfo(request.EntityID)
+		if err != nil {
+			return "", err
+		}
+
+		if entity != nil {
+			data.EntityName = entity.Name
+		}
+	}
+
+	return role.renderDescription(data)
+}
+
+func (r *Role) renderDescription(data descriptionData) (string, error) {
+	tmpl, err := template.New("description").Parse(r.DescriptionTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var description strings.Builder
+	if err = tmpl.Execute(&description, data); err != nil {
+		return "", err
+	}
+
+	return description.String(), nil
+}
+
+// filterResponse returns only the fields of a generated key that the role returns. All fields are returned if the role
+// does not restrict them.
+func (r *Role) filterResponse(data map[string]interface{}) map[string]interface{} {
+	if len(r.ResponseFields) == 0 {
+		return data
+	}
+
+	filtered := make(map[string]interface{}, len(r.ResponseFields))
+	for _, field := range r.ResponseFields {
+		if value, ok := data[field]; ok {
+			filtered[field] = value
+		}
+	}
+
+	return filtered
+}
+
+// checkWrapping returns an error if the role requires response wrapping and the request does not ask for its response
+// to be wrapped.
+func (r *Role) checkWrapping(request *logical.Request) error {
+	if !r.WrapRequired || (request.WrapInfo != nil && request.WrapInfo.TTL > 0) {
+		return nil
+	}
+
+	return fmt.Errorf("role %q requires the response to be wrapped, retry the request with a wrap ttl", r.Name)
+}
+
+// checkDeniedTags returns an error if any of the given tags matches one of the role's denied tag patterns.
+func (r *Role) checkDeniedTags(tags []string) error {
+	for _, tag := range tags {
+		if strutil.StrListContainsGlob(r.DeniedTags, tag) {
+			return fmt.Errorf("tag %q is denied by role %q", tag, r.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkIssuanceWindows returns an error if the role restricts when keys may be generated and the given time is not
+// within any of its issuance windows.
+func (r *Role) checkIssuanceWindows(now time.Time) error {
+	if len(r.AllowedIssuanceWindows) == 0 {
+		return nil
+	}
+
+	open, next, err := matchWindows(r.AllowedIssuanceWindows, now)
+	switch {
+	case err != nil:
+		return fmt.Errorf("issuance windows of role %q are invalid: %w", r.Name, err)
+	case open:
+		return nil
+	case next.IsZero():
+		return fmt.Errorf("keys cannot be generated using role %q outside of its issuance windows", r.Name)
+	}
+
+	return fmt.Errorf("keys cannot be generated using role %q outside of its issuance windows, the next window opens at %s",
+		r.Name, next.UTC().Format(time.RFC3339))
+}
+
+// matchWindows returns true if the given time is within any of the windows, which are cron expressions matching the
+// minutes they cover. Otherwise, it returns when the next window opens, or the zero time if none will.
+func matchWindows(windows []string, now time.Time) (bool, time.Time, error) {
+	// A time is within a window when it is the next activation of the schedule after the preceding minute.
+	minute := now.Truncate(time.Minute)
+
+	var next time.Time
+	for _, window := range windows {
+		schedule, err := cron.ParseStandard(window)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("window %q is invalid: %w", window, err)
+		}
+
+		if schedule.Next(minute.Add(-time.Second)).Equal(minute) {
+			return true, time.Time{}, nil
+		}
+
+		if opens := schedule.Next(now); !opens.IsZero() && (next.IsZero() || opens.Before(next)) {
+			next = opens
+		}
+	}
+
+	return false, next, nil
+}
+
+// capabilities returns the capabilities of a key generated using the role. Values provided in the request take
+// precedence over those of the role, unless the role locks them. Returns an error if the request provides a value that
+// differs from one locked by the role, or a tag that the role does not allow.
+func (r *Role) capabilities(data *framework.FieldData) (tailscale.KeyCapabilities, error) {
+	var capabilities tailscale.KeyCapabilities
+	capabilities.Devices.Create.Tags = r.Tags
+	capabilities.Devices.Create.Preauthorized = r.Preauthorized
+	capabilities.Devices.Create.Ephemeral = r.Ephemeral
+	capabilities.Devices.Create.Reusable = r.Reusable
+
+	if tags, ok := data.GetOk("tags"); ok {
+		if err := r.checkRequestedTags(tags.([]string)); err != nil {
+			return tailscale.KeyCapabilities{}, err
+		}
+
+		capabilities.Devices.Create.Tags = tags.([]string)
+	}
+	if preauthorized, ok := data.GetOk("preauthorized"); ok {
+		if r.LockPreauthorized && preauthorized.(bool) != r.Preauthorized {
+			return tailscale.KeyCapabilities{}, fmt.Errorf("preauthorized is locked to %t by role %q", r.Preauthorized, r.Name)
+		}
+
+		capabilities.Devices.Create.Preauthorized = preauthorized.(bool)
+	}
+	if ephemeral, ok := data.GetOk("ephemeral"); ok {
+		if r.LockEphemeral && ephemeral.(bool) != r.Ephemeral {
+			return tailscale.KeyCapabilities{}, fmt.Errorf("ephemeral is locked to %t by role %q", r.Ephemeral, r.Name)
+		}
+
+		capabilities.Devices.Create.Ephemeral = ephemeral.(bool)
+	}
+
+	return capabilities, nil
+}
+
+// expiry returns how long a key generated using the role is valid for. The expiry provided in the request takes
+// precedence over the default expiry of the role. A zero expiry leaves it to the Tailscale API, unless the role's
+// maximum expiry is shorter than the expiry given by the API, in which case the maximum is used. Returns an error if
+// the expiry is negative or exceeds the role's maximum expiry.
+func (r *Role) expiry(data *framework.FieldData) (time.Duration, error) {
+	expiry := r.DefaultExpiry
+	if value, ok := data.GetOk("expiry"); ok {
+		expiry = time.Duration(value.(int)) * time.Second
+	}
+
+	switch {
+	case expiry < 0:
+		return 0, fmt.Errorf("provided expiry cannot be negative")
+	case r.MaxExpiry <= 0:
+		return expiry, nil
+	case expiry == 0 && r.MaxExpiry < defaultKeyExpiry:
+		return r.MaxExpiry, nil
+	case expiry > r.MaxExpiry:
+		return 0, fmt.Errorf("requested expiry of %s exceeds the maximum expiry of %s allowed by role %q", expiry, r.MaxExpiry, r.Name)
+	}
+
+	return expiry, nil
+}
+
+func (b *Backend) saveRole(ctx context.Context, storage logical.Storage, role *Role) error {
+	entry, err := logical.StorageEntryJSON(rolePrefix+role.Name, role)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *Backend) role(ctx context.Context, storage logical.Storage, name string) (*Role, error) {
+	entry, err := storage.Get(ctx, rolePrefix+name)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var role Role
+	if err = entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func roleResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": {
+			Type:        framework.TypeString,
+			Description: roleNameDescription,
+		},
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: roleTagsDescription,
+		},
+		"ephemeral": {
+			Type:        framework.TypeBool,
+			Description: roleEphemeralDescription,
+		},
+		"preauthorized": {
+			Type:        framework.TypeBool,
+			Description: rolePreauthorizedDescription,
+		},
+		"policy": {
+			Type:        framework.TypeString,
+			Description: rolePolicyDescription,
+		},
+		"require_approval": {
+			Type:        framework.TypeBool,
+			Description: roleRequireApprovalDescription,
+		},
+		"allowed_issuance_windows": {
+			Type:        framework.TypeStringSlice,
+			Description: roleIssuanceWindowsDescription,
+		},
+		"retrieval_token": {
+			Type:        framework.TypeBool,
+			Description: roleRetrievalTokenDescription,
+		},
+		"reusable": {
+			Type:        framework.TypeBool,
+			Description: roleReusableDescription,
+		},
+		"allowed_tags": {
+			Type:        framework.TypeStringSlice,
+			Description: roleAllowedTagsDescription,
+		},
+		"denied_tags": {
+			Type:        framework.TypeStringSlice,
+			Description: roleDeniedTagsDescription,
+		},
+		"lock_preauthorized": {
+			Type:        framework.TypeBool,
+			Description: lockPreauthorizedDescription,
+		},
+		"lock_ephemeral": {
+			Type:        framework.TypeBool,
+			Description: lockEphemeralDescription,
+		},
+		"default_expiry": {
+			Type:        framework.TypeDurationSecond,
+			Description: roleDefaultExpiryDescription,
+		},
+		"max_expiry": {
+			Type:        framework.TypeDurationSecond,
+			Description: roleMaxExpiryDescription,
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: roleTTLDescription,
+		},
+		"max_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: roleMaxTTLDescription,
+		},
+		"description": {
+			Type:        framework.TypeString,
+			Description: roleDescriptionDescription,
+		},
+		"config": {
+			Type:        framework.TypeString,
+			Description: roleConfigDescription,
+		},
+		"allowed_configs": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: roleAllowedConfigsDescription,
+		},
+		"bound_entity_ids": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: roleBoundEntitiesDescription,
+		},
+		"bound_group_ids": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: roleBoundGroupsDescription,
+		},
+		"wrap_required": {
+			Type:        framework.TypeBool,
+			Description: roleWrapRequiredDescription,
+		},
+		"description_template": {
+			Type:        framework.TypeString,
+			Description: roleDescriptionTmplDescription,
+		},
+		"response_fields": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: roleResponseFieldsDescription,
+		},
+		"delete_devices": {
+			Type:        framework.TypeBool,
+			Description: roleDeleteDevicesDescription,
+		},
+		"reissue_on_renew": {
+			Type:        framework.TypeBool,
+			Description: roleReissueOnRenewDescription,
+		},
+	}
+}
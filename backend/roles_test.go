@@ -0,0 +1,989 @@
+package backend_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_Roles(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+
+	t.Run("It should create a role", func(t *testing.T) {
+		_, exists, err := b.HandleExistenceCheck(ctx, &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"tags":      []string{"tag:test"},
+				"ephemeral": true,
+				"reusable":  true,
+			},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("It should retain existing values when updating a role", func(t *testing.T) {
+		_, exists, err := b.HandleExistenceCheck(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"preauthorized": true,
+			},
+		})
+		require.NoError(t, err)
+
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		expected := map[string]interface{}{
+			"name":          "test",
+			"tags":          []string{"tag:test"},
+			"ephemeral":     true,
+			"preauthorized": true,
+			"reusable":      true,
+		}
+
+		for k, v := range expected {
+			assert.EqualValues(t, v, response.Data[k], k)
+		}
+	})
+
+	t.Run("It should patch a role", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.PatchOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+			Data:      map[string]interface{}{"allowed_tags": []string{"tag:*"}},
+		})
+		require.NoError(t, err)
+
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"tag:*"}, response.Data["allowed_tags"])
+		assert.EqualValues(t, []string{"tag:test"}, response.Data["tags"])
+		assert.EqualValues(t, true, response.Data["preauthorized"])
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.PatchOperation,
+			Path:      "roles/missing",
+			Storage:   storage,
+			Data:      map[string]interface{}{"ephemeral": true},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should list roles", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/prod",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+
+		for prefix, expected := range map[string]interface{}{
+			"":     []string{"prod", "test"},
+			"te":   []string{"test"},
+			"none": nil,
+		} {
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ListOperation,
+				Path:      "roles/",
+				Storage:   storage,
+				Data:      map[string]interface{}{"prefix": prefix},
+			})
+			require.NoError(t, err)
+			assert.EqualValues(t, expected, response.Data["keys"], prefix)
+		}
+	})
+
+	t.Run("It should delete a role", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+}
+
+func TestBackend_DefaultRole(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name          string
+		DefaultRole   string
+		Data          map[string]interface{}
+		ExpectedTags  []string
+		ExpectedEphem bool
+		ExpectedReuse bool
+		ExpectsError  bool
+	}{
+		{
+			Name:          "It should apply the default role's settings",
+			DefaultRole:   "ci",
+			ExpectedTags:  []string{"tag:ci", "tag:vault"},
+			ExpectedEphem: true,
+			ExpectedReuse: true,
+		},
+		{
+			Name:        "It should prefer values provided in the request",
+			DefaultRole: "ci",
+			Data: map[string]interface{}{
+				"tags": "tag:other",
+			},
+			ExpectedTags:  []string{"tag:other", "tag:vault"},
+			ExpectedEphem: true,
+			ExpectedReuse: true,
+		},
+		{
+			Name:         "It should return an error if the default role does not exist",
+			DefaultRole:  "missing",
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":      "example",
+					"api_key":      "example",
+					"api_url":      "http://localhost:1337",
+					"default_role": tc.DefaultRole,
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tags":      "tag:ci",
+					"ephemeral": true,
+					"reusable":  true,
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, api.Requests(), 1)
+
+			capabilities := api.Requests()[0].Capabilities.Devices.Create
+			assert.EqualValues(t, tc.ExpectedTags, capabilities.Tags)
+			assert.EqualValues(t, tc.ExpectedEphem, capabilities.Ephemeral)
+			assert.EqualValues(t, tc.ExpectedReuse, capabilities.Reusable)
+		})
+	}
+}
+
+func TestBackend_RoleCreds(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name             string
+		RequireRole      bool
+		Path             string
+		ExpectsError     bool
+		ExpectedRequests int
+	}{
+		{
+			Name:             "It should generate a key using a role",
+			Path:             "creds/ci",
+			ExpectedRequests: 1,
+		},
+		{
+			Name:         "It should return an error if the role does not exist",
+			Path:         "creds/missing",
+			ExpectsError: true,
+		},
+		{
+			Name:             "It should allow the key path if roles are not required",
+			Path:             "key",
+			ExpectedRequests: 1,
+		},
+		{
+			Name:         "It should disable the key path if roles are required",
+			Path:         "key",
+			RequireRole:  true,
+			ExpectsError: true,
+		},
+		{
+			Name:             "It should allow role creds if roles are required",
+			Path:             "creds/ci",
+			RequireRole:      true,
+			ExpectedRequests: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":      "example",
+					"api_key":      "example",
+					"api_url":      "http://localhost:1337",
+					"require_role": tc.RequireRole,
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tags": "tag:ci",
+				},
+			})
+			require.NoError(t, err)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      tc.Path,
+				Storage:   storage,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotEmpty(t, response.Data["key"])
+			assert.Len(t, api.Requests(), tc.ExpectedRequests)
+		})
+	}
+}
+
+func TestBackend_RoleIssuanceWindows(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name              string
+		Windows           []string
+		ExpectsWriteError bool
+		ExpectsError      bool
+	}{
+		{
+			Name:    "It should generate a key within an issuance window",
+			Windows: []string{"* * * * *"},
+		},
+		{
+			Name:         "It should return an error outside of the issuance windows",
+			Windows:      []string{"0 0 30 2 *"},
+			ExpectsError: true,
+		},
+		{
+			Name:    "It should generate a key if any issuance window matches",
+			Windows: []string{"0 0 30 2 *", "* * * * *"},
+		},
+		{
+			Name:              "It should return an error if an issuance window is invalid",
+			Windows:           []string{"not a window"},
+			ExpectsWriteError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			putConfig(t, ctx, storage)
+			api := mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"allowed_issuance_windows": tc.Windows,
+				},
+			})
+			if tc.ExpectsWriteError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "creds/ci",
+				Storage:   storage,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, api.Requests(), 1)
+		})
+	}
+}
+
+func TestBackend_RoleAllowedTags(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name              string
+		Path              string
+		RoleTags          []string
+		Tags              []string
+		ExpectsWriteError bool
+		ExpectsError      bool
+	}{
+		{
+			Name: "It should generate a key with tags matching the allowed tags",
+			Tags: []string{"tag:ci-linux", "tag:ci-windows"},
+		},
+		{
+			Name:         "It should return an error if a tag does not match the allowed tags",
+			Tags:         []string{"tag:ci-linux", "tag:prod"},
+			ExpectsError: true,
+		},
+		{
+			Name:     "It should generate a key with the role's tags",
+			RoleTags: []string{"tag:ci-default"},
+		},
+		{
+			Name:              "It should return an error if the role's tags do not match its allowed tags",
+			RoleTags:          []string{"tag:prod"},
+			ExpectsWriteError: true,
+		},
+		{
+			Name: "It should generate a key with requested tags matching the allowed tags using the role",
+			Path: "creds/ci",
+			Tags: []string{"tag:ci-linux"},
+		},
+		{
+			Name:         "It should return an error if a tag requested using the role does not match the allowed tags",
+			Path:         "creds/ci",
+			Tags:         []string{"tag:prod"},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should generate a batch of keys with requested tags matching the allowed tags",
+			Path: "creds/ci/batch",
+			Tags: []string{"tag:ci-linux"},
+		},
+		{
+			Name:         "It should return an error if a tag requested for a batch does not match the allowed tags",
+			Path:         "creds/ci/batch",
+			Tags:         []string{"tag:prod"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":      "example",
+					"api_key":      "example",
+					"api_url":      "http://localhost:1337",
+					"default_role": "ci",
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tags":         tc.RoleTags,
+					"allowed_tags": []string{"tag:ci-*"},
+				},
+			})
+			if tc.ExpectsWriteError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			data := map[string]interface{}{}
+			if tc.Tags != nil {
+				data["tags"] = tc.Tags
+			}
+
+			path := "key"
+			var operation logical.Operation = logical.ReadOperation
+			switch {
+			case strings.HasSuffix(tc.Path, "/batch"):
+				path, operation = tc.Path, logical.UpdateOperation
+				data["hostnames"] = "ci-1"
+			case tc.Path != "":
+				path = tc.Path
+			}
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: operation,
+				Path:      path,
+				Storage:   storage,
+				Data:      data,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, api.Requests(), 1)
+			for _, tag := range tc.Tags {
+				assert.Contains(t, api.Requests()[0].Capabilities.Devices.Create.Tags, tag)
+			}
+		})
+	}
+}
+
+func TestBackend_RoleDeniedTags(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name              string
+		RoleTags          []string
+		Tags              []string
+		ExpectsWriteError bool
+		ExpectsError      bool
+	}{
+		{
+			Name: "It should generate a key with tags that are not denied",
+			Tags: []string{"tag:server"},
+		},
+		{
+			Name:         "It should return an error if a tag is denied even if allowed",
+			Tags:         []string{"tag:server", "tag:exit-node"},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if a tag matches a denied pattern",
+			Tags:         []string{"tag:admin-eu"},
+			ExpectsError: true,
+		},
+		{
+			Name:              "It should return an error if the role's tags are denied",
+			RoleTags:          []string{"tag:exit-node"},
+			ExpectsWriteError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":      "example",
+					"api_key":      "example",
+					"api_url":      "http://localhost:1337",
+					"default_role": "ci",
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tags":         tc.RoleTags,
+					"allowed_tags": []string{"tag:*"},
+					"denied_tags":  []string{"tag:exit-node", "tag:admin*"},
+				},
+			})
+			if tc.ExpectsWriteError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data:      map[string]interface{}{"tags": tc.Tags},
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, api.Requests(), 1)
+		})
+	}
+}
+
+func TestBackend_RoleLockedFlags(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		Data         map[string]interface{}
+		ExpectsError bool
+	}{
+		{
+			Name: "It should apply the locked values of the role",
+		},
+		{
+			Name: "It should allow requests matching the locked values",
+			Data: map[string]interface{}{"ephemeral": true, "preauthorized": false},
+		},
+		{
+			Name:         "It should return an error if the request overrides a locked preauthorized value",
+			Data:         map[string]interface{}{"preauthorized": true},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if the request overrides a locked ephemeral value",
+			Data:         map[string]interface{}{"ephemeral": false},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":      "example",
+					"api_key":      "example",
+					"api_url":      "http://localhost:1337",
+					"default_role": "ci",
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tags":               "tag:ci",
+					"ephemeral":          true,
+					"preauthorized":      false,
+					"lock_ephemeral":     true,
+					"lock_preauthorized": true,
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, api.Requests(), 1)
+
+			capabilities := api.Requests()[0].Capabilities.Devices.Create
+			assert.True(t, capabilities.Ephemeral)
+			assert.False(t, capabilities.Preauthorized)
+		})
+	}
+}
+
+func TestBackend_RoleExpiry(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name           string
+		Role           map[string]interface{}
+		Data           map[string]interface{}
+		ExpectedExpiry int64
+		ExpectsError   bool
+	}{
+		{
+			Name:           "It should apply the default expiry of the role",
+			Role:           map[string]interface{}{"default_expiry": "1h", "max_expiry": "24h"},
+			ExpectedExpiry: 3600,
+		},
+		{
+			Name:           "It should apply the requested expiry within the maximum expiry",
+			Role:           map[string]interface{}{"default_expiry": "1h", "max_expiry": "24h"},
+			Data:           map[string]interface{}{"expiry": "12h"},
+			ExpectedExpiry: 43200,
+		},
+		{
+			Name:           "It should apply the maximum expiry if shorter than the expiry given by the API",
+			Role:           map[string]interface{}{"max_expiry": "24h"},
+			ExpectedExpiry: 86400,
+		},
+		{
+			Name: "It should leave the expiry to the API if the role does not set one",
+			Role: map[string]interface{}{},
+		},
+		{
+			Name:         "It should return an error if the requested expiry exceeds the maximum expiry",
+			Role:         map[string]interface{}{"max_expiry": "24h"},
+			Data:         map[string]interface{}{"expiry": "48h"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+			putConfig(t, ctx, storage)
+
+			tc.Role["tags"] = "tag:ci"
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data:      tc.Role,
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "creds/ci",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, api.Requests(), 1)
+			assert.EqualValues(t, tc.ExpectedExpiry, api.Requests()[0].ExpirySeconds)
+		})
+	}
+
+	t.Run("It should return an error if the default expiry exceeds the maximum expiry", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/ci",
+			Storage:   &logical.InmemStorage{},
+			Data:      map[string]interface{}{"default_expiry": "48h", "max_expiry": "24h"},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestBackend_RoleBoundIdentity(t *testing.T) {
+	ctx := context.Background()
+
+	config := logical.TestBackendConfig()
+	config.System.(*logical.StaticSystemView).GroupsVal = []*logical.Group{
+		{ID: "group-1", Name: "sre"},
+	}
+
+	b, err := backend.Create(ctx, config)
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name         string
+		Role         map[string]interface{}
+		EntityID     string
+		ExpectsError bool
+	}{
+		{
+			Name:     "It should allow bound entities",
+			Role:     map[string]interface{}{"bound_entity_ids": "entity-1"},
+			EntityID: "entity-1",
+		},
+		{
+			Name:     "It should allow members of bound groups",
+			Role:     map[string]interface{}{"bound_entity_ids": "entity-1", "bound_group_ids": "group-1"},
+			EntityID: "entity-2",
+		},
+		{
+			Name:         "It should return an error if the requester is not bound to the role",
+			Role:         map[string]interface{}{"bound_entity_ids": "entity-1", "bound_group_ids": "group-2"},
+			EntityID:     "entity-2",
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if the request has no entity",
+			Role:         map[string]interface{}{"bound_entity_ids": "entity-1"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+			putConfig(t, ctx, storage)
+
+			tc.Role["tags"] = "tag:ci"
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data:      tc.Role,
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "creds/ci",
+				Storage:   storage,
+				EntityID:  tc.EntityID,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, api.Requests(), 1)
+		})
+	}
+}
+
+func TestBackend_RoleWrapRequired(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		WrapInfo     *logical.RequestWrapInfo
+		ExpectsError bool
+	}{
+		{
+			Name:     "It should generate keys if the response is wrapped",
+			WrapInfo: &logical.RequestWrapInfo{TTL: time.Minute},
+		},
+		{
+			Name:         "It should return an error if the response is not wrapped",
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+			putConfig(t, ctx, storage)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/ci",
+				Storage:   storage,
+				Data:      map[string]interface{}{"tags": "tag:ci", "wrap_required": true},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "creds/ci",
+				Storage:   storage,
+				WrapInfo:  tc.WrapInfo,
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, api.Requests(), 1)
+		})
+	}
+}
+
+func TestBackend_RoleDescriptionTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	config := logical.TestBackendConfig()
+	config.System.(*logical.StaticSystemView).EntityVal = &logical.Entity{ID: "entity", Name: "alice"}
+
+	b, err := backend.Create(ctx, config)
+	require.NoError(t, err)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+	putConfig(t, ctx, storage)
+
+	t.Run("It should render the description of keys generated using the role", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/ci",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"tags":                 "tag:ci",
+				"description":          "ignored",
+				"description_template": "{{.Role}} {{.RequestID}} {{.EntityName}}",
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			ID:        "request-1",
+			EntityID:  "entity",
+			Operation: logical.ReadOperation,
+			Path:      "creds/ci",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		require.Len(t, api.Requests(), 1)
+		assert.EqualValues(t, "ci request-1 alice", withoutNonce(api.Requests()[0].Description))
+	})
+
+	t.Run("It should return an error if the template is invalid", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/ci",
+			Storage:   storage,
+			Data:      map[string]interface{}{"description_template": "{{.Unknown}}"},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestBackend_RoleResponseFields(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	mockKeysAPI(t)
+	putConfig(t, ctx, storage)
+
+	t.Run("It should only return the fields allowed by the role", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/ci",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": "tag:ci", "response_fields": "key,expires"},
+		})
+		require.NoError(t, err)
+
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/ci",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, response)
+
+		assert.Len(t, response.Data, 2)
+		assert.Contains(t, response.Data, "key")
+		assert.Contains(t, response.Data, "expires")
+	})
+
+	t.Run("It should return all fields if the role does not restrict them", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/ci",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": "tag:ci", "response_fields": ""},
+		})
+		require.NoError(t, err)
+
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/ci",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, response)
+
+		assert.Contains(t, response.Data, "id")
+		assert.Contains(t, response.Data, "tags")
+	})
+
+	t.Run("It should return an error for unknown fields", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/ci",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": "tag:ci", "response_fields": "key,secret"},
+		})
+		assert.Error(t, err)
+	})
+}
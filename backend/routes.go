@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+// parseRoutes parses a list of routes in CIDR notation, returning an error if any are invalid.
+func parseRoutes(routes []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(routes))
+	for _, route := range routes {
+		prefix, err := netip.ParsePrefix(route)
+		if err != nil {
+			return nil, fmt.Errorf("route %q is invalid: %w", route, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// routeAllowed returns true if the route falls entirely inside any of the allowed prefixes.
+func routeAllowed(route string, allowed []netip.Prefix) bool {
+	prefix, err := netip.ParsePrefix(route)
+	if err != nil {
+		return false
+	}
+
+	prefix = prefix.Masked()
+	for _, allow := range allowed {
+		if allow.Bits() <= prefix.Bits() && allow.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// approveRoutes enables the routes advertised by a device that fall entirely inside the allowed prefixes. Routes that
+// are already enabled remain enabled. Returns the routes that are enabled once complete, along with the advertised
+// routes that were approved and rejected.
+func approveRoutes(ctx context.Context, client *tailscale.Client, deviceID string, allowed []netip.Prefix) (enabled, approved, rejected []string, err error) {
+	routes, err := client.DeviceSubnetRoutes(ctx, deviceID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read routes of device %q: %w", deviceID, err)
+	}
+
+	enabled = append([]string{}, routes.Enabled...)
+	approved = []string{}
+	rejected = []string{}
+	for _, route := range routes.Advertised {
+		switch {
+		case strutil.StrListContains(routes.Enabled, route):
+			continue
+		case routeAllowed(route, allowed):
+			approved = append(approved, route)
+			enabled = append(enabled, route)
+		default:
+			rejected = append(rejected, route)
+		}
+	}
+
+	if len(approved) == 0 {
+		return enabled, approved, rejected, nil
+	}
+
+	if err = client.SetDeviceSubnetRoutes(ctx, deviceID, enabled); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to enable routes of device %q: %w", deviceID, err)
+	}
+
+	return enabled, approved, rejected, nil
+}
+
+// findDevice returns the device with the given identifier.
+func findDevice(devices []tailscale.Device, id string) (tailscale.Device, bool) {
+	for _, device := range devices {
+		if device.ID == id {
+			return device, true
+		}
+	}
+
+	return tailscale.Device{}, false
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// okResponse returns the documented responses of an operation that returns the given fields.
+func okResponse(description string, fields map[string]*framework.FieldSchema) map[int][]framework.Response {
+	return map[int][]framework.Response{
+		http.StatusOK: {{
+			Description: description,
+			Fields:      fields,
+		}},
+	}
+}
+
+// noContentResponse returns the documented responses of an operation that returns no data.
+func noContentResponse() map[int][]framework.Response {
+	return map[int][]framework.Response{
+		http.StatusNoContent: {{
+			Description: http.StatusText(http.StatusNoContent),
+		}},
+	}
+}
+
+// listResponse returns the documented responses of a list operation. Each listed identifier may be described by an
+// entry in key_info.
+func listResponse(description string) map[int][]framework.Response {
+	return okResponse(description, map[string]*framework.FieldSchema{
+		"keys": {
+			Type:        framework.TypeStringSlice,
+			Description: "The listed identifiers",
+		},
+		"key_info": {
+			Type:        framework.TypeMap,
+			Description: "Details of each listed identifier",
+		},
+	})
+}
+
+// keyResponseFields returns the schema of the fields returned when a key is generated. If the key is only returned
+// via a retrieval token, the key itself is replaced by the token.
+func keyResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: keyIDDescription,
+		},
+		"key": {
+			Type:        framework.TypeString,
+			Description: "The authentication key, encrypted to the PGP key if one was provided",
+		},
+		"expires": {
+			Type:        framework.TypeTime,
+			Description: "When the key expires",
+		},
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: "The tags applied to devices added using the key",
+		},
+		"reusable": {
+			Type:        framework.TypeBool,
+			Description: "Whether the key can be used more than once",
+		},
+		"ephemeral": {
+			Type:        framework.TypeBool,
+			Description: ephemeralDescription,
+		},
+		"preauthorized": {
+			Type:        framework.TypeBool,
+			Description: preauthorizedDescription,
+		},
+		"metadata": {
+			Type:        framework.TypeKVPairs,
+			Description: metadataDescription,
+		},
+		"labels": {
+			Type:        framework.TypeKVPairs,
+			Description: labelsDescription,
+		},
+		"pgp_fingerprint": {
+			Type:        framework.TypeString,
+			Description: "The fingerprint of the PGP key the key is encrypted to",
+		},
+		"retrieval_token": {
+			Type:        framework.TypeString,
+			Description: "The single-use token used to retrieve the key, returned instead of the key",
+		},
+		"retrieval_expires": {
+			Type:        framework.TypeTime,
+			Description: "When the retrieval token expires",
+		},
+		"key_accessor": {
+			Type:        framework.TypeString,
+			Description: "An opaque accessor that the key can be looked up and revoked using, without its identifier",
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/testhelpers/schema"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_ResponseSchemas(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	t.Run("It should document every path and operation", func(t *testing.T) {
+		for _, path := range b.Paths {
+			assert.NotEmpty(t, path.HelpSynopsis, path.Pattern)
+			assert.NotEmpty(t, path.HelpDescription, path.Pattern)
+
+			for operation, handler := range path.Operations {
+				assert.NotEmpty(t, handler.Properties().Responses, "%s %s", operation, path.Pattern)
+			}
+		}
+	})
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/ci",
+		Storage:   storage,
+		Data:      map[string]interface{}{"tags": []string{"tag:ci"}},
+	})
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name      string
+		Operation logical.Operation
+		Path      string
+		Data      map[string]interface{}
+	}{
+		{
+			Name:      "It should describe a generated key",
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Data: map[string]interface{}{
+				"tags":     []string{"tag:server"},
+				"metadata": map[string]string{"ticket": "OPS-1"},
+			},
+		},
+		{
+			Name:      "It should describe a key generated using a role",
+			Operation: logical.ReadOperation,
+			Path:      "creds/ci",
+		},
+		{
+			Name:      "It should describe the configuration",
+			Operation: logical.ReadOperation,
+			Path:      "config",
+		},
+		{
+			Name:      "It should describe a role",
+			Operation: logical.ReadOperation,
+			Path:      "roles/ci",
+		},
+		{
+			Name:      "It should describe the usage of an issued key",
+			Operation: logical.ReadOperation,
+			Path:      "keys/key-1/usage",
+		},
+		{
+			Name:      "It should describe the keys in the tailnet",
+			Operation: logical.ListOperation,
+			Path:      "keys/",
+		},
+		{
+			Name:      "It should describe the issued keys",
+			Operation: logical.ListOperation,
+			Path:      "issued-keys/",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: tc.Operation,
+				Path:      tc.Path,
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+			require.NoError(t, err)
+			require.NotNil(t, response)
+
+			route := b.Route(tc.Path)
+			require.NotNil(t, route)
+
+			schema.ValidateResponse(t, schema.GetResponseSchema(t, route, tc.Operation), response, true)
+		})
+	}
+}
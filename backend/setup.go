@@ -0,0 +1,184 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	setupDescription         = "Validate credentials, store the configuration and optionally create a starter role in a single call"
+	setupRoleNameDescription = "The name of a starter role to create. No role is created if omitted"
+	setupRoleTagsDescription = "The tags of the starter role"
+
+	setupHelpSynopsis    = "Configure the mount and optionally create a starter role in a single call."
+	setupHelpDescription = `
+Validates the provided credentials against the Tailscale API before storing the
+configuration, so that a mount is never left with credentials that do not work. Warnings
+are returned for tags that are not defined in the tagOwners of the tailnet policy. If a
+role name is given and the role does not exist, a starter role is created.
+`
+)
+
+func (b *Backend) setupPaths() []*framework.Path {
+	fields := configFields()
+	fields["role_name"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: setupRoleNameDescription,
+	}
+	fields["role_tags"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: setupRoleTagsDescription,
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: "setup$",
+			Fields:  fields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.RunSetup,
+					Responses: okResponse(setupDescription, setupResponseFields()),
+					Summary:   setupDescription,
+				},
+			},
+			HelpSynopsis:    setupHelpSynopsis,
+			HelpDescription: setupHelpDescription,
+		},
+	}
+}
+
+// RunSetup performs the first-run configuration of the Backend. It validates the provided credentials against the
+// Tailscale API, checks that the issuer tag and the tags of the starter role are defined in the tagOwners of the
+// tailnet policy, stores the configuration and creates the starter role if one is named. Nothing is stored if the
+// credentials are invalid. Undefined tags are reported as warnings rather than added to the tailnet policy, as
+// rewriting the policy would discard its comments and formatting. An existing role with the same name is left
+// unchanged. Returns a summary of what was configured.
+func (b *Backend) RunSetup(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := parseConfig(data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkRoleName(data.Get("role_name").(string)); err != nil {
+		return nil, err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate credentials: %w", err)
+	}
+
+	roleName := data.Get("role_name").(string)
+	roleTags := data.Get("role_tags").([]string)
+
+	var tags []string
+	if config.IssuerTag != "" {
+		tags = append(tags, config.IssuerTag)
+	}
+	if roleName != "" {
+		tags = mergeTags(tags, roleTags...)
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"tailnet":    config.Tailnet,
+			"api_url":    config.APIUrl,
+			"auth":       authAPIKey,
+			"devices":    len(devices),
+			"issuer_tag": config.IssuerTag,
+		},
+	}
+
+	if config.OAuthClientID != "" {
+		response.Data["auth"] = authOAuth
+	}
+
+	if len(tags) > 0 {
+		acl, err := client.ACL(ctx)
+		if err != nil {
+			response.AddWarning(fmt.Sprintf("unable to read the tailnet policy to check tag ownership: %v", err))
+		} else {
+			defined := make(map[string]bool, len(tags))
+			for _, tag := range tags {
+				_, defined[tag] = acl.TagOwners[tag]
+				if !defined[tag] {
+					response.AddWarning(fmt.Sprintf("tag %q is not defined in the tagOwners of the tailnet policy, "+
+						"keys cannot be generated with it until it is added", tag))
+				}
+			}
+
+			response.Data["tags_defined"] = defined
+		}
+	}
+
+	if err = b.saveConfig(ctx, request.Storage, config); err != nil {
+		return nil, err
+	}
+
+	if roleName == "" {
+		return response, nil
+	}
+
+	role, err := b.role(ctx, request.Storage, roleName)
+	switch {
+	case err != nil:
+		return nil, err
+	case role != nil:
+		response.AddWarning(fmt.Sprintf("role %q already exists and was not modified", roleName))
+		response.Data["role_created"] = false
+	default:
+		if err = b.saveRole(ctx, request.Storage, &Role{Name: roleName, Tags: roleTags}); err != nil {
+			return nil, err
+		}
+
+		response.Data["role_created"] = true
+	}
+
+	response.Data["role"] = roleName
+	return response, nil
+}
+
+func setupResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"tailnet": {
+			Type:        framework.TypeString,
+			Description: tailnetDescription,
+		},
+		"api_url": {
+			Type:        framework.TypeString,
+			Description: apiUrlDescription,
+		},
+		"auth": {
+			Type:        framework.TypeString,
+			Description: "How the mount authenticates with the API, either api_key or oauth",
+		},
+		"devices": {
+			Type:        framework.TypeInt,
+			Description: "The number of devices in the tailnet",
+		},
+		"issuer_tag": {
+			Type:        framework.TypeString,
+			Description: issuerTagDescription,
+		},
+		"tags_defined": {
+			Type:        framework.TypeMap,
+			Description: "Whether each tag of the issuer and starter role is defined in the tagOwners of the tailnet policy",
+		},
+		"role": {
+			Type:        framework.TypeString,
+			Description: setupRoleNameDescription,
+		},
+		"role_created": {
+			Type:        framework.TypeBool,
+			Description: "Whether the starter role was created, false if it already existed",
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestBackend_Setup(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	data := map[string]interface{}{
+		"tailnet":   "example",
+		"api_key":   "example",
+		"api_url":   "http://localhost:1337",
+		"role_name": "ci",
+		"role_tags": "tag:ci",
+	}
+
+	api.SetDevices(tailscale.Device{ID: "device-1"})
+	api.SetTagOwners(map[string][]string{
+		"tag:vault": {"autogroup:admin"},
+	})
+
+	t.Run("It should not store the configuration if the credentials are invalid", func(t *testing.T) {
+		api.SetFailing(true)
+		defer api.SetFailing(false)
+
+		_, err := request(logical.UpdateOperation, "setup", data)
+		assert.Error(t, err)
+
+		_, err = request(logical.ReadOperation, "config", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should return an error if the starter role name is reserved", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "setup", map[string]interface{}{
+			"tailnet":   "example",
+			"api_key":   "example",
+			"api_url":   "http://localhost:1337",
+			"role_name": "export",
+		})
+		assert.Error(t, err)
+
+		_, err = request(logical.ReadOperation, "config", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should store the configuration and create the starter role", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "setup", data)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, response.Data["devices"])
+		assert.EqualValues(t, "api_key", response.Data["auth"])
+		assert.EqualValues(t, true, response.Data["role_created"])
+		assert.EqualValues(t, map[string]bool{"tag:vault": true, "tag:ci": false}, response.Data["tags_defined"])
+		assert.Len(t, response.Warnings, 1)
+
+		config, err := request(logical.ReadOperation, "config", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "example", config.Data["tailnet"])
+
+		role, err := request(logical.ReadOperation, "roles/ci", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"tag:ci"}, role.Data["tags"])
+	})
+
+	t.Run("It should not modify an existing role", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "setup", map[string]interface{}{
+			"tailnet":   "example",
+			"api_key":   "example",
+			"api_url":   "http://localhost:1337",
+			"role_name": "ci",
+			"role_tags": "tag:other",
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, false, response.Data["role_created"])
+
+		role, err := request(logical.ReadOperation, "roles/ci", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"tag:ci"}, role.Data["tags"])
+	})
+}
@@ -0,0 +1,442 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The SinkConfig type describes an external collector, such as a SIEM, to which issuance and revocation records
+	// are streamed as they happen.
+	SinkConfig struct {
+		Type       string        `json:"type"`
+		Address    string        `json:"address"`
+		CACert     string        `json:"ca_cert"`
+		ClientCert string        `json:"client_cert"`
+		ClientKey  string        `json:"client_key"`
+		Timeout    time.Duration `json:"timeout"`
+	}
+
+	// The sinkClient type holds the HTTP client used to post records to an HTTPS sink, along with the configuration it
+	// was created for, so that connections to the collector are reused until the configuration changes.
+	sinkClient struct {
+		config SinkConfig
+		http   *http.Client
+	}
+)
+
+const (
+	sinkConfigPath     = "config/sink"
+	sinkTypeSyslog     = "syslog"
+	sinkTypeHTTPS      = "https"
+	defaultSinkTimeout = 5 * time.Second
+	sinkAppName        = "vault-plugin-tailscale"
+
+	// maxPendingSinkRecords is the most records that are sent to the sink at once. Further records are dropped rather
+	// than queued, so that an unresponsive sink cannot delay operations or cause unbounded growth in memory.
+	maxPendingSinkRecords = 64
+
+	// The syslog priorities of records, using the local0 facility with the informational and warning severities.
+	syslogPriorityInfo    = 16*8 + 6
+	syslogPriorityWarning = 16*8 + 4
+
+	readSinkDescription       = "Read the configuration of the sink that issuance and revocation records are streamed to"
+	updateSinkDescription     = "Update the configuration of the sink that issuance and revocation records are streamed to"
+	deleteSinkDescription     = "Delete the sink configuration, disabling streaming of records"
+	sinkTypeDescription       = "The type of the sink, either syslog or https"
+	sinkAddressDescription    = "For syslog, the address of the server as udp://, tcp:// or tls:// followed by host:port. For https, the URL of the collector"
+	sinkCACertDescription     = "PEM encoded CA certificate used to verify the sink. Defaults to the system roots"
+	sinkClientCertDescription = "PEM encoded client certificate presented to the sink for mutual TLS"
+	sinkClientKeyDescription  = "PEM encoded private key of the client certificate"
+	sinkTimeoutDescription    = "How long to wait when sending a record to the sink"
+
+	sinkHelpSynopsis    = "Configure the sink that issuance and revocation records are streamed to."
+	sinkHelpDescription = `
+Records of key issuance and revocation attempts are streamed to a syslog server or an
+HTTPS collector, such as a SIEM, as they happen. Client certificates may be used for
+mutual TLS. The client key is not returned when the configuration is read.
+`
+)
+
+func (b *Backend) sinkPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: sinkConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"type": {
+					Type:          framework.TypeString,
+					Description:   sinkTypeDescription,
+					AllowedValues: []interface{}{sinkTypeSyslog, sinkTypeHTTPS},
+				},
+				"address": {
+					Type:        framework.TypeString,
+					Description: sinkAddressDescription,
+				},
+				"ca_cert": {
+					Type:        framework.TypeString,
+					Description: sinkCACertDescription,
+				},
+				"client_cert": {
+					Type:        framework.TypeString,
+					Description: sinkClientCertDescription,
+				},
+				"client_key": {
+					Type:        framework.TypeString,
+					Description: sinkClientKeyDescription,
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+				"timeout": {
+					Type:        framework.TypeDurationSecond,
+					Description: sinkTimeoutDescription,
+					Default:     int(defaultSinkTimeout.Seconds()),
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadSinkConfiguration,
+					Responses: okResponse(readSinkDescription, sinkResponseFields()),
+					Summary:   readSinkDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateSinkConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateSinkDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteSinkConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteSinkDescription,
+				},
+			},
+			HelpSynopsis:    sinkHelpSynopsis,
+			HelpDescription: sinkHelpDescription,
+		},
+	}
+}
+
+// ReadSinkConfiguration returns the sink configuration. The client key is never returned.
+func (b *Backend) ReadSinkConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.sinkConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"type":        config.Type,
+			"address":     config.Address,
+			"ca_cert":     config.CACert,
+			"client_cert": config.ClientCert,
+			"timeout":     int64(config.Timeout.Seconds()),
+		},
+	}, nil
+}
+
+// UpdateSinkConfiguration modifies the sink configuration. Returns an error if the address does not suit the type of
+// sink or the certificates cannot be parsed.
+func (b *Backend) UpdateSinkConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := SinkConfig{
+		Type:       data.Get("type").(string),
+		Address:    data.Get("address").(string),
+		CACert:     data.Get("ca_cert").(string),
+		ClientCert: data.Get("client_cert").(string),
+		ClientKey:  data.Get("client_key").(string),
+		Timeout:    time.Duration(data.Get("timeout").(int)) * time.Second,
+	}
+
+	u, err := url.Parse(config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("provided address is invalid: %w", err)
+	}
+
+	switch {
+	case config.Type != sinkTypeSyslog && config.Type != sinkTypeHTTPS:
+		return nil, fmt.Errorf("provided type must be %q or %q", sinkTypeSyslog, sinkTypeHTTPS)
+	case config.Type == sinkTypeSyslog && u.Scheme != "udp" && u.Scheme != "tcp" && u.Scheme != "tls":
+		return nil, errors.New("provided address must use udp, tcp or tls for a syslog sink")
+	case config.Type == sinkTypeHTTPS && u.Scheme != "https":
+		return nil, errors.New("provided address must use https for an https sink")
+	case u.Host == "":
+		return nil, errors.New("provided address must include a host")
+	case (config.ClientCert == "") != (config.ClientKey == ""):
+		return nil, errors.New("provided client_cert and client_key must be set together")
+	case config.Timeout <= 0:
+		return nil, errors.New("provided timeout must be greater than zero")
+	}
+
+	if _, err = config.tlsConfig(); err != nil {
+		return nil, err
+	}
+
+	entry, err := logical.StorageEntryJSON(sinkConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteSinkConfiguration removes the sink configuration, disabling streaming of records.
+func (b *Backend) DeleteSinkConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, sinkConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// exportActivity sends a record of an issuance or revocation attempt to the sink, if one is configured. Exports are
+// best-effort and sent in the background, failures to send them are logged and otherwise ignored.
+func (b *Backend) exportActivity(ctx context.Context, storage logical.Storage, activity Activity) {
+	config, err := b.sinkConfig(ctx, storage)
+	switch {
+	case err != nil:
+		b.Logger().Warn("failed to export record to sink", "type", activity.Type, "error", err)
+		return
+	case config == nil:
+		return
+	}
+
+	select {
+	case b.sinkRecords <- struct{}{}:
+	default:
+		b.Logger().Warn("dropping record as too many are being exported", "type", activity.Type)
+		return
+	}
+
+	go func() {
+		defer func() { <-b.sinkRecords }()
+
+		if err := b.sendToSink(config, activity); err != nil {
+			b.Logger().Warn("failed to export record to sink", "type", activity.Type, "error", err)
+		}
+	}()
+}
+
+func (b *Backend) sendToSink(config *SinkConfig, activity Activity) error {
+	record, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	// The export outlives the request that caused it, so is bounded only by the configured timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	if config.Type == sinkTypeHTTPS {
+		client, err := b.sinkHTTPClient(config)
+		if err != nil {
+			return err
+		}
+
+		return config.sendHTTPS(ctx, client, record)
+	}
+
+	priority := syslogPriorityInfo
+	if activity.Outcome == activityOutcomeFailure {
+		priority = syslogPriorityWarning
+	}
+
+	return config.sendSyslog(ctx, syslogMessage(priority, activity.Timestamp, activity.Type, record))
+}
+
+// sinkHTTPClient returns the HTTP client used to post records to an HTTPS sink. The client is reused for as long as
+// the sink configuration is unchanged, and replaced when it is modified, including by another node of the Vault
+// cluster.
+func (b *Backend) sinkHTTPClient(config *SinkConfig) (*http.Client, error) {
+	b.sinkMu.Lock()
+	defer b.sinkMu.Unlock()
+
+	if b.sink != nil && b.sink.config == *config {
+		return b.sink.http, nil
+	}
+
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if b.sink != nil {
+		b.sink.http.CloseIdleConnections()
+	}
+
+	b.sink = &sinkClient{
+		config: *config,
+		http: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+
+	return b.sink.http, nil
+}
+
+// sendHTTPS posts a record to the collector as JSON.
+func (c *SinkConfig) sendHTTPS(ctx context.Context, client *http.Client, record []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Address, bytes.NewReader(record))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// sendSyslog writes a message to the syslog server. Messages sent over TCP or TLS use octet-counting framing.
+func (c *SinkConfig) sendSyslog(ctx context.Context, message []byte) error {
+	u, err := url.Parse(c.Address)
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "tls":
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return err
+		}
+
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+	default:
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, u.Scheme, u.Host)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if u.Scheme != "udp" {
+		message = append([]byte(fmt.Sprintf("%d ", len(message))), message...)
+	}
+
+	_, err = conn.Write(message)
+	return err
+}
+
+// tlsConfig returns the TLS configuration used to connect to the sink, trusting the configured CA certificate and
+// presenting the configured client certificate, if any.
+func (c *SinkConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("provided ca_cert contains no valid certificates")
+		}
+
+		config.RootCAs = pool
+	}
+
+	if c.ClientCert != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("provided client_cert and client_key are invalid: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// syslogMessage formats a record as an RFC 5424 syslog message, using the record type as the message identifier.
+func syslogMessage(priority int, timestamp time.Time, msgID string, record []byte) []byte {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ", priority, timestamp.UTC().Format(time.RFC3339Nano), hostname,
+		sinkAppName, os.Getpid(), msgID)
+
+	return append([]byte(header), record...)
+}
+
+func (b *Backend) sinkConfig(ctx context.Context, storage logical.Storage) (*SinkConfig, error) {
+	entry, err := storage.Get(ctx, sinkConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config SinkConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func sinkResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"type": {
+			Type:        framework.TypeString,
+			Description: sinkTypeDescription,
+		},
+		"address": {
+			Type:        framework.TypeString,
+			Description: sinkAddressDescription,
+		},
+		"ca_cert": {
+			Type:        framework.TypeString,
+			Description: sinkCACertDescription,
+		},
+		"client_cert": {
+			Type:        framework.TypeString,
+			Description: sinkClientCertDescription,
+		},
+		"timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: sinkTimeoutDescription,
+		},
+	}
+}
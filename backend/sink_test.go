@@ -0,0 +1,312 @@
+package backend_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_SinkConfiguration(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	clientCert, clientKey := generateClientCertificate(t)
+
+	tt := []struct {
+		Name         string
+		Data         map[string]interface{}
+		ExpectsError bool
+	}{
+		{
+			Name: "It should store a syslog sink",
+			Data: map[string]interface{}{"type": "syslog", "address": "tcp://localhost:514"},
+		},
+		{
+			Name: "It should store an https sink with a client certificate",
+			Data: map[string]interface{}{
+				"type":        "https",
+				"address":     "https://siem.example.com/ingest",
+				"client_cert": clientCert,
+				"client_key":  clientKey,
+			},
+		},
+		{
+			Name:         "It should return an error if the address does not suit a syslog sink",
+			Data:         map[string]interface{}{"type": "syslog", "address": "https://siem.example.com"},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if the address does not suit an https sink",
+			Data:         map[string]interface{}{"type": "https", "address": "http://siem.example.com"},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if the client key is missing",
+			Data:         map[string]interface{}{"type": "https", "address": "https://siem.example.com", "client_cert": clientCert},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error if the ca certificate is invalid",
+			Data:         map[string]interface{}{"type": "https", "address": "https://siem.example.com", "ca_cert": "invalid"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config/sink",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "config/sink",
+				Storage:   storage,
+			})
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.Data["address"], response.Data["address"])
+			assert.NotContains(t, response.Data, "client_key")
+		})
+	}
+}
+
+func TestBackend_SinkExport(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	issue := func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": []string{"tag:server"}},
+		})
+		require.NoError(t, err)
+	}
+
+	configure := func(t *testing.T, data map[string]interface{}) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config/sink",
+			Storage:   storage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("It should stream records to a syslog server", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { listener.Close() })
+
+		messages := make(chan string, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			body, _ := io.ReadAll(bufio.NewReader(conn))
+			messages <- string(body)
+		}()
+
+		configure(t, map[string]interface{}{"type": "syslog", "address": "tcp://" + listener.Addr().String()})
+		issue(t)
+
+		select {
+		case message := <-messages:
+			_, message, ok := strings.Cut(message, " ")
+			require.True(t, ok)
+			assert.True(t, strings.HasPrefix(message, "<134>1 "))
+			assert.Contains(t, message, " vault-plugin-tailscale ")
+			assert.Contains(t, message, `"type":"issuance"`)
+			assert.Contains(t, message, `"key_id":"key-1"`)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message was received")
+		}
+	})
+
+	t.Run("It should stream records to an https collector using mutual tls", func(t *testing.T) {
+		records := make(chan backend.Activity, 1)
+		svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.PeerCertificates) == 0 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var record backend.Activity
+			if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			records <- record
+		}))
+		svr.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		svr.StartTLS()
+		t.Cleanup(svr.Close)
+
+		clientCert, clientKey := generateClientCertificate(t)
+		caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw})
+
+		configure(t, map[string]interface{}{
+			"type":        "https",
+			"address":     svr.URL,
+			"ca_cert":     string(caCert),
+			"client_cert": clientCert,
+			"client_key":  clientKey,
+		})
+		issue(t)
+
+		select {
+		case record := <-records:
+			assert.EqualValues(t, "issuance", record.Type)
+			assert.EqualValues(t, "success", record.Outcome)
+			assert.EqualValues(t, []string{"tag:server"}, record.Tags)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no record was received")
+		}
+	})
+}
+
+func TestBackend_SinkDelivery(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	var connections atomic.Int64
+	records := make(chan struct{}, 1)
+	collector := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		records <- struct{}{}
+	}))
+	collector.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	collector.StartTLS()
+	t.Cleanup(collector.Close)
+
+	configure := func(t *testing.T, timeout int) {
+		_, err := request(logical.UpdateOperation, "config/sink", map[string]interface{}{
+			"type":    "https",
+			"address": collector.URL,
+			"ca_cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: collector.Certificate().Raw})),
+			"timeout": timeout,
+		})
+		require.NoError(t, err)
+	}
+
+	export := func(t *testing.T) {
+		_, err := request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+
+		select {
+		case <-records:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no record was received")
+		}
+	}
+
+	t.Run("It should reuse connections to the collector", func(t *testing.T) {
+		configure(t, 5)
+		export(t)
+		export(t)
+
+		assert.EqualValues(t, 1, connections.Load())
+	})
+
+	t.Run("It should create a new client when the configuration changes", func(t *testing.T) {
+		configure(t, 10)
+		export(t)
+
+		assert.EqualValues(t, 2, connections.Load())
+	})
+
+	t.Run("It should not wait for the collector to respond", func(t *testing.T) {
+		release := make(chan struct{})
+		unresponsive := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		t.Cleanup(unresponsive.Close)
+		t.Cleanup(func() { close(release) })
+
+		_, err := request(logical.UpdateOperation, "config/sink", map[string]interface{}{
+			"type":    "https",
+			"address": unresponsive.URL,
+			"ca_cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: unresponsive.Certificate().Raw})),
+			"timeout": 5,
+		})
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = request(logical.ReadOperation, "key", nil)
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func generateClientCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return string(cert), string(keyPEM)
+}
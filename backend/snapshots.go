@@ -0,0 +1,529 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The SnapshotConfig type describes how often the device inventory of the tailnet is recorded and how long each
+	// recording is kept.
+	SnapshotConfig struct {
+		Interval  time.Duration `json:"interval"`
+		Retention time.Duration `json:"retention"`
+	}
+
+	// The DeviceSnapshot type describes the devices in the tailnet at a point in time.
+	DeviceSnapshot struct {
+		ID      string           `json:"id"`
+		Taken   time.Time        `json:"taken"`
+		Devices []SnapshotDevice `json:"devices"`
+	}
+
+	// The SnapshotDevice type describes a single device recorded in a DeviceSnapshot.
+	SnapshotDevice struct {
+		ID         string    `json:"id"`
+		Name       string    `json:"name"`
+		Hostname   string    `json:"hostname"`
+		User       string    `json:"user"`
+		OS         string    `json:"os"`
+		Addresses  []string  `json:"addresses"`
+		Tags       []string  `json:"tags"`
+		Authorized bool      `json:"authorized"`
+		Created    time.Time `json:"created"`
+		LastSeen   time.Time `json:"last_seen"`
+	}
+)
+
+const (
+	snapshotConfigPath       = "config/snapshots"
+	snapshotPrefix           = "device-snapshots/"
+	snapshotIDFormat         = "20060102T150405Z"
+	defaultSnapshotInterval  = 24 * time.Hour
+	defaultSnapshotRetention = 90 * 24 * time.Hour
+
+	readSnapshotConfigDescription   = "Read the device snapshot configuration"
+	updateSnapshotConfigDescription = "Update the device snapshot configuration"
+	deleteSnapshotConfigDescription = "Delete the device snapshot configuration, disabling snapshots"
+	snapshotIntervalDescription     = "How often the devices in the tailnet are recorded"
+	snapshotRetentionDescription    = "How long each recording of the devices in the tailnet is kept"
+	listSnapshotsDescription        = "List the recorded snapshots of the devices in the tailnet"
+	readSnapshotDescription         = "Read a recorded snapshot of the devices in the tailnet"
+	snapshotIDDescription           = "The identifier of the snapshot, which is the UTC time it was taken"
+	diffSnapshotsDescription        = "Report the devices added, removed and re-tagged between two snapshots"
+	snapshotDiffFromDescription     = "The identifier of the earlier snapshot"
+	snapshotDiffToDescription       = "The identifier of the later snapshot. Defaults to the latest snapshot"
+
+	snapshotConfigHelpSynopsis    = "Configure periodic snapshots of the devices in the tailnet."
+	snapshotConfigHelpDescription = `
+When configured, the devices in the tailnet are recorded at the given interval and each
+recording is kept for the retention period. Deleting this path disables snapshots, but
+existing snapshots are kept until they expire.
+`
+	listSnapshotsHelpSynopsis    = "List the recorded snapshots of the devices in the tailnet."
+	listSnapshotsHelpDescription = `
+Lists the identifiers of the recorded snapshots, each of which is the UTC time the
+snapshot was taken.
+`
+	diffSnapshotsHelpSynopsis    = "Compare two snapshots of the devices in the tailnet."
+	diffSnapshotsHelpDescription = `
+Reports the devices added to or removed from the tailnet between two snapshots, and the
+devices whose tags changed. If no later snapshot is given, the latest snapshot is used.
+`
+	snapshotHelpSynopsis    = "Read a recorded snapshot of the devices in the tailnet."
+	snapshotHelpDescription = `
+Returns the devices recorded in a snapshot, including their names, addresses, tags and
+when they were created and last seen.
+`
+)
+
+func (b *Backend) snapshotPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: snapshotConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"interval": {
+					Type:        framework.TypeDurationSecond,
+					Description: snapshotIntervalDescription,
+					Default:     int(defaultSnapshotInterval.Seconds()),
+				},
+				"retention": {
+					Type:        framework.TypeDurationSecond,
+					Description: snapshotRetentionDescription,
+					Default:     int(defaultSnapshotRetention.Seconds()),
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadSnapshotConfiguration,
+					Responses: okResponse(readSnapshotConfigDescription, snapshotConfigResponseFields()),
+					Summary:   readSnapshotConfigDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateSnapshotConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateSnapshotConfigDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteSnapshotConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteSnapshotConfigDescription,
+				},
+			},
+			HelpSynopsis:    snapshotConfigHelpSynopsis,
+			HelpDescription: snapshotConfigHelpDescription,
+		},
+		{
+			Pattern: "devices/snapshots/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListSnapshots,
+					Responses: listResponse(listSnapshotsDescription),
+					Summary:   listSnapshotsDescription,
+				},
+			},
+			HelpSynopsis:    listSnapshotsHelpSynopsis,
+			HelpDescription: listSnapshotsHelpDescription,
+		},
+		{
+			Pattern: "devices/snapshots/diff$",
+			Fields: map[string]*framework.FieldSchema{
+				"from": {
+					Type:        framework.TypeString,
+					Description: snapshotDiffFromDescription,
+				},
+				"to": {
+					Type:        framework.TypeString,
+					Description: snapshotDiffToDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.DiffSnapshots,
+					Responses: okResponse(diffSnapshotsDescription, snapshotDiffResponseFields()),
+					Summary:   diffSnapshotsDescription,
+				},
+			},
+			HelpSynopsis:    diffSnapshotsHelpSynopsis,
+			HelpDescription: diffSnapshotsHelpDescription,
+		},
+		{
+			Pattern: "devices/snapshots/" + framework.GenericNameRegex("id"),
+			Fields: map[string]*framework.FieldSchema{
+				"id": {
+					Type:        framework.TypeString,
+					Description: snapshotIDDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadSnapshot,
+					Responses: okResponse(readSnapshotDescription, snapshotResponseFields()),
+					Summary:   readSnapshotDescription,
+				},
+			},
+			HelpSynopsis:    snapshotHelpSynopsis,
+			HelpDescription: snapshotHelpDescription,
+		},
+	}
+}
+
+// ReadSnapshotConfiguration returns the device snapshot configuration.
+func (b *Backend) ReadSnapshotConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.snapshotConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"interval":  int64(config.Interval.Seconds()),
+			"retention": int64(config.Retention.Seconds()),
+		},
+	}, nil
+}
+
+// UpdateSnapshotConfiguration enables device snapshots, or modifies how often they are taken and how long they are
+// kept. Returns an error if the interval is not positive or is longer than the retention.
+func (b *Backend) UpdateSnapshotConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := SnapshotConfig{
+		Interval:  time.Duration(data.Get("interval").(int)) * time.Second,
+		Retention: time.Duration(data.Get("retention").(int)) * time.Second,
+	}
+
+	switch {
+	case config.Interval <= 0:
+		return nil, errors.New("provided interval must be greater than zero")
+	case config.Retention < config.Interval:
+		return nil, errors.New("provided retention cannot be shorter than the interval")
+	}
+
+	entry, err := logical.StorageEntryJSON(snapshotConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteSnapshotConfiguration disables device snapshots. Existing snapshots are kept.
+func (b *Backend) DeleteSnapshotConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, snapshotConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// ListSnapshots returns the identifiers of all recorded device snapshots, oldest first.
+func (b *Backend) ListSnapshots(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	ids, err := request.Storage.List(ctx, snapshotPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ids)
+	return logical.ListResponse(ids), nil
+}
+
+// ReadSnapshot returns the devices recorded in a snapshot.
+func (b *Backend) ReadSnapshot(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	snapshot, err := b.snapshot(ctx, request.Storage, data.Get("id").(string))
+	switch {
+	case err != nil:
+		return nil, err
+	case snapshot == nil:
+		return nil, nil
+	}
+
+	devices := make([]map[string]interface{}, 0, len(snapshot.Devices))
+	for _, device := range snapshot.Devices {
+		devices = append(devices, map[string]interface{}{
+			"id":         device.ID,
+			"name":       device.Name,
+			"hostname":   device.Hostname,
+			"user":       device.User,
+			"os":         device.OS,
+			"addresses":  device.Addresses,
+			"tags":       device.Tags,
+			"authorized": device.Authorized,
+			"created":    device.Created,
+			"last_seen":  device.LastSeen,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":      snapshot.ID,
+			"taken":   snapshot.Taken,
+			"devices": devices,
+		},
+	}, nil
+}
+
+// DiffSnapshots compares two snapshots, returning the devices that were added to or removed from the tailnet between
+// them and the devices whose tags changed. Returns an error if either snapshot does not exist.
+func (b *Backend) DiffSnapshots(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	fromID := data.Get("from").(string)
+	toID := data.Get("to").(string)
+
+	if fromID == "" {
+		return nil, errors.New("provided from cannot be empty")
+	}
+
+	if toID == "" {
+		ids, err := request.Storage.List(ctx, snapshotPrefix)
+		switch {
+		case err != nil:
+			return nil, err
+		case len(ids) == 0:
+			return nil, errors.New("no snapshots have been taken")
+		}
+
+		sort.Strings(ids)
+		toID = ids[len(ids)-1]
+	}
+
+	from, err := b.snapshot(ctx, request.Storage, fromID)
+	switch {
+	case err != nil:
+		return nil, err
+	case from == nil:
+		return nil, fmt.Errorf("snapshot %q does not exist", fromID)
+	}
+
+	to, err := b.snapshot(ctx, request.Storage, toID)
+	switch {
+	case err != nil:
+		return nil, err
+	case to == nil:
+		return nil, fmt.Errorf("snapshot %q does not exist", toID)
+	}
+
+	previous := make(map[string]SnapshotDevice, len(from.Devices))
+	for _, device := range from.Devices {
+		previous[device.ID] = device
+	}
+
+	added := make([]map[string]interface{}, 0)
+	retagged := make([]map[string]interface{}, 0)
+	for _, device := range to.Devices {
+		before, ok := previous[device.ID]
+		delete(previous, device.ID)
+
+		switch {
+		case !ok:
+			added = append(added, snapshotDeviceSummary(device))
+		case !strutil.EquivalentSlices(before.Tags, device.Tags):
+			summary := snapshotDeviceSummary(device)
+			summary["previous_tags"] = before.Tags
+			retagged = append(retagged, summary)
+		}
+	}
+
+	removed := make([]map[string]interface{}, 0, len(previous))
+	for _, device := range from.Devices {
+		if _, ok := previous[device.ID]; ok {
+			removed = append(removed, snapshotDeviceSummary(device))
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"from":     from.ID,
+			"to":       to.ID,
+			"added":    added,
+			"removed":  removed,
+			"retagged": retagged,
+		},
+	}, nil
+}
+
+func snapshotDeviceSummary(device SnapshotDevice) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       device.ID,
+		"name":     device.Name,
+		"hostname": device.Hostname,
+		"tags":     device.Tags,
+	}
+}
+
+// snapshotDevices records the devices in the tailnet if snapshots are enabled and the configured interval has elapsed
+// since the latest snapshot. Snapshots older than the configured retention are removed.
+func (b *Backend) snapshotDevices(ctx context.Context, storage logical.Storage) error {
+	config, err := b.snapshotConfig(ctx, storage)
+	if err != nil || config == nil {
+		return err
+	}
+
+	ids, err := storage.List(ctx, snapshotPrefix)
+	if err != nil {
+		return err
+	}
+	sort.Strings(ids)
+
+	now := time.Now().UTC()
+
+	var errs *multierror.Error
+	for _, id := range ids {
+		taken, err := time.Parse(snapshotIDFormat, id)
+		if err != nil || now.Sub(taken) <= config.Retention {
+			continue
+		}
+
+		errs = multierror.Append(errs, storage.Delete(ctx, snapshotPrefix+id))
+	}
+
+	if len(ids) > 0 {
+		latest, err := time.Parse(snapshotIDFormat, ids[len(ids)-1])
+		if err == nil && now.Sub(latest) < config.Interval {
+			return errs.ErrorOrNil()
+		}
+	}
+
+	return multierror.Append(errs, b.takeSnapshot(ctx, storage, now)).ErrorOrNil()
+}
+
+func (b *Backend) takeSnapshot(ctx context.Context, storage logical.Storage, now time.Time) error {
+	client, err := b.client(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	snapshot := DeviceSnapshot{
+		ID:      now.Format(snapshotIDFormat),
+		Taken:   now,
+		Devices: make([]SnapshotDevice, 0, len(devices)),
+	}
+
+	for _, device := range devices {
+		snapshot.Devices = append(snapshot.Devices, SnapshotDevice{
+			ID:         device.ID,
+			Name:       device.Name,
+			Hostname:   device.Hostname,
+			User:       device.User,
+			OS:         device.OS,
+			Addresses:  device.Addresses,
+			Tags:       device.Tags,
+			Authorized: device.Authorized,
+			Created:    device.Created.UTC(),
+			LastSeen:   device.LastSeen.UTC(),
+		})
+	}
+
+	entry, err := logical.StorageEntryJSON(snapshotPrefix+snapshot.ID, snapshot)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *Backend) snapshot(ctx context.Context, storage logical.Storage, id string) (*DeviceSnapshot, error) {
+	entry, err := storage.Get(ctx, snapshotPrefix+id)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var snapshot DeviceSnapshot
+	if err = entry.DecodeJSON(&snapshot); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+func (b *Backend) snapshotConfig(ctx context.Context, storage logical.Storage) (*SnapshotConfig, error) {
+	entry, err := storage.Get(ctx, snapshotConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config SnapshotConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func snapshotConfigResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"interval": {
+			Type:        framework.TypeDurationSecond,
+			Description: snapshotIntervalDescription,
+		},
+		"retention": {
+			Type:        framework.TypeDurationSecond,
+			Description: snapshotRetentionDescription,
+		},
+	}
+}
+
+func snapshotResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: snapshotIDDescription,
+		},
+		"taken": {
+			Type:        framework.TypeTime,
+			Description: "When the snapshot was taken",
+		},
+		"devices": {
+			Type:        framework.TypeSlice,
+			Description: "The devices in the tailnet when the snapshot was taken",
+		},
+	}
+}
+
+func snapshotDiffResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"from": {
+			Type:        framework.TypeString,
+			Description: snapshotDiffFromDescription,
+		},
+		"to": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the later snapshot",
+		},
+		"added": {
+			Type:        framework.TypeSlice,
+			Description: "The devices added to the tailnet between the snapshots",
+		},
+		"removed": {
+			Type:        framework.TypeSlice,
+			Description: "The devices removed from the tailnet between the snapshots",
+		},
+		"retagged": {
+			Type:        framework.TypeSlice,
+			Description: "The devices whose tags changed between the snapshots",
+		},
+	}
+}
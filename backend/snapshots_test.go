@@ -0,0 +1,192 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_DeviceSnapshots(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	api.SetDevices(tailscale.Device{
+		ID:       "device-1",
+		Name:     "web-1.example.ts.net",
+		Hostname: "web-1",
+		Tags:     []string{"tag:web"},
+	})
+
+	t.Run("It should not take snapshots unless configured", func(t *testing.T) {
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ListOperation, "devices/snapshots", nil)
+		require.NoError(t, err)
+		assert.Empty(t, response.Data["keys"])
+	})
+
+	t.Run("It should return an error if the retention is shorter than the interval", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/snapshots", map[string]interface{}{
+			"interval":  "2h",
+			"retention": "1h",
+		})
+		assert.Error(t, err)
+	})
+
+	_, err := request(logical.UpdateOperation, "config/snapshots", map[string]interface{}{
+		"interval":  "1h",
+		"retention": "24h",
+	})
+	require.NoError(t, err)
+
+	expired := time.Now().UTC().Add(-48 * time.Hour)
+	entry, err := logical.StorageEntryJSON("device-snapshots/"+expired.Format("20060102T150405Z"), backend.DeviceSnapshot{
+		ID:    expired.Format("20060102T150405Z"),
+		Taken: expired,
+	})
+	require.NoError(t, err)
+	require.NoError(t, storage.Put(ctx, entry))
+
+	t.Run("It should take a snapshot and remove expired snapshots", func(t *testing.T) {
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ListOperation, "devices/snapshots", nil)
+		require.NoError(t, err)
+		require.Len(t, response.Data["keys"], 1)
+
+		id := response.Data["keys"].([]string)[0]
+		response, err = request(logical.ReadOperation, "devices/snapshots/"+id, nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, id, response.Data["id"])
+
+		devices := response.Data["devices"].([]map[string]interface{})
+		require.Len(t, devices, 1)
+		assert.EqualValues(t, "device-1", devices[0]["id"])
+		assert.EqualValues(t, "web-1", devices[0]["hostname"])
+		assert.EqualValues(t, []string{"tag:web"}, devices[0]["tags"])
+	})
+
+	t.Run("It should not take another snapshot within the interval", func(t *testing.T) {
+		_, err := request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ListOperation, "devices/snapshots", nil)
+		require.NoError(t, err)
+		assert.Len(t, response.Data["keys"], 1)
+	})
+}
+
+func TestBackend_DiffSnapshots(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	snapshots := []backend.DeviceSnapshot{
+		{
+			ID: "20220401T000000Z",
+			Devices: []backend.SnapshotDevice{
+				{ID: "device-1", Tags: []string{"tag:web"}},
+				{ID: "device-2", Tags: []string{"tag:db"}},
+				{ID: "device-3", Tags: []string{"tag:web"}},
+			},
+		},
+		{
+			ID: "20220402T000000Z",
+			Devices: []backend.SnapshotDevice{
+				{ID: "device-1", Tags: []string{"tag:web"}},
+				{ID: "device-2", Tags: []string{"tag:db", "tag:prod"}},
+				{ID: "device-4", Tags: []string{"tag:ci"}},
+			},
+		},
+	}
+
+	for _, snapshot := range snapshots {
+		entry, err := logical.StorageEntryJSON("device-snapshots/"+snapshot.ID, snapshot)
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+	}
+
+	tt := []struct {
+		Name             string
+		Data             map[string]interface{}
+		ExpectedAdded    []string
+		ExpectedRemoved  []string
+		ExpectedRetagged []string
+		ExpectsError     bool
+	}{
+		{
+			Name: "It should report the changes between two snapshots",
+			Data: map[string]interface{}{
+				"from": "20220401T000000Z",
+				"to":   "20220402T000000Z",
+			},
+			ExpectedAdded:    []string{"device-4"},
+			ExpectedRemoved:  []string{"device-3"},
+			ExpectedRetagged: []string{"device-2"},
+		},
+		{
+			Name: "It should compare against the latest snapshot by default",
+			Data: map[string]interface{}{
+				"from": "20220401T000000Z",
+			},
+			ExpectedAdded:    []string{"device-4"},
+			ExpectedRemoved:  []string{"device-3"},
+			ExpectedRetagged: []string{"device-2"},
+		},
+		{
+			Name: "It should report no changes between the same snapshot",
+			Data: map[string]interface{}{
+				"from": "20220402T000000Z",
+				"to":   "20220402T000000Z",
+			},
+		},
+		{
+			Name: "It should return an error if a snapshot does not exist",
+			Data: map[string]interface{}{
+				"from": "20220301T000000Z",
+			},
+			ExpectsError: true,
+		},
+	}
+
+	ids := func(devices interface{}) []string {
+		var result []string
+		for _, device := range devices.([]map[string]interface{}) {
+			result = append(result, device["id"].(string))
+		}
+		return result
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			response, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "devices/snapshots/diff",
+				Storage:   storage,
+				Data:      tc.Data,
+			})
+
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.EqualValues(t, tc.ExpectedAdded, ids(response.Data["added"]))
+			assert.EqualValues(t, tc.ExpectedRemoved, ids(response.Data["removed"]))
+			assert.EqualValues(t, tc.ExpectedRetagged, ids(response.Data["retagged"]))
+		})
+	}
+}
@@ -0,0 +1,965 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/robfig/cron/v3"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// The StaticRole type describes a reusable authentication key that is created and owned by the Backend. The key
+	// is rotated on a schedule so that consumers sharing it never need to manage its lifecycle themselves.
+	StaticRole struct {
+		Name             string        `json:"name"`
+		Tags             []string      `json:"tags"`
+		Ephemeral        bool          `json:"ephemeral"`
+		Preauthorized    bool          `json:"preauthorized"`
+		RotationPeriod   time.Duration `json:"rotation_period"`
+		RotationSchedule string        `json:"rotation_schedule"`
+		RotationWindow   time.Duration `json:"rotation_window"`
+		RotationOverlap  time.Duration `json:"rotation_overlap"`
+		KeyID            string        `json:"key_id"`
+		Key              string        `json:"key"`
+		Expires          time.Time     `json:"expires"`
+		LastRotated      time.Time     `json:"last_rotated"`
+		Library          bool          `json:"library"`
+		MaxCheckouts     int           `json:"max_checkouts"`
+		CheckoutTTL      time.Duration `json:"checkout_ttl"`
+		Checkouts        []Checkout    `json:"checkouts"`
+
+		PreviousKeyID      string    `json:"previous_key_id"`
+		PreviousKey        string    `json:"previous_key"`
+		PreviousValidUntil time.Time `json:"previous_valid_until"`
+
+		RotationFailures    int       `json:"rotation_failures"`
+		LastRotationError   string    `json:"last_rotation_error"`
+		LastRotationFailure time.Time `json:"last_rotation_failure"`
+	}
+)
+
+const (
+	staticRolePrefix = "static-roles/"
+
+	defaultRotationPeriod = 30 * 24 * time.Hour
+	maxRotationPeriod     = 90 * 24 * time.Hour
+
+	// staticRoleExpiryMargin is how long before its key expires a static role is rotated, regardless of its schedule.
+	staticRoleExpiryMargin = 24 * time.Hour
+
+	listStaticRolesDescription     = "List the names of all static roles"
+	readStaticRoleDescription      = "Read the configuration of a static role"
+	updateStaticRoleDescription    = "Create or update a static role, generating its managed key if required"
+	deleteStaticRoleDescription    = "Delete a static role and the key it manages"
+	rotateStaticRoleDescription    = "Immediately rotate the key managed by a static role"
+	readStaticCredsDescription     = "Read the current key managed by a static role"
+	staticRoleNameDescription      = "The name of the static role"
+	rotationPeriodDescription      = "How often the managed key is rotated, up to a maximum of 90 days. Mutually exclusive with rotation_schedule"
+	rotationScheduleDescription    = "A cron-style schedule describing when the managed key is rotated. Mutually exclusive with rotation_period"
+	rotationWindowDescription      = "How long after a scheduled time the rotation may still take place. Only valid with rotation_schedule"
+	staticRoleTagsDescription      = "Tags to apply to devices that use the managed key"
+	rotationOverlapDescription     = "How long the previous key remains valid after a rotation, allowing in-flight consumers to finish using it"
+	libraryDescription             = "If true, the managed key must be checked out before use and checked back in afterwards"
+	maxCheckoutsDescription        = "The maximum number of concurrent check-outs of the managed key when in library mode"
+	checkoutTTLDescription         = "The default and maximum duration of a check-out when in library mode"
+	staticRoleEphemeralDescription = "If true, nodes created with the managed key will be removed after a period of inactivity or when they disconnect from the Tailnet"
+
+	listStaticRolesHelpSynopsis    = "List the names of all static roles."
+	listStaticRolesHelpDescription = `
+Lists the names of the static roles, each of which manages a single reusable key that is
+rotated periodically.
+`
+	staticRoleHelpSynopsis    = "Manage static roles and the reusable keys they manage."
+	staticRoleHelpDescription = `
+A static role manages a single reusable key that is rotated on a period or cron
+schedule. The previous key can remain valid for an overlap after each rotation, and in
+library mode the key must be checked out before use. Deleting a static role deletes the
+key it manages.
+`
+	staticCredsHelpSynopsis    = "Read the current key managed by a static role."
+	staticCredsHelpDescription = `
+Returns the current key managed by the static role, when it was last rotated and when it
+will next be rotated. While the rotation overlap has not elapsed, the previous key is
+also returned.
+`
+	rotateStaticRoleHelpSynopsis    = "Immediately rotate the key managed by a static role."
+	rotateStaticRoleHelpDescription = `
+Generates a new key for the static role and deletes the key it replaces, or retains it
+until the rotation overlap elapses.
+`
+)
+
+func (b *Backend) staticRolePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "static-roles/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListStaticRoles,
+					Responses: listResponse(listStaticRolesDescription),
+					Summary:   listStaticRolesDescription,
+				},
+			},
+			HelpSynopsis:    listStaticRolesHelpSynopsis,
+			HelpDescription: listStaticRolesHelpDescription,
+		},
+		{
+			Pattern: "static-roles/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: staticRoleNameDescription,
+				},
+				"tags": {
+					Type:        framework.TypeStringSlice,
+					Description: staticRoleTagsDescription,
+				},
+				"preauthorized": {
+					Type:        framework.TypeBool,
+					Description: preauthorizedDescription,
+				},
+				"ephemeral": {
+					Type:        framework.TypeBool,
+					Description: staticRoleEphemeralDescription,
+				},
+				"rotation_period": {
+					Type:        framework.TypeDurationSecond,
+					Description: rotationPeriodDescription,
+					Default:     int(defaultRotationPeriod.Seconds()),
+				},
+				"rotation_schedule": {
+					Type:        framework.TypeString,
+					Description: rotationScheduleDescription,
+				},
+				"rotation_window": {
+					Type:        framework.TypeDurationSecond,
+					Description: rotationWindowDescription,
+				},
+				"rotation_overlap": {
+					Type:        framework.TypeDurationSecond,
+					Description: rotationOverlapDescription,
+				},
+				"library": {
+					Type:        framework.TypeBool,
+					Description: libraryDescription,
+				},
+				"max_checkouts": {
+					Type:        framework.TypeInt,
+					Description: maxCheckoutsDescription,
+					Default:     defaultMaxCheckouts,
+				},
+				"checkout_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: checkoutTTLDescription,
+					Default:     int(defaultCheckoutTTL.Seconds()),
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadStaticRole,
+					Responses: okResponse(readStaticRoleDescription, staticRoleResponseFields()),
+					Summary:   readStaticRoleDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateStaticRole,
+					Responses: noContentResponse(),
+					Summary:   updateStaticRoleDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteStaticRole,
+					Responses: noContentResponse(),
+					Summary:   deleteStaticRoleDescription,
+				},
+			},
+			HelpSynopsis:    staticRoleHelpSynopsis,
+			HelpDescription: staticRoleHelpDescription,
+		},
+		{
+			Pattern: "static-creds/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: staticRoleNameDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadStaticCreds,
+					Responses: okResponse(readStaticCredsDescription, staticCredsResponseFields()),
+					Summary:   readStaticCredsDescription,
+				},
+			},
+			HelpSynopsis:    staticCredsHelpSynopsis,
+			HelpDescription: staticCredsHelpDescription,
+		},
+		{
+			Pattern: "rotate-role/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: staticRoleNameDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.RotateStaticRole,
+					Responses: noContentResponse(),
+					Summary:   rotateStaticRoleDescription,
+				},
+			},
+			HelpSynopsis:    rotateStaticRoleHelpSynopsis,
+			HelpDescription: rotateStaticRoleHelpDescription,
+		},
+	}
+}
+
+// ListStaticRoles returns the names of all static roles.
+func (b *Backend) ListStaticRoles(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	names, err := request.Storage.List(ctx, staticRolePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+// ReadStaticRole returns the configuration of a static role. The managed key itself is not included in the response.
+func (b *Backend) ReadStaticRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.staticRole(ctx, request.Storage, data.Get("name").(string))
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, nil
+	}
+
+	now := time.Now()
+	next, err := role.nextRotation(now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":                  role.Name,
+			"tags":                  role.Tags,
+			"ephemeral":             role.Ephemeral,
+			"preauthorized":         role.Preauthorized,
+			"rotation_period":       int64(role.RotationPeriod.Seconds()),
+			"rotation_schedule":     role.RotationSchedule,
+			"rotation_window":       int64(role.RotationWindow.Seconds()),
+			"rotation_overlap":      int64(role.RotationOverlap.Seconds()),
+			"key_id":                role.KeyID,
+			"previous_key_id":       role.PreviousKeyID,
+			"last_rotated":          role.LastRotated,
+			"next_rotation":         next,
+			"key_age":               int64(now.Sub(role.LastRotated).Seconds()),
+			"library":               role.Library,
+			"max_checkouts":         role.MaxCheckouts,
+			"checkout_ttl":          int64(role.CheckoutTTL.Seconds()),
+			"rotation_failures":     role.RotationFailures,
+			"last_rotation_error":   role.LastRotationError,
+			"last_rotation_failure": role.LastRotationFailure,
+		},
+	}, nil
+}
+
+// UpdateStaticRole creates or modifies a static role. A new key is generated when the role is first created or when
+// any of the key's capabilities change.
+func (b *Backend) UpdateStaticRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.staticMu.Lock()
+	defer b.staticMu.Unlock()
+
+	name := data.Get("name").(string)
+	role, err := b.staticRole(ctx, request.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	rotate := role == nil
+	if role == nil {
+		role = &StaticRole{Name: name}
+	}
+
+	if tags, ok := data.GetOk("tags"); ok {
+		rotate = rotate || !strutil.EquivalentSlices(role.Tags, tags.([]string))
+		role.Tags = tags.([]string)
+	}
+	if preauthorized, ok := data.GetOk("preauthorized"); ok {
+		rotate = rotate || role.Preauthorized != preauthorized.(bool)
+		role.Preauthorized = preauthorized.(bool)
+	}
+	if ephemeral, ok := data.GetOk("ephemeral"); ok {
+		rotate = rotate || role.Ephemeral != ephemeral.(bool)
+		role.Ephemeral = ephemeral.(bool)
+	}
+
+	_, hasPeriod := data.GetOk("rotation_period")
+	schedule, hasSchedule := data.GetOk("rotation_schedule")
+	switch {
+	case hasPeriod && hasSchedule:
+		return nil, errors.New("provided rotation_period and rotation_schedule are mutually exclusive")
+	case hasSchedule:
+		role.RotationSchedule = schedule.(string)
+		role.RotationPeriod = 0
+	case hasPeriod, role.RotationSchedule == "" && role.RotationPeriod == 0:
+		role.RotationPeriod = time.Duration(data.Get("rotation_period").(int)) * time.Second
+		role.RotationSchedule = ""
+		role.RotationWindow = 0
+	}
+
+	if window, ok := data.GetOk("rotation_window"); ok {
+		role.RotationWindow = time.Duration(window.(int)) * time.Second
+	}
+	if overlap, ok := data.GetOk("rotation_overlap"); ok {
+		role.RotationOverlap = time.Duration(overlap.(int)) * time.Second
+	}
+	if library, ok := data.GetOk("library"); ok {
+		role.Library = library.(bool)
+	}
+	if _, ok := data.GetOk("max_checkouts"); ok || role.MaxCheckouts == 0 {
+		role.MaxCheckouts = data.Get("max_checkouts").(int)
+	}
+	if _, ok := data.GetOk("checkout_ttl"); ok || role.CheckoutTTL == 0 {
+		role.CheckoutTTL = time.Duration(data.Get("checkout_ttl").(int)) * time.Second
+	}
+
+	if role.RotationSchedule != "" {
+		if _, err = cron.ParseStandard(role.RotationSchedule); err != nil {
+			return nil, fmt.Errorf("provided rotation_schedule is invalid: %w", err)
+		}
+	}
+
+	switch {
+	case role.RotationSchedule == "" && role.RotationPeriod <= 0:
+		return nil, errors.New("provided rotation_period must be greater than zero")
+	case role.RotationPeriod > maxRotationPeriod:
+		return nil, fmt.Errorf("provided rotation_period cannot exceed %s", maxRotationPeriod)
+	case role.RotationWindow < 0:
+		return nil, errors.New("provided rotation_window cannot be negative")
+	case role.RotationSchedule == "" && role.RotationWindow > 0:
+		return nil, errors.New("provided rotation_window requires a rotation_schedule")
+	case role.RotationOverlap < 0:
+		return nil, errors.New("provided rotation_overlap cannot be negative")
+	case role.RotationSchedule == "" && role.RotationOverlap >= role.RotationPeriod:
+		return nil, errors.New("provided rotation_overlap must be shorter than the rotation_period")
+	case role.MaxCheckouts <= 0:
+		return nil, errors.New("provided max_checkouts must be greater than zero")
+	case role.CheckoutTTL <= 0:
+		return nil, errors.New("provided checkout_ttl must be greater than zero")
+	}
+
+	if rotate {
+		err = b.rotateStaticRole(ctx, request.Storage, role)
+	} else {
+		err = b.saveStaticRole(ctx, request.Storage, role)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteStaticRole removes a static role and deletes its managed key from the Tailnet. Keys that no longer exist in the
+// Tailnet, because they were deleted or have expired, are treated as deleted.
+func (b *Backend) DeleteStaticRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.staticMu.Lock()
+	defer b.staticMu.Unlock()
+
+	name := data.Get("name").(string)
+	role, err := b.staticRole(ctx, request.Storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, nil
+	}
+
+	for _, id := range []string{role.KeyID, role.PreviousKeyID} {
+		if id == "" {
+			continue
+		}
+
+		if err = b.deleteKey(ctx, request.Storage, id); err != nil && !tailscale.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	if err = request.Storage.Delete(ctx, staticRolePrefix+name); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// ReadStaticCreds returns the key currently managed by a static role along with its rotation metadata.
+func (b *Backend) ReadStaticCreds(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	role, err := b.staticRole(ctx, request.Storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("static role %q does not exist", name)
+	case role.Library:
+		return nil, fmt.Errorf("static role %q is in library mode, its key must be checked out", name)
+	}
+
+	now := time.Now()
+	next, err := role.nextRotation(now)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"id":            role.KeyID,
+			"key":           role.Key,
+			"expires":       role.Expires,
+			"tags":          role.Tags,
+			"reusable":      true,
+			"ephemeral":     role.Ephemeral,
+			"preauthorized": role.Preauthorized,
+			"last_rotated":  role.LastRotated,
+			"next_rotation": next,
+			"key_age":       int64(now.Sub(role.LastRotated).Seconds()),
+		},
+	}
+
+	if role.PreviousKeyID != "" {
+		response.Data["previous"] = map[string]interface{}{
+			"id":          role.PreviousKeyID,
+			"key":         role.PreviousKey,
+			"valid_until": role.PreviousValidUntil,
+		}
+	}
+
+	return response, nil
+}
+
+// RotateStaticRole immediately replaces the key managed by a static role.
+func (b *Backend) RotateStaticRole(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.staticMu.Lock()
+	defer b.staticMu.Unlock()
+
+	name := data.Get("name").(string)
+	role, err := b.staticRole(ctx, request.Storage, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case role == nil:
+		return nil, fmt.Errorf("static role %q does not exist", name)
+	}
+
+	if err = b.rotateStaticRole(ctx, request.Storage, role); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// rotateStaticRoles is invoked periodically and rotates the key of every static role whose rotation period has
+// elapsed. A failure to rotate one role does not prevent the others from being rotated.
+func (b *Backend) rotateStaticRoles(ctx context.Context, request *logical.Request) error {
+	names, err := request.Storage.List(ctx, staticRolePrefix)
+	if err != nil || len(names) == 0 {
+		return err
+	}
+
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return err
+	}
+
+	// Rotating or retiring keys modifies the tailnet, so nothing is done in read-only mode.
+	if config.ReadOnly {
+		return nil
+	}
+
+	disabled, err := b.disableConfig(ctx, request.Storage)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	now := time.Now()
+	for _, name := range names {
+		errs = multierror.Append(errs, b.rotateDueStaticRole(ctx, request.Storage, name, now, disabled.Disabled))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// rotateDueStaticRole deletes the previous key of the named static role once its overlap has elapsed, and rotates its
+// key once the rotation is due unless key generation is disabled. The lock on static roles is only held while the role
+// is read and saved, not while the Tailscale API is called, so the role is read again before it is saved. Should the
+// role have been rotated or deleted in the meantime, the newly generated key is deleted instead.
+func (b *Backend) rotateDueStaticRole(ctx context.Context, storage logical.Storage, name string, now time.Time, disabled bool) error {
+	b.staticMu.Lock()
+	role, err := b.staticRole(ctx, storage, name)
+	b.staticMu.Unlock()
+
+	switch {
+	case err != nil:
+		return err
+	case role == nil:
+		return nil
+	}
+
+	var errs *multierror.Error
+	if role.PreviousKeyID != "" && !now.Before(role.PreviousValidUntil) {
+		if err = b.retirePreviousKey(ctx, storage, name, role.PreviousKeyID); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to delete previous key of static role %q: %w", name, err))
+		}
+	}
+
+	// Rotation generates a new key, so is postponed while key generation is disabled.
+	if disabled {
+		return errs.ErrorOrNil()
+	}
+
+	next, err := role.nextRotation(now)
+	switch {
+	case err != nil:
+		return multierror.Append(errs, fmt.Errorf("failed to check rotation of static role %q: %w", name, err))
+	case next.After(now):
+		return errs.ErrorOrNil()
+	}
+
+	key, walID, err := b.generateStaticKey(ctx, storage, role)
+
+	b.staticMu.Lock()
+	current, lErr := b.staticRole(ctx, storage, name)
+	switch {
+	case lErr != nil:
+		b.staticMu.Unlock()
+		return multierror.Append(errs, lErr)
+	case current == nil || current.KeyID != role.KeyID:
+		b.staticMu.Unlock()
+		if err == nil {
+			b.abandonStaticKey(ctx, storage, walID, key.ID)
+		}
+
+		return errs.ErrorOrNil()
+	case err != nil:
+		errs = multierror.Append(errs, fmt.Errorf("failed to rotate static role %q: %w", name, err))
+		errs = multierror.Append(errs, b.recordRotationFailure(ctx, storage, current, err))
+		b.staticMu.Unlock()
+
+		return errs.ErrorOrNil()
+	}
+
+	retired := current.replaceKey(key, time.Now().UTC())
+	err = b.saveStaticRole(ctx, storage, current)
+	b.staticMu.Unlock()
+
+	if err != nil {
+		return multierror.Append(errs, fmt.Errorf("failed to rotate static role %q: %w", name, err))
+	}
+
+	return multierror.Append(errs, b.completeStaticRotation(ctx, storage, current, walID, retired)).ErrorOrNil()
+}
+
+// nextRotation returns the time at which the role's key will next be rotated. This is the scheduled rotation, brought
+// forward to shortly before the current key expires if the schedule would otherwise let it lapse.
+func (r *StaticRole) nextRotation(now time.Time) (time.Time, error) {
+	next, err := r.scheduledRotation(now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if r.Expires.IsZero() {
+		return next, nil
+	}
+
+	if deadline := r.Expires.Add(-staticRoleExpiryMargin); next.After(deadline) {
+		return deadline, nil
+	}
+
+	return next, nil
+}
+
+// scheduledRotation returns the time at which the role's rotation period or schedule next calls for a rotation. Roles
+// using a rotation schedule with a window are only rotated while inside the window following a scheduled time. If the
+// window is missed the rotation waits for the next scheduled time.
+func (r *StaticRole) scheduledRotation(now time.Time) (time.Time, error) {
+	if r.RotationSchedule == "" {
+		return r.LastRotated.Add(r.RotationPeriod), nil
+	}
+
+	schedule, err := cron.ParseStandard(r.RotationSchedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if r.RotationWindow == 0 {
+		return schedule.Next(r.LastRotated), nil
+	}
+
+	// Find the earliest scheduled time whose window has not yet closed. If it has already passed and the key was
+	// rotated since, the next rotation is the following scheduled time.
+	scheduled := schedule.Next(now.Add(-r.RotationWindow))
+	if !scheduled.After(now) && !r.LastRotated.Before(scheduled) {
+		scheduled = schedule.Next(r.LastRotated)
+	}
+
+	return scheduled, nil
+}
+
+// rotateStaticRole generates a new reusable key for the role, persists it and then deletes the key it replaces. The
+// new key is protected by a write-ahead log entry until the role is persisted, so that it is deleted from the tailnet
+// if the role cannot be saved.
+func (b *Backend) rotateStaticRole(ctx context.Context, storage logical.Storage, role *StaticRole) error {
+	key, walID, err := b.generateStaticKey(ctx, storage, role)
+	if err != nil {
+		return err
+	}
+
+	retired := role.replaceKey(key, time.Now().UTC())
+	if err = b.saveStaticRole(ctx, storage, role); err != nil {
+		return err
+	}
+
+	return b.completeStaticRotation(ctx, storage, role, walID, retired)
+}
+
+// generateStaticKey generates a new reusable key with the capabilities of the static role, returning it along with
+// the identifier of the write-ahead log entry protecting it.
+func (b *Backend) generateStaticKey(ctx context.Context, storage logical.Storage, role *StaticRole) (tailscale.Key, string, error) {
+	config, err := b.config(ctx, storage)
+	if err != nil {
+		return tailscale.Key{}, "", err
+	}
+
+	var capabilities tailscale.KeyCapabilities
+	capabilities.Devices.Create.Reusable = true
+	capabilities.Devices.Create.Tags = role.Tags
+	capabilities.Devices.Create.Preauthorized = role.Preauthorized
+	capabilities.Devices.Create.Ephemeral = role.Ephemeral
+
+	walID, nonce, err := b.putKeyWAL(ctx, storage, "")
+	if err != nil {
+		return tailscale.Key{}, "", err
+	}
+
+	key, err := b.createKey(ctx, storage, config, capabilities, 0, "", nonce)
+	if err != nil {
+		b.deleteKeyWAL(ctx, storage, walID)
+		return tailscale.Key{}, "", err
+	}
+
+	if walID, err = b.updateKeyWAL(ctx, storage, walID, "", nonce, key); err != nil {
+		return tailscale.Key{}, "", err
+	}
+
+	return key, walID, nil
+}
+
+// replaceKey makes the key the current key of the static role, returning the identifier of the key that must now be
+// deleted, if any. When an overlap is configured the replaced key remains valid until the overlap elapses, so only a
+// key still overlapping from an earlier rotation needs deleting.
+func (r *StaticRole) replaceKey(key tailscale.Key, now time.Time) string {
+	retired := r.KeyID
+	if r.RotationOverlap > 0 && r.KeyID != "" {
+		retired = r.PreviousKeyID
+		r.PreviousKeyID = r.KeyID
+		r.PreviousKey = r.Key
+		r.PreviousValidUntil = now.Add(r.RotationOverlap)
+	}
+
+	r.KeyID = key.ID
+	r.Key = key.Key
+	r.Expires = key.Expires
+	r.LastRotated = now
+	r.RotationFailures = 0
+	r.LastRotationError = ""
+
+	return retired
+}
+
+// completeStaticRotation is called once a rotation of the static role has been persisted. The write-ahead log entry
+// protecting the new key is deleted and the retired key, if any, is deleted from the tailnet.
+func (b *Backend) completeStaticRotation(ctx context.Context, storage logical.Storage, role *StaticRole, walID, retired string) error {
+	b.deleteKeyWAL(ctx, storage, walID)
+	b.notify(ctx, storage, eventStaticRoleRotated, map[string]string{
+		"role":   role.Name,
+		"key_id": role.KeyID,
+	})
+
+	if retired == "" {
+		return nil
+	}
+
+	// The rotation has already been persisted, so a failure to delete the retired key is queued for retry rather
+	// than being treated as a failed rotation.
+	return b.revokeKey(ctx, storage, retired)
+}
+
+// abandonStaticKey deletes a key generated for a static role that was rotated or deleted while the key was being
+// generated. Once the key is deleted, or queued for deletion, its write-ahead log entry is no longer needed.
+func (b *Backend) abandonStaticKey(ctx context.Context, storage logical.Storage, walID, id string) {
+	if err := b.revokeKey(ctx, storage, id); err != nil {
+		b.Logger().Warn("failed to delete key of static role rotated elsewhere", "id", id, "error", err)
+		return
+	}
+
+	b.deleteKeyWAL(ctx, storage, walID)
+}
+
+// retirePreviousKey deletes the key replaced by the most recent rotation of the named static role once its overlap has
+// elapsed. A key that no longer exists in the Tailnet is treated as retired. The role is only updated if the key is
+// still its previous key.
+func (b *Backend) retirePreviousKey(ctx context.Context, storage logical.Storage, name, id string) error {
+	if err := b.deleteKey(ctx, storage, id); err != nil && !tailscale.IsNotFound(err) {
+		return err
+	}
+
+	b.staticMu.Lock()
+	defer b.staticMu.Unlock()
+
+	role, err := b.staticRole(ctx, storage, name)
+	if err != nil || role == nil || role.PreviousKeyID != id {
+		return err
+	}
+
+	role.PreviousKeyID = ""
+	role.PreviousKey = ""
+	role.PreviousValidUntil = time.Time{}
+
+	return b.saveStaticRole(ctx, storage, role)
+}
+
+// recordRotationFailure persists the failure state of a scheduled rotation on the role and emits a metric and event so
+// that stale shared keys are noticed.
+func (b *Backend) recordRotationFailure(ctx context.Context, storage logical.Storage, role *StaticRole, cause error) error {
+	role.RotationFailures++
+	role.LastRotationError = cause.Error()
+	role.LastRotationFailure = time.Now().UTC()
+
+	b.incrCounter(ctx, storage, []string{"static_role", "rotation", "failure"}, metrics.Label{Name: "role", Value: role.Name})
+	b.sendEvent(ctx, storage, "static-role-rotation-failed",
+		"name", role.Name,
+		"error", role.LastRotationError,
+		logical.EventMetadataDataPath, staticRolePrefix+role.Name,
+	)
+
+	return b.saveStaticRole(ctx, storage, role)
+}
+
+// deleteKey removes an authentication key from the Tailnet it was generated in, recording the outcome in the usage
+// counters.
+func (b *Backend) deleteKey(ctx context.Context, storage logical.Storage, id string) error {
+	return b.deleteKeyFrom(ctx, storage, "", id)
+}
+
+// deleteKeyFrom removes an authentication key from the Tailnet of the named configuration, as deleteKey does. If no
+// configuration is named, the key is removed from the Tailnet it was recorded as being generated in.
+func (b *Backend) deleteKeyFrom(ctx context.Context, storage logical.Storage, configName, id string) error {
+	config, err := b.revocationConfig(ctx, storage, configName, id)
+	if err != nil {
+		return err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return err
+	}
+
+	if err = client.DeleteKey(ctx, id); err != nil {
+		b.recordActivity(ctx, storage, Activity{
+			Type:    activityRevocation,
+			KeyID:   id,
+			Outcome: activityOutcomeFailure,
+			Error:   err.Error(),
+		})
+
+		b.notify(ctx, storage, eventKeyRevocationFailed, map[string]string{
+			"key_id": id,
+			"error":  err.Error(),
+		})
+
+		return err
+	}
+
+	b.recordUsage(ctx, storage, func(usage *Usage) {
+		usage.KeysRevoked++
+	})
+
+	b.recordActivity(ctx, storage, Activity{
+		Type:    activityRevocation,
+		KeyID:   id,
+		Outcome: activityOutcomeSuccess,
+	})
+
+	return nil
+}
+
+func (b *Backend) staticRole(ctx context.Context, storage logical.Storage, name string) (*StaticRole, error) {
+	entry, err := storage.Get(ctx, staticRolePrefix+name)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var role StaticRole
+	if err = entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (b *Backend) saveStaticRole(ctx context.Context, storage logical.Storage, role *StaticRole) error {
+	entry, err := logical.StorageEntryJSON(staticRolePrefix+role.Name, role)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func staticRoleResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": {
+			Type:        framework.TypeString,
+			Description: staticRoleNameDescription,
+		},
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: staticRoleTagsDescription,
+		},
+		"ephemeral": {
+			Type:        framework.TypeBool,
+			Description: staticRoleEphemeralDescription,
+		},
+		"preauthorized": {
+			Type:        framework.TypeBool,
+			Description: preauthorizedDescription,
+		},
+		"rotation_period": {
+			Type:        framework.TypeDurationSecond,
+			Description: rotationPeriodDescription,
+		},
+		"rotation_schedule": {
+			Type:        framework.TypeString,
+			Description: rotationScheduleDescription,
+		},
+		"rotation_window": {
+			Type:        framework.TypeDurationSecond,
+			Description: rotationWindowDescription,
+		},
+		"rotation_overlap": {
+			Type:        framework.TypeDurationSecond,
+			Description: rotationOverlapDescription,
+		},
+		"key_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the managed key",
+		},
+		"previous_key_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the key replaced by the last rotation, if it is still valid",
+		},
+		"last_rotated": {
+			Type:        framework.TypeTime,
+			Description: "When the managed key was last rotated",
+		},
+		"next_rotation": {
+			Type:        framework.TypeTime,
+			Description: "When the managed key will next be rotated",
+		},
+		"key_age": {
+			Type:        framework.TypeDurationSecond,
+			Description: "How long ago the managed key was generated",
+		},
+		"library": {
+			Type:        framework.TypeBool,
+			Description: libraryDescription,
+		},
+		"max_checkouts": {
+			Type:        framework.TypeInt,
+			Description: maxCheckoutsDescription,
+		},
+		"checkout_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: checkoutTTLDescription,
+		},
+		"rotation_failures": {
+			Type:        framework.TypeInt,
+			Description: "The number of consecutive failed rotations",
+		},
+		"last_rotation_error": {
+			Type:        framework.TypeString,
+			Description: "The error of the last failed rotation",
+		},
+		"last_rotation_failure": {
+			Type:        framework.TypeTime,
+			Description: "When the last rotation failed",
+		},
+	}
+}
+
+func staticCredsResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the managed key",
+		},
+		"key": {
+			Type:        framework.TypeString,
+			Description: "The managed authentication key",
+		},
+		"expires": {
+			Type:        framework.TypeTime,
+			Description: "When the managed key expires",
+		},
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: staticRoleTagsDescription,
+		},
+		"reusable": {
+			Type:        framework.TypeBool,
+			Description: "Always true, as the managed key is shared by every consumer",
+		},
+		"ephemeral": {
+			Type:        framework.TypeBool,
+			Description: staticRoleEphemeralDescription,
+		},
+		"preauthorized": {
+			Type:        framework.TypeBool,
+			Description: preauthorizedDescription,
+		},
+		"last_rotated": {
+			Type:        framework.TypeTime,
+			Description: "When the managed key was last rotated",
+		},
+		"next_rotation": {
+			Type:        framework.TypeTime,
+			Description: "When the managed key will next be rotated",
+		},
+		"key_age": {
+			Type:        framework.TypeDurationSecond,
+			Description: "How long ago the managed key was generated",
+		},
+		"previous": {
+			Type:        framework.TypeMap,
+			Description: "The id, key and valid_until of the key replaced by the last rotation, while it remains valid",
+		},
+	}
+}
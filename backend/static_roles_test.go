@@ -0,0 +1,441 @@
+package backend_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_StaticRoles(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		Data         map[string]interface{}
+		Expected     map[string]interface{}
+		ExpectsError bool
+	}{
+		{
+			Name: "It should create a static role and generate its key",
+			Data: map[string]interface{}{
+				"name":          "test",
+				"tags":          "tag:test",
+				"preauthorized": true,
+			},
+			Expected: map[string]interface{}{
+				"name":                  "test",
+				"tags":                  []string{"tag:test"},
+				"ephemeral":             false,
+				"preauthorized":         true,
+				"rotation_period":       int64(2592000),
+				"rotation_schedule":     "",
+				"rotation_window":       int64(0),
+				"key_id":                "key-1",
+				"library":               false,
+				"max_checkouts":         1,
+				"checkout_ttl":          int64(3600),
+				"rotation_failures":     0,
+				"last_rotation_error":   "",
+				"last_rotation_failure": time.Time{},
+			},
+		},
+		{
+			Name: "It should create a static role using a rotation schedule",
+			Data: map[string]interface{}{
+				"name":              "test",
+				"rotation_schedule": "0 2 * * SAT",
+				"rotation_window":   "2h",
+			},
+			Expected: map[string]interface{}{
+				"name":                  "test",
+				"tags":                  []string(nil),
+				"ephemeral":             false,
+				"preauthorized":         false,
+				"rotation_period":       int64(0),
+				"rotation_schedule":     "0 2 * * SAT",
+				"rotation_window":       int64(7200),
+				"key_id":                "key-1",
+				"library":               false,
+				"max_checkouts":         1,
+				"checkout_ttl":          int64(3600),
+				"rotation_failures":     0,
+				"last_rotation_error":   "",
+				"last_rotation_failure": time.Time{},
+			},
+		},
+		{
+			Name: "It should return an error if both a rotation period and schedule are provided",
+			Data: map[string]interface{}{
+				"name":              "test",
+				"rotation_period":   "24h",
+				"rotation_schedule": "0 2 * * *",
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error if the rotation schedule is invalid",
+			Data: map[string]interface{}{
+				"name":              "test",
+				"rotation_schedule": "not a schedule",
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error if a rotation window is provided without a schedule",
+			Data: map[string]interface{}{
+				"name":            "test",
+				"rotation_window": "1h",
+			},
+			ExpectsError: true,
+		},
+		{
+			Name: "It should return an error if the rotation period is too long",
+			Data: map[string]interface{}{
+				"name":            "test",
+				"rotation_period": "2400h",
+			},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			putConfig(t, ctx, storage)
+			api := mockKeysAPI(t)
+
+			request := requester(ctx, b, storage)
+
+			_, err := request(logical.UpdateOperation, "static-roles/test", tc.Data)
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			response, err := request(logical.ReadOperation, "static-roles/test", nil)
+			require.NoError(t, err)
+
+			lastRotated := response.Data["last_rotated"].(time.Time)
+			nextRotation := response.Data["next_rotation"].(time.Time)
+			assert.True(t, nextRotation.After(lastRotated))
+			assert.EqualValues(t, 0, response.Data["key_age"])
+
+			for k, v := range tc.Expected {
+				assert.EqualValues(t, v, response.Data[k], k)
+			}
+
+			response, err = request(logical.ReadOperation, "static-creds/test", nil)
+			require.NoError(t, err)
+			assert.EqualValues(t, "key-1", response.Data["id"])
+			assert.EqualValues(t, "secret-1", response.Data["key"])
+			assert.EqualValues(t, true, response.Data["reusable"])
+			assert.EqualValues(t, lastRotated, response.Data["last_rotated"])
+			assert.EqualValues(t, nextRotation, response.Data["next_rotation"])
+
+			_, err = request(logical.UpdateOperation, "rotate-role/test", nil)
+			require.NoError(t, err)
+
+			response, err = request(logical.ReadOperation, "static-roles/test", nil)
+			require.NoError(t, err)
+			assert.EqualValues(t, "key-2", response.Data["key_id"])
+			assert.EqualValues(t, []string{"key-1"}, api.Deleted())
+
+			response, err = request(logical.ReadOperation, "static-creds/test", nil)
+			require.NoError(t, err)
+			assert.EqualValues(t, "secret-2", response.Data["key"])
+
+			_, err = request(logical.DeleteOperation, "static-roles/test", nil)
+			require.NoError(t, err)
+
+			response, err = request(logical.ReadOperation, "static-roles/test", nil)
+			require.NoError(t, err)
+			assert.Nil(t, response)
+			assert.EqualValues(t, []string{"key-1", "key-2"}, api.Deleted())
+		})
+	}
+}
+
+func TestBackend_StaticRoleRotation(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"rotation_period": "1s",
+		},
+	})
+	require.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   storage,
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, []string{"key-1"}, api.Deleted())
+}
+
+func TestBackend_StaticRoleRotationFailure(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"rotation_period": "1s",
+		},
+	})
+	require.NoError(t, err)
+
+	api.SetFailing(true)
+	time.Sleep(time.Second)
+
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   storage,
+	})
+	require.Error(t, err)
+
+	response, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-roles/test",
+		Storage:   storage,
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, response.Data["rotation_failures"])
+	assert.Contains(t, response.Data["last_rotation_error"], "failed")
+	assert.EqualValues(t, "key-1", response.Data["key_id"])
+
+	api.SetFailing(false)
+
+	_, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   storage,
+	})
+	require.NoError(t, err)
+
+	response, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-roles/test",
+		Storage:   storage,
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, response.Data["rotation_failures"])
+	assert.EqualValues(t, "key-2", response.Data["key_id"])
+}
+
+func TestBackend_StaticRoleRotationWAL(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+	failing := requester(ctx, b, &failingPutStorage{Storage: storage, key: "static-roles/test"})
+
+	_, err := request(logical.UpdateOperation, "static-roles/test", nil)
+	require.NoError(t, err)
+
+	t.Run("It should delete the new key if the rotation cannot be saved", func(t *testing.T) {
+		_, err := failing(logical.UpdateOperation, "rotate-role/test", nil)
+		require.Error(t, err)
+
+		entries, err := framework.ListWAL(ctx, storage)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RollbackOperation,
+			Storage:   storage,
+			Data:      map[string]interface{}{"immediate": true},
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-2"}, api.Deleted())
+	})
+
+	t.Run("It should not leave write-ahead log entries once the rotation is saved", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "rotate-role/test", nil)
+		require.NoError(t, err)
+
+		entries, err := framework.ListWAL(ctx, storage)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestBackend_StaticRoleRotationOverlap(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "static-roles/test", map[string]interface{}{
+		"rotation_period":  "2s",
+		"rotation_overlap": "1s",
+	})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "rotate-role/test", nil)
+	require.NoError(t, err)
+
+	t.Run("It should return both the current and previous keys", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "static-creds/test", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "secret-2", response.Data["key"])
+
+		previous := response.Data["previous"].(map[string]interface{})
+		assert.EqualValues(t, "key-1", previous["id"])
+		assert.EqualValues(t, "secret-1", previous["key"])
+		assert.Empty(t, api.Deleted())
+	})
+
+	t.Run("It should delete the previous key once the overlap has elapsed", func(t *testing.T) {
+		time.Sleep(time.Second)
+
+		_, err = request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"key-1"}, api.Deleted())
+
+		response, err := request(logical.ReadOperation, "static-creds/test", nil)
+		require.NoError(t, err)
+		assert.NotContains(t, response.Data, "previous")
+	})
+}
+
+func TestBackend_StaticRoleMissingKeys(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.UpdateOperation, "static-roles/test", map[string]interface{}{"tags": "tag:test"})
+	require.NoError(t, err)
+
+	t.Run("It should delete a static role whose key no longer exists", func(t *testing.T) {
+		api.SetMissingKeys("key-1")
+
+		_, err := request(logical.DeleteOperation, "static-roles/test", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "static-roles/test", nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+
+	_, err = request(logical.UpdateOperation, "static-roles/overlap", map[string]interface{}{
+		"rotation_period":  "2s",
+		"rotation_overlap": "1s",
+	})
+	require.NoError(t, err)
+
+	_, err = request(logical.UpdateOperation, "rotate-role/overlap", nil)
+	require.NoError(t, err)
+
+	t.Run("It should retire a previous key that no longer exists", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "static-creds/overlap", nil)
+		require.NoError(t, err)
+
+		previous := response.Data["previous"].(map[string]interface{})
+		api.SetMissingKeys(previous["id"].(string))
+		time.Sleep(time.Second)
+
+		_, err = request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err = request(logical.ReadOperation, "static-creds/overlap", nil)
+		require.NoError(t, err)
+		assert.NotContains(t, response.Data, "previous")
+	})
+}
+
+func TestBackend_StaticRoleKeyExpiry(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	// A yearly schedule whose next run is months away outlives the expiry the key is generated with.
+	month := time.Now().AddDate(0, 6, 0).Month()
+	_, err := request(logical.UpdateOperation, "static-roles/test", map[string]interface{}{
+		"rotation_schedule": fmt.Sprintf("0 0 1 %d *", month),
+	})
+	require.NoError(t, err)
+
+	t.Run("It should schedule the next rotation before the key expires", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "static-creds/test", nil)
+		require.NoError(t, err)
+
+		expires := response.Data["expires"].(time.Time)
+		next := response.Data["next_rotation"].(time.Time)
+		assert.True(t, next.Before(expires), "next rotation %s is not before expiry %s", next, expires)
+	})
+
+	t.Run("It should rotate a key that is about to expire", func(t *testing.T) {
+		entry, err := storage.Get(ctx, "static-roles/test")
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+
+		var role backend.StaticRole
+		require.NoError(t, entry.DecodeJSON(&role))
+		role.Expires = time.Now().UTC().Add(time.Hour)
+
+		entry, err = logical.StorageEntryJSON("static-roles/test", role)
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+
+		_, err = request(logical.RollbackOperation, "", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "static-creds/test", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "key-2", response.Data["id"])
+		assert.EqualValues(t, []string{"key-1"}, api.Deleted())
+	})
+}
+
+// The failingPutStorage type wraps a logical.Storage so that storing the entry with the given key fails.
+type failingPutStorage struct {
+	logical.Storage
+	key string
+}
+
+func (s *failingPutStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if entry.Key == s.key {
+		return errors.New("storage unavailable")
+	}
+
+	return s.Storage.Put(ctx, entry)
+}
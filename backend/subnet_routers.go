@@ -0,0 +1,623 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The SubnetRouterConfig type describes the routes that subnet routers onboarded by the Backend may have
+	// approved.
+	SubnetRouterConfig struct {
+		AllowedRoutes []string `json:"allowed_routes"`
+		AutoApprove   bool     `json:"auto_approve"`
+	}
+
+	// The Onboarding type describes a subnet router being onboarded. Once a device joins the tailnet using the key
+	// generated for the onboarding, its advertised routes are approved against the allowed routes.
+	Onboarding struct {
+		ID            string    `json:"id"`
+		KeyID         string    `json:"key_id"`
+		Role          string    `json:"role"`
+		AllowedRoutes []string  `json:"allowed_routes"`
+		Status        string    `json:"status"`
+		Created       time.Time `json:"created"`
+		Expires       time.Time `json:"expires"`
+		DeviceID      string    `json:"device_id"`
+		Approved      []string  `json:"approved"`
+		Rejected      []string  `json:"rejected"`
+		Error         string    `json:"error"`
+	}
+)
+
+const (
+	subnetRouterConfigPath = "config/subnet-routers"
+	onboardingPrefix       = "onboarding/"
+	onboardingTTL          = time.Hour
+
+	onboardingPending  = "pending"
+	onboardingComplete = "complete"
+	onboardingExpired  = "expired"
+
+	readSubnetRouterConfigDescription   = "Read the subnet router onboarding configuration"
+	updateSubnetRouterConfigDescription = "Update the subnet router onboarding configuration"
+	deleteSubnetRouterConfigDescription = "Delete the subnet router onboarding configuration"
+	subnetRouterRoutesDescription       = "Routes in CIDR notation. Advertised routes that fall entirely inside any of them may be approved"
+	onboardSubnetRouterDescription      = "Generate a key for a subnet router and approve its advertised routes once it joins the tailnet"
+	readOnboardingDescription           = "Read the status of a subnet router onboarding"
+	onboardingIDDescription             = "The identifier of the onboarding"
+	onboardingRoleDescription           = "The name of a role whose settings are applied to the key"
+	onboardingRoutesDescription         = "Narrows the configured allowed routes for this subnet router. Each route must fall inside the configured allowed routes"
+	subnetRouterAutoApproveDescription  = "If true, allowed routes advertised by any device added with a key issued by the backend are approved periodically"
+
+	subnetRouterConfigHelpSynopsis    = "Configure which routes of subnet routers may be approved."
+	subnetRouterConfigHelpDescription = `
+Subnet routers onboarded using the backend have the routes they advertise approved once
+they join the tailnet, provided the routes fall entirely inside the allowed routes. If
+auto_approve is set, allowed routes advertised by any device added with an issued key
+are approved periodically.
+`
+	onboardSubnetRouterHelpSynopsis    = "Generate a key for a subnet router."
+	onboardSubnetRouterHelpDescription = `
+Generates a key for a subnet router and records an onboarding. Once a device joins the
+tailnet using the key, the routes it advertises that are allowed are approved. The
+status of the onboarding can be read using the returned onboarding_id.
+`
+	onboardingHelpSynopsis    = "Read the status of a subnet router onboarding."
+	onboardingHelpDescription = `
+Returns the status of a subnet router onboarding, including the device that joined the
+tailnet using its key and the routes that were approved and rejected. If the onboarding
+is pending, an attempt is made to complete it before returning.
+`
+)
+
+func (b *Backend) subnetRouterPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: subnetRouterConfigPath,
+			Fields: map[string]*framework.FieldSchema{
+				"allowed_routes": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: subnetRouterRoutesDescription,
+				},
+				"auto_approve": {
+					Type:        framework.TypeBool,
+					Description: subnetRouterAutoApproveDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadSubnetRouterConfiguration,
+					Responses: okResponse(readSubnetRouterConfigDescription, subnetRouterConfigResponseFields()),
+					Summary:   readSubnetRouterConfigDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateSubnetRouterConfiguration,
+					Responses: noContentResponse(),
+					Summary:   updateSubnetRouterConfigDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteSubnetRouterConfiguration,
+					Responses: noContentResponse(),
+					Summary:   deleteSubnetRouterConfigDescription,
+				},
+			},
+			HelpSynopsis:    subnetRouterConfigHelpSynopsis,
+			HelpDescription: subnetRouterConfigHelpDescription,
+		},
+		{
+			Pattern: "onboard/subnet-router$",
+			Fields: map[string]*framework.FieldSchema{
+				"role": {
+					Type:        framework.TypeString,
+					Description: onboardingRoleDescription,
+				},
+				"tags": {
+					Type:        framework.TypeStringSlice,
+					Description: tagsDescription,
+				},
+				"preauthorized": {
+					Type:        framework.TypeBool,
+					Description: preauthorizedDescription,
+				},
+				"allowed_routes": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: onboardingRoutesDescription,
+				},
+				"pgp_key": {
+					Type:        framework.TypeString,
+					Description: pgpKeyDescription,
+				},
+				"metadata": {
+					Type:        framework.TypeKVPairs,
+					Description: metadataDescription,
+				},
+				"labels": {
+					Type:        framework.TypeKVPairs,
+					Description: labelsDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.OnboardSubnetRouter,
+					Responses: okResponse(onboardSubnetRouterDescription, onboardResponseFields()),
+					Summary:   onboardSubnetRouterDescription,
+				},
+			},
+			HelpSynopsis:    onboardSubnetRouterHelpSynopsis,
+			HelpDescription: onboardSubnetRouterHelpDescription,
+		},
+		{
+			Pattern: "onboard/subnet-router/" + framework.GenericNameRegex("id"),
+			Fields: map[string]*framework.FieldSchema{
+				"id": {
+					Type:        framework.TypeString,
+					Description: onboardingIDDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadOnboarding,
+					Responses: okResponse(readOnboardingDescription, onboardingResponseFields()),
+					Summary:   readOnboardingDescription,
+				},
+			},
+			HelpSynopsis:    onboardingHelpSynopsis,
+			HelpDescription: onboardingHelpDescription,
+		},
+	}
+}
+
+// ReadSubnetRouterConfiguration returns the subnet router onboarding configuration.
+func (b *Backend) ReadSubnetRouterConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.subnetRouterConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case config == nil:
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed_routes": config.AllowedRoutes,
+			"auto_approve":   config.AutoApprove,
+		},
+	}, nil
+}
+
+// UpdateSubnetRouterConfiguration modifies the subnet router onboarding configuration. Returns an error if no routes
+// are provided or any are invalid.
+func (b *Backend) UpdateSubnetRouterConfiguration(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := SubnetRouterConfig{
+		AllowedRoutes: data.Get("allowed_routes").([]string),
+		AutoApprove:   data.Get("auto_approve").(bool),
+	}
+
+	if len(config.AllowedRoutes) == 0 {
+		return nil, errors.New("provided allowed_routes cannot be empty")
+	}
+
+	if _, err := parseRoutes(config.AllowedRoutes); err != nil {
+		return nil, fmt.Errorf("provided allowed_routes are invalid: %w", err)
+	}
+
+	entry, err := logical.StorageEntryJSON(subnetRouterConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = request.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteSubnetRouterConfiguration removes the subnet router onboarding configuration.
+func (b *Backend) DeleteSubnetRouterConfiguration(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := request.Storage.Delete(ctx, subnetRouterConfigPath); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// OnboardSubnetRouter generates a key for a subnet router using the given role, subject to the same checks as the
+// creds path, and records an onboarding. Once a device joins the tailnet using the key, its advertised routes that
+// fall inside the allowed routes are approved. The onboarding expires if no device joins within an hour.
+func (b *Backend) OnboardSubnetRouter(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	routers, err := b.subnetRouterConfig(ctx, request.Storage)
+	switch {
+	case err != nil:
+		return nil, err
+	case routers == nil:
+		return nil, errors.New("subnet router onboarding has not been configured")
+	}
+
+	configured, err := parseRoutes(routers.AllowedRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedRoutes := routers.AllowedRoutes
+	if routes, ok := data.GetOk("allowed_routes"); ok && len(routes.([]string)) > 0 {
+		allowedRoutes = routes.([]string)
+		if _, err = parseRoutes(allowedRoutes); err != nil {
+			return nil, fmt.Errorf("provided allowed_routes are invalid: %w", err)
+		}
+
+		for _, route := range allowedRoutes {
+			if !routeAllowed(route, configured) {
+				return nil, fmt.Errorf("provided route %q is not within the configured allowed routes", route)
+			}
+		}
+	}
+
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var role *Role
+	if name := data.Get("role").(string); name != "" {
+		role, err = b.role(ctx, request.Storage, name)
+		switch {
+		case err != nil:
+			return nil, err
+		case role == nil:
+			return nil, fmt.Errorf("role %q does not exist", name)
+		}
+	} else if role, err = b.defaultRole(ctx, request.Storage, config); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := b.issueKey(ctx, request, data, config, role, "")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	onboarding := &Onboarding{
+		ID:            id,
+		KeyID:         leasedKeyID(response),
+		Role:          role.Name,
+		AllowedRoutes: allowedRoutes,
+		Status:        onboardingPending,
+		Created:       now,
+		Expires:       now.Add(onboardingTTL),
+	}
+
+	if err = b.saveOnboarding(ctx, request.Storage, onboarding); err != nil {
+		return nil, err
+	}
+
+	response.Data["onboarding_id"] = onboarding.ID
+	return response, nil
+}
+
+// ReadOnboarding returns the status of a subnet router onboarding. If the onboarding is pending, an attempt is made to
+// complete it before returning.
+func (b *Backend) ReadOnboarding(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	onboarding, err := b.onboarding(ctx, request.Storage, data.Get("id").(string))
+	switch {
+	case err != nil:
+		return nil, err
+	case onboarding == nil:
+		return nil, nil
+	}
+
+	if onboarding.Status == onboardingPending {
+		if err = b.completeOnboarding(ctx, request.Storage, onboarding); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":             onboarding.ID,
+			"key_id":         onboarding.KeyID,
+			"role":           onboarding.Role,
+			"allowed_routes": onboarding.AllowedRoutes,
+			"status":         onboarding.Status,
+			"created":        onboarding.Created,
+			"expires":        onboarding.Expires,
+			"device_id":      onboarding.DeviceID,
+			"approved":       onboarding.Approved,
+			"rejected":       onboarding.Rejected,
+			"error":          onboarding.Error,
+		},
+	}, nil
+}
+
+// completeOnboardings attempts to complete all pending subnet router onboardings. Completed and expired onboardings
+// are removed once a day has passed since they expired. Nothing is done while the backend is in read-only mode.
+func (b *Backend) completeOnboardings(ctx context.Context, storage logical.Storage) error {
+	ids, err := storage.List(ctx, onboardingPrefix)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	config, err := b.config(ctx, storage)
+	if err != nil || config.ReadOnly {
+		// Routes cannot be approved until the mount is configured and writable.
+		return nil
+	}
+
+	var errs *multierror.Error
+	now := time.Now()
+	for _, id := range ids {
+		onboarding, err := b.onboarding(ctx, storage, id)
+		switch {
+		case err != nil:
+			errs = multierror.Append(errs, err)
+			continue
+		case onboarding == nil:
+			continue
+		case onboarding.Status != onboardingPending:
+			if now.After(onboarding.Expires.Add(24 * time.Hour)) {
+				errs = multierror.Append(errs, storage.Delete(ctx, onboardingPrefix+id))
+			}
+			continue
+		}
+
+		errs = multierror.Append(errs, b.completeOnboarding(ctx, storage, onboarding))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// completeOnboarding looks for the device that joined the tailnet using the onboarding's key and approves its
+// advertised routes that fall inside the onboarding's allowed routes. Onboardings whose key has not been used within
+// an hour are marked as expired.
+func (b *Backend) completeOnboarding(ctx context.Context, storage logical.Storage, onboarding *Onboarding) error {
+	if time.Now().After(onboarding.Expires) {
+		onboarding.Status = onboardingExpired
+		return b.saveOnboarding(ctx, storage, onboarding)
+	}
+
+	issued, err := b.issuedKey(ctx, storage, onboarding.KeyID)
+	switch {
+	case err != nil:
+		return err
+	case issued == nil:
+		return fmt.Errorf("key %q of onboarding %q was not recorded", onboarding.KeyID, onboarding.ID)
+	}
+
+	config, err := b.config(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return err
+	}
+
+	err = b.checkMaintenance(ctx, storage)
+	switch {
+	case errors.Is(err, ErrMaintenance):
+		// Routes are approved once the maintenance window ends, so the onboarding remains pending.
+		return nil
+	case err != nil:
+		return err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	device, ok := issued.matchDevice(devices)
+	if !ok {
+		return nil
+	}
+
+	allowed, err := parseRoutes(onboarding.AllowedRoutes)
+	if err != nil {
+		return err
+	}
+
+	_, approved, rejected, err := approveRoutes(ctx, client, device.ID, allowed)
+	if err != nil {
+		onboarding.Error = err.Error()
+		if saveErr := b.saveOnboarding(ctx, storage, onboarding); saveErr != nil {
+			return saveErr
+		}
+
+		return err
+	}
+
+	onboarding.Status = onboardingComplete
+	onboarding.DeviceID = device.ID
+	onboarding.Approved = approved
+	onboarding.Rejected = rejected
+	onboarding.Error = ""
+
+	return b.saveOnboarding(ctx, storage, onboarding)
+}
+
+// autoApproveRoutes approves the allowed routes advertised by devices added to the tailnet using keys issued by the
+// Backend, if enabled on the subnet router configuration. Devices are identified using the records of issued keys.
+// Nothing is done while the backend is in read-only mode or during a maintenance window.
+func (b *Backend) autoApproveRoutes(ctx context.Context, storage logical.Storage) error {
+	routers, err := b.subnetRouterConfig(ctx, storage)
+	if err != nil || routers == nil || !routers.AutoApprove {
+		return err
+	}
+
+	config, err := b.config(ctx, storage)
+	if err != nil || config.ReadOnly {
+		return nil
+	}
+
+	if err = b.checkMaintenance(ctx, storage); err != nil {
+		return nil
+	}
+
+	allowed, err := parseRoutes(routers.AllowedRoutes)
+	if err != nil {
+		return err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return err
+	}
+
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	issued, err := b.issuedDevices(ctx, storage, devices)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	for _, device := range issued {
+		_, approved, _, err := approveRoutes(ctx, client, device.ID, allowed)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to approve routes of device %q: %w", device.ID, err))
+			continue
+		}
+
+		if len(approved) > 0 {
+			b.Logger().Info("approved advertised routes", "device_id", device.ID, "routes", approved)
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (b *Backend) saveOnboarding(ctx context.Context, storage logical.Storage, onboarding *Onboarding) error {
+	entry, err := logical.StorageEntryJSON(onboardingPrefix+onboarding.ID, onboarding)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *Backend) onboarding(ctx context.Context, storage logical.Storage, id string) (*Onboarding, error) {
+	entry, err := storage.Get(ctx, onboardingPrefix+id)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var onboarding Onboarding
+	if err = entry.DecodeJSON(&onboarding); err != nil {
+		return nil, err
+	}
+
+	return &onboarding, nil
+}
+
+func (b *Backend) subnetRouterConfig(ctx context.Context, storage logical.Storage) (*SubnetRouterConfig, error) {
+	entry, err := storage.Get(ctx, subnetRouterConfigPath)
+	switch {
+	case err != nil:
+		return nil, err
+	case entry == nil:
+		return nil, nil
+	}
+
+	var config SubnetRouterConfig
+	if err = entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func subnetRouterConfigResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"allowed_routes": {
+			Type:        framework.TypeStringSlice,
+			Description: subnetRouterRoutesDescription,
+		},
+		"auto_approve": {
+			Type:        framework.TypeBool,
+			Description: subnetRouterAutoApproveDescription,
+		},
+	}
+}
+
+func onboardResponseFields() map[string]*framework.FieldSchema {
+	fields := keyResponseFields()
+	fields["onboarding_id"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: onboardingIDDescription,
+	}
+
+	return fields
+}
+
+func onboardingResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"id": {
+			Type:        framework.TypeString,
+			Description: onboardingIDDescription,
+		},
+		"key_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the key generated for the subnet router",
+		},
+		"role": {
+			Type:        framework.TypeString,
+			Description: onboardingRoleDescription,
+		},
+		"allowed_routes": {
+			Type:        framework.TypeStringSlice,
+			Description: "The routes that may be approved for the subnet router",
+		},
+		"status": {
+			Type:        framework.TypeString,
+			Description: "The status of the onboarding, either pending, complete or expired",
+		},
+		"created": {
+			Type:        framework.TypeTime,
+			Description: "When the onboarding was created",
+		},
+		"expires": {
+			Type:        framework.TypeTime,
+			Description: "When the onboarding expires if no device joins the tailnet",
+		},
+		"device_id": {
+			Type:        framework.TypeString,
+			Description: "The identifier of the device that joined the tailnet using the key",
+		},
+		"approved": {
+			Type:        framework.TypeStringSlice,
+			Description: "The advertised routes that were approved",
+		},
+		"rejected": {
+			Type:        framework.TypeStringSlice,
+			Description: "The advertised routes that are not allowed",
+		},
+		"error": {
+			Type:        framework.TypeString,
+			Description: "Why the onboarding failed",
+		},
+	}
+}
@@ -0,0 +1,127 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestBackend_OnboardSubnetRouter(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should return an error if onboarding is not configured", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "onboard/subnet-router", map[string]interface{}{
+			"tags": []string{"tag:router"},
+		})
+		assert.Error(t, err)
+	})
+
+	_, err := request(logical.UpdateOperation, "config/subnet-routers", map[string]interface{}{
+		"allowed_routes": "10.0.0.0/8",
+	})
+	require.NoError(t, err)
+
+	t.Run("It should return an error if the requested routes are not within the configured routes", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "onboard/subnet-router", map[string]interface{}{
+			"tags":           []string{"tag:router"},
+			"allowed_routes": "192.168.0.0/24",
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("It should approve the allowed routes once the device joins", func(t *testing.T) {
+		response, err := request(logical.UpdateOperation, "onboard/subnet-router", map[string]interface{}{
+			"tags":           []string{"tag:router"},
+			"allowed_routes": "10.1.0.0/16",
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, response.Data["key"])
+
+		id := response.Data["onboarding_id"].(string)
+		path := "onboard/subnet-router/" + id
+
+		response, err = request(logical.ReadOperation, path, nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "pending", response.Data["status"])
+
+		api.SetDevices(tailscale.Device{
+			ID:      "router",
+			Tags:    []string{"tag:router"},
+			Created: tailscale.Time{Time: time.Now().Add(time.Minute)},
+		})
+		api.SetRoutes("router", []string{"10.1.2.0/24", "10.2.0.0/16"}, nil)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{Operation: logical.RollbackOperation, Storage: storage})
+		require.NoError(t, err)
+
+		response, err = request(logical.ReadOperation, path, nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "complete", response.Data["status"])
+		assert.EqualValues(t, "router", response.Data["device_id"])
+		assert.EqualValues(t, []string{"10.1.2.0/24"}, response.Data["approved"])
+		assert.EqualValues(t, []string{"10.2.0.0/16"}, response.Data["rejected"])
+		assert.EqualValues(t, []string{"10.1.2.0/24"}, api.Routes("router").Enabled)
+	})
+
+	t.Run("It should return nil for an unknown onboarding", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "onboard/subnet-router/unknown", nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+}
+
+func TestBackend_AutoApproveRoutes(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	request := requester(ctx, b, storage)
+
+	_, err := request(logical.ReadOperation, "key", map[string]interface{}{
+		"tags": []string{"tag:router"},
+	})
+	require.NoError(t, err)
+
+	api.SetDevices(
+		tailscale.Device{ID: "router", Tags: []string{"tag:router"}, Created: tailscale.Time{Time: time.Now().Add(time.Minute)}},
+		tailscale.Device{ID: "other", Tags: []string{"tag:other"}, Created: tailscale.Time{Time: time.Now().Add(time.Minute)}},
+	)
+	api.SetRoutes("router", []string{"10.1.0.0/16", "192.168.0.0/24"}, nil)
+	api.SetRoutes("other", []string{"10.2.0.0/16"}, nil)
+
+	t.Run("It should not approve routes unless enabled", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/subnet-routers", map[string]interface{}{
+			"allowed_routes": "10.0.0.0/8",
+		})
+		require.NoError(t, err)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{Operation: logical.RollbackOperation, Storage: storage})
+		require.NoError(t, err)
+		assert.Empty(t, api.Routes("router").Enabled)
+	})
+
+	t.Run("It should approve allowed routes of devices added with issued keys", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "config/subnet-routers", map[string]interface{}{
+			"allowed_routes": "10.0.0.0/8",
+			"auto_approve":   true,
+		})
+		require.NoError(t, err)
+
+		_, err = b.HandleRequest(ctx, &logical.Request{Operation: logical.RollbackOperation, Storage: storage})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"10.1.0.0/16"}, api.Routes("router").Enabled)
+		assert.Empty(t, api.Routes("other").Enabled)
+	})
+}
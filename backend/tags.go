@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tagName matches a valid Tailscale tag, which must start with a letter and may only contain letters, numbers and
+// dashes.
+var tagName = regexp.MustCompile(`^tag:[a-z][a-z0-9-]*$`)
+
+// normalizeTags returns the tags in the form expected by the Tailscale API, adding the "tag:" prefix to those without
+// it and converting them to lower case. In strict mode, tags are never modified and an error is returned for any tag
+// not already in that form. Returns an error if any tag is not a valid Tailscale tag once normalized.
+func normalizeTags(tags []string, strict bool) ([]string, error) {
+	if len(tags) == 0 {
+		return tags, nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag, strict)
+		if err != nil {
+			return nil, err
+		}
+
+		normalized = mergeTags(normalized, tag)
+	}
+
+	return normalized, nil
+}
+
+func normalizeTag(tag string, strict bool) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+	if !strings.HasPrefix(normalized, "tag:") {
+		normalized = "tag:" + normalized
+	}
+
+	switch {
+	case !tagName.MatchString(normalized):
+		return "", fmt.Errorf("tag %q is invalid, tags must start with a letter and may only contain letters, numbers and dashes", tag)
+	case strict && normalized != tag:
+		return "", fmt.Errorf("tag %q is malformed, did you mean %q?", tag, normalized)
+	}
+
+	return normalized, nil
+}
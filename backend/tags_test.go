@@ -0,0 +1,86 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_TagNormalization(t *testing.T) {
+	ctx, b := setup(t)
+
+	tt := []struct {
+		Name         string
+		Strict       bool
+		Tags         []string
+		ExpectedTags []string
+		ExpectsError bool
+	}{
+		{
+			Name:         "It should add the tag prefix and convert tags to lower case",
+			Tags:         []string{"ci", "tag:Server", " tag:db "},
+			ExpectedTags: []string{"tag:ci", "tag:server", "tag:db"},
+		},
+		{
+			Name:         "It should remove tags that are duplicates once normalized",
+			Tags:         []string{"ci", "tag:ci"},
+			ExpectedTags: []string{"tag:ci"},
+		},
+		{
+			Name:         "It should accept well-formed tags in strict mode",
+			Strict:       true,
+			Tags:         []string{"tag:ci"},
+			ExpectedTags: []string{"tag:ci"},
+		},
+		{
+			Name:         "It should return an error for malformed tags in strict mode",
+			Strict:       true,
+			Tags:         []string{"tag:CI"},
+			ExpectsError: true,
+		},
+		{
+			Name:         "It should return an error for invalid tags",
+			Tags:         []string{"tag:ci_runner"},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			storage := &logical.InmemStorage{}
+			api := mockKeysAPI(t)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config",
+				Storage:   storage,
+				Data: map[string]interface{}{
+					"tailnet":     "example",
+					"api_key":     "example",
+					"api_url":     "http://localhost:1337",
+					"issuer_tag":  "",
+					"strict_tags": tc.Strict,
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "key",
+				Storage:   storage,
+				Data:      map[string]interface{}{"tags": tc.Tags},
+			})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				assert.Empty(t, api.Requests())
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, api.Requests(), 1)
+			assert.EqualValues(t, tc.ExpectedTags, api.Requests()[0].Capabilities.Devices.Create.Tags)
+		})
+	}
+}
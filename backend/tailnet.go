@@ -0,0 +1,246 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The TailnetSettings type describes the settings of the tailnet managed by the Backend.
+	TailnetSettings struct {
+		NetworkFlowLoggingOn bool `json:"networkFlowLoggingOn"`
+	}
+
+	// The Contact type describes one of the contacts of the tailnet.
+	Contact struct {
+		Email             string `json:"email"`
+		FallbackEmail     string `json:"fallbackEmail"`
+		NeedsVerification bool   `json:"needsVerification"`
+	}
+)
+
+const (
+	readFlowLogsDescription    = "Read whether network flow logging is enabled for the tailnet"
+	updateFlowLogsDescription  = "Enable or disable network flow logging for the tailnet"
+	flowLogsEnabledDescription = "If true, network flow logging is enabled for the tailnet"
+	readContactsDescription    = "Read the account, support and security contacts of the tailnet"
+	updateContactDescription   = "Update one of the contacts of the tailnet"
+	contactTypeDescription     = "The type of contact, one of account, support or security"
+	contactEmailDescription    = "The email address of the contact"
+
+	flowLogsHelpSynopsis    = "Enable or disable network flow logging for the tailnet."
+	flowLogsHelpDescription = `
+Reads or changes whether the tailnet logs the network flows between its devices.
+`
+	contactsHelpSynopsis    = "Read the contacts of the tailnet."
+	contactsHelpDescription = `
+Returns the account, support and security contacts of the tailnet, including whether
+each email address still needs to be verified.
+`
+	contactHelpSynopsis    = "Update one of the contacts of the tailnet."
+	contactHelpDescription = `
+Sets the email address of the account, support or security contact of the tailnet.
+Tailscale sends a verification email to the new address.
+`
+)
+
+func (b *Backend) tailnetPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "tailnet/network-flow-logs",
+			Fields: map[string]*framework.FieldSchema{
+				"enabled": {
+					Type:        framework.TypeBool,
+					Description: flowLogsEnabledDescription,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadNetworkFlowLogs,
+					Responses: okResponse(readFlowLogsDescription, flowLogsResponseFields()),
+					Summary:   readFlowLogsDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateNetworkFlowLogs,
+					Responses: noContentResponse(),
+					Summary:   updateFlowLogsDescription,
+				},
+			},
+			HelpSynopsis:    flowLogsHelpSynopsis,
+			HelpDescription: flowLogsHelpDescription,
+		},
+		{
+			Pattern: "tailnet/contacts/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadContacts,
+					Responses: okResponse(readContactsDescription, contactsResponseFields()),
+					Summary:   readContactsDescription,
+				},
+			},
+			HelpSynopsis:    contactsHelpSynopsis,
+			HelpDescription: contactsHelpDescription,
+		},
+		{
+			Pattern: "tailnet/contacts/" + framework.GenericNameRegex("type"),
+			Fields: map[string]*framework.FieldSchema{
+				"type": {
+					Type:          framework.TypeString,
+					Description:   contactTypeDescription,
+					AllowedValues: []interface{}{"account", "support", "security"},
+				},
+				"email": {
+					Type:        framework.TypeString,
+					Description: contactEmailDescription,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateContact,
+					Responses: noContentResponse(),
+					Summary:   updateContactDescription,
+				},
+			},
+			HelpSynopsis:    contactHelpSynopsis,
+			HelpDescription: contactHelpDescription,
+		},
+	}
+}
+
+// ReadContacts returns the account, support and security contacts of the tailnet.
+func (b *Backend) ReadContacts(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var contacts map[string]Contact
+	if err = b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("contacts"), nil, nil, &contacts); err != nil {
+		return nil, fmt.Errorf("failed to read tailnet contacts: %w", err)
+	}
+
+	data := make(map[string]interface{}, len(contacts))
+	for kind, contact := range contacts {
+		data[kind] = map[string]interface{}{
+			"email":              contact.Email,
+			"fallback_email":     contact.FallbackEmail,
+			"needs_verification": contact.NeedsVerification,
+		}
+	}
+
+	return &logical.Response{Data: data}, nil
+}
+
+// UpdateContact sets the email address of one of the contacts of the tailnet. Tailscale sends a verification email to
+// the new address. Returns an error if the backend is in read-only mode or during a maintenance window.
+func (b *Backend) UpdateContact(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	kind := data.Get("type").(string)
+	email := data.Get("email").(string)
+
+	switch kind {
+	case "account", "support", "security":
+	default:
+		return nil, fmt.Errorf("provided type %q must be one of account, support or security", kind)
+	}
+
+	if _, err = mail.ParseAddress(email); err != nil {
+		return nil, fmt.Errorf("provided email is invalid: %w", err)
+	}
+
+	body := map[string]string{"email": email}
+	if err = b.apiRequest(ctx, config, http.MethodPatch, config.tailnetURI("contacts", kind), nil, body, nil); err != nil {
+		return nil, fmt.Errorf("failed to update tailnet contact: %w", err)
+	}
+
+	return &logical.Response{}, nil
+}
+
+// ReadNetworkFlowLogs returns whether network flow logging is enabled for the tailnet.
+func (b *Backend) ReadNetworkFlowLogs(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings TailnetSettings
+	if err = b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("settings"), nil, nil, &settings); err != nil {
+		return nil, fmt.Errorf("failed to read tailnet settings: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled": settings.NetworkFlowLoggingOn,
+		},
+	}, nil
+}
+
+// UpdateNetworkFlowLogs enables or disables network flow logging for the tailnet. Returns an error if the backend is
+// in read-only mode or during a maintenance window.
+func (b *Backend) UpdateNetworkFlowLogs(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	enabled, ok := data.GetOk("enabled")
+	if !ok {
+		return nil, errors.New("enabled must be provided")
+	}
+
+	settings := TailnetSettings{NetworkFlowLoggingOn: enabled.(bool)}
+	if err = b.apiRequest(ctx, config, http.MethodPatch, config.tailnetURI("settings"), nil, settings, nil); err != nil {
+		return nil, fmt.Errorf("failed to update tailnet settings: %w", err)
+	}
+
+	return &logical.Response{}, nil
+}
+
+func flowLogsResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"enabled": {
+			Type:        framework.TypeBool,
+			Description: flowLogsEnabledDescription,
+		},
+	}
+}
+
+func contactsResponseFields() map[string]*framework.FieldSchema {
+	fields := make(map[string]*framework.FieldSchema, 3)
+	for _, kind := range []string{"account", "support", "security"} {
+		fields[kind] = &framework.FieldSchema{
+			Type:        framework.TypeMap,
+			Description: "The email, fallback_email and needs_verification of the " + kind + " contact",
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,130 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_NetworkFlowLogs(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+
+	var (
+		mu       sync.Mutex
+		settings = map[string]interface{}{"networkFlowLoggingOn": false}
+	)
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.EqualValues(t, "/api/v2/tailnet/example/settings", r.URL.Path)
+		if r.Method == http.MethodPatch {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&settings))
+		}
+
+		assert.NoError(t, json.NewEncoder(w).Encode(settings))
+	})
+
+	request := func(operation logical.Operation, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: operation,
+			Path:      "tailnet/network-flow-logs",
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+
+	t.Run("It should read whether network flow logging is enabled", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, false, response.Data["enabled"])
+	})
+
+	t.Run("It should enable network flow logging", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, map[string]interface{}{
+			"enabled": true,
+		})
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, true, response.Data["enabled"])
+	})
+
+	t.Run("It should return an error if enabled is not provided", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestBackend_Contacts(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+
+	var (
+		mu       sync.Mutex
+		contacts = map[string]map[string]interface{}{
+			"account":  {"email": "account@example.com"},
+			"support":  {"email": "support@example.com"},
+			"security": {"email": "security@example.com"},
+		}
+	)
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method == http.MethodPatch {
+			kind := r.URL.Path[len("/api/v2/tailnet/example/contacts/"):]
+
+			var body map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			body["needsVerification"] = true
+			contacts[kind] = body
+			return
+		}
+
+		assert.EqualValues(t, "/api/v2/tailnet/example/contacts", r.URL.Path)
+		assert.NoError(t, json.NewEncoder(w).Encode(contacts))
+	})
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should read the tailnet contacts", func(t *testing.T) {
+		response, err := request(logical.ReadOperation, "tailnet/contacts", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "security@example.com", response.Data["security"].(map[string]interface{})["email"])
+	})
+
+	t.Run("It should update a tailnet contact", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "tailnet/contacts/security", map[string]interface{}{
+			"email": "secops@example.com",
+		})
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "tailnet/contacts", nil)
+		require.NoError(t, err)
+
+		security := response.Data["security"].(map[string]interface{})
+		assert.EqualValues(t, "secops@example.com", security["email"])
+		assert.EqualValues(t, true, security["needs_verification"])
+	})
+
+	t.Run("It should return an error for an unknown contact type", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "tailnet/contacts/billing", map[string]interface{}{
+			"email": "billing@example.com",
+		})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	metricPrefix = "tailscale"
+	eventPrefix  = "tailscale/"
+
+	maxMetricLabels = 16
+)
+
+var (
+	// reservedMetricLabels contains the names of labels set by the Backend itself, which cannot be configured.
+	reservedMetricLabels = []string{"role"}
+
+	// metricLabelName matches the names of labels that are valid across metric sinks.
+	metricLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// incrCounter increments the named counter metric, prefixing its key with the name of the plugin. The configured
+// metric labels are added to the given labels.
+func (b *Backend) incrCounter(ctx context.Context, storage logical.Storage, key []string, labels ...metrics.Label) {
+	labels = append(labels, b.metricLabels(ctx, storage)...)
+	metrics.IncrCounterWithLabels(append([]string{metricPrefix}, key...), 1, labels)
+}
+
+// setGauge sets the named gauge metric, prefixing its key with the name of the plugin. The configured metric labels
+// are added to the given labels.
+func (b *Backend) setGauge(ctx context.Context, storage logical.Storage, key []string, value float32, labels ...metrics.Label) {
+	labels = append(labels, b.metricLabels(ctx, storage)...)
+	metrics.SetGaugeWithLabels(append([]string{metricPrefix}, key...), value, labels)
+}
+
+// sendEvent publishes an event of the given type to Vault's event system. The metadata is provided as key/value
+// pairs, to which the configured metric labels are added. Events are best-effort, failures to send them are logged
+// and otherwise ignored.
+func (b *Backend) sendEvent(ctx context.Context, storage logical.Storage, eventType string, metadataPairs ...string) {
+	for _, label := range b.metricLabels(ctx, storage) {
+		metadataPairs = append(metadataPairs, label.Name, label.Value)
+	}
+
+	err := logical.SendEvent(ctx, b, eventPrefix+eventType, metadataPairs...)
+	switch {
+	case errors.Is(err, framework.ErrNoEvents):
+		return
+	case err != nil:
+		b.Logger().Warn("failed to send event", "type", eventType, "error", err)
+	}
+}
+
+// metricLabels returns the configured metric labels, sorted by name. No labels are returned if the mount has not
+// been configured.
+func (b *Backend) metricLabels(ctx context.Context, storage logical.Storage) []metrics.Label {
+	config, err := b.config(ctx, storage)
+	if err != nil || len(config.MetricLabels) == 0 {
+		return nil
+	}
+
+	labels := make([]metrics.Label, 0, len(config.MetricLabels))
+	for name, value := range config.MetricLabels {
+		labels = append(labels, metrics.Label{Name: name, Value: value})
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+
+	return labels
+}
+
+// validateMetricLabels returns an error if there are more than 16 labels, or any label name is not a valid metric
+// label name or is set by the Backend itself.
+func validateMetricLabels(labels map[string]string) error {
+	if len(labels) > maxMetricLabels {
+		return fmt.Errorf("provided metric_labels cannot contain more than %d labels", maxMetricLabels)
+	}
+
+	for name := range labels {
+		switch {
+		case !metricLabelName.MatchString(name):
+			return fmt.Errorf("provided metric label %q may only contain letters, digits and underscores and "+
+				"cannot start with a digit", name)
+		case strutil.StrListContains(reservedMetricLabels, name):
+			return fmt.Errorf("provided metric label %q is reserved", name)
+		}
+	}
+
+	return nil
+}
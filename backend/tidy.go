@@ -0,0 +1,277 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	defaultTidySafetyBuffer = 72 * time.Hour
+
+	tidyDescription             = "Remove stale records of issued keys, write-ahead log entries, accessors and counters from storage"
+	tidyIssuedKeysDescription   = "If true, the records of keys that expired or were revoked before the safety buffer are deleted"
+	tidyWALDescription          = "If true, keys whose write-ahead log entries are older than the safety buffer are deleted from the tailnet and the entries removed"
+	tidyAccessorsDescription    = "If true, accessors that no longer refer to the record of an issued key are deleted"
+	tidyUsageDescription        = "If true, the aggregate usage counters are reset"
+	tidySafetyBufferDescription = "How long ago a record must have expired, been revoked or been written before it is removed. Defaults to 72 hours"
+	tidyDryRunDescription       = "If true, what would be removed is reported without modifying storage"
+	tidyHelpSynopsis            = "Remove stale records from storage."
+	tidyHelpDescription         = `
+Removes stale records from storage, reporting what was removed. The records of issued
+keys are deleted once the keys expired or were revoked longer ago than the safety
+buffer. Keys whose write-ahead log entries are older than the safety buffer were
+generated but never returned, so they are deleted from the tailnet before the entries
+are removed. Accessors that no longer refer to a record are deleted. The usage counters
+are only reset if requested. With dry_run set, nothing is modified.
+`
+)
+
+func (b *Backend) tidyPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "tidy$",
+			Fields: map[string]*framework.FieldSchema{
+				"tidy_issued_keys": {
+					Type:        framework.TypeBool,
+					Description: tidyIssuedKeysDescription,
+					Default:     true,
+				},
+				"tidy_wal": {
+					Type:        framework.TypeBool,
+					Description: tidyWALDescription,
+					Default:     true,
+				},
+				"tidy_accessors": {
+					Type:        framework.TypeBool,
+					Description: tidyAccessorsDescription,
+					Default:     true,
+				},
+				"tidy_usage": {
+					Type:        framework.TypeBool,
+					Description: tidyUsageDescription,
+				},
+				"safety_buffer": {
+					Type:        framework.TypeDurationSecond,
+					Description: tidySafetyBufferDescription,
+					Default:     int(defaultTidySafetyBuffer.Seconds()),
+				},
+				"dry_run": {
+					Type:        framework.TypeBool,
+					Description: tidyDryRunDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.Tidy,
+					Responses: okResponse(tidyDescription, tidyResponseFields()),
+					Summary:   tidyDescription,
+				},
+			},
+			HelpSynopsis:    tidyHelpSynopsis,
+			HelpDescription: tidyHelpDescription,
+		},
+	}
+}
+
+// Tidy removes stale records from storage, returning how many of each were removed. Records of issued keys, along
+// with their accessors, are removed once the keys expired or were revoked before the safety buffer. Write-ahead log
+// entries older than the safety buffer are rolled back, deleting their keys from the tailnet. If dry_run is set, the
+// records that would be removed are counted without modifying storage.
+func (b *Backend) Tidy(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	safetyBuffer := time.Duration(data.Get("safety_buffer").(int)) * time.Second
+	dryRun := data.Get("dry_run").(bool)
+	cutoff := time.Now().Add(-safetyBuffer)
+
+	var (
+		errs     *multierror.Error
+		response = map[string]interface{}{
+			"issued_keys_deleted": 0,
+			"wal_rolled_back":     0,
+			"accessors_deleted":   0,
+			"usage_reset":         false,
+			"dry_run":             dryRun,
+		}
+	)
+
+	if data.Get("tidy_issued_keys").(bool) {
+		deleted, err := b.tidyIssuedKeys(ctx, request.Storage, cutoff, dryRun)
+		errs = multierror.Append(errs, err)
+		response["issued_keys_deleted"] = deleted
+	}
+
+	if data.Get("tidy_wal").(bool) {
+		rolledBack, err := b.tidyWAL(ctx, request, cutoff, dryRun)
+		errs = multierror.Append(errs, err)
+		response["wal_rolled_back"] = rolledBack
+	}
+
+	if data.Get("tidy_accessors").(bool) {
+		deleted, err := b.tidyAccessors(ctx, request.Storage, dryRun)
+		errs = multierror.Append(errs, err)
+		response["accessors_deleted"] = deleted
+	}
+
+	if data.Get("tidy_usage").(bool) {
+		if !dryRun {
+			_, err := b.ResetUsage(ctx, request, data)
+			errs = multierror.Append(errs, err)
+		}
+
+		response["usage_reset"] = true
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{Data: response}, nil
+}
+
+// tidyIssuedKeys deletes the records of issued keys, along with their accessors, that expired or were revoked before
+// the cutoff, returning how many were deleted. Records of keys that have neither expired nor been revoked are kept
+// regardless of their age.
+func (b *Backend) tidyIssuedKeys(ctx context.Context, storage logical.Storage, cutoff time.Time, dryRun bool) (int, error) {
+	ids, err := storage.List(ctx, issuedKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs *multierror.Error
+	deleted := 0
+	for _, id := range ids {
+		issued, err := b.issuedKey(ctx, storage, id)
+		switch {
+		case err != nil:
+			errs = multierror.Append(errs, err)
+			continue
+		case issued == nil:
+			continue
+		}
+
+		expired := !issued.Expires.IsZero() && issued.Expires.Before(cutoff)
+		revoked := !issued.Revoked.IsZero() && issued.Revoked.Before(cutoff)
+		if !expired && !revoked {
+			continue
+		}
+
+		if !dryRun {
+			if err = b.deleteIssuedKey(ctx, storage, issued); err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+		}
+
+		deleted++
+	}
+
+	return deleted, errs.ErrorOrNil()
+}
+
+// tidyWAL rolls back the write-ahead log entries written before the cutoff, returning how many were rolled back. Vault
+// rolls entries back on its own schedule, so this only finds entries whose rollback has been failing.
+func (b *Backend) tidyWAL(ctx context.Context, request *logical.Request, cutoff time.Time, dryRun bool) (int, error) {
+	ids, err := framework.ListWAL(ctx, request.Storage)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs *multierror.Error
+	rolledBack := 0
+	for _, id := range ids {
+		entry, err := framework.GetWAL(ctx, request.Storage, id)
+		switch {
+		case err != nil:
+			errs = multierror.Append(errs, err)
+			continue
+		case entry == nil, !time.Unix(entry.CreatedAt, 0).Before(cutoff):
+			continue
+		}
+
+		if !dryRun {
+			if err = b.walRollback(ctx, request, entry.Kind, entry.Data); err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+
+			if err = framework.DeleteWAL(ctx, request.Storage, id); err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+		}
+
+		rolledBack++
+	}
+
+	return rolledBack, errs.ErrorOrNil()
+}
+
+// tidyAccessors deletes the accessors that no longer refer to the record of an issued key, returning how many were
+// deleted.
+func (b *Backend) tidyAccessors(ctx context.Context, storage logical.Storage, dryRun bool) (int, error) {
+	accessors, err := storage.List(ctx, keyAccessorPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs *multierror.Error
+	deleted := 0
+	for _, accessor := range accessors {
+		entry, err := storage.Get(ctx, keyAccessorPrefix+accessor)
+		if err != nil || entry == nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+
+		var index keyAccessor
+		if err = entry.DecodeJSON(&index); err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+
+		issued, err := b.issuedKey(ctx, storage, index.KeyID)
+		if err != nil || issued != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+
+		if !dryRun {
+			if err = storage.Delete(ctx, keyAccessorPrefix+accessor); err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+		}
+
+		deleted++
+	}
+
+	return deleted, errs.ErrorOrNil()
+}
+
+func tidyResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"issued_keys_deleted": {
+			Type:        framework.TypeInt,
+			Description: "The number of records of issued keys deleted",
+		},
+		"wal_rolled_back": {
+			Type:        framework.TypeInt,
+			Description: "The number of write-ahead log entries rolled back",
+		},
+		"accessors_deleted": {
+			Type:        framework.TypeInt,
+			Description: "The number of accessors deleted",
+		},
+		"usage_reset": {
+			Type:        framework.TypeBool,
+			Description: "Whether the usage counters were reset",
+		},
+		"dry_run": {
+			Type:        framework.TypeBool,
+			Description: "Whether the records were only counted, without modifying storage",
+		},
+	}
+}
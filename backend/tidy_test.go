@@ -0,0 +1,81 @@
+package backend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_Tidy(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	now := time.Now()
+	for _, issued := range []backend.IssuedKey{
+		{ID: "expired", Expires: now.Add(-96 * time.Hour)},
+		{ID: "revoked", Expires: now.Add(time.Hour), Revoked: now.Add(-96 * time.Hour)},
+		{ID: "recently-expired", Expires: now.Add(-time.Hour)},
+		{ID: "active", Expires: now.Add(time.Hour)},
+	} {
+		entry, err := logical.StorageEntryJSON("issued-keys/"+issued.ID, issued)
+		require.NoError(t, err)
+		require.NoError(t, storage.Put(ctx, entry))
+	}
+
+	_, err := framework.PutWAL(ctx, storage, "key", map[string]interface{}{"id": "orphan"})
+	require.NoError(t, err)
+
+	tidy := func(data map[string]interface{}) map[string]interface{} {
+		response, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "tidy",
+			Storage:   storage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, response)
+
+		return response.Data
+	}
+
+	t.Run("It should report what would be removed without modifying storage", func(t *testing.T) {
+		response := tidy(map[string]interface{}{"dry_run": true, "safety_buffer": 0})
+		assert.EqualValues(t, 3, response["issued_keys_deleted"])
+		assert.EqualValues(t, true, response["dry_run"])
+
+		ids, err := storage.List(ctx, "issued-keys/")
+		require.NoError(t, err)
+		assert.Len(t, ids, 4)
+	})
+
+	t.Run("It should keep records within the safety buffer", func(t *testing.T) {
+		response := tidy(nil)
+		assert.EqualValues(t, 2, response["issued_keys_deleted"])
+		assert.EqualValues(t, 0, response["wal_rolled_back"])
+
+		ids, err := storage.List(ctx, "issued-keys/")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"recently-expired", "active"}, ids)
+	})
+
+	t.Run("It should remove stale records and roll back write-ahead log entries once outside the safety buffer", func(t *testing.T) {
+		response := tidy(map[string]interface{}{"safety_buffer": 0, "tidy_usage": true})
+		assert.EqualValues(t, 1, response["issued_keys_deleted"])
+		assert.EqualValues(t, 1, response["wal_rolled_back"])
+		assert.EqualValues(t, true, response["usage_reset"])
+		assert.Contains(t, api.Deleted(), "orphan")
+
+		entries, err := framework.ListWAL(ctx, storage)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+type (
+	// The limitedTransport type wraps an http.RoundTripper so that no response body can be read beyond a fixed size,
+	// protecting the plugin process from unbounded memory growth caused by a misbehaving proxy or API endpoint.
+	limitedTransport struct {
+		base     *http.Transport
+		limit    int64
+		failures *atomic.Uint64
+	}
+
+	// The limitedBody type wraps a response body, returning ErrResponseTooLarge once more than the limit is read.
+	limitedBody struct {
+		body      io.ReadCloser
+		remaining int64
+	}
+)
+
+const (
+	// maxAPIResponseSize is the largest response body that will be read from the Tailscale API.
+	maxAPIResponseSize = 32 << 20
+
+	// maxAPIErrorLength is the longest error message from the Tailscale API that will be returned to callers.
+	maxAPIErrorLength = 512
+)
+
+// ErrResponseTooLarge is the error given when a response from the Tailscale API exceeds the maximum size.
+var ErrResponseTooLarge = fmt.Errorf("response exceeds the maximum size of %d bytes", maxAPIResponseSize)
+
+// newAPITransport returns the transport used for requests to the Tailscale API, which applies any override for the
+// host of the configured API URL, limits the size of responses and forwards the identifiers of the Vault request being
+// handled. Failed requests are counted in failures. Each set of client credentials has its own transport, so that
+// requests made by the rest of the process, such as those to webhooks, and by other mounts are unaffected.
+func newAPITransport(config Config, failures *atomic.Uint64) (*limitedTransport, error) {
+	override, err := apiHostOverride(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var base *http.Transport
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		base = transport.Clone()
+	} else {
+		base = &http.Transport{
+			Proxy:       http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		}
+	}
+
+	if override != nil {
+		base.DialContext = override.dialContext(base.DialContext)
+	}
+
+	return &limitedTransport{base: base, limit: maxAPIResponseSize, failures: failures}, nil
+}
+
+// RoundTrip performs the request, returning ErrResponseTooLarge if the response declares a length beyond the limit
+// and otherwise limiting how much of the body can be read. Requests made while handling a Vault request carry its
+// identifiers. Requests that fail, or that the API responds to with an error other than not found, are counted as API
+// errors.
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, correlated := requestCorrelation(req)
+	if correlated {
+		req = c.apply(req)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if correlated {
+		c.log(req, resp, err)
+	}
+
+	// Not found responses are expected when checking whether a resource, such as a key, still exists.
+	if err != nil || (resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound) {
+		t.failures.Add(1)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ContentLength > t.limit {
+		resp.Body.Close()
+		return nil, ErrResponseTooLarge
+	}
+
+	resp.Body = &limitedBody{body: resp.Body, remaining: t.limit}
+	return resp, nil
+}
+
+// client returns an HTTP client that makes requests to the Tailscale API using the transport.
+func (t *limitedTransport) client() *http.Client {
+	return &http.Client{Transport: t, Timeout: apiTimeout}
+}
+
+// CloseIdleConnections closes any idle connections held by the underlying transport.
+func (t *limitedTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Probe for a single byte to distinguish a body of exactly the limit from one that exceeds it.
+		n, err := l.body.Read(make([]byte, 1))
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.body.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.body.Close()
+}
+
+// checkContentType returns an error if a response from the Tailscale API has a content type that cannot contain JSON,
+// such as an HTML page returned by a proxy. Responses without a content type, or with a plain text one, are accepted
+// as they may contain JSON.
+func checkContentType(header http.Header) error {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("response has an invalid content type: %w", err)
+	}
+
+	switch {
+	case mediaType == "application/json", mediaType == "text/plain", strings.HasSuffix(mediaType, "+json"):
+		return nil
+	default:
+		return fmt.Errorf("response has unexpected content type %q", sanitize(mediaType, maxAPIErrorLength))
+	}
+}
+
+// sanitize removes control characters from a message returned by the Tailscale API, and truncates it to the given
+// length, so that it can be safely included in errors and logs.
+func sanitize(message string, length int) string {
+	message = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+
+		return r
+	}, message)
+
+	message = strings.TrimSpace(message)
+	if runes := []rune(message); len(runes) > length {
+		message = string(runes[:length]) + "..."
+	}
+
+	return message
+}
@@ -0,0 +1,163 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_ResponseLimits(t *testing.T) {
+	const maxSize = 32 << 20
+
+	tt := []struct {
+		Name          string
+		Path          string
+		Operation     logical.Operation
+		Handler       http.HandlerFunc
+		ExpectsError  bool
+		ExpectedError string
+		Unexpected    string
+	}{
+		{
+			Name:      "It should read responses within the limit",
+			Path:      "vip-services/",
+			Operation: logical.ListOperation,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+					"vipServices": []map[string]interface{}{{"name": "svc:web"}},
+				}))
+			},
+		},
+		{
+			Name:      "It should return an error if the response is larger than the limit",
+			Path:      "vip-services/",
+			Operation: logical.ListOperation,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"vipServices":[{"name":"`))
+				_, _ = w.Write([]byte(strings.Repeat("a", maxSize)))
+				_, _ = w.Write([]byte(`"}]}`))
+			},
+			ExpectsError:  true,
+			ExpectedError: "maximum size",
+		},
+		{
+			Name:      "It should return an error if the response declares a length larger than the limit",
+			Path:      "vip-services/",
+			Operation: logical.ListOperation,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(maxSize+1))
+				w.WriteHeader(http.StatusOK)
+			},
+			ExpectsError:  true,
+			ExpectedError: "maximum size",
+		},
+		{
+			Name:      "It should return an error if a key response from the client library is larger than the limit",
+			Path:      "key",
+			Operation: logical.ReadOperation,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"key":"`))
+				_, _ = w.Write([]byte(strings.Repeat("a", maxSize)))
+				_, _ = w.Write([]byte(`"}`))
+			},
+			ExpectsError:  true,
+			ExpectedError: "maximum size",
+		},
+		{
+			Name:      "It should return an error if the response has an unexpected content type",
+			Path:      "vip-services/",
+			Operation: logical.ListOperation,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				_, _ = w.Write([]byte(`<html><body>Sign in to continue</body></html>`))
+			},
+			ExpectsError:  true,
+			ExpectedError: "unexpected content type",
+			Unexpected:    "Sign in",
+		},
+		{
+			Name:      "It should not include the body of a non-json error response",
+			Path:      "vip-services/",
+			Operation: logical.ListOperation,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(http.StatusBadGateway)
+				_, _ = w.Write([]byte(`{"message":"<script>alert(1)</script>"}`))
+			},
+			ExpectsError:  true,
+			ExpectedError: http.StatusText(http.StatusBadGateway),
+			Unexpected:    "script",
+		},
+		{
+			Name:      "It should truncate long error messages and remove control characters",
+			Path:      "vip-services/",
+			Operation: logical.ListOperation,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+					"message": "invalid\r\nrequest" + strings.Repeat("!", 4096),
+				}))
+			},
+			ExpectsError:  true,
+			ExpectedError: "invalid  request",
+			Unexpected:    strings.Repeat("!", 1024),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, b := setup(t)
+
+			storage := &logical.InmemStorage{}
+			putConfig(t, ctx, storage)
+			serve(t, tc.Handler)
+
+			_, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: tc.Operation,
+				Path:      tc.Path,
+				Storage:   storage,
+			})
+
+			if !tc.ExpectsError {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.ExpectedError)
+			if tc.Unexpected != "" {
+				assert.NotContains(t, err.Error(), tc.Unexpected)
+			}
+		})
+	}
+}
+
+func TestBackend_APITransport(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	mockKeysAPI(t)
+
+	t.Run("It should not replace the default transport of the process", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+		})
+		require.NoError(t, err)
+
+		_, ok := http.DefaultTransport.(*http.Transport)
+		assert.True(t, ok)
+	})
+}
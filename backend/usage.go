@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The Usage type describes aggregate counters of how the mount has been used since it was created or since the
+	// counters were last reset.
+	Usage struct {
+		KeysIssued  uint64    `json:"keys_issued"`
+		KeysRevoked uint64    `json:"keys_revoked"`
+		KeysFailed  uint64    `json:"keys_failed"`
+		APIErrors   uint64    `json:"api_errors"`
+		Since       time.Time `json:"since"`
+	}
+)
+
+const (
+	usagePath = "usage"
+
+	readUsageDescription  = "Read aggregate usage counters for the Tailscale backend"
+	resetUsageDescription = "Reset the aggregate usage counters for the Tailscale backend"
+
+	usageHelpSynopsis    = "Read or reset aggregate usage counters."
+	usageHelpDescription = `
+Returns the number of keys issued, revoked and that failed to be generated, along with
+the number of errors returned by the Tailscale API, since the mount was created or the
+counters were last reset. Deleting this path resets every counter to zero.
+`
+)
+
+func (b *Backend) usagePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "usage",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadUsage,
+					Responses: okResponse(readUsageDescription, usageResponseFields()),
+					Summary:   readUsageDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.ResetUsage,
+					Responses: noContentResponse(),
+					Summary:   resetUsageDescription,
+				},
+			},
+			HelpSynopsis:    usageHelpSynopsis,
+			HelpDescription: usageHelpDescription,
+		},
+	}
+}
+
+// ReadUsage returns the aggregate usage counters for the Backend. If no usage has been recorded yet, all counters
+// are returned as zero.
+func (b *Backend) ReadUsage(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	usage, err := b.loadUsage(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"keys_issued":  usage.KeysIssued,
+			"keys_revoked": usage.KeysRevoked,
+			"keys_failed":  usage.KeysFailed,
+			"api_errors":   usage.APIErrors,
+			"since":        usage.Since,
+		},
+	}, nil
+}
+
+// ResetUsage sets all usage counters back to zero, starting a new counting period from the current time.
+func (b *Backend) ResetUsage(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.usageMu.Lock()
+	defer b.usageMu.Unlock()
+
+	b.apiErrors.Swap(0)
+	if err := b.saveUsage(ctx, request.Storage, Usage{Since: time.Now().UTC()}); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{}, nil
+}
+
+// recordUsage applies fn to the stored usage counters and persists the result, along with any errors returned by the
+// Tailscale API since the counters were last persisted. Failures are logged rather than returned so that the
+// bookkeeping never causes an otherwise successful operation to fail.
+func (b *Backend) recordUsage(ctx context.Context, storage logical.Storage, fn func(usage *Usage)) {
+	b.usageMu.Lock()
+	defer b.usageMu.Unlock()
+
+	usage, err := b.loadUsage(ctx, storage)
+	if err != nil {
+		b.Logger().Warn("failed to load usage counters", "error", err)
+		return
+	}
+
+	usage.APIErrors += b.apiErrors.Swap(0)
+	fn(&usage)
+	if err = b.saveUsage(ctx, storage, usage); err != nil {
+		b.Logger().Warn("failed to save usage counters", "error", err)
+	}
+}
+
+// flushAPIErrors persists the errors returned by the Tailscale API, which are counted by the transport used to call
+// it, if any have occurred since the usage counters were last persisted.
+func (b *Backend) flushAPIErrors(ctx context.Context, storage logical.Storage) {
+	if storage == nil || b.apiErrors.Load() == 0 {
+		return
+	}
+
+	b.recordUsage(ctx, storage, func(*Usage) {})
+}
+
+func (b *Backend) loadUsage(ctx context.Context, storage logical.Storage) (Usage, error) {
+	entry, err := storage.Get(ctx, usagePath)
+	switch {
+	case err != nil:
+		return Usage{}, err
+	case entry == nil:
+		return Usage{Since: time.Now().UTC()}, nil
+	}
+
+	var usage Usage
+	if err = entry.DecodeJSON(&usage); err != nil {
+		return Usage{}, err
+	}
+
+	return usage, nil
+}
+
+func (b *Backend) saveUsage(ctx context.Context, storage logical.Storage, usage Usage) error {
+	entry, err := logical.StorageEntryJSON(usagePath, usage)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func usageResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"keys_issued": {
+			Type:        framework.TypeInt64,
+			Description: "The number of keys generated",
+		},
+		"keys_revoked": {
+			Type:        framework.TypeInt64,
+			Description: "The number of keys revoked",
+		},
+		"keys_failed": {
+			Type:        framework.TypeInt64,
+			Description: "The number of keys that could not be generated",
+		},
+		"api_errors": {
+			Type:        framework.TypeInt64,
+			Description: "The number of errors returned by the Tailscale API",
+		},
+		"since": {
+			Type:        framework.TypeTime,
+			Description: "When counting began",
+		},
+	}
+}
@@ -0,0 +1,127 @@
+package backend_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+func TestBackend_ReadUsage(t *testing.T) {
+	ctx, b := setup(t)
+
+	requestSchema := map[string]*framework.FieldSchema{
+		"tags": {
+			Type: framework.TypeStringSlice,
+		},
+		"preauthorized": {
+			Type: framework.TypeBool,
+		},
+		"ephemeral": {
+			Type: framework.TypeBool,
+		},
+	}
+
+	tt := []struct {
+		Name          string
+		APIResponse   interface{}
+		APIStatusCode int
+		Requests      int
+		Expected      map[string]interface{}
+	}{
+		{
+			Name:          "It should count successfully issued keys",
+			APIResponse:   tailscale.Key{ID: "12345", Key: "test"},
+			APIStatusCode: http.StatusOK,
+			Requests:      2,
+			Expected: map[string]interface{}{
+				"keys_issued":  uint64(2),
+				"keys_revoked": uint64(0),
+				"keys_failed":  uint64(0),
+				"api_errors":   uint64(0),
+			},
+		},
+		{
+			Name:          "It should count failed key issuance",
+			APIResponse:   tailscale.APIError{Message: "nope"},
+			APIStatusCode: http.StatusBadRequest,
+			Requests:      1,
+			Expected: map[string]interface{}{
+				"keys_issued":  uint64(0),
+				"keys_revoked": uint64(0),
+				"keys_failed":  uint64(1),
+				"api_errors":   uint64(1),
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			request := logical.TestRequest(t, logical.ReadOperation, "usage")
+
+			entry, err := logical.StorageEntryJSON("config", backend.Config{
+				Tailnet: "example",
+				APIUrl:  "http://localhost:1337",
+				APIKey:  "example",
+			})
+			require.NoError(t, err)
+			require.NoError(t, request.Storage.Put(ctx, entry))
+
+			respondWith(t, tc.APIStatusCode, tc.APIResponse)
+			for i := 0; i < tc.Requests; i++ {
+				_, _ = b.GenerateKey(ctx, request, &framework.FieldData{Schema: requestSchema})
+			}
+
+			response, err := b.ReadUsage(ctx, request, nil)
+			require.NoError(t, err)
+
+			for k, v := range tc.Expected {
+				assert.EqualValues(t, v, response.Data[k], k)
+			}
+
+			_, err = b.ResetUsage(ctx, request, nil)
+			require.NoError(t, err)
+
+			response, err = b.ReadUsage(ctx, request, nil)
+			require.NoError(t, err)
+			assert.EqualValues(t, 0, response.Data["keys_issued"])
+			assert.EqualValues(t, 0, response.Data["keys_failed"])
+		})
+	}
+}
+
+func TestBackend_UsageAPIErrors(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	request := requester(ctx, b, storage)
+
+	t.Run("It should count errors returned by any endpoint of the API", func(t *testing.T) {
+		respondWith(t, http.StatusInternalServerError, map[string]interface{}{"message": "nope"})
+
+		_, err := request(logical.ListOperation, "vip-services/", nil)
+		require.Error(t, err)
+
+		response, err := request(logical.ReadOperation, "usage", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, response.Data["api_errors"])
+		assert.EqualValues(t, 0, response.Data["keys_failed"])
+	})
+
+	t.Run("It should not count resources that are not found", func(t *testing.T) {
+		respondWith(t, http.StatusNotFound, map[string]interface{}{"message": "not found"})
+
+		_, _ = request(logical.ListOperation, "vip-services/", nil)
+
+		response, err := request(logical.ReadOperation, "usage", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, response.Data["api_errors"])
+	})
+}
@@ -0,0 +1,244 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+type (
+	// The VIPService type describes a service published in the tailnet at its own virtual IP addresses, backed by
+	// one or more devices.
+	VIPService struct {
+		Name    string   `json:"name"`
+		Addrs   []string `json:"addrs,omitempty"`
+		Comment string   `json:"comment"`
+		Ports   []string `json:"ports"`
+		Tags    []string `json:"tags"`
+	}
+)
+
+const (
+	vipServicePrefix = "svc:"
+
+	listVIPServicesDescription   = "List the VIP services of the tailnet"
+	readVIPServiceDescription    = "Read a VIP service"
+	updateVIPServiceDescription  = "Create or update a VIP service"
+	deleteVIPServiceDescription  = "Delete a VIP service"
+	vipServiceNameDescription    = "The name of the service, with or without the svc: prefix"
+	vipServiceCommentDescription = "A description of the service"
+	vipServicePortsDescription   = "The ports the service is published on, such as tcp:443"
+	vipServiceTagsDescription    = "The tags of the devices allowed to host the service"
+
+	listVIPServicesHelpSynopsis    = "List the VIP services of the tailnet."
+	listVIPServicesHelpDescription = `
+Lists the names of the VIP services of the tailnet, each including the svc: prefix.
+`
+	vipServiceHelpSynopsis    = "Manage a VIP service of the tailnet."
+	vipServiceHelpDescription = `
+VIP services are published on fixed addresses in the tailnet and hosted by the devices
+with the given tags. Names may be given with or without the svc: prefix. The addresses
+of a service are assigned by Tailscale and returned when it is read.
+`
+)
+
+func (b *Backend) vipServicePaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "vip-services/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback:  b.ListVIPServices,
+					Responses: listResponse(listVIPServicesDescription),
+					Summary:   listVIPServicesDescription,
+				},
+			},
+			HelpSynopsis:    listVIPServicesHelpSynopsis,
+			HelpDescription: listVIPServicesHelpDescription,
+		},
+		{
+			Pattern: `vip-services/(?P<name>(svc:)?\w(([\w-.]+)?\w)?)`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: vipServiceNameDescription,
+				},
+				"comment": {
+					Type:        framework.TypeString,
+					Description: vipServiceCommentDescription,
+				},
+				"ports": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: vipServicePortsDescription,
+				},
+				"tags": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: vipServiceTagsDescription,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:  b.ReadVIPService,
+					Responses: okResponse(readVIPServiceDescription, vipServiceResponseFields()),
+					Summary:   readVIPServiceDescription,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:  b.UpdateVIPService,
+					Responses: noContentResponse(),
+					Summary:   updateVIPServiceDescription,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback:  b.DeleteVIPService,
+					Responses: noContentResponse(),
+					Summary:   deleteVIPServiceDescription,
+				},
+			},
+			HelpSynopsis:    vipServiceHelpSynopsis,
+			HelpDescription: vipServiceHelpDescription,
+		},
+	}
+}
+
+// ListVIPServices returns the names of the VIP services of the tailnet.
+func (b *Backend) ListVIPServices(ctx context.Context, request *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		VIPServices []VIPService `json:"vipServices"`
+	}
+
+	if err = b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("vip-services"), nil, nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to list vip services: %w", err)
+	}
+
+	names := make([]string, 0, len(result.VIPServices))
+	for _, service := range result.VIPServices {
+		names = append(names, service.Name)
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+// ReadVIPService returns a VIP service, including the virtual IP addresses it is published at.
+func (b *Backend) ReadVIPService(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var service VIPService
+	err = b.apiRequest(ctx, config, http.MethodGet, config.tailnetURI("vip-services", vipServiceName(data)), nil, nil, &service)
+	switch {
+	case isAPINotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read vip service: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":    service.Name,
+			"addrs":   service.Addrs,
+			"comment": service.Comment,
+			"ports":   service.Ports,
+			"tags":    service.Tags,
+		},
+	}, nil
+}
+
+// UpdateVIPService creates or replaces a VIP service. Returns an error if no ports are provided or the backend is in
+// read-only mode or during a maintenance window.
+func (b *Backend) UpdateVIPService(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	service := VIPService{
+		Name:    vipServiceName(data),
+		Comment: data.Get("comment").(string),
+		Ports:   data.Get("ports").([]string),
+		Tags:    data.Get("tags").([]string),
+	}
+
+	if len(service.Ports) == 0 {
+		return nil, errors.New("provided ports cannot be empty")
+	}
+
+	err = b.apiRequest(ctx, config, http.MethodPut, config.tailnetURI("vip-services", service.Name), nil, service, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update vip service: %w", err)
+	}
+
+	return &logical.Response{}, nil
+}
+
+// DeleteVIPService deletes a VIP service. Returns an error if the backend is in read-only mode or during a maintenance
+// window.
+func (b *Backend) DeleteVIPService(ctx context.Context, request *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, request.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = config.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	if err = b.checkMaintenance(ctx, request.Storage); err != nil {
+		return nil, err
+	}
+
+	err = b.apiRequest(ctx, config, http.MethodDelete, config.tailnetURI("vip-services", vipServiceName(data)), nil, nil, nil)
+	if err != nil && !isAPINotFound(err) {
+		return nil, fmt.Errorf("failed to delete vip service: %w", err)
+	}
+
+	return &logical.Response{}, nil
+}
+
+// vipServiceName returns the name of the VIP service in the request, adding the "svc:" prefix if it was omitted.
+func vipServiceName(data *framework.FieldData) string {
+	return vipServicePrefix + strings.TrimPrefix(data.Get("name").(string), vipServicePrefix)
+}
+
+func vipServiceResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": {
+			Type:        framework.TypeString,
+			Description: "The name of the service, including the svc: prefix",
+		},
+		"addrs": {
+			Type:        framework.TypeStringSlice,
+			Description: "The addresses assigned to the service",
+		},
+		"comment": {
+			Type:        framework.TypeString,
+			Description: vipServiceCommentDescription,
+		},
+		"ports": {
+			Type:        framework.TypeStringSlice,
+			Description: vipServicePortsDescription,
+		},
+		"tags": {
+			Type:        framework.TypeStringSlice,
+			Description: vipServiceTagsDescription,
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_VIPServices(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+
+	var (
+		mu       sync.Mutex
+		services = map[string]map[string]interface{}{}
+	)
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		const prefix = "/api/v2/tailnet/example/vip-services"
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+		switch {
+		case name == "":
+			result := make([]interface{}, 0, len(services))
+			for _, service := range services {
+				result = append(result, service)
+			}
+			assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"vipServices": result}))
+		case r.Method == http.MethodPut:
+			var service map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&service))
+			service["addrs"] = []string{"100.100.100.1"}
+			services[name] = service
+		case r.Method == http.MethodDelete:
+			delete(services, name)
+		default:
+			service, ok := services[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			assert.NoError(t, json.NewEncoder(w).Encode(service))
+		}
+	})
+
+	request := requester(ctx, b, storage)
+
+	t.Run("It should return an error if no ports are provided", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "vip-services/web", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("It should create a service, adding the svc prefix", func(t *testing.T) {
+		_, err := request(logical.UpdateOperation, "vip-services/web", map[string]interface{}{
+			"comment": "The web frontend",
+			"ports":   "tcp:443",
+			"tags":    "tag:web",
+		})
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "vip-services/svc:web", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, "svc:web", response.Data["name"])
+		assert.EqualValues(t, []string{"tcp:443"}, response.Data["ports"])
+		assert.EqualValues(t, []string{"100.100.100.1"}, response.Data["addrs"])
+	})
+
+	t.Run("It should list services", func(t *testing.T) {
+		response, err := request(logical.ListOperation, "vip-services/", nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"svc:web"}, response.Data["keys"])
+	})
+
+	t.Run("It should delete a service", func(t *testing.T) {
+		_, err := request(logical.DeleteOperation, "vip-services/web", nil)
+		require.NoError(t, err)
+
+		response, err := request(logical.ReadOperation, "vip-services/web", nil)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+}
@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+type (
+	// The keyWAL type is the write-ahead log entry stored while a key is being generated and returned. If the entry is
+	// not deleted, because the key could not be returned, the key is deleted from the tailnet once the entry is rolled
+	// back. The entry is stored before the key is generated, so until the identifier of the key is known the key is
+	// found using the nonce added to its description.
+	keyWAL struct {
+		ID     string `json:"id"`
+		Nonce  string `json:"nonce,omitempty"`
+		Config string `json:"config,omitempty"`
+	}
+)
+
+const (
+	walKindKey = "key"
+
+	// keyNoncePrefix is the prefix of the nonce added to the description of each key protected by a write-ahead log
+	// entry.
+	keyNoncePrefix = "vt-"
+)
+
+// keyNoncePattern matches the nonce at the end of the description of a key.
+var keyNoncePattern = regexp.MustCompile(`(^| )` + keyNoncePrefix + `[0-9a-f]{12}$`)
+
+// putKeyWAL stores a write-ahead log entry for a key that is about to be generated in the tailnet of the named
+// configuration, returning the identifier of the entry and the nonce that must be added to the description of the key.
+func (b *Backend) putKeyWAL(ctx context.Context, storage logical.Storage, configName string) (string, string, error) {
+	random := make([]byte, 6)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+
+	nonce := keyNoncePrefix + hex.EncodeToString(random)
+	id, err := framework.PutWAL(ctx, storage, walKindKey, &keyWAL{
+		Nonce:  nonce,
+		Config: configName,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store write-ahead log entry: %w", err)
+	}
+
+	return id, nonce, nil
+}
+
+// updateKeyWAL replaces the write-ahead log entry of a generated key with one containing its identifier, returning
+// the identifier of the new entry. If the new entry cannot be stored, the key is revoked, as it could otherwise be left
+// in the tailnet without ever being returned. Should the revocation fail, the original entry is kept so that the key
+// is still found using its nonce.
+func (b *Backend) updateKeyWAL(ctx context.Context, storage logical.Storage, walID, configName, nonce string, key tailscale.Key) (string, error) {
+	id, err := framework.PutWAL(ctx, storage, walKindKey, &keyWAL{
+		ID:     key.ID,
+		Nonce:  nonce,
+		Config: configName,
+	})
+	if err != nil {
+		if rErr := b.revokeKeyFrom(ctx, storage, configName, key.ID); rErr != nil {
+			b.Logger().Error("failed to revoke key without a write-ahead log entry", "id", key.ID, "error", rErr)
+		} else {
+			b.deleteKeyWAL(ctx, storage, walID)
+		}
+
+		return "", fmt.Errorf("failed to store write-ahead log entry for key %q: %w", key.ID, err)
+	}
+
+	b.deleteKeyWAL(ctx, storage, walID)
+	return id, nil
+}
+
+// deleteKeyWAL deletes a write-ahead log entry that is no longer needed. Failures are logged rather than returned, as
+// rolling back an entry whose key no longer needs deleting only results in an attempt to delete it again.
+func (b *Backend) deleteKeyWAL(ctx context.Context, storage logical.Storage, walID string) {
+	if err := framework.DeleteWAL(ctx, storage, walID); err != nil {
+		b.Logger().Warn("failed to delete write-ahead log entry", "id", walID, "error", err)
+	}
+}
+
+// walRollback is invoked by Vault for write-ahead log entries that were not deleted once the operation they protect
+// completed. Keys whose entries remain were generated but never returned, so they are deleted from the tailnet. If the
+// entry does not contain the identifier of its key, the key is found using its nonce, and if no key has the nonce the
+// key was never generated.
+func (b *Backend) walRollback(ctx context.Context, request *logical.Request, kind string, data interface{}) error {
+	if kind != walKindKey {
+		return fmt.Errorf("unknown write-ahead log entry kind %q", kind)
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var entry keyWAL
+	if err = json.Unmarshal(encoded, &entry); err != nil {
+		return err
+	}
+
+	if entry.ID == "" && entry.Nonce != "" {
+		if entry.ID, err = b.findKeyByNonce(ctx, request.Storage, entry.Config, entry.Nonce); err != nil {
+			return err
+		}
+	}
+
+	if entry.ID == "" {
+		return nil
+	}
+
+	b.Logger().Warn("deleting key that was generated but never returned", "id", entry.ID)
+	if err = b.revokeKeyFrom(ctx, request.Storage, entry.Config, entry.ID); err != nil {
+		return err
+	}
+
+	b.markRevoked(ctx, request.Storage, entry.ID, revokedReasonRollback)
+	return nil
+}
+
+// findKeyByNonce returns the identifier of the key in the tailnet of the named configuration whose description ends
+// with the nonce, or an empty string if there is no such key.
+func (b *Backend) findKeyByNonce(ctx context.Context, storage logical.Storage, configName, nonce string) (string, error) {
+	config, err := b.revocationConfig(ctx, storage, configName, "")
+	if err != nil {
+		return "", err
+	}
+
+	client, err := b.newClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := client.Keys(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	// The keys are listed without their descriptions, so each key is read individually.
+	for _, listed := range keys {
+		key, err := client.GetKey(ctx, listed.ID)
+		switch {
+		case tailscale.IsNotFound(err):
+			continue
+		case err != nil:
+			return "", fmt.Errorf("failed to read key %q: %w", listed.ID, err)
+		case strings.HasSuffix(key.Description, nonce):
+			return key.ID, nil
+		}
+	}
+
+	return "", nil
+}
+
+// withoutKeyNonce returns the description of a key without the nonce added to it when it was generated.
+func withoutKeyNonce(description string) string {
+	return keyNoncePattern.ReplaceAllString(description, "")
+}
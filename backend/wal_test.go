@@ -0,0 +1,102 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestBackend_KeyWAL(t *testing.T) {
+	ctx, b := setup(t)
+
+	storage := &logical.InmemStorage{}
+	putConfig(t, ctx, storage)
+	api := mockKeysAPI(t)
+
+	rollback := func(immediate bool) {
+		data := map[string]interface{}{}
+		if immediate {
+			data["immediate"] = true
+		}
+
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RollbackOperation,
+			Storage:   storage,
+			Data:      data,
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("It should not leave write-ahead log entries for returned keys", func(t *testing.T) {
+		_, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "key",
+			Storage:   storage,
+			Data:      map[string]interface{}{"tags": []string{"tag:server"}},
+		})
+		require.NoError(t, err)
+
+		entries, err := framework.ListWAL(ctx, storage)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	_, err := framework.PutWAL(ctx, storage, "key", map[string]interface{}{"id": "orphan"})
+	require.NoError(t, err)
+
+	t.Run("It should not delete keys whose entries are recent", func(t *testing.T) {
+		rollback(false)
+		assert.NotContains(t, api.Deleted(), "orphan")
+	})
+
+	t.Run("It should delete keys that were generated but never returned", func(t *testing.T) {
+		rollback(true)
+		assert.Contains(t, api.Deleted(), "orphan")
+
+		entries, err := framework.ListWAL(ctx, storage)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("It should add a nonce to the description of generated keys", func(t *testing.T) {
+		requests := api.Requests()
+		require.NotEmpty(t, requests)
+		assert.Regexp(t, `^vt-[0-9a-f]{12}$`, requests[0].Description)
+	})
+
+	t.Run("It should delete keys generated before their identifier was recorded", func(t *testing.T) {
+		api.SetKeys(
+			tailscale.Key{ID: "crashed", Description: "web-1 vt-0123456789ab"},
+			tailscale.Key{ID: "other", Description: "web-2 vt-ba9876543210"},
+		)
+
+		_, err := framework.PutWAL(ctx, storage, "key", map[string]interface{}{"nonce": "vt-0123456789ab"})
+		require.NoError(t, err)
+
+		rollback(true)
+		assert.Contains(t, api.Deleted(), "crashed")
+		assert.NotContains(t, api.Deleted(), "other")
+
+		entries, err := framework.ListWAL(ctx, storage)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("It should remove entries whose keys were never generated", func(t *testing.T) {
+		deleted := len(api.Deleted())
+
+		_, err := framework.PutWAL(ctx, storage, "key", map[string]interface{}{"nonce": "vt-ffffffffffff"})
+		require.NoError(t, err)
+
+		rollback(true)
+		assert.Len(t, api.Deleted(), deleted)
+
+		entries, err := framework.ListWAL(ctx, storage)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
@@ -0,0 +1,135 @@
+// Package main contains a command for bootstrapping the Tailscale secrets engine. It registers the plugin binary in
+// Vault's plugin catalog, mounts it and writes its initial configuration. The Vault address and token are read from
+// the standard VAULT_ADDR and VAULT_TOKEN environment variables.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+)
+
+type options struct {
+	PluginPath string
+	Name       string
+	Mount      string
+	Tailnet    string
+	APIKey     string
+	APIUrl     string
+}
+
+func main() {
+	logger := hclog.New(&hclog.LoggerOptions{})
+
+	if err := run(context.Background(), logger, os.Args[1:]); err != nil {
+		logger.Error("failed to bootstrap plugin", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, logger hclog.Logger, args []string) error {
+	opts := options{}
+
+	flags := flag.NewFlagSet("tailscale-plugin", flag.ContinueOnError)
+	flags.StringVar(&opts.PluginPath, "plugin-path", "", "Path to the plugin binary within Vault's plugin directory")
+	flags.StringVar(&opts.Name, "name", "vault-plugin-tailscale", "Name to register the plugin under in the catalog")
+	flags.StringVar(&opts.Mount, "mount", "tailscale", "Path to mount the secrets engine at")
+	flags.StringVar(&opts.Tailnet, "tailnet", os.Getenv("TAILSCALE_TAILNET"), "Name of the tailnet, defaults to $TAILSCALE_TAILNET")
+	flags.StringVar(&opts.APIKey, "api-key", os.Getenv("TAILSCALE_API_KEY"), "Tailscale API key, defaults to $TAILSCALE_API_KEY")
+	flags.StringVar(&opts.APIUrl, "api-url", "", "URL of the Tailscale API, if not the default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if opts.PluginPath == "" {
+		return errors.New("-plugin-path must be set")
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		return err
+	}
+
+	sum, err := checksum(opts.PluginPath)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum of %s: %w", opts.PluginPath, err)
+	}
+
+	err = client.Sys().RegisterPluginWithContext(ctx, &api.RegisterPluginInput{
+		Name:    opts.Name,
+		Type:    api.PluginTypeSecrets,
+		Command: filepath.Base(opts.PluginPath),
+		SHA256:  sum,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register plugin: %w", err)
+	}
+
+	logger.Info("registered plugin", "name", opts.Name, "sha256", sum)
+
+	mounts, err := client.Sys().ListMountsWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list mounts: %w", err)
+	}
+
+	mount := strings.Trim(opts.Mount, "/")
+	if existing, ok := mounts[mount+"/"]; ok {
+		if existing.Type != opts.Name {
+			return fmt.Errorf("path %s is already in use by a %s mount", mount, existing.Type)
+		}
+
+		logger.Info("plugin already mounted", "path", mount)
+	} else {
+		if err = client.Sys().MountWithContext(ctx, mount, &api.MountInput{Type: opts.Name}); err != nil {
+			return fmt.Errorf("failed to mount plugin: %w", err)
+		}
+
+		logger.Info("mounted plugin", "path", mount)
+	}
+
+	if opts.Tailnet == "" || opts.APIKey == "" {
+		logger.Info("tailnet or api key not provided, skipping configuration")
+		return nil
+	}
+
+	config := map[string]interface{}{
+		"tailnet": opts.Tailnet,
+		"api_key": opts.APIKey,
+	}
+
+	if opts.APIUrl != "" {
+		config["api_url"] = opts.APIUrl
+	}
+
+	if _, err = client.Logical().WriteWithContext(ctx, mount+"/config", config); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+
+	logger.Info("wrote configuration", "path", mount+"/config", "tailnet", opts.Tailnet)
+	return nil
+}
+
+func checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,274 @@
+// Package dev contains a standalone server that runs the secrets engine against in-memory storage. It emulates the
+// subset of Vault's HTTP API needed to read and write paths of a single mount, so that roles and requests can be
+// prototyped without running a Vault server. Nothing is authenticated and nothing is persisted.
+package dev
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/davidsbond/vault-plugin-tailscale/backend"
+)
+
+type (
+	// The Server type serves the paths of the secrets engine over HTTP in the same shape as Vault, under
+	// /v1/<mount>/.
+	Server struct {
+		logger  hclog.Logger
+		mount   string
+		backend logical.Backend
+		storage logical.Storage
+	}
+)
+
+const (
+	// DefaultAddress is the address the server listens on when none is provided. It matches the address of a Vault
+	// dev server so that the vault CLI can be used against it without further configuration.
+	DefaultAddress = "127.0.0.1:8200"
+
+	// DefaultMount is the path the secrets engine is served under when none is provided.
+	DefaultMount = "tailscale"
+
+	periodicInterval = time.Minute
+	shutdownTimeout  = 5 * time.Second
+	defaultLeaseTTL  = 24 * time.Hour
+	maxLeaseTTL      = 32 * 24 * time.Hour
+)
+
+// New returns a new Server that serves a fresh instance of the secrets engine at the given mount.
+func New(ctx context.Context, logger hclog.Logger, mount string) (*Server, error) {
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		mount = DefaultMount
+	}
+
+	storage := &logical.InmemStorage{}
+	config := &logical.BackendConfig{
+		Logger: logger.Named("backend"),
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: defaultLeaseTTL,
+			MaxLeaseTTLVal:     maxLeaseTTL,
+		},
+		StorageView: storage,
+		BackendUUID: "dev",
+		Config:      map[string]string{},
+	}
+
+	b, err := backend.Create(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}); err != nil {
+		return nil, fmt.Errorf("failed to initialize backend: %w", err)
+	}
+
+	return &Server{
+		logger:  logger,
+		mount:   mount,
+		backend: b,
+		storage: storage,
+	}, nil
+}
+
+// Run serves HTTP requests on the given address until the context is cancelled. The periodic tasks of the secrets
+// engine are invoked every minute, as Vault would.
+func (s *Server) Run(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	s.logger.Info("serving secrets engine", "address", "http://"+listener.Addr().String(), "mount", s.mount)
+
+	ticker := time.NewTicker(periodicInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+
+			return server.Shutdown(shutdownCtx)
+		case err = <-errs:
+			return err
+		case <-ticker.C:
+			s.periodic(ctx)
+		}
+	}
+}
+
+// ServeHTTP handles a single request against the mount, translating it into a logical request for the secrets engine
+// and writing its response in the same shape as Vault.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/v1/" + s.mount + "/"
+	if !strings.HasPrefix(r.URL.Path+"/", prefix) {
+		logical.RespondError(w, http.StatusNotFound, fmt.Errorf("no handler for route %q", r.URL.Path))
+		return
+	}
+
+	request, err := s.request(r, strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/"))
+	if err != nil {
+		logical.RespondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := s.backend.HandleRequest(r.Context(), request)
+	status, err := logical.RespondErrorCommon(request, response, err)
+	switch {
+	case err != nil:
+		logical.RespondError(w, status, err)
+		return
+	case status != 0:
+		w.WriteHeader(status)
+		return
+	}
+
+	s.respond(w, response)
+}
+
+// request builds the logical request for the path. Reads take their data from the query string and writes from a
+// JSON body. Writes to paths with an existence check are sent as create operations when the target does not exist.
+func (s *Server) request(r *http.Request, path string) (*logical.Request, error) {
+	request := &logical.Request{
+		ID:          fmt.Sprintf("dev-%d", time.Now().UnixNano()),
+		Path:        path,
+		Storage:     s.storage,
+		MountPoint:  s.mount + "/",
+		MountType:   "vault-plugin-tailscale",
+		DisplayName: "dev",
+		Connection:  &logical.Connection{RemoteAddr: remoteAddr(r)},
+		Data:        map[string]interface{}{},
+	}
+
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		request.Operation = logical.ReadOperation
+		if query.Get("list") == "true" {
+			request.Operation = logical.ListOperation
+			query.Del("list")
+		}
+
+		for key := range query {
+			request.Data[key] = query.Get(key)
+		}
+
+		return request, nil
+	case "LIST":
+		request.Operation = logical.ListOperation
+	case http.MethodPost, http.MethodPut:
+		request.Operation = logical.UpdateOperation
+	case http.MethodPatch:
+		request.Operation = logical.PatchOperation
+	case http.MethodDelete:
+		request.Operation = logical.DeleteOperation
+	default:
+		return nil, fmt.Errorf("unsupported method %q", r.Method)
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request.Data); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+
+	if request.Operation != logical.UpdateOperation {
+		return request, nil
+	}
+
+	checkFound, exists, err := s.backend.HandleExistenceCheck(r.Context(), request)
+	switch {
+	case err != nil:
+		return nil, err
+	case checkFound && !exists:
+		request.Operation = logical.CreateOperation
+	}
+
+	return request, nil
+}
+
+// respond writes the response as Vault would, with no content when the response is empty.
+func (s *Server) respond(w http.ResponseWriter, response *logical.Response) {
+	if response == nil || (len(response.Data) == 0 && len(response.Warnings) == 0 && response.Secret == nil) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if raw, ok := response.Data[logical.HTTPRawBody]; ok {
+		if contentType, ok := response.Data[logical.HTTPContentType].(string); ok {
+			w.Header().Set("Content-Type", contentType)
+		}
+
+		status := http.StatusOK
+		if code, ok := response.Data[logical.HTTPStatusCode].(int); ok {
+			status = code
+		}
+
+		w.WriteHeader(status)
+
+		switch body := raw.(type) {
+		case []byte:
+			_, _ = w.Write(body)
+		case string:
+			_, _ = io.WriteString(w, body)
+		}
+
+		return
+	}
+
+	body := map[string]interface{}{
+		"data":     response.Data,
+		"warnings": response.Warnings,
+	}
+
+	if response.Secret != nil {
+		body["lease_duration"] = int(response.Secret.TTL.Seconds())
+		body["renewable"] = response.Secret.Renewable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.logger.Warn("failed to write response", "error", err)
+	}
+}
+
+func (s *Server) periodic(ctx context.Context) {
+	request := &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   s.storage,
+	}
+
+	if _, err := s.backend.HandleRequest(ctx, request); err != nil {
+		s.logger.Warn("failed to run periodic tasks", "error", err)
+	}
+}
+
+func remoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,111 @@
+package dev_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/vault-plugin-tailscale/dev"
+)
+
+func TestServer(t *testing.T) {
+	server, err := dev.New(context.Background(), hclog.NewNullLogger(), "")
+	require.NoError(t, err)
+
+	svr := httptest.NewServer(server)
+	t.Cleanup(svr.Close)
+
+	tt := []struct {
+		Name           string
+		Method         string
+		Path           string
+		Body           interface{}
+		ExpectedStatus int
+		ExpectedData   map[string]interface{}
+	}{
+		{
+			Name:           "It should write a role",
+			Method:         http.MethodPut,
+			Path:           "/v1/tailscale/roles/test",
+			Body:           map[string]interface{}{"tags": []string{"tag:test"}, "ephemeral": true},
+			ExpectedStatus: http.StatusNoContent,
+		},
+		{
+			Name:           "It should read a role",
+			Method:         http.MethodGet,
+			Path:           "/v1/tailscale/roles/test",
+			ExpectedStatus: http.StatusOK,
+			ExpectedData: map[string]interface{}{
+				"tags":      []interface{}{"tag:test"},
+				"ephemeral": true,
+			},
+		},
+		{
+			Name:           "It should return not found for a missing role",
+			Method:         http.MethodGet,
+			Path:           "/v1/tailscale/roles/missing",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "It should delete a role",
+			Method:         http.MethodDelete,
+			Path:           "/v1/tailscale/roles/test",
+			ExpectedStatus: http.StatusNoContent,
+		},
+		{
+			Name:           "It should return not found for an unknown path",
+			Method:         http.MethodGet,
+			Path:           "/v1/tailscale/unknown",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "It should return not found for another mount",
+			Method:         http.MethodGet,
+			Path:           "/v1/secret/roles/test",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "It should reject unsupported methods",
+			Method:         http.MethodOptions,
+			Path:           "/v1/tailscale/roles/test",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tc.Body != nil {
+				require.NoError(t, json.NewEncoder(&body).Encode(tc.Body))
+			}
+
+			request, err := http.NewRequest(tc.Method, svr.URL+tc.Path, &body)
+			require.NoError(t, err)
+
+			response, err := svr.Client().Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			require.EqualValues(t, tc.ExpectedStatus, response.StatusCode)
+			if tc.ExpectedData == nil {
+				return
+			}
+
+			var result struct {
+				Data map[string]interface{} `json:"data"`
+			}
+
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+			for key, value := range tc.ExpectedData {
+				assert.EqualValues(t, value, result.Data[key])
+			}
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/sdk/plugin"
 
 	"github.com/davidsbond/vault-plugin-tailscale/backend"
+	"github.com/davidsbond/vault-plugin-tailscale/dev"
 )
 
 func main() {
@@ -21,13 +25,42 @@ func main() {
 
 func run(logger hclog.Logger) error {
 	meta := &api.PluginAPIClientMeta{}
-	if err := meta.FlagSet().Parse(os.Args[1:]); err != nil {
+
+	var (
+		devMode    bool
+		devAddress string
+		devMount   string
+	)
+
+	flags := meta.FlagSet()
+	flags.BoolVar(&devMode, "dev", false, "")
+	flags.StringVar(&devAddress, "dev-address", dev.DefaultAddress, "")
+	flags.StringVar(&devMount, "dev-mount", dev.DefaultMount, "")
+	if err := flags.Parse(os.Args[1:]); err != nil {
 		return err
 	}
 
+	if devMode {
+		return runDev(logger, devAddress, devMount)
+	}
+
 	return plugin.Serve(&plugin.ServeOpts{
 		TLSProviderFunc:    api.VaultPluginTLSProvider(meta.GetTLSConfig()),
 		BackendFactoryFunc: backend.Create,
 		Logger:             logger,
 	})
 }
+
+// runDev serves the secrets engine against in-memory storage on a local HTTP listener until interrupted, so that it
+// can be used without a Vault server.
+func runDev(logger hclog.Logger, address, mount string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	server, err := dev.New(ctx, logger, mount)
+	if err != nil {
+		return err
+	}
+
+	return server.Run(ctx, address)
+}